@@ -23,14 +23,6 @@ var deployKubernetesCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		sshFile, err := cmd.Flags().GetString("ssh")
-		if err != nil {
-			return err
-		}
-		sshKey, err := os.ReadFile(sshFile)
-		if err != nil {
-			log.Fatal().Err(err).Send()
-		}
 		masterNode, err := cmd.Flags().GetUint32("master-node")
 		if err != nil {
 			return err
@@ -51,6 +43,40 @@ var deployKubernetesCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
+		mastersNumber, err := cmd.Flags().GetInt("masters")
+		if err != nil {
+			return err
+		}
+		if mastersNumber != 1 && mastersNumber != 3 && mastersNumber != 5 {
+			return fmt.Errorf("masters must be 1, 3 or 5, got %d", mastersNumber)
+		}
+		mastersFarms, err := cmd.Flags().GetUintSlice("masters-farms")
+		if err != nil {
+			return err
+		}
+		endpoint, err := cmd.Flags().GetString("endpoint")
+		if err != nil {
+			return err
+		}
+		sshFile, err := cmd.Flags().GetString("ssh")
+		if err != nil {
+			return err
+		}
+		// masters of highly available clusters and clusters with an endpoint run k3s server without ssh
+		withoutSSH := mastersNumber != 1 || endpoint != ""
+		if withoutSSH && sshFile != "" {
+			return fmt.Errorf("ssh is not supported with more than one master or an endpoint")
+		}
+		if !withoutSSH && sshFile == "" {
+			return fmt.Errorf("ssh is required for a cluster with a single master and no endpoint")
+		}
+		var sshKey []byte
+		if sshFile != "" {
+			sshKey, err = os.ReadFile(sshFile)
+			if err != nil {
+				log.Fatal().Err(err).Send()
+			}
+		}
 		ipv4, err := cmd.Flags().GetBool("ipv4")
 		if err != nil {
 			return err
@@ -88,6 +114,30 @@ var deployKubernetesCmd = &cobra.Command{
 			DiskSizeGB: masterDisk,
 		}
 
+		var masters []workloads.K8sNode
+		for i := 1; i < mastersNumber; i++ {
+			var seed []byte
+			if mycelium {
+				seed, err = workloads.RandomMyceliumIPSeed()
+				if err != nil {
+					log.Fatal().Err(err).Send()
+				}
+			}
+			m := workloads.K8sNode{
+				VM: &workloads.VM{
+					Name:           fmt.Sprintf("%smaster%d", name, i),
+					CPU:            masterCPU,
+					MemoryMB:       masterMemory * 1024,
+					PublicIP:       ipv4,
+					PublicIP6:      ipv6,
+					Planetary:      ygg,
+					MyceliumIPSeed: seed,
+				},
+				DiskSizeGB: masterDisk,
+			}
+			masters = append(masters, m)
+		}
+
 		workersNumber, err := cmd.Flags().GetInt("workers-number")
 		if err != nil {
 			return err
@@ -164,16 +214,29 @@ var deployKubernetesCmd = &cobra.Command{
 			log.Fatal().Err(err).Send()
 		}
 
-		if masterNode == 0 {
-
+		if masterNode == 0 || len(masters) != 0 {
 			filter, disks, rootfss := filters.BuildK8sNodeFilter(
 				master,
 				masterFarm,
 			)
-			nodes, err := deployer.FilterNodes(
+			count := mastersNumber
+			if masterNode != 0 {
+				filter.Excluded = []uint64{uint64(masterNode)}
+				count--
+			}
+			// masters are spread across the given farms, each on a different farm if there are enough of them
+			if len(mastersFarms) != 0 {
+				filter.FarmIDs = nil
+				for _, farm := range mastersFarms {
+					filter.FarmIDs = append(filter.FarmIDs, uint64(farm))
+				}
+			}
+			nodes, err := deployer.FilterDistinctNodes(
 				cmd.Context(),
 				t,
 				filter,
+				count,
+				len(mastersFarms) >= mastersNumber,
 				disks,
 				nil,
 				rootfss,
@@ -182,7 +245,13 @@ var deployKubernetesCmd = &cobra.Command{
 				log.Fatal().Err(err).Send()
 			}
 
-			masterNode = uint32(nodes[0].NodeID)
+			if masterNode == 0 {
+				masterNode = uint32(nodes[0].NodeID)
+				nodes = nodes[1:]
+			}
+			for i := range masters {
+				masters[i].NodeID = uint32(nodes[i].NodeID)
+			}
 		}
 		master.NodeID = masterNode
 		if len(workersNodes) < workersNumber {
@@ -209,7 +278,7 @@ var deployKubernetesCmd = &cobra.Command{
 		for i := range workers {
 			workers[i].NodeID = uint32(workersNodes[i])
 		}
-		cluster, err := command.DeployKubernetesCluster(cmd.Context(), t, master, workers, string(sshKey), workloads.K8sFlist)
+		cluster, err := command.DeployKubernetesCluster(cmd.Context(), t, master, masters, workers, string(sshKey), endpoint, workloads.K8sFlist)
 		if err != nil {
 			log.Fatal().Err(err).Send()
 		}
@@ -228,6 +297,22 @@ var deployKubernetesCmd = &cobra.Command{
 			log.Info().Msgf("master mycelium ip: %s", cluster.Master.MyceliumIP)
 		}
 
+		for _, m := range cluster.Masters {
+			log.Info().Msgf("%s wireguard ip: %s", m.Name, m.IP)
+			if ipv4 {
+				log.Info().Msgf("%s ipv4: %s", m.Name, m.ComputedIP)
+			}
+			if ipv6 {
+				log.Info().Msgf("%s ipv6: %s", m.Name, m.ComputedIP6)
+			}
+			if ygg {
+				log.Info().Msgf("%s planetary ip: %s", m.Name, m.PlanetaryIP)
+			}
+			if mycelium {
+				log.Info().Msgf("%s mycelium ip: %s", m.Name, m.MyceliumIP)
+			}
+		}
+
 		for _, worker := range cluster.Workers {
 			log.Info().Msgf("%s wireguard ip: %s", worker.Name, worker.IP)
 		}
@@ -263,17 +348,17 @@ func init() {
 	if err != nil {
 		log.Fatal().Err(err).Send()
 	}
-	deployKubernetesCmd.Flags().String("ssh", "", "path to public ssh key")
-	err = deployKubernetesCmd.MarkFlagRequired("ssh")
-	if err != nil {
-		log.Fatal().Err(err).Send()
-	}
+	deployKubernetesCmd.Flags().String("ssh", "", "path to public ssh key, required for a single master cluster without an endpoint")
 	deployKubernetesCmd.Flags().Uint8("master-cpu", 1, "master number of cpu units")
 	deployKubernetesCmd.Flags().Uint64("master-memory", 1, "master memory size in gb")
 	deployKubernetesCmd.Flags().Uint64("master-disk", 2, "master disk size in gb")
 	deployKubernetesCmd.Flags().Uint32("master-node", 0, "node id master should be deployed on")
 	deployKubernetesCmd.Flags().Uint64("master-farm", 1, "farm id master should be deployed on")
 	deployKubernetesCmd.MarkFlagsMutuallyExclusive("master-node", "master-farm")
+	deployKubernetesCmd.Flags().Int("masters", 1, "number of masters, 3 or 5 masters make a highly available cluster")
+	deployKubernetesCmd.Flags().UintSlice("masters-farms", []uint{}, "farm ids the masters should be spread across")
+	deployKubernetesCmd.MarkFlagsMutuallyExclusive("masters-farms", "master-farm")
+	deployKubernetesCmd.Flags().String("endpoint", "", "shared address of the masters workers register through, e.g. a gateway domain or a floating public ip")
 
 	deployKubernetesCmd.Flags().Int("workers-number", 0, "number of workers")
 	deployKubernetesCmd.Flags().Uint8("workers-cpu", 1, "workers number of cpu units")
@@ -2,10 +2,12 @@
 package cmd
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"os"
 	"slices"
+	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
@@ -18,6 +20,7 @@ import (
 	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/subi"
 	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
 	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/zos"
+	"gopkg.in/yaml.v3"
 )
 
 var (
@@ -53,7 +56,19 @@ var deployVMCmd = &cobra.Command{
 		if err != nil {
 			log.Fatal().Err(err).Send()
 		}
-		env["SSH_KEY"] = string(sshKey)
+		provisionFile, err := cmd.Flags().GetString("provision")
+		if err != nil {
+			return err
+		}
+		var provisioning *workloads.Provisioning
+		if provisionFile != "" {
+			provisioning, err = readProvisioning(provisionFile, string(sshKey))
+			if err != nil {
+				log.Fatal().Err(err).Send()
+			}
+		} else {
+			env["SSH_KEY"] = string(sshKey)
+		}
 		node, err := cmd.Flags().GetUint32("node")
 		if err != nil {
 			return err
@@ -146,6 +161,7 @@ var deployVMCmd = &cobra.Command{
 			vm := workloads.VMLight{
 				Name:           name,
 				EnvVars:        env,
+				Provisioning:   provisioning,
 				CPU:            cpu,
 				MemoryMB:       memory * 1024,
 				GPUs:           convertGPUsToZosGPUs(gpus),
@@ -167,6 +183,7 @@ var deployVMCmd = &cobra.Command{
 		vm := workloads.VM{
 			Name:           name,
 			EnvVars:        env,
+			Provisioning:   provisioning,
 			CPU:            cpu,
 			MemoryMB:       memory * 1024,
 			GPUs:           convertGPUsToZosGPUs(gpus),
@@ -223,6 +240,30 @@ func init() {
 	deployVMCmd.Flags().Bool("ygg", false, "assign yggdrasil ip for vm")
 	deployVMCmd.Flags().Bool("mycelium", true, "assign mycelium ip for vm")
 	deployVMCmd.Flags().StringToStringP("env", "e", make(map[string]string), "environment variables for the vm")
+	deployVMCmd.Flags().String("provision", "", "path to a yaml file with extra ssh keys authorized for root on the vm")
+}
+
+// readProvisioning reads a provisioning spec file and authorizes the given ssh key for root
+func readProvisioning(path, sshKey string) (*workloads.Provisioning, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read provisioning file %s", path)
+	}
+
+	// unknown fields are rejected since zos only delivers root ssh keys
+	var provisioning workloads.Provisioning
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&provisioning); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse provisioning file %s", path)
+	}
+
+	provisioning.SSHKeys = append(provisioning.SSHKeys, strings.TrimSpace(sshKey))
+	if err := provisioning.Validate(); err != nil {
+		return nil, errors.Wrapf(err, "invalid provisioning file %s", path)
+	}
+
+	return &provisioning, nil
 }
 
 func executeVM(
@@ -105,10 +105,15 @@ func DeployVMLight(ctx context.Context, t deployer.TFPluginClient, vm workloads.
 }
 
 // DeployKubernetesCluster deploys a kubernetes cluster
-func DeployKubernetesCluster(ctx context.Context, t deployer.TFPluginClient, master workloads.K8sNode, workers []workloads.K8sNode, sshKey, k8sFlist string) (workloads.K8sCluster, error) {
+func DeployKubernetesCluster(ctx context.Context, t deployer.TFPluginClient, master workloads.K8sNode, masters, workers []workloads.K8sNode, sshKey, endpoint, k8sFlist string) (workloads.K8sCluster, error) {
 	networkName := fmt.Sprintf("%snetwork", master.Name)
 	projectName := fmt.Sprintf("kubernetes/%s", master.Name)
 	networkNodes := []uint32{master.NodeID}
+	for _, m := range masters {
+		if !slices.Contains(networkNodes, m.NodeID) {
+			networkNodes = append(networkNodes, m.NodeID)
+		}
+	}
 	for _, worker := range workers {
 		if !slices.Contains(networkNodes, worker.NodeID) {
 			networkNodes = append(networkNodes, worker.NodeID)
@@ -121,12 +126,16 @@ func DeployKubernetesCluster(ctx context.Context, t deployer.TFPluginClient, mas
 	}
 
 	master.NetworkName = networkName
+	for i := range masters {
+		masters[i].NetworkName = networkName
+	}
 	for i := range workers {
 		workers[i].NetworkName = networkName
 	}
 
 	cluster := workloads.K8sCluster{
 		Master:  &master,
+		Masters: masters,
 		Workers: workers,
 		// TODO: should be randomized
 		Token:        "securetoken",
@@ -134,6 +143,7 @@ func DeployKubernetesCluster(ctx context.Context, t deployer.TFPluginClient, mas
 		SSHKey:       sshKey,
 		Flist:        k8sFlist,
 		NetworkName:  networkName,
+		Endpoint:     endpoint,
 	}
 	log.Info().Msg("deploying network")
 	err = t.NetworkDeployer.Deploy(ctx, &network)
@@ -151,13 +161,9 @@ func DeployKubernetesCluster(ctx context.Context, t deployer.TFPluginClient, mas
 		}
 		return workloads.K8sCluster{}, errors.Wrap(err, "failed to deploy kubernetes cluster")
 	}
-	nodeIDs := []uint32{master.NodeID}
-	for _, worker := range workers {
-		nodeIDs = append(nodeIDs, worker.NodeID)
-	}
 	return t.State.LoadK8sFromGrid(
 		ctx,
-		nodeIDs,
+		networkNodes,
 		master.Name,
 	)
 }
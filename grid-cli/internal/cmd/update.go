@@ -58,9 +58,11 @@ func AddWorkersKubernetesCluster(ctx context.Context, t deployer.TFPluginClient,
 }
 
 func DeleteWorkerKubernetesCluster(ctx context.Context, t deployer.TFPluginClient, cluster workloads.K8sCluster) error {
-	usedNodes := []uint32{cluster.Master.NodeID}
-	for _, worker := range cluster.Workers {
-		usedNodes = append(usedNodes, worker.NodeID)
+	var usedNodes []uint32
+	for _, node := range append(cluster.MasterNodes(), cluster.Workers...) {
+		if !slices.Contains(usedNodes, node.NodeID) {
+			usedNodes = append(usedNodes, node.NodeID)
+		}
 	}
 
 	log.Info().Msg("updating network")
@@ -3,6 +3,7 @@ package calculator
 import (
 	"math"
 
+	"github.com/pkg/errors"
 	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
 	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/subi"
 )
@@ -11,23 +12,33 @@ const defaultPricingPolicyID = uint32(1)
 
 // Calculator struct for calculating the cost of resources
 type Calculator struct {
-	substrateConn subi.SubstrateExt
-	identity      substrate.Identity
+	source   PricingSource
+	identity substrate.Identity
 }
 
-// NewCalculator creates a new Calculator
+// NewCalculator creates a new Calculator reading prices from tfchain
 func NewCalculator(substrateConn subi.SubstrateExt, identity substrate.Identity) Calculator {
-	return Calculator{substrateConn: substrateConn, identity: identity}
+	return NewCalculatorFromSource(NewLiveSource(substrateConn), identity)
+}
+
+// NewCalculatorFromSource creates a new Calculator reading prices from the given source
+func NewCalculatorFromSource(source PricingSource, identity substrate.Identity) Calculator {
+	return Calculator{source: source, identity: identity}
+}
+
+// Source returns the pricing source of the calculator
+func (c *Calculator) Source() PricingSource {
+	return c.source
 }
 
 // CalculateCost calculates the cost in $ per month of the given resources without a discount
 func (c *Calculator) CalculateCost(cru, mru, hru, sru int64, publicIP, certified bool) (float64, error) {
-	tftPrice, err := c.substrateConn.GetTFTPrice()
+	tftPrice, err := c.source.GetTFTPrice()
 	if err != nil {
 		return 0, err
 	}
 
-	pricingPolicy, err := c.substrateConn.GetPricingPolicy(defaultPricingPolicyID)
+	pricingPolicy, err := c.source.GetPricingPolicy(defaultPricingPolicyID)
 	if err != nil {
 		return 0, err
 	}
@@ -51,12 +62,12 @@ func (c *Calculator) CalculateCost(cru, mru, hru, sru int64, publicIP, certified
 
 // CalculateDiscount calculates the discount of a given cost
 func (c *Calculator) CalculateDiscount(cost float64) (dedicatedPrice, sharedPrice float64, err error) {
-	tftPrice, err := c.substrateConn.GetTFTPrice()
+	tftPrice, err := c.source.GetTFTPrice()
 	if err != nil {
 		return
 	}
 
-	pricingPolicy, err := c.substrateConn.GetPricingPolicy(defaultPricingPolicyID)
+	pricingPolicy, err := c.source.GetPricingPolicy(defaultPricingPolicyID)
 	if err != nil {
 		return
 	}
@@ -69,49 +80,24 @@ func (c *Calculator) CalculateDiscount(cost float64) (dedicatedPrice, sharedPric
 	dedicatedPrice = cost - cost*(discount/100)
 
 	// discount for Twin Balance in TFT
-	accountBalance, err := c.substrateConn.GetBalance(c.identity)
+	accountBalance, err := c.source.GetBalance(c.identity)
 	if err != nil {
 		return
 	}
 	balance := float64(tftPrice) / 1000 * float64(accountBalance.Free.Int64()) * 10000000
 
-	discountPackages := map[string]map[string]float64{
-		"none": {
-			"duration": 0,
-			"discount": 0,
-		},
-		"default": {
-			"duration": 1.5,
-			"discount": 20,
-		},
-		"bronze": {
-			"duration": 3,
-			"discount": 30,
-		},
-		"silver": {
-			"duration": 6,
-			"discount": 40,
-		},
-		"gold": {
-			"duration": 18,
-			"discount": 60,
-		},
+	packages, err := c.source.GetDiscountPackages()
+	if err != nil {
+		err = errors.Wrap(err, "could not get discount packages")
+		return
 	}
 
 	// check which package will be used according to the balance
-	dedicatedPackage := "none"
-	sharedPackage := "none"
-	for pkg := range discountPackages {
-		if balance > dedicatedPrice*discountPackages[pkg]["duration"] {
-			dedicatedPackage = pkg
-		}
-		if balance > sharedPrice*discountPackages[pkg]["duration"] {
-			sharedPackage = pkg
-		}
-	}
+	dedicatedPackage := packages.best(balance, dedicatedPrice)
+	sharedPackage := packages.best(balance, sharedPrice)
 
-	dedicatedPrice = (dedicatedPrice - dedicatedPrice*(discountPackages[dedicatedPackage]["discount"]/100)) / 1e7
-	sharedPrice = (sharedPrice - sharedPrice*(discountPackages[sharedPackage]["discount"]/100)) / 1e7
+	dedicatedPrice = (dedicatedPrice - dedicatedPrice*(dedicatedPackage.Discount/100)) / 1e7
+	sharedPrice = (sharedPrice - sharedPrice*(sharedPackage.Discount/100)) / 1e7
 
 	return
 }
@@ -91,3 +91,43 @@ func TestSubstrateErrors(t *testing.T) {
 		assert.Error(t, err)
 	})
 }
+
+func TestUnitPrices(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	sub := mocks.NewMockSubstrateExt(ctrl)
+	identity, err := substrate.NewIdentityFromSr25519Phrase("//Alice")
+	assert.NoError(t, err)
+
+	calculator := NewCalculator(sub, identity)
+
+	sub.EXPECT().GetTFTPrice().Return(types.U32(10), nil).AnyTimes()
+	sub.EXPECT().GetPricingPolicy(uint32(2)).Return(substrate.PricingPolicy{
+		ID:                     2,
+		CU:                     substrate.Policy{Value: 100},
+		SU:                     substrate.Policy{Value: 50},
+		IPU:                    substrate.Policy{Value: 10},
+		UniqueName:             substrate.Policy{Value: 20},
+		DedicatedNodesDiscount: 50,
+	}, nil).AnyTimes()
+
+	prices, err := calculator.UnitPrices(2, false)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(2), prices.PolicyID)
+	assert.InDelta(t, 7.305, prices.CU, 1e-9)
+	assert.InDelta(t, 3.6525, prices.SU, 1e-9)
+	assert.InDelta(t, 0.7305, prices.IPv4, 1e-9)
+	assert.InDelta(t, 1.461, prices.UniqueName, 1e-9)
+	assert.Equal(t, 50.0, prices.DedicatedDiscount)
+	// a fee of 1 USD with a tft price of 10 mUSD
+	assert.InDelta(t, 0.1, prices.Fee(1000), 1e-9)
+
+	certified, err := calculator.UnitPrices(2, true)
+	assert.NoError(t, err)
+	assert.InDelta(t, 9.13125, certified.CU, 1e-9)
+
+	assert.Equal(t, 1.0, ComputeUnits(2, 4))
+	assert.Equal(t, 0.5, ComputeUnits(1, 1))
+	assert.Equal(t, 1.5, StorageUnits(600, 200))
+}
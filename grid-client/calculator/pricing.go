@@ -0,0 +1,83 @@
+package calculator
+
+import (
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// HoursPerMonth is the average number of hours in a month
+const HoursPerMonth = 24 * 365.25 / 12
+
+// UnitPrices are the monthly prices of the units of a pricing policy
+type UnitPrices struct {
+	PolicyID uint32 `json:"policy_id"`
+	// CU is the price of a compute unit
+	CU float64 `json:"cu"`
+	// SU is the price of a storage unit
+	SU float64 `json:"su"`
+	// IPv4 is the price of a public ipv4
+	IPv4 float64 `json:"ipv4"`
+	// UniqueName is the price of a name contract
+	UniqueName float64 `json:"unique_name"`
+	// DedicatedDiscount is the discount percentage of dedicated nodes
+	DedicatedDiscount float64 `json:"dedicated_discount"`
+	// TFTPrice is the tft price in mUSD the prices are converted with
+	TFTPrice float64 `json:"tft_price"`
+}
+
+// Fee converts a fee in mUSD to the same unit as the unit prices using their tft price
+func (p UnitPrices) Fee(mUSD uint64) float64 {
+	return float64(mUSD) / 1000 / p.TFTPrice
+}
+
+// UnitPrices returns the monthly unit prices of a pricing policy in the same unit as CalculateCost
+// over an average month, prices of certified nodes are 25% higher
+func (c *Calculator) UnitPrices(policyID uint32, certified bool) (UnitPrices, error) {
+	tftPrice, err := c.source.GetTFTPrice()
+	if err != nil {
+		return UnitPrices{}, errors.Wrap(err, "could not get tft price")
+	}
+
+	if tftPrice == 0 {
+		return UnitPrices{}, errors.New("tft price is zero")
+	}
+
+	pricingPolicy, err := c.source.GetPricingPolicy(policyID)
+	if err != nil {
+		return UnitPrices{}, errors.Wrapf(err, "could not get pricing policy %d", policyID)
+	}
+
+	certifiedFactor := 1.0
+	if certified {
+		certifiedFactor = 1.25
+	}
+
+	monthly := func(valuePerHour uint64) float64 {
+		return float64(valuePerHour) * certifiedFactor * HoursPerMonth / float64(tftPrice) / 1000
+	}
+
+	return UnitPrices{
+		PolicyID:          policyID,
+		CU:                monthly(uint64(pricingPolicy.CU.Value)),
+		SU:                monthly(uint64(pricingPolicy.SU.Value)),
+		IPv4:              monthly(uint64(pricingPolicy.IPU.Value)),
+		UniqueName:        monthly(uint64(pricingPolicy.UniqueName.Value)),
+		DedicatedDiscount: float64(pricingPolicy.DedicatedNodesDiscount),
+		TFTPrice:          float64(tftPrice),
+	}, nil
+}
+
+// ComputeUnits returns the compute units of cores and memory in GB
+func ComputeUnits(cru, mruGB float64) float64 {
+	cu1 := math.Max(mruGB/4, cru/2)
+	cu2 := math.Max(mruGB/8, cru)
+	cu3 := math.Max(mruGB/2, cru/4)
+
+	return math.Min(cu1, math.Min(cu2, cu3))
+}
+
+// StorageUnits returns the storage units of hdd and ssd storage in GB
+func StorageUnits(hruGB, sruGB float64) float64 {
+	return hruGB/1200 + sruGB/200
+}
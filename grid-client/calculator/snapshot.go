@@ -0,0 +1,149 @@
+package calculator
+
+import (
+	"encoding/json"
+	"math/big"
+	"os"
+
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/pkg/errors"
+	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
+)
+
+// PolicySnapshot is the snapshot of a pricing policy, values are in unit-USD per hour
+type PolicySnapshot struct {
+	Name                   string `json:"name"`
+	CU                     uint32 `json:"cu"`
+	SU                     uint32 `json:"su"`
+	NU                     uint32 `json:"nu"`
+	IPU                    uint32 `json:"ipu"`
+	UniqueName             uint32 `json:"unique_name"`
+	DomainName             uint32 `json:"domain_name"`
+	DedicatedNodesDiscount uint8  `json:"dedicated_nodes_discount"`
+}
+
+// Snapshot is a pricing source frozen in time, it can be saved to and loaded from a file
+// to calculate costs offline or with a different TFT price
+type Snapshot struct {
+	// TFTPrice in mUSD
+	TFTPrice uint32 `json:"tft_price"`
+	// PricingPolicies by policy ID
+	PricingPolicies  map[uint32]PolicySnapshot `json:"pricing_policies"`
+	DiscountPackages DiscountPackages          `json:"discount_packages"`
+	// Balance is the free balance used for all identities
+	Balance uint64 `json:"balance"`
+}
+
+// ExportSnapshot exports a snapshot of the given pricing policies and the balance of identity from a source
+func ExportSnapshot(source PricingSource, identity substrate.Identity, policyIDs ...uint32) (Snapshot, error) {
+	tftPrice, err := source.GetTFTPrice()
+	if err != nil {
+		return Snapshot{}, errors.Wrap(err, "could not get tft price")
+	}
+
+	packages, err := source.GetDiscountPackages()
+	if err != nil {
+		return Snapshot{}, errors.Wrap(err, "could not get discount packages")
+	}
+
+	snapshot := Snapshot{
+		TFTPrice:         uint32(tftPrice),
+		PricingPolicies:  make(map[uint32]PolicySnapshot),
+		DiscountPackages: packages,
+	}
+
+	if len(policyIDs) == 0 {
+		policyIDs = []uint32{defaultPricingPolicyID}
+	}
+
+	for _, policyID := range policyIDs {
+		policy, err := source.GetPricingPolicy(policyID)
+		if err != nil {
+			return Snapshot{}, errors.Wrapf(err, "could not get pricing policy %d", policyID)
+		}
+
+		snapshot.PricingPolicies[policyID] = PolicySnapshot{
+			Name:                   policy.Name,
+			CU:                     uint32(policy.CU.Value),
+			SU:                     uint32(policy.SU.Value),
+			NU:                     uint32(policy.NU.Value),
+			IPU:                    uint32(policy.IPU.Value),
+			UniqueName:             uint32(policy.UniqueName.Value),
+			DomainName:             uint32(policy.DomainName.Value),
+			DedicatedNodesDiscount: uint8(policy.DedicatedNodesDiscount),
+		}
+	}
+
+	if identity != nil {
+		balance, err := source.GetBalance(identity)
+		if err != nil {
+			return Snapshot{}, errors.Wrap(err, "could not get balance")
+		}
+		snapshot.Balance = balance.Free.Uint64()
+	}
+
+	return snapshot, nil
+}
+
+// LoadSnapshot loads a snapshot from a json file
+func LoadSnapshot(path string) (Snapshot, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return Snapshot{}, errors.Wrapf(err, "could not read snapshot file %s", path)
+	}
+
+	var snapshot Snapshot
+	if err := json.Unmarshal(content, &snapshot); err != nil {
+		return Snapshot{}, errors.Wrapf(err, "could not parse snapshot file %s", path)
+	}
+
+	return snapshot, nil
+}
+
+// Save saves the snapshot to a json file
+func (s Snapshot) Save(path string) error {
+	content, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "could not encode snapshot")
+	}
+
+	return errors.Wrapf(os.WriteFile(path, content, 0o644), "could not write snapshot file %s", path)
+}
+
+// GetTFTPrice returns the snapshot TFT price in mUSD
+func (s Snapshot) GetTFTPrice() (types.U32, error) {
+	return types.U32(s.TFTPrice), nil
+}
+
+// GetPricingPolicy returns a pricing policy of the snapshot
+func (s Snapshot) GetPricingPolicy(policyID uint32) (substrate.PricingPolicy, error) {
+	policy, ok := s.PricingPolicies[policyID]
+	if !ok {
+		return substrate.PricingPolicy{}, errors.Errorf("pricing policy %d is not in the snapshot", policyID)
+	}
+
+	return substrate.PricingPolicy{
+		ID:                     types.U32(policyID),
+		Name:                   policy.Name,
+		CU:                     substrate.Policy{Value: types.U32(policy.CU)},
+		SU:                     substrate.Policy{Value: types.U32(policy.SU)},
+		NU:                     substrate.Policy{Value: types.U32(policy.NU)},
+		IPU:                    substrate.Policy{Value: types.U32(policy.IPU)},
+		UniqueName:             substrate.Policy{Value: types.U32(policy.UniqueName)},
+		DomainName:             substrate.Policy{Value: types.U32(policy.DomainName)},
+		DedicatedNodesDiscount: types.U8(policy.DedicatedNodesDiscount),
+	}, nil
+}
+
+// GetBalance returns the snapshot balance regardless of the identity
+func (s Snapshot) GetBalance(substrate.Identity) (substrate.Balance, error) {
+	return substrate.Balance{Free: types.NewU128(*new(big.Int).SetUint64(s.Balance))}, nil
+}
+
+// GetDiscountPackages returns the snapshot discount packages or the default ones if not set
+func (s Snapshot) GetDiscountPackages() (DiscountPackages, error) {
+	if len(s.DiscountPackages) == 0 {
+		return DefaultDiscountPackages, nil
+	}
+	return s.DiscountPackages, nil
+}
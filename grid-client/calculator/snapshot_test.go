@@ -0,0 +1,100 @@
+package calculator
+
+import (
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/mocks"
+)
+
+func TestSnapshot(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	sub := mocks.NewMockSubstrateExt(ctrl)
+	identity, err := substrate.NewIdentityFromSr25519Phrase("//Alice")
+	require.NoError(t, err)
+
+	sub.EXPECT().GetTFTPrice().Return(types.U32(20), nil).AnyTimes()
+	sub.EXPECT().GetPricingPolicy(uint32(1)).Return(substrate.PricingPolicy{
+		ID:                     1,
+		Name:                   "default",
+		CU:                     substrate.Policy{Value: 10},
+		SU:                     substrate.Policy{Value: 5},
+		IPU:                    substrate.Policy{Value: 2},
+		UniqueName:             substrate.Policy{Value: 1},
+		DedicatedNodesDiscount: 50,
+	}, nil).AnyTimes()
+	sub.EXPECT().GetBalance(identity).Return(substrate.Balance{
+		Free: types.NewU128(*big.NewInt(50000000)),
+	}, nil).AnyTimes()
+
+	live := NewCalculator(sub, identity)
+
+	snapshot, err := ExportSnapshot(live.Source(), identity)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(20), snapshot.TFTPrice)
+	assert.Equal(t, uint64(50000000), snapshot.Balance)
+	assert.Equal(t, DefaultDiscountPackages, snapshot.DiscountPackages)
+
+	path := filepath.Join(t.TempDir(), "pricing.json")
+	require.NoError(t, snapshot.Save(path))
+
+	loaded, err := LoadSnapshot(path)
+	require.NoError(t, err)
+	assert.Equal(t, snapshot, loaded)
+
+	offline := NewCalculatorFromSource(loaded, nil)
+
+	t.Run("same costs as live", func(t *testing.T) {
+		liveCost, err := live.CalculateCost(8, 32, 0, 50, true, true)
+		require.NoError(t, err)
+		offlineCost, err := offline.CalculateCost(8, 32, 0, 50, true, true)
+		require.NoError(t, err)
+		assert.Equal(t, liveCost, offlineCost)
+
+		liveDedicated, liveShared, err := live.CalculateDiscount(liveCost)
+		require.NoError(t, err)
+		offlineDedicated, offlineShared, err := offline.CalculateDiscount(offlineCost)
+		require.NoError(t, err)
+		assert.Equal(t, liveDedicated, offlineDedicated)
+		assert.Equal(t, liveShared, offlineShared)
+
+		livePrices, err := live.UnitPrices(1, false)
+		require.NoError(t, err)
+		offlinePrices, err := offline.UnitPrices(1, false)
+		require.NoError(t, err)
+		assert.Equal(t, livePrices, offlinePrices)
+	})
+
+	t.Run("what if tft price doubles", func(t *testing.T) {
+		cost, err := offline.CalculateCost(8, 32, 0, 50, true, true)
+		require.NoError(t, err)
+
+		whatIf := loaded
+		whatIf.TFTPrice *= 2
+		whatIfCalculator := NewCalculatorFromSource(whatIf, nil)
+
+		whatIfCost, err := whatIfCalculator.CalculateCost(8, 32, 0, 50, true, true)
+		require.NoError(t, err)
+		assert.InDelta(t, cost/2, whatIfCost, 1e-9)
+	})
+
+	t.Run("missing policy", func(t *testing.T) {
+		_, err := offline.UnitPrices(2, false)
+		assert.Error(t, err)
+	})
+}
+
+func TestDiscountPackages(t *testing.T) {
+	assert.Equal(t, DiscountPackage{}, DefaultDiscountPackages.best(0, 10))
+	assert.Equal(t, DefaultDiscountPackages["default"], DefaultDiscountPackages.best(20, 10))
+	assert.Equal(t, DefaultDiscountPackages["silver"], DefaultDiscountPackages.best(100, 10))
+	assert.Equal(t, DefaultDiscountPackages["gold"], DefaultDiscountPackages.best(1000, 10))
+}
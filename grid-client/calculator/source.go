@@ -0,0 +1,86 @@
+package calculator
+
+import (
+	"sort"
+
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/subi"
+)
+
+// PricingSource provides the data costs are calculated from
+type PricingSource interface {
+	GetTFTPrice() (types.U32, error)
+	GetPricingPolicy(policyID uint32) (substrate.PricingPolicy, error)
+	GetBalance(identity substrate.Identity) (substrate.Balance, error)
+	GetDiscountPackages() (DiscountPackages, error)
+}
+
+// DiscountPackage is a discount applied when the twin balance covers the cost for a duration
+type DiscountPackage struct {
+	// Duration in months the balance should cover
+	Duration float64 `json:"duration"`
+	// Discount percentage
+	Discount float64 `json:"discount"`
+}
+
+// DiscountPackages are the discount packages by name
+type DiscountPackages map[string]DiscountPackage
+
+// DefaultDiscountPackages are the discount packages of tfchain
+var DefaultDiscountPackages = DiscountPackages{
+	"none":    {Duration: 0, Discount: 0},
+	"default": {Duration: 1.5, Discount: 20},
+	"bronze":  {Duration: 3, Discount: 30},
+	"silver":  {Duration: 6, Discount: 40},
+	"gold":    {Duration: 18, Discount: 60},
+}
+
+// best returns the package with the highest discount the balance covers for the given cost
+func (d DiscountPackages) best(balance, cost float64) DiscountPackage {
+	names := make([]string, 0, len(d))
+	for name := range d {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var best DiscountPackage
+	for _, name := range names {
+		pkg := d[name]
+		if balance > cost*pkg.Duration && pkg.Discount > best.Discount {
+			best = pkg
+		}
+	}
+
+	return best
+}
+
+// LiveSource reads pricing data from tfchain
+type LiveSource struct {
+	substrateConn subi.SubstrateExt
+}
+
+// NewLiveSource creates a new pricing source reading from tfchain
+func NewLiveSource(substrateConn subi.SubstrateExt) LiveSource {
+	return LiveSource{substrateConn: substrateConn}
+}
+
+// GetTFTPrice returns the current TFT price in mUSD
+func (s LiveSource) GetTFTPrice() (types.U32, error) {
+	return s.substrateConn.GetTFTPrice()
+}
+
+// GetPricingPolicy returns a pricing policy from tfchain
+func (s LiveSource) GetPricingPolicy(policyID uint32) (substrate.PricingPolicy, error) {
+	return s.substrateConn.GetPricingPolicy(policyID)
+}
+
+// GetBalance returns the balance of the identity from tfchain
+func (s LiveSource) GetBalance(identity substrate.Identity) (substrate.Balance, error) {
+	return s.substrateConn.GetBalance(identity)
+}
+
+// GetDiscountPackages returns the default discount packages, they are not stored on tfchain
+func (s LiveSource) GetDiscountPackages() (DiscountPackages, error) {
+	return DefaultDiscountPackages, nil
+}
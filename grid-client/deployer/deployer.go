@@ -4,6 +4,7 @@ package deployer
 import (
 	"context"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"strings"
 	"sync"
@@ -50,6 +51,8 @@ type Deployer struct {
 	ncPool          client.NodeClientGetter
 	revertOnFailure bool
 	substrateConn   subi.SubstrateExt
+	observers       *observers
+	reservations    *ReservationLedger
 }
 
 // NewDeployer returns a new deployer
@@ -64,6 +67,8 @@ func NewDeployer(
 		tfPluginClient.NcPool,
 		revertOnFailure,
 		tfPluginClient.SubstrateConn,
+		tfPluginClient.observers,
+		tfPluginClient.Reservations,
 	}
 }
 
@@ -91,6 +96,7 @@ func (d *Deployer) Deploy(ctx context.Context,
 			return currentDeployments, errors.Wrapf(err, "failed to fetch deployment objects to revert deployments: %s; try again", oldErr)
 		}
 
+		d.observers.emit(Event{Type: EventRevertStarted, Message: err.Error()})
 		currentDls, rerr := d.deploy(ctx, currentDeployments, oldDeployments, newDeploymentSolutionProvider, false)
 		if rerr != nil {
 			return currentDls, errors.Wrapf(err, "failed to revert deployments: %s; try again", rerr)
@@ -119,6 +125,7 @@ func (d *Deployer) deploy(
 			if err != nil && !strings.Contains(err.Error(), "ContractNotExists") {
 				return currentDeployments, errors.Wrap(err, "failed to delete deployment")
 			}
+			d.observers.emit(Event{Type: EventContractCanceled, NodeID: node, ContractID: contractID})
 			delete(currentDeployments, node)
 		}
 	}
@@ -154,11 +161,19 @@ func (d *Deployer) deploy(
 			}
 			log.Debug().Uint32("Number of public ips", publicIPCount)
 
+			reservation, err := deploymentReservation(dl)
+			if err != nil {
+				return currentDeployments, err
+			}
+			release := d.reservations.Reserve(node, reservation)
+			defer release()
+
 			contractID, err := d.substrateConn.CreateNodeContract(d.identity, node, dl.Metadata, hashHex, publicIPCount, newDeploymentSolutionProvider[node])
 			log.Debug().Uint64("CreateNodeContract returned id", contractID)
 			if err != nil {
 				return currentDeployments, errors.Wrapf(err, "failed to create contract on node %d", node)
 			}
+			d.observers.emit(Event{Type: EventContractCreated, NodeID: node, ContractID: contractID})
 
 			dl.ContractID = contractID
 			err = client.DeploymentDeploy(ctx, dl)
@@ -167,15 +182,17 @@ func (d *Deployer) deploy(
 				if rerr != nil {
 					return currentDeployments, errors.Wrapf(err, "error cancelling contract: %s; you must cancel it manually (id: %d)", rerr, contractID)
 				}
+				d.observers.emit(Event{Type: EventContractCanceled, NodeID: node, ContractID: contractID, Message: err.Error()})
 				return currentDeployments, errors.Wrapf(err, "error sending deployment to node %d", node)
 
 			}
+			d.observers.emit(Event{Type: EventDeploymentSent, NodeID: node, ContractID: contractID})
 			currentDeployments[node] = dl.ContractID
 			newWorkloadVersions := make(map[string]uint32)
 			for _, w := range dl.Workloads {
 				newWorkloadVersions[w.Name] = 0
 			}
-			err = d.Wait(ctx, client, dl.ContractID, newWorkloadVersions)
+			err = d.wait(ctx, node, client, dl.ContractID, newWorkloadVersions)
 			if err != nil {
 				return currentDeployments, errors.Wrap(err, "error waiting deployment")
 			}
@@ -240,15 +257,18 @@ func (d *Deployer) deploy(
 			if err != nil {
 				return currentDeployments, errors.Wrap(err, "failed to update deployment")
 			}
+			d.observers.emit(Event{Type: EventContractUpdated, NodeID: node, ContractID: contractID})
+
 			dl.ContractID = contractID
 			err = client.DeploymentUpdate(ctx, dl)
 			if err != nil {
 				// cancel previous contract
 				return currentDeployments, errors.Wrapf(err, "failed to send deployment update request to node %d", node)
 			}
+			d.observers.emit(Event{Type: EventDeploymentSent, NodeID: node, ContractID: contractID})
 			currentDeployments[node] = dl.ContractID
 
-			err = d.Wait(ctx, client, dl.ContractID, newWorkloadsVersions)
+			err = d.wait(ctx, node, client, dl.ContractID, newWorkloadsVersions)
 			if err != nil {
 				return currentDeployments, errors.Wrap(err, "error waiting deployment")
 			}
@@ -266,6 +286,7 @@ func (d *Deployer) Cancel(ctx context.Context,
 	if err != nil {
 		return errors.Wrapf(err, "failed to delete deployment: %d", contractID)
 	}
+	d.observers.emit(Event{Type: EventContractCanceled, ContractID: contractID})
 
 	return nil
 }
@@ -312,9 +333,21 @@ func (d *Deployer) Wait(
 	nodeClient *client.NodeClient,
 	deploymentID uint64,
 	workloadVersions map[string]uint32,
+) error {
+	return d.wait(ctx, 0, nodeClient, deploymentID, workloadVersions)
+}
+
+// wait waits for a deployment to be deployed on node and emits the changes of its workloads states
+func (d *Deployer) wait(
+	ctx context.Context,
+	nodeID uint32,
+	nodeClient *client.NodeClient,
+	deploymentID uint64,
+	workloadVersions map[string]uint32,
 ) error {
 	lastProgress := Progress{time.Now(), 0}
 	numberOfWorkloads := len(workloadVersions)
+	workloadStates := make(map[string]zos.ResultState)
 
 	deploymentError := backoff.Retry(func() error {
 		stateOk := 0
@@ -326,6 +359,19 @@ func (d *Deployer) Wait(
 
 		for _, wl := range deploymentChanges {
 			if _, ok := workloadVersions[wl.Name]; ok && wl.Version == workloadVersions[wl.Name] {
+				if previous := workloadStates[wl.Name]; previous != wl.Result.State {
+					workloadStates[wl.Name] = wl.Result.State
+					d.observers.emit(Event{
+						Type:          EventWorkloadStateChanged,
+						NodeID:        nodeID,
+						ContractID:    deploymentID,
+						Workload:      wl.Name,
+						PreviousState: previous,
+						State:         wl.Result.State,
+						Message:       wl.Result.Error,
+					})
+				}
+
 				var errString string
 				switch wl.Result.State {
 				case zos.StateOk:
@@ -375,6 +421,14 @@ func (d *Deployer) BatchDeploy(
 
 	mu := sync.Mutex{}
 
+	// capacity of the batch is reserved until the deployments succeed or fail
+	var releases []func()
+	defer func() {
+		for _, release := range releases {
+			release()
+		}
+	}()
+
 	group, ctx2 := errgroup.WithContext(ctx)
 	for node, dls := range deployments {
 		// loading node clients first before creating any contract and caching the clients
@@ -417,6 +471,11 @@ func (d *Deployer) BatchDeploy(
 				}
 				log.Debug().Uint32("Number of public ips", publicIPCount)
 
+				reservation, err := deploymentReservation(dl)
+				if err != nil {
+					return err
+				}
+
 				var solutionProviderID *uint64
 				if deploymentsSolutionProvider[node] != nil && len(deploymentsSolutionProvider[node]) > i {
 					solutionProviderID = deploymentsSolutionProvider[node][i]
@@ -430,6 +489,7 @@ func (d *Deployer) BatchDeploy(
 					SolutionProviderID: solutionProviderID,
 				})
 				deploymentsSlice = append(deploymentsSlice, dl)
+				releases = append(releases, d.reservations.Reserve(node, reservation))
 				mu.Unlock()
 				return nil
 			})
@@ -450,6 +510,10 @@ func (d *Deployer) BatchDeploy(
 		multiErr = multierror.Append(multiErr, err)
 	}
 
+	for i, contractID := range contracts {
+		d.observers.emit(Event{Type: EventContractCreated, NodeID: contractsData[i].Node, ContractID: contractID})
+	}
+
 	failedContracts := make([]uint64, 0)
 	var wg sync.WaitGroup
 	for i, dl := range deploymentsSlice {
@@ -480,11 +544,13 @@ func (d *Deployer) BatchDeploy(
 				mu.Unlock()
 				return
 			}
+			d.observers.emit(Event{Type: EventDeploymentSent, NodeID: node, ContractID: dl.ContractID})
+
 			newWorkloadVersions := make(map[string]uint32)
 			for _, w := range dl.Workloads {
 				newWorkloadVersions[w.Name] = 0
 			}
-			err = d.Wait(ctx, client, dl.ContractID, newWorkloadVersions)
+			err = d.wait(ctx, node, client, dl.ContractID, newWorkloadVersions)
 			mu.Lock()
 			defer mu.Unlock()
 			if err != nil {
@@ -506,6 +572,10 @@ func (d *Deployer) BatchDeploy(
 		err := d.substrateConn.BatchCancelContract(d.identity, failedContracts)
 		if err != nil {
 			multiErr = multierror.Append(multiErr, errors.Wrapf(err, "failed to cancel failed contracts %v", failedContracts))
+		} else {
+			for _, contractID := range failedContracts {
+				d.observers.emit(Event{Type: EventContractCanceled, ContractID: contractID})
+			}
 		}
 	}
 
@@ -550,9 +620,107 @@ func assignVersions(oldDl *zos.Deployment, newDl *zos.Deployment) (map[string]ui
 		newWorkloadsVersions[w.Name] = newDl.Workloads[idx].Version
 	}
 
+	if err := validateUpgrade(oldDl, newDl); err != nil {
+		return nil, err
+	}
+
 	return newWorkloadsVersions, nil
 }
 
+// validateUpgrade checks the updated workloads of a new deployment version can be updated by zos:
+//   - workloads can't change their types
+//   - vms can't be updated in place, they have to be removed first then deployed again
+//   - disks and volumes can only grow
+//   - disks can't grow while mounted by a running vm
+func validateUpgrade(oldDl *zos.Deployment, newDl *zos.Deployment) error {
+	oldWorkloads := make(map[string]zos.Workload)
+	for _, wl := range oldDl.Workloads {
+		oldWorkloads[wl.Name] = wl
+	}
+
+	// vms kept running through the update
+	keptVMs := make(map[string]bool)
+	for _, wl := range newDl.Workloads {
+		if _, ok := oldWorkloads[wl.Name]; ok && (wl.Type == zos.ZMachineType || wl.Type == zos.ZMachineLightType) {
+			keptVMs[wl.Name] = true
+		}
+	}
+
+	for _, wl := range newDl.Workloads {
+		old, ok := oldWorkloads[wl.Name]
+		if !ok || wl.Version != newDl.Version {
+			continue
+		}
+
+		if old.Type != wl.Type {
+			return errors.Errorf("cannot change type of workload '%s' from %s to %s", wl.Name, old.Type, wl.Type)
+		}
+
+		switch wl.Type {
+		case zos.ZMachineType, zos.ZMachineLightType:
+			return errors.Errorf("vm '%s' cannot be updated in place, it has to be removed then deployed again", wl.Name)
+
+		case zos.ZMountType, zos.VolumeType:
+			var oldSize, newSize zos.ZMount
+			if err := json.Unmarshal(old.Data, &oldSize); err != nil {
+				return errors.Wrapf(err, "failed to load data of workload '%s'", wl.Name)
+			}
+			if err := json.Unmarshal(wl.Data, &newSize); err != nil {
+				return errors.Wrapf(err, "failed to load data of workload '%s'", wl.Name)
+			}
+
+			if newSize.Size < oldSize.Size {
+				return errors.Errorf("cannot shrink %s '%s' from %d to %d bytes", wl.Type, wl.Name, oldSize.Size, newSize.Size)
+			}
+
+			if wl.Type != zos.ZMountType || newSize.Size == oldSize.Size {
+				continue
+			}
+
+			vm, err := mountingVM(oldDl, wl.Name)
+			if err != nil {
+				return err
+			}
+			if keptVMs[vm] {
+				return errors.Errorf("disk '%s' is mounted by vm '%s', it can only be resized while the vm is removed", wl.Name, vm)
+			}
+		}
+	}
+
+	return nil
+}
+
+// mountingVM returns the name of the vm mounting a disk in a deployment if any
+func mountingVM(dl *zos.Deployment, disk string) (string, error) {
+	for _, wl := range dl.Workloads {
+		var mounts []zos.MachineMount
+		switch wl.Type {
+		case zos.ZMachineType:
+			var data zos.ZMachine
+			if err := json.Unmarshal(wl.Data, &data); err != nil {
+				return "", errors.Wrapf(err, "failed to load data of vm '%s'", wl.Name)
+			}
+			mounts = data.Mounts
+		case zos.ZMachineLightType:
+			var data zos.ZMachineLight
+			if err := json.Unmarshal(wl.Data, &data); err != nil {
+				return "", errors.Wrapf(err, "failed to load data of vm '%s'", wl.Name)
+			}
+			mounts = data.Mounts
+		default:
+			continue
+		}
+
+		for _, mount := range mounts {
+			if mount.Name == disk {
+				return wl.Name, nil
+			}
+		}
+	}
+
+	return "", nil
+}
+
 // Validate is a best effort validation. it returns an error if it's very sure there's a problem
 //   - validates old deployments nodes (for update cases) and new deployments nodes
 //   - validates nodes' farm
@@ -574,6 +742,7 @@ func (d *Deployer) Validate(ctx context.Context, oldDeployments map[uint32]zos.D
 		}
 		nodeMap[node] = nodeInfo
 		farmIPs[nodeInfo.FarmID] = 0
+		d.reservations.setFarm(node, nodeInfo.FarmID)
 	}
 
 	for node := range newDeployments {
@@ -586,6 +755,7 @@ func (d *Deployer) Validate(ctx context.Context, oldDeployments map[uint32]zos.D
 		}
 		nodeMap[node] = nodeInfo
 		farmIPs[nodeInfo.FarmID] = 0
+		d.reservations.setFarm(node, nodeInfo.FarmID)
 	}
 
 	for farm := range farmIPs {
@@ -607,6 +777,8 @@ func (d *Deployer) Validate(ctx context.Context, oldDeployments map[uint32]zos.D
 				farmIPs[farm]++
 			}
 		}
+		// ips reserved by in-flight deployments of the client are not free
+		farmIPs[farm] -= int(d.reservations.farmReservedIPs(farm))
 	}
 
 	for node, dl := range oldDeployments {
@@ -672,9 +844,10 @@ func (d *Deployer) Validate(ctx context.Context, oldDeployments map[uint32]zos.D
 		if HasWorkload(&dl, zos.GatewayNameProxyType) && nodeInfo.PublicConfig.Domain == "" {
 			return errors.Errorf("node %d cannot deploy a gateway name workload as it does not have a domain configured", node)
 		}
-		mru := nodeInfo.Capacity.Total.MRU - nodeInfo.Capacity.Used.MRU
-		hru := nodeInfo.Capacity.Total.HRU - nodeInfo.Capacity.Used.HRU
-		sru := 2*nodeInfo.Capacity.Total.SRU - nodeInfo.Capacity.Used.SRU
+		reserved := d.reservations.Reserved(node)
+		mru := freeAfterReserved(nodeInfo.Capacity.Total.MRU-nodeInfo.Capacity.Used.MRU, reserved.MRU)
+		hru := freeAfterReserved(nodeInfo.Capacity.Total.HRU-nodeInfo.Capacity.Used.HRU, reserved.HRU())
+		sru := freeAfterReserved(2*nodeInfo.Capacity.Total.SRU-nodeInfo.Capacity.Used.SRU, reserved.SRU())
 		if uint64(mru) < needed.MRU ||
 			uint64(sru) < needed.SRU ||
 			uint64(hru) < needed.HRU {
@@ -62,33 +62,14 @@ func (d *DeploymentDeployer) generateVersionlessDeployments(ctx context.Context,
 		wg.Add(1)
 		go func(dl *workloads.Deployment) {
 			defer wg.Done()
-			newDl := workloads.NewGridDeployment(d.tfPluginClient.TwinID, 0, []zos.Workload{})
-			for _, disk := range dl.Disks {
-				newDl.Workloads = append(newDl.Workloads, disk.ZosWorkload())
-			}
-			for _, volume := range dl.Volumes {
-				newDl.Workloads = append(newDl.Workloads, volume.ZosWorkload())
-			}
-			for _, zdb := range dl.Zdbs {
-				newDl.Workloads = append(newDl.Workloads, zdb.ZosWorkload())
-			}
-			for _, vm := range dl.Vms {
-				newDl.Workloads = append(newDl.Workloads, vm.ZosWorkload()...)
-			}
-			for _, vm := range dl.VmsLight {
-				newDl.Workloads = append(newDl.Workloads, vm.ZosWorkload()...)
-			}
-
-			for idx, q := range dl.QSFS {
-				qsfsWorkload, err := q.ZosWorkload()
-				if err != nil {
-					mu.Lock()
-					defer mu.Unlock()
-					errs = multierror.Append(errs, errors.Wrapf(err, "failed to generate QSFS %d in deployment '%s'", idx, dl.Name))
-					return
-				}
-				newDl.Workloads = append(newDl.Workloads, qsfsWorkload)
+			wls, err := deploymentWorkloads(dl)
+			if err != nil {
+				mu.Lock()
+				defer mu.Unlock()
+				errs = multierror.Append(errs, err)
+				return
 			}
+			newDl := workloads.NewGridDeployment(d.tfPluginClient.TwinID, 0, wls)
 
 			mu.Lock()
 			defer mu.Unlock()
@@ -106,6 +87,36 @@ func (d *DeploymentDeployer) generateVersionlessDeployments(ctx context.Context,
 	return gridDlsPerNodes, errs
 }
 
+// deploymentWorkloads returns the grid workloads of a deployment
+func deploymentWorkloads(dl *workloads.Deployment) ([]zos.Workload, error) {
+	wls := []zos.Workload{}
+	for _, disk := range dl.Disks {
+		wls = append(wls, disk.ZosWorkload())
+	}
+	for _, volume := range dl.Volumes {
+		wls = append(wls, volume.ZosWorkload())
+	}
+	for _, zdb := range dl.Zdbs {
+		wls = append(wls, zdb.ZosWorkload())
+	}
+	for _, vm := range dl.Vms {
+		wls = append(wls, vm.ZosWorkload()...)
+	}
+	for _, vm := range dl.VmsLight {
+		wls = append(wls, vm.ZosWorkload()...)
+	}
+
+	for idx, q := range dl.QSFS {
+		qsfsWorkload, err := q.ZosWorkload()
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to generate QSFS %d in deployment '%s'", idx, dl.Name)
+		}
+		wls = append(wls, qsfsWorkload)
+	}
+
+	return wls, nil
+}
+
 // Deploy deploys a new deployment
 func (d *DeploymentDeployer) Deploy(ctx context.Context, dl *workloads.Deployment) error {
 	if err := d.Validate(ctx, []*workloads.Deployment{dl}); err != nil {
@@ -132,6 +143,7 @@ func (d *DeploymentDeployer) Deploy(ctx context.Context, dl *workloads.Deploymen
 	if contractID, ok := dl.NodeDeploymentID[dl.NodeID]; ok && contractID != 0 {
 		dl.ContractID = contractID
 		d.tfPluginClient.State.StoreContractIDs(dl.NodeID, dl.ContractID)
+		storeDeploymentsInfo(d.tfPluginClient.State, dl.NodeDeploymentID, map[uint32]zos.Deployment{dl.NodeID: dlsPerNodes[dl.NodeID][0]})
 	}
 
 	return d.tfPluginClient.sentry.error(err)
@@ -167,10 +179,48 @@ func (d *DeploymentDeployer) BatchDeploy(ctx context.Context, dls []*workloads.D
 			multiErr = multierror.Append(multiErr, errors.Wrapf(err, "failed to update deployment '%s' state", dl.Name))
 		}
 	}
+	storeBatchDeploymentsInfo(d.tfPluginClient.State, newDls)
 
 	return d.tfPluginClient.sentry.error(multiErr)
 }
 
+// Plan returns the changes deploying the deployment would make without sending any extrinsic
+func (d *DeploymentDeployer) Plan(ctx context.Context, dl *workloads.Deployment) (Plan, error) {
+	if err := d.Validate(ctx, []*workloads.Deployment{dl}); err != nil {
+		return Plan{}, d.tfPluginClient.sentry.error(fmt.Errorf("invalid deployment: %w", err))
+	}
+
+	dlsPerNodes, err := d.generateVersionlessDeployments(ctx, []*workloads.Deployment{dl})
+	if err != nil {
+		return Plan{}, d.tfPluginClient.sentry.error(errors.Wrap(err, "could not generate deployments data"))
+	}
+
+	if len(dlsPerNodes[dl.NodeID]) == 0 {
+		return Plan{}, d.tfPluginClient.sentry.error(fmt.Errorf("failed to generate the grid deployment"))
+	}
+
+	plan, err := planDeployments(
+		ctx, d.tfPluginClient, d.deployer, dl.NodeDeploymentID,
+		map[uint32]zos.Deployment{dl.NodeID: dlsPerNodes[dl.NodeID][0]},
+	)
+	return plan, d.tfPluginClient.sentry.error(err)
+}
+
+// BatchPlan returns the changes batch deploying the deployments would make without sending any extrinsic
+func (d *DeploymentDeployer) BatchPlan(ctx context.Context, dls []*workloads.Deployment) (Plan, error) {
+	if err := d.Validate(ctx, dls); err != nil {
+		return Plan{}, d.tfPluginClient.sentry.error(fmt.Errorf("invalid deployments: %w", err))
+	}
+
+	newDeployments, err := d.generateVersionlessDeployments(ctx, dls)
+	if err != nil {
+		return Plan{}, d.tfPluginClient.sentry.error(fmt.Errorf("could not generate grid deployments: %w", err))
+	}
+
+	plan, err := planBatchDeployments(ctx, d.tfPluginClient, newDeployments)
+	return plan, d.tfPluginClient.sentry.error(err)
+}
+
 // Cancel cancels deployments
 func (d *DeploymentDeployer) Cancel(ctx context.Context, dl *workloads.Deployment) error {
 	if err := d.Validate(ctx, []*workloads.Deployment{dl}); err != nil {
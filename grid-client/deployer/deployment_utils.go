@@ -4,6 +4,8 @@ import (
 	"crypto/md5"
 
 	"github.com/pkg/errors"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/state"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
 	zosTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-client/zos"
 	"github.com/threefoldtech/zos/pkg/gridtypes/zos"
 )
@@ -105,3 +107,34 @@ func Capacity(dl zosTypes.Deployment) (zosTypes.Capacity, error) {
 	}
 	return cap, nil
 }
+
+// deploymentInfo builds the state info of a grid deployment deployed on a node
+func deploymentInfo(nodeID uint32, dl zosTypes.Deployment) state.DeploymentInfo {
+	info := state.DeploymentInfo{NodeID: nodeID}
+	if data, err := workloads.ParseDeploymentData(dl.Metadata); err == nil {
+		info.Name = data.Name
+		info.Type = data.Type
+		info.ProjectName = data.ProjectName
+	}
+
+	for _, wl := range dl.Workloads {
+		info.Workloads = append(info.Workloads, wl.Name)
+	}
+	return info
+}
+
+// storeDeploymentsInfo stores the info of the deployed grid deployments using their contract IDs
+func storeDeploymentsInfo(st *state.State, nodeDeploymentIDs map[uint32]uint64, deployments map[uint32]zosTypes.Deployment) {
+	for nodeID, dl := range deployments {
+		st.StoreDeploymentInfo(nodeDeploymentIDs[nodeID], deploymentInfo(nodeID, dl))
+	}
+}
+
+// storeBatchDeploymentsInfo stores the info of the successfully deployed batch deployments
+func storeBatchDeploymentsInfo(st *state.State, deployments map[uint32][]zosTypes.Deployment) {
+	for nodeID, dls := range deployments {
+		for _, dl := range dls {
+			st.StoreDeploymentInfo(dl.ContractID, deploymentInfo(nodeID, dl))
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package deployer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/zos"
+)
+
+// EventType is the type of a deployment event
+type EventType string
+
+const (
+	// EventContractCreated is emitted when a node contract is created
+	EventContractCreated EventType = "contract_created"
+	// EventContractUpdated is emitted when a node contract is updated
+	EventContractUpdated EventType = "contract_updated"
+	// EventContractCanceled is emitted when a node contract is canceled
+	EventContractCanceled EventType = "contract_canceled"
+	// EventDeploymentSent is emitted when a deployment is sent to its node
+	EventDeploymentSent EventType = "deployment_sent"
+	// EventWorkloadStateChanged is emitted when a workload state changes while waiting for a deployment
+	EventWorkloadStateChanged EventType = "workload_state_changed"
+	// EventRevertStarted is emitted when a failed deployment starts reverting to the old deployments
+	EventRevertStarted EventType = "revert_started"
+)
+
+// Event is a deployment progress event
+type Event struct {
+	Type       EventType `json:"type"`
+	Time       time.Time `json:"time"`
+	NodeID     uint32    `json:"node_id,omitempty"`
+	ContractID uint64    `json:"contract_id,omitempty"`
+	// Workload is the workload name of workload state changes
+	Workload      string          `json:"workload,omitempty"`
+	PreviousState zos.ResultState `json:"previous_state,omitempty"`
+	State         zos.ResultState `json:"state,omitempty"`
+	Message       string          `json:"message,omitempty"`
+}
+
+// Observer receives deployment events, it is called synchronously from concurrent deployments
+// so it should be safe for concurrent use and return quickly
+type Observer interface {
+	OnEvent(event Event)
+}
+
+// ObserverFunc is a function used as an Observer
+type ObserverFunc func(event Event)
+
+// OnEvent calls f
+func (f ObserverFunc) OnEvent(event Event) {
+	f(event)
+}
+
+// observers are the observers registered on a plugin client and shared by its deployers
+type observers struct {
+	mu   sync.RWMutex
+	next int
+	list map[int]Observer
+}
+
+func newObservers() *observers {
+	return &observers{list: make(map[int]Observer)}
+}
+
+func (o *observers) register(observer Observer) (unregister func()) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	id := o.next
+	o.next++
+	o.list[id] = observer
+
+	return func() {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		delete(o.list, id)
+	}
+}
+
+func (o *observers) emit(event Event) {
+	if o == nil {
+		return
+	}
+
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	for _, observer := range o.list {
+		observer.OnEvent(event)
+	}
+}
+
+// RegisterObserver registers an observer for the deployment events of the client deployers and returns a function to unregister it
+func (t *TFPluginClient) RegisterObserver(observer Observer) (unregister func()) {
+	if t.observers == nil {
+		// deployers created before this point don't share the new observers
+		t.observers = newObservers()
+	}
+
+	return t.observers.register(observer)
+}
@@ -0,0 +1,49 @@
+package deployer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/mocks"
+)
+
+func TestObservers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	sub := mocks.NewMockSubstrateExt(ctrl)
+	tfPluginClient := TFPluginClient{SubstrateConn: sub}
+
+	var first, second []Event
+	unregister := tfPluginClient.RegisterObserver(ObserverFunc(func(e Event) { first = append(first, e) }))
+	tfPluginClient.RegisterObserver(ObserverFunc(func(e Event) { second = append(second, e) }))
+
+	deployer := NewDeployer(tfPluginClient, true)
+
+	sub.EXPECT().EnsureContractCanceled(gomock.Any(), uint64(10)).Return(nil)
+	require.NoError(t, deployer.Cancel(context.Background(), 10))
+
+	require.Len(t, first, 1)
+	assert.Equal(t, EventContractCanceled, first[0].Type)
+	assert.Equal(t, uint64(10), first[0].ContractID)
+	assert.False(t, first[0].Time.IsZero())
+	assert.Equal(t, first, second)
+
+	unregister()
+
+	sub.EXPECT().BatchCancelContract(gomock.Any(), []uint64{11, 12}).Return(nil)
+	require.NoError(t, tfPluginClient.BatchCancelContract([]uint64{11, 12}))
+
+	assert.Len(t, first, 1)
+	require.Len(t, second, 3)
+	assert.Equal(t, uint64(11), second[1].ContractID)
+	assert.Equal(t, uint64(12), second[2].ContractID)
+
+	t.Run("no observers", func(t *testing.T) {
+		var o *observers
+		assert.NotPanics(t, func() { o.emit(Event{Type: EventRevertStarted}) })
+	})
+}
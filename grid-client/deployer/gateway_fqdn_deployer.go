@@ -37,21 +37,47 @@ func (d *GatewayFQDNDeployer) Validate(ctx context.Context, gw *workloads.Gatewa
 		return d.tfPluginClient.sentry.error(err)
 	}
 
-	nodeClient, err := d.tfPluginClient.NcPool.GetNodeClient(sub, gw.NodeID)
+	cfg, err := d.publicConfig(ctx, gw.NodeID)
 	if err != nil {
-		return d.tfPluginClient.sentry.error(errors.Wrapf(err, "failed to get node client with ID %d", gw.NodeID))
+		return d.tfPluginClient.sentry.error(err)
+	}
+
+	if d.tfPluginClient.DNSResolver != nil {
+		if err := verifyGatewayFQDN(ctx, d.tfPluginClient.DNSResolver, gw.FQDN, gw.NodeID, cfg); err != nil {
+			return d.tfPluginClient.sentry.error(err)
+		}
+	}
+
+	return d.tfPluginClient.sentry.error(client.AreNodesUp(ctx, sub, []uint32{gw.NodeID}, d.tfPluginClient.NcPool))
+}
+
+// DNSRecords returns the dns records the owner of the gateway fqdn must create to point it to the gateway node
+func (d *GatewayFQDNDeployer) DNSRecords(ctx context.Context, gw *workloads.GatewayFQDNProxy) (GatewayFQDNRecords, error) {
+	cfg, err := d.publicConfig(ctx, gw.NodeID)
+	if err != nil {
+		return GatewayFQDNRecords{}, err
+	}
+
+	return gatewayFQDNRecords(gw.FQDN, cfg), nil
+}
+
+// publicConfig returns the public config of a gateway node, the node must have a public ipv4
+func (d *GatewayFQDNDeployer) publicConfig(ctx context.Context, nodeID uint32) (client.PublicConfig, error) {
+	nodeClient, err := d.tfPluginClient.NcPool.GetNodeClient(d.tfPluginClient.SubstrateConn, nodeID)
+	if err != nil {
+		return client.PublicConfig{}, errors.Wrapf(err, "failed to get node client with ID %d", nodeID)
 	}
 
 	cfg, err := nodeClient.NetworkGetPublicConfig(ctx)
 	if err != nil {
-		return d.tfPluginClient.sentry.error(errors.Wrapf(err, "couldn't get node %d public config", gw.NodeID))
+		return client.PublicConfig{}, errors.Wrapf(err, "couldn't get node %d public config", nodeID)
 	}
 
 	if cfg.IPv4.IP == nil {
-		return d.tfPluginClient.sentry.error(errors.Errorf("node %d doesn't contain a public IP in its public config", gw.NodeID))
+		return client.PublicConfig{}, errors.Errorf("node %d doesn't contain a public IP in its public config", nodeID)
 	}
 
-	return d.tfPluginClient.sentry.error(client.AreNodesUp(ctx, sub, []uint32{gw.NodeID}, d.tfPluginClient.NcPool))
+	return cfg, nil
 }
 
 // GenerateVersionlessDeployments generates deployments for gatewayFqdn deployer without versions
@@ -92,9 +118,8 @@ func (d *GatewayFQDNDeployer) Deploy(ctx context.Context, gw *workloads.GatewayF
 	// error is not returned immediately before updating state because of untracked failed deployments
 	if contractID, ok := gw.NodeDeploymentID[gw.NodeID]; ok && contractID != 0 {
 		gw.ContractID = contractID
-		if !workloads.Contains(d.tfPluginClient.State.CurrentNodeDeployments[gw.NodeID], gw.ContractID) {
-			d.tfPluginClient.State.CurrentNodeDeployments[gw.NodeID] = append(d.tfPluginClient.State.CurrentNodeDeployments[gw.NodeID], gw.ContractID)
-		}
+		d.tfPluginClient.State.StoreContractIDs(gw.NodeID, gw.ContractID)
+		storeDeploymentsInfo(d.tfPluginClient.State, gw.NodeDeploymentID, newDeployments)
 	}
 
 	return d.tfPluginClient.sentry.error(err)
@@ -136,10 +161,49 @@ func (d *GatewayFQDNDeployer) BatchDeploy(ctx context.Context, gws []*workloads.
 			return d.tfPluginClient.sentry.error(errors.Wrapf(err, "failed to update gateway fqdn '%s' state", gw.Name))
 		}
 	}
+	storeBatchDeploymentsInfo(d.tfPluginClient.State, newDls)
 
 	return d.tfPluginClient.sentry.error(err)
 }
 
+// Plan returns the changes deploying the GatewayFQDN would make without sending any extrinsic
+func (d *GatewayFQDNDeployer) Plan(ctx context.Context, gw *workloads.GatewayFQDNProxy) (Plan, error) {
+	if err := d.Validate(ctx, gw); err != nil {
+		return Plan{}, d.tfPluginClient.sentry.error(err)
+	}
+
+	newDeployments, err := d.generateVersionlessDeployments(ctx, gw)
+	if err != nil {
+		return Plan{}, d.tfPluginClient.sentry.error(errors.Wrap(err, "could not generate deployments data"))
+	}
+
+	plan, err := planDeployments(ctx, d.tfPluginClient, d.deployer, gw.NodeDeploymentID, newDeployments)
+	return plan, d.tfPluginClient.sentry.error(err)
+}
+
+// BatchPlan returns the changes batch deploying the GatewayFQDNs would make without sending any extrinsic
+func (d *GatewayFQDNDeployer) BatchPlan(ctx context.Context, gws []*workloads.GatewayFQDNProxy) (Plan, error) {
+	newDeployments := make(map[uint32][]zosTypes.Deployment)
+
+	for _, gw := range gws {
+		if err := d.Validate(ctx, gw); err != nil {
+			return Plan{}, d.tfPluginClient.sentry.error(err)
+		}
+
+		dls, err := d.generateVersionlessDeployments(ctx, gw)
+		if err != nil {
+			return Plan{}, d.tfPluginClient.sentry.error(errors.Wrap(err, "could not generate deployments data"))
+		}
+
+		for nodeID, dl := range dls {
+			newDeployments[nodeID] = append(newDeployments[nodeID], dl)
+		}
+	}
+
+	plan, err := planBatchDeployments(ctx, d.tfPluginClient, newDeployments)
+	return plan, d.tfPluginClient.sentry.error(err)
+}
+
 // Cancel cancels a gateway deployment
 func (d *GatewayFQDNDeployer) Cancel(ctx context.Context, gw *workloads.GatewayFQDNProxy) (err error) {
 	if err := d.Validate(ctx, gw); err != nil {
@@ -155,7 +219,7 @@ func (d *GatewayFQDNDeployer) Cancel(ctx context.Context, gw *workloads.GatewayF
 	// update state
 	gw.ContractID = 0
 	delete(gw.NodeDeploymentID, gw.NodeID)
-	d.tfPluginClient.State.CurrentNodeDeployments[gw.NodeID] = workloads.Delete(d.tfPluginClient.State.CurrentNodeDeployments[gw.NodeID], contractID)
+	d.tfPluginClient.State.RemoveContractIDs(gw.NodeID, contractID)
 
 	return nil
 }
@@ -176,9 +240,7 @@ func (d *GatewayFQDNDeployer) updateStateFromDeployments(gw *workloads.GatewayFQ
 
 	if contractID, ok := gw.NodeDeploymentID[gw.NodeID]; ok && contractID != 0 {
 		gw.ContractID = contractID
-		if !workloads.Contains(d.tfPluginClient.State.CurrentNodeDeployments[gw.NodeID], gw.ContractID) {
-			d.tfPluginClient.State.CurrentNodeDeployments[gw.NodeID] = append(d.tfPluginClient.State.CurrentNodeDeployments[gw.NodeID], gw.ContractID)
-		}
+		d.tfPluginClient.State.StoreContractIDs(gw.NodeID, gw.ContractID)
 	}
 
 	return nil
@@ -207,7 +269,8 @@ func (d *GatewayFQDNDeployer) Sync(ctx context.Context, gw *workloads.GatewayFQD
 	}
 
 	dl := dls[gw.NodeID]
-	wl, _ := dl.Get(gw.Name)
+	name, workloadName := gw.Name, gw.ZosWorkload().Name
+	wl, _ := dl.Get(workloadName.String())
 
 	gwWorkload := workloads.GatewayFQDNProxy{}
 	gw.Backends = gwWorkload.Backends
@@ -219,7 +282,8 @@ func (d *GatewayFQDNDeployer) Sync(ctx context.Context, gw *workloads.GatewayFQD
 	if wl != nil && wl.Result.State.IsOkay() {
 		gwWorkload, err := workloads.NewGatewayFQDNProxyFromZosWorkload(*wl.Workload.Workload3())
 		gw.Backends = gwWorkload.Backends
-		gw.Name = gwWorkload.Name
+		// the workload of a gateway replaced in place is named differently
+		gw.Name = name
 		gw.FQDN = gwWorkload.FQDN
 		gw.TLSPassthrough = gwWorkload.TLSPassthrough
 		gw.Network = gwWorkload.Network
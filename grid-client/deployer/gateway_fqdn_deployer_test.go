@@ -50,6 +50,7 @@ func constructTestFQDNDeployer(t *testing.T, mock bool) (
 		tfPluginClient.NcPool = ncPool
 		tfPluginClient.RMB = cl
 		tfPluginClient.GridProxyClient = gridProxyCl
+		tfPluginClient.DNSResolver = staticResolver{ips: map[string][]string{"name.com": {"192.168.1.10"}}}
 
 		tfPluginClient.State.NcPool = ncPool
 		tfPluginClient.State.Substrate = sub
@@ -0,0 +1,103 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+	client "github.com/threefoldtech/tfgrid-sdk-go/grid-client/node"
+)
+
+// DNSResolver resolves the records of a domain, net.Resolver implements it
+type DNSResolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+	LookupCNAME(ctx context.Context, host string) (string, error)
+}
+
+// DNSRecord is a dns record to create for a domain
+type DNSRecord struct {
+	Type  string `json:"type"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+func (r DNSRecord) String() string {
+	return fmt.Sprintf("%s %s %s", r.Name, r.Type, r.Value)
+}
+
+// GatewayFQDNRecords are the dns records pointing a fqdn to a gateway node.
+// either the address records or the cname record are created, a cname can't coexist with other records
+type GatewayFQDNRecords struct {
+	Address []DNSRecord `json:"address"`
+	CNAME   *DNSRecord  `json:"cname,omitempty"`
+}
+
+func (r GatewayFQDNRecords) String() string {
+	records := make([]string, 0, len(r.Address))
+	for _, record := range r.Address {
+		records = append(records, record.String())
+	}
+
+	s := strings.Join(records, ", ")
+	if r.CNAME != nil {
+		s = fmt.Sprintf("%s or %s", s, r.CNAME)
+	}
+	return s
+}
+
+// gatewayFQDNRecords returns the records pointing a fqdn to a node with the given public config
+func gatewayFQDNRecords(fqdn string, cfg client.PublicConfig) GatewayFQDNRecords {
+	var records GatewayFQDNRecords
+	if ip := cfg.IPv4.IP.To4(); ip != nil {
+		records.Address = append(records.Address, DNSRecord{Type: "A", Name: fqdn, Value: ip.String()})
+	}
+	if ip := cfg.IPv6.IP; ip != nil && ip.To4() == nil {
+		records.Address = append(records.Address, DNSRecord{Type: "AAAA", Name: fqdn, Value: ip.String()})
+	}
+	if cfg.Domain != "" {
+		records.CNAME = &DNSRecord{Type: "CNAME", Name: fqdn, Value: cfg.Domain}
+	}
+
+	return records
+}
+
+// verifyGatewayFQDN checks that a fqdn resolves only to the public ips of the gateway node
+func verifyGatewayFQDN(ctx context.Context, resolver DNSResolver, fqdn string, nodeID uint32, cfg client.PublicConfig) error {
+	records := gatewayFQDNRecords(fqdn, cfg)
+
+	addrs, err := resolver.LookupIPAddr(ctx, fqdn)
+	if err != nil || len(addrs) == 0 {
+		if err == nil {
+			err = errors.New("no addresses found")
+		}
+		return errors.Wrapf(err, "fqdn %s doesn't resolve, create the dns records: %s", fqdn, records)
+	}
+
+	var expected []net.IP
+	for _, record := range records.Address {
+		expected = append(expected, net.ParseIP(record.Value))
+	}
+
+	var unexpected []string
+	for _, addr := range addrs {
+		if !slices.ContainsFunc(expected, addr.IP.Equal) {
+			unexpected = append(unexpected, addr.IP.String())
+		}
+	}
+	if len(unexpected) == 0 {
+		return nil
+	}
+
+	target := fqdn
+	if cname, err := resolver.LookupCNAME(ctx, fqdn); err == nil && strings.TrimSuffix(cname, ".") != fqdn {
+		target = fmt.Sprintf("%s (cname %s)", fqdn, strings.TrimSuffix(cname, "."))
+	}
+
+	return errors.Errorf(
+		"fqdn %s resolves to %s which are not public ips of gateway node %d, update the dns records to: %s",
+		target, strings.Join(unexpected, ", "), nodeID, records,
+	)
+}
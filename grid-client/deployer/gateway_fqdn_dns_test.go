@@ -0,0 +1,105 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+	"github.com/threefoldtech/zos/pkg/gridtypes/zos"
+)
+
+// staticResolver resolves domains from in memory records
+type staticResolver struct {
+	ips    map[string][]string
+	cnames map[string]string
+}
+
+func (r staticResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	ips, ok := r.ips[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+
+	addrs := make([]net.IPAddr, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, net.IPAddr{IP: net.ParseIP(ip)})
+	}
+	return addrs, nil
+}
+
+func (r staticResolver) LookupCNAME(ctx context.Context, host string) (string, error) {
+	if cname, ok := r.cnames[host]; ok {
+		return cname + ".", nil
+	}
+	return host + ".", nil
+}
+
+func TestGatewayFQDNDNS(t *testing.T) {
+	resolver := staticResolver{
+		ips: map[string][]string{
+			"app.example.com":   {"185.206.123.1"},
+			"stale.example.com": {"185.206.123.1", "10.1.1.1"},
+			"other.example.com": {"185.206.123.2"},
+		},
+		cnames: map[string]string{"other.example.com": "node2.sim.grid.tf"},
+	}
+
+	tfPluginClient, err := NewTFPluginClient(simulationMnemonic, WithSimulation(), WithDNSResolver(resolver))
+	require.NoError(t, err)
+	defer tfPluginClient.Close()
+
+	ctx := context.Background()
+	gateway := func(fqdn string) workloads.GatewayFQDNProxy {
+		return workloads.GatewayFQDNProxy{
+			NodeID:   1,
+			Name:     "app",
+			FQDN:     fqdn,
+			Backends: []zos.Backend{"http://185.206.123.2:8080"},
+		}
+	}
+
+	t.Run("records", func(t *testing.T) {
+		gw := gateway("app.example.com")
+		records, err := tfPluginClient.GatewayFQDNDeployer.DNSRecords(ctx, &gw)
+		require.NoError(t, err)
+		assert.Equal(t, []DNSRecord{{Type: "A", Name: "app.example.com", Value: "185.206.123.1"}}, records.Address)
+		assert.Equal(t, &DNSRecord{Type: "CNAME", Name: "app.example.com", Value: "node1.sim.grid.tf"}, records.CNAME)
+		assert.Equal(t, "app.example.com A 185.206.123.1 or app.example.com CNAME node1.sim.grid.tf", records.String())
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		gw := gateway("missing.example.com")
+		err := tfPluginClient.GatewayFQDNDeployer.Validate(ctx, &gw)
+		assert.ErrorContains(t, err, "fqdn missing.example.com doesn't resolve, create the dns records: missing.example.com A 185.206.123.1")
+
+		gw = gateway("other.example.com")
+		err = tfPluginClient.GatewayFQDNDeployer.Validate(ctx, &gw)
+		assert.ErrorContains(t, err, "fqdn other.example.com (cname node2.sim.grid.tf) resolves to 185.206.123.2 which are not public ips of gateway node 1")
+
+		gw = gateway("stale.example.com")
+		err = tfPluginClient.GatewayFQDNDeployer.Validate(ctx, &gw)
+		assert.ErrorContains(t, err, "resolves to 10.1.1.1 which")
+	})
+
+	t.Run("deploy", func(t *testing.T) {
+		gw := gateway("app.example.com")
+		require.NoError(t, tfPluginClient.GatewayFQDNDeployer.Deploy(ctx, &gw))
+		assert.NotZero(t, gw.ContractID)
+		assert.NoError(t, tfPluginClient.GatewayFQDNDeployer.Cancel(ctx, &gw))
+	})
+}
+
+func ExampleGatewayFQDNRecords() {
+	records := GatewayFQDNRecords{
+		Address: []DNSRecord{
+			{Type: "A", Name: "app.example.com", Value: "185.206.123.1"},
+			{Type: "AAAA", Name: "app.example.com", Value: "2a02:1802:5e::1"},
+		},
+	}
+	fmt.Println(records)
+	// Output: app.example.com A 185.206.123.1, app.example.com AAAA 2a02:1802:5e::1
+}
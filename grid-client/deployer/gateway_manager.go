@@ -0,0 +1,419 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+	"github.com/threefoldtech/zos/pkg/gridtypes/zos"
+)
+
+const defaultHealthCheckTimeout = 5 * time.Second
+
+// GatewayBackendAddress selects the address of a vm a gateway routes to
+type GatewayBackendAddress string
+
+const (
+	// BackendPublicIP routes to the public ipv4 of the vms, the default
+	BackendPublicIP GatewayBackendAddress = "ipv4"
+	// BackendPublicIP6 routes to the public ipv6 of the vms
+	BackendPublicIP6 GatewayBackendAddress = "ipv6"
+	// BackendPlanetaryIP routes to the yggdrasil ip of the vms
+	BackendPlanetaryIP GatewayBackendAddress = "planetary"
+	// BackendMyceliumIP routes to the mycelium ip of the vms
+	BackendMyceliumIP GatewayBackendAddress = "mycelium"
+	// BackendPrivateIP routes to the private ip of the vms, the gateway must join their network
+	BackendPrivateIP GatewayBackendAddress = "private"
+)
+
+// GatewayBackendSet is a set of replicas serving a gateway, e.g. the blue or the green version of an app
+type GatewayBackendSet struct {
+	Name string
+	// Deployments hold the replicas, they are synced from the grid on each reconciliation so new replicas are picked up
+	Deployments []*workloads.Deployment
+	// VMs are the names of the replicas in the deployments, all the vms and vm-lights are replicas if empty
+	VMs     []string
+	Port    uint16
+	Address GatewayBackendAddress
+}
+
+// GatewayHealthCheck returns an error if a backend can't serve traffic
+type GatewayHealthCheck func(ctx context.Context, backend zos.Backend) error
+
+// GatewaySync is the outcome of a gateway manager reconciliation
+type GatewaySync struct {
+	Set     string
+	Backend zos.Backend
+	Healthy []zos.Backend
+	// Unhealthy backends failed their health check and are not routed to
+	Unhealthy []zos.Backend
+	// Updated is set if the gateway was deployed again with a new backend
+	Updated bool
+}
+
+// GatewayManager keeps a name or fqdn gateway routed to a healthy replica of its active backend set.
+// zos gateways support a single backend, so the manager fails over to another healthy replica
+// when the routed one fails its health check instead of balancing the traffic
+type GatewayManager struct {
+	client  *TFPluginClient
+	gateway managedGateway
+	check   GatewayHealthCheck
+
+	mu     sync.Mutex
+	sets   map[string]GatewayBackendSet
+	active string
+}
+
+// managedGateway is a name or fqdn gateway deployed by a gateway manager
+type managedGateway interface {
+	name() string
+	backend() zos.Backend
+	tlsPassthrough() bool
+	deploy(ctx context.Context, backend zos.Backend) error
+}
+
+// NewGatewayNameManager creates a manager for a name gateway routed to the first of the backend sets
+func NewGatewayNameManager(client *TFPluginClient, gw *workloads.GatewayNameProxy, check GatewayHealthCheck, sets ...GatewayBackendSet) (*GatewayManager, error) {
+	return newGatewayManager(client, &nameGateway{client: client, gw: gw}, check, sets)
+}
+
+// NewGatewayFQDNManager creates a manager for a fqdn gateway routed to the first of the backend sets
+func NewGatewayFQDNManager(client *TFPluginClient, gw *workloads.GatewayFQDNProxy, check GatewayHealthCheck, sets ...GatewayBackendSet) (*GatewayManager, error) {
+	return newGatewayManager(client, &fqdnGateway{client: client, gw: gw}, check, sets)
+}
+
+func newGatewayManager(client *TFPluginClient, gateway managedGateway, check GatewayHealthCheck, sets []GatewayBackendSet) (*GatewayManager, error) {
+	if len(sets) == 0 {
+		return nil, errors.New("at least one backend set is required")
+	}
+	if check == nil {
+		check = HTTPHealthCheck("/")
+	}
+
+	m := &GatewayManager{
+		client:  client,
+		gateway: gateway,
+		check:   check,
+		sets:    make(map[string]GatewayBackendSet),
+		active:  sets[0].Name,
+	}
+	for _, set := range sets {
+		if err := m.SetBackendSet(set); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// SetBackendSet adds a backend set or replaces the one of the same name
+func (m *GatewayManager) SetBackendSet(set GatewayBackendSet) error {
+	if set.Name == "" {
+		return errors.New("backend set name is required")
+	}
+	if set.Port == 0 {
+		return fmt.Errorf("backend set %s port is required", set.Name)
+	}
+	if len(set.Deployments) == 0 {
+		return fmt.Errorf("backend set %s has no deployments", set.Name)
+	}
+	if set.Address == "" {
+		set.Address = BackendPublicIP
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sets[set.Name] = set
+	return nil
+}
+
+// Active returns the name of the backend set the gateway routes to
+func (m *GatewayManager) Active() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.active
+}
+
+// Switch routes the gateway to a healthy replica of another backend set, e.g. from blue to green.
+// the gateway keeps its current backend set if none of the replicas of the new one is healthy
+func (m *GatewayManager) Switch(ctx context.Context, set string) (GatewaySync, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.sets[set]; !ok {
+		return GatewaySync{}, fmt.Errorf("backend set %s not found", set)
+	}
+
+	result, err := m.reconcile(ctx, set)
+	if err != nil {
+		return result, errors.Wrapf(err, "failed to switch gateway %s to backend set %s", m.gateway.name(), set)
+	}
+	m.active = set
+	return result, nil
+}
+
+// Run reconciles the gateway every interval until the context is done
+func (m *GatewayManager) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		result, err := m.Reconcile(ctx)
+		if err != nil {
+			log.Error().Err(err).Str("gateway", m.gateway.name()).Msg("failed to reconcile gateway")
+		} else if result.Updated {
+			log.Info().Str("gateway", m.gateway.name()).Str("backend", string(result.Backend)).Msg("gateway routed to a new backend")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Reconcile checks the replicas of the active backend set once and routes the gateway
+// to another healthy one if its backend is gone or unhealthy
+func (m *GatewayManager) Reconcile(ctx context.Context) (GatewaySync, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.reconcile(ctx, m.active)
+}
+
+func (m *GatewayManager) reconcile(ctx context.Context, setName string) (GatewaySync, error) {
+	set := m.sets[setName]
+	result := GatewaySync{Set: setName, Backend: m.gateway.backend()}
+
+	backends, err := m.backends(ctx, set)
+	if err != nil {
+		return result, err
+	}
+	if len(backends) == 0 {
+		return result, fmt.Errorf("backend set %s has no replicas", setName)
+	}
+
+	for _, backend := range backends {
+		if err := m.check(ctx, backend); err != nil {
+			log.Debug().Err(err).Str("backend", string(backend)).Msg("backend is unhealthy")
+			result.Unhealthy = append(result.Unhealthy, backend)
+			continue
+		}
+		result.Healthy = append(result.Healthy, backend)
+	}
+
+	if slices.Contains(result.Healthy, result.Backend) {
+		return result, nil
+	}
+	if len(result.Healthy) == 0 {
+		return result, fmt.Errorf("no healthy replica in backend set %s", setName)
+	}
+
+	backend := result.Healthy[0]
+	if err := m.gateway.deploy(ctx, backend); err != nil {
+		return result, errors.Wrapf(err, "failed to route gateway %s to %s", m.gateway.name(), backend)
+	}
+	result.Backend, result.Updated = backend, true
+
+	return result, nil
+}
+
+// backends returns the backends of the replicas of a set in a stable order
+func (m *GatewayManager) backends(ctx context.Context, set GatewayBackendSet) ([]zos.Backend, error) {
+	var backends []zos.Backend
+	for _, dl := range set.Deployments {
+		if err := m.client.DeploymentDeployer.Sync(ctx, dl); err != nil {
+			return nil, errors.Wrapf(err, "failed to sync deployment %s of backend set %s", dl.Name, set.Name)
+		}
+
+		for _, vm := range dl.Vms {
+			if len(set.VMs) != 0 && !slices.Contains(set.VMs, vm.Name) {
+				continue
+			}
+			addresses := map[GatewayBackendAddress]string{
+				BackendPublicIP:    vm.ComputedIP,
+				BackendPublicIP6:   vm.ComputedIP6,
+				BackendPlanetaryIP: vm.PlanetaryIP,
+				BackendMyceliumIP:  vm.MyceliumIP,
+				BackendPrivateIP:   vm.IP,
+			}
+			if backend, ok := m.backend(addresses[set.Address], set.Port); ok {
+				backends = append(backends, backend)
+			}
+		}
+		for _, vm := range dl.VmsLight {
+			if len(set.VMs) != 0 && !slices.Contains(set.VMs, vm.Name) {
+				continue
+			}
+			addresses := map[GatewayBackendAddress]string{
+				BackendMyceliumIP: vm.MyceliumIP,
+				BackendPrivateIP:  vm.IP,
+			}
+			if backend, ok := m.backend(addresses[set.Address], set.Port); ok {
+				backends = append(backends, backend)
+			}
+		}
+	}
+
+	return backends, nil
+}
+
+// backend builds the backend of a replica address, the address may be a cidr
+func (m *GatewayManager) backend(address string, port uint16) (zos.Backend, bool) {
+	ip, _, err := net.ParseCIDR(address)
+	if err != nil {
+		ip = net.ParseIP(address)
+	}
+	if ip == nil {
+		return "", false
+	}
+
+	hostPort := net.JoinHostPort(ip.String(), fmt.Sprint(port))
+	if m.gateway.tlsPassthrough() {
+		return zos.Backend(hostPort), true
+	}
+	return zos.Backend(fmt.Sprintf("http://%s", hostPort)), true
+}
+
+// HTTPHealthCheck checks backends answer a GET request on the path with a non 5xx status.
+// tls passthrough backends are checked by opening a tcp connection
+func HTTPHealthCheck(path string) GatewayHealthCheck {
+	client := http.Client{Timeout: defaultHealthCheckTimeout}
+
+	return func(ctx context.Context, backend zos.Backend) error {
+		if !strings.Contains(string(backend), "://") {
+			return TCPHealthCheck(ctx, backend)
+		}
+
+		u, err := url.Parse(string(backend))
+		if err != nil {
+			return errors.Wrapf(err, "invalid backend %s", backend)
+		}
+		u.Path = path
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return err
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("backend %s responded with status %s", backend, res.Status)
+		}
+		return nil
+	}
+}
+
+// TCPHealthCheck checks a tcp connection can be opened to a backend
+func TCPHealthCheck(ctx context.Context, backend zos.Backend) error {
+	address := string(backend)
+	if u, err := url.Parse(address); err == nil && u.Host != "" {
+		address = u.Host
+	}
+
+	dialer := net.Dialer{Timeout: defaultHealthCheckTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// rotatedWorkloadName returns the workload name replacing a deployed gateway workload.
+// it alternates between the default gateway name and a suffixed one since both only exist during the same update
+func rotatedWorkloadName(name, current string) string {
+	if current == "" || current == name {
+		return name + "_1"
+	}
+	return ""
+}
+
+type nameGateway struct {
+	client *TFPluginClient
+	gw     *workloads.GatewayNameProxy
+}
+
+func (g *nameGateway) name() string {
+	return g.gw.Name
+}
+
+func (g *nameGateway) backend() zos.Backend {
+	if len(g.gw.Backends) == 0 {
+		return ""
+	}
+	return g.gw.Backends[0]
+}
+
+func (g *nameGateway) tlsPassthrough() bool {
+	return g.gw.TLSPassthrough
+}
+
+// deploy routes the gateway to a backend, a deployed gateway workload is replaced within the same deployment
+func (g *nameGateway) deploy(ctx context.Context, backend zos.Backend) error {
+	gw := *g.gw
+	gw.Backends = []zos.Backend{backend}
+	if gw.ContractID != 0 {
+		gw.WorkloadName = rotatedWorkloadName(gw.Name, gw.WorkloadName)
+	}
+
+	err := g.client.GatewayNameDeployer.Deploy(ctx, &gw)
+	g.gw.NodeDeploymentID, g.gw.ContractID, g.gw.NameContractID = gw.NodeDeploymentID, gw.ContractID, gw.NameContractID
+	if err != nil {
+		return err
+	}
+
+	*g.gw = gw
+	return nil
+}
+
+type fqdnGateway struct {
+	client *TFPluginClient
+	gw     *workloads.GatewayFQDNProxy
+}
+
+func (g *fqdnGateway) name() string {
+	return g.gw.Name
+}
+
+func (g *fqdnGateway) backend() zos.Backend {
+	if len(g.gw.Backends) == 0 {
+		return ""
+	}
+	return g.gw.Backends[0]
+}
+
+func (g *fqdnGateway) tlsPassthrough() bool {
+	return g.gw.TLSPassthrough
+}
+
+// deploy routes the gateway to a backend, a deployed gateway workload is replaced within the same deployment
+func (g *fqdnGateway) deploy(ctx context.Context, backend zos.Backend) error {
+	gw := *g.gw
+	gw.Backends = []zos.Backend{backend}
+	if gw.ContractID != 0 {
+		gw.WorkloadName = rotatedWorkloadName(gw.Name, gw.WorkloadName)
+	}
+
+	err := g.client.GatewayFQDNDeployer.Deploy(ctx, &gw)
+	g.gw.NodeDeploymentID, g.gw.ContractID = gw.NodeDeploymentID, gw.ContractID
+	if err != nil {
+		return err
+	}
+
+	*g.gw = gw
+	return nil
+}
@@ -0,0 +1,161 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/simulation"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+	zosTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-client/zos"
+	"github.com/threefoldtech/zos/pkg/gridtypes/zos"
+)
+
+func TestGatewayManager(t *testing.T) {
+	// serves the flists of the vms
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer hub.Close()
+
+	grid := simulation.NewGrid()
+	tfPluginClient, err := NewTFPluginClient(simulationMnemonic, WithSimulation(grid))
+	require.NoError(t, err)
+	defer tfPluginClient.Close()
+
+	ctx := context.Background()
+	network := workloads.ZNet{
+		Name:  "gwnet",
+		Nodes: []uint32{1},
+		IPRange: zosTypes.IPNet{IPNet: net.IPNet{
+			IP:   net.IPv4(10, 20, 0, 0),
+			Mask: net.CIDRMask(16, 32),
+		}},
+	}
+	require.NoError(t, tfPluginClient.NetworkDeployer.Deploy(ctx, &network))
+
+	vm := func(name string) workloads.VM {
+		return workloads.VM{
+			Name:        name,
+			NodeID:      1,
+			NetworkName: network.Name,
+			Flist:       hub.URL + "/app.flist",
+			CPU:         1,
+			MemoryMB:    512,
+		}
+	}
+	blue := workloads.NewDeployment("blue", 1, "", nil, network.Name, nil, nil, []workloads.VM{vm("blue0"), vm("blue1")}, nil, nil, nil)
+	require.NoError(t, tfPluginClient.DeploymentDeployer.Deploy(ctx, &blue))
+	green := workloads.NewDeployment("green", 1, "", nil, network.Name, nil, nil, []workloads.VM{vm("green0")}, nil, nil, nil)
+	require.NoError(t, tfPluginClient.DeploymentDeployer.Deploy(ctx, &green))
+
+	backend := func(dl *workloads.Deployment, name string) zos.Backend {
+		t.Helper()
+		for _, vm := range dl.Vms {
+			if vm.Name == name {
+				return zos.Backend("http://" + net.JoinHostPort(vm.IP, "8080"))
+			}
+		}
+		t.Fatalf("vm %s not found", name)
+		return ""
+	}
+
+	unhealthy := map[zos.Backend]bool{}
+	check := func(ctx context.Context, backend zos.Backend) error {
+		if unhealthy[backend] {
+			return errors.New("connection refused")
+		}
+		return nil
+	}
+
+	gw := workloads.GatewayNameProxy{NodeID: 1, Name: "app", Network: network.Name}
+	manager, err := NewGatewayNameManager(&tfPluginClient, &gw, check,
+		GatewayBackendSet{Name: "blue", Deployments: []*workloads.Deployment{&blue}, Port: 8080, Address: BackendPrivateIP},
+		GatewayBackendSet{Name: "green", Deployments: []*workloads.Deployment{&green}, Port: 8080, Address: BackendPrivateIP},
+	)
+	require.NoError(t, err)
+
+	t.Run("deploy", func(t *testing.T) {
+		result, err := manager.Reconcile(ctx)
+		require.NoError(t, err)
+		assert.True(t, result.Updated)
+		assert.Equal(t, backend(&blue, "blue0"), result.Backend)
+		assert.Len(t, result.Healthy, 2)
+		assert.NotZero(t, gw.ContractID)
+		assert.Empty(t, gw.WorkloadName)
+
+		result, err = manager.Reconcile(ctx)
+		require.NoError(t, err)
+		assert.False(t, result.Updated)
+	})
+
+	t.Run("fail over in place", func(t *testing.T) {
+		contractID := gw.ContractID
+		unhealthy[backend(&blue, "blue0")] = true
+
+		result, err := manager.Reconcile(ctx)
+		require.NoError(t, err)
+		assert.True(t, result.Updated)
+		assert.Equal(t, backend(&blue, "blue1"), result.Backend)
+		assert.Equal(t, []zos.Backend{backend(&blue, "blue0")}, result.Unhealthy)
+		assert.Equal(t, contractID, gw.ContractID)
+		assert.Equal(t, "app_1", gw.WorkloadName)
+
+		loaded, err := tfPluginClient.State.LoadGatewayNameFromGrid(ctx, 1, gw.Name, gw.Name)
+		require.NoError(t, err)
+		assert.Equal(t, "app", loaded.Name)
+		assert.Equal(t, "app_1", loaded.WorkloadName)
+		assert.Equal(t, []zos.Backend{result.Backend}, loaded.Backends)
+	})
+
+	t.Run("new replica", func(t *testing.T) {
+		unhealthy[backend(&blue, "blue1")] = true
+		_, err := manager.Reconcile(ctx)
+		assert.ErrorContains(t, err, "no healthy replica")
+
+		blue.Vms = append(blue.Vms, vm("blue2"))
+		require.NoError(t, tfPluginClient.DeploymentDeployer.Deploy(ctx, &blue))
+
+		result, err := manager.Reconcile(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, backend(&blue, "blue2"), result.Backend)
+		assert.Equal(t, "", gw.WorkloadName)
+	})
+
+	t.Run("blue green switch", func(t *testing.T) {
+		unhealthy[backend(&green, "green0")] = true
+		_, err := manager.Switch(ctx, "green")
+		assert.Error(t, err)
+		assert.Equal(t, "blue", manager.Active())
+
+		delete(unhealthy, backend(&green, "green0"))
+		result, err := manager.Switch(ctx, "green")
+		require.NoError(t, err)
+		assert.Equal(t, "green", manager.Active())
+		assert.Equal(t, backend(&green, "green0"), result.Backend)
+		assert.Equal(t, []zos.Backend{result.Backend}, gw.Backends)
+	})
+}
+
+func TestHTTPHealthCheck(t *testing.T) {
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/healthz", r.URL.Path)
+	}))
+	defer healthy.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	ctx := context.Background()
+	check := HTTPHealthCheck("/healthz")
+	assert.NoError(t, check(ctx, zos.Backend(healthy.URL)))
+	assert.Error(t, check(ctx, zos.Backend(failing.URL)))
+	assert.NoError(t, check(ctx, zos.Backend(healthy.Listener.Addr().String())))
+
+	failing.Close()
+	assert.Error(t, check(ctx, zos.Backend(failing.Listener.Addr().String())))
+}
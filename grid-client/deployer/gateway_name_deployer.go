@@ -80,6 +80,7 @@ func (d *GatewayNameDeployer) Deploy(ctx context.Context, gw *workloads.GatewayN
 		if err != nil {
 			return d.tfPluginClient.sentry.error(err)
 		}
+		d.tfPluginClient.observers.emit(Event{Type: EventContractCreated, ContractID: gw.NameContractID, Message: fmt.Sprintf("name contract %s", gw.Name)})
 	}
 
 	gw.NodeDeploymentID, err = d.deployer.Deploy(ctx, gw.NodeDeploymentID, newDeployments, newDeploymentsSolutionProvider)
@@ -94,9 +95,8 @@ func (d *GatewayNameDeployer) Deploy(ctx context.Context, gw *workloads.GatewayN
 	// error is not returned immediately before updating state because of untracked failed deployments
 	if contractID, ok := gw.NodeDeploymentID[gw.NodeID]; ok && contractID != 0 {
 		gw.ContractID = contractID
-		if !workloads.Contains(d.tfPluginClient.State.CurrentNodeDeployments[gw.NodeID], gw.ContractID) {
-			d.tfPluginClient.State.CurrentNodeDeployments[gw.NodeID] = append(d.tfPluginClient.State.CurrentNodeDeployments[gw.NodeID], gw.ContractID)
-		}
+		d.tfPluginClient.State.StoreContractIDs(gw.NodeID, gw.ContractID)
+		storeDeploymentsInfo(d.tfPluginClient.State, gw.NodeDeploymentID, newDeployments)
 	}
 
 	return d.tfPluginClient.sentry.error(err)
@@ -125,6 +125,7 @@ func (d *GatewayNameDeployer) BatchDeploy(ctx context.Context, gws []*workloads.
 			if err != nil {
 				return d.tfPluginClient.sentry.error(err)
 			}
+			d.tfPluginClient.observers.emit(Event{Type: EventContractCreated, ContractID: gw.NameContractID, Message: fmt.Sprintf("name contract %s", gw.Name)})
 		}
 
 		for nodeID, dl := range dls {
@@ -148,10 +149,81 @@ func (d *GatewayNameDeployer) BatchDeploy(ctx context.Context, gws []*workloads.
 			return d.tfPluginClient.sentry.error(errors.Wrapf(err, "failed to update gateway fqdn '%s' state", gw.Name))
 		}
 	}
+	storeBatchDeploymentsInfo(d.tfPluginClient.State, newDls)
 
 	return d.tfPluginClient.sentry.error(err)
 }
 
+// Plan returns the changes deploying the GatewayName would make without sending any extrinsic
+func (d *GatewayNameDeployer) Plan(ctx context.Context, gw *workloads.GatewayNameProxy) (Plan, error) {
+	if err := d.Validate(ctx, gw); err != nil {
+		return Plan{}, d.tfPluginClient.sentry.error(err)
+	}
+
+	newDeployments, err := d.generateVersionlessDeployments(gw)
+	if err != nil {
+		return Plan{}, d.tfPluginClient.sentry.error(errors.Wrap(err, "could not generate deployments data"))
+	}
+
+	plan, err := planDeployments(ctx, d.tfPluginClient, d.deployer, gw.NodeDeploymentID, newDeployments)
+	if err != nil {
+		return Plan{}, d.tfPluginClient.sentry.error(err)
+	}
+
+	needed, err := d.needsNameContract(gw)
+	if needed {
+		plan.NameContracts = append(plan.NameContracts, gw.Name)
+	}
+
+	return plan, d.tfPluginClient.sentry.error(err)
+}
+
+// BatchPlan returns the changes batch deploying the GatewayNames would make without sending any extrinsic
+func (d *GatewayNameDeployer) BatchPlan(ctx context.Context, gws []*workloads.GatewayNameProxy) (Plan, error) {
+	newDeployments := make(map[uint32][]zosTypes.Deployment)
+	var nameContracts []string
+
+	for _, gw := range gws {
+		if err := d.Validate(ctx, gw); err != nil {
+			return Plan{}, d.tfPluginClient.sentry.error(err)
+		}
+
+		dls, err := d.generateVersionlessDeployments(gw)
+		if err != nil {
+			return Plan{}, d.tfPluginClient.sentry.error(errors.Wrap(err, "could not generate deployments data"))
+		}
+
+		needed, err := d.needsNameContract(gw)
+		if err != nil {
+			return Plan{}, d.tfPluginClient.sentry.error(err)
+		}
+		if needed {
+			nameContracts = append(nameContracts, gw.Name)
+		}
+
+		for nodeID, dl := range dls {
+			newDeployments[nodeID] = append(newDeployments[nodeID], dl)
+		}
+	}
+
+	plan, err := planBatchDeployments(ctx, d.tfPluginClient, newDeployments)
+	plan.NameContracts = nameContracts
+	return plan, d.tfPluginClient.sentry.error(err)
+}
+
+// needsNameContract checks if deploying the gateway creates a new name contract
+func (d *GatewayNameDeployer) needsNameContract(gw *workloads.GatewayNameProxy) (bool, error) {
+	if gw.NameContractID == 0 {
+		return true, nil
+	}
+
+	valid, err := d.tfPluginClient.SubstrateConn.IsValidContract(gw.NameContractID)
+	if err != nil {
+		return false, errors.Wrapf(err, "could not check name contract %d", gw.NameContractID)
+	}
+	return !valid, nil
+}
+
 // Cancel cancels the gatewayName deployment
 func (d *GatewayNameDeployer) Cancel(ctx context.Context, gw *workloads.GatewayNameProxy) (err error) {
 	contractID := gw.NodeDeploymentID[gw.NodeID]
@@ -162,7 +234,7 @@ func (d *GatewayNameDeployer) Cancel(ctx context.Context, gw *workloads.GatewayN
 
 	gw.ContractID = 0
 	delete(gw.NodeDeploymentID, gw.NodeID)
-	d.tfPluginClient.State.CurrentNodeDeployments[gw.NodeID] = workloads.Delete(d.tfPluginClient.State.CurrentNodeDeployments[gw.NodeID], contractID)
+	d.tfPluginClient.State.RemoveContractIDs(gw.NodeID, contractID)
 
 	if gw.NameContractID != 0 {
 		if err := d.tfPluginClient.SubstrateConn.EnsureContractCanceled(d.tfPluginClient.Identity, gw.NameContractID); err != nil {
@@ -190,9 +262,7 @@ func (d *GatewayNameDeployer) updateStateFromDeployments(gw *workloads.GatewayNa
 
 	if contractID, ok := gw.NodeDeploymentID[gw.NodeID]; ok && contractID != 0 {
 		gw.ContractID = contractID
-		if !workloads.Contains(d.tfPluginClient.State.CurrentNodeDeployments[gw.NodeID], gw.ContractID) {
-			d.tfPluginClient.State.CurrentNodeDeployments[gw.NodeID] = append(d.tfPluginClient.State.CurrentNodeDeployments[gw.NodeID], gw.ContractID)
-		}
+		d.tfPluginClient.State.StoreContractIDs(gw.NodeID, gw.ContractID)
 	}
 
 	return nil
@@ -241,7 +311,8 @@ func (d *GatewayNameDeployer) Sync(ctx context.Context, gw *workloads.GatewayNam
 		return d.tfPluginClient.sentry.error(errors.Wrap(err, "could not get deployment objects"))
 	}
 	dl := dls[gw.NodeID]
-	wl, _ := dl.Get(gw.Name)
+	workloadName := gw.ZosWorkload().Name
+	wl, _ := dl.Get(workloadName.String())
 
 	gwWorkload := workloads.GatewayNameProxy{}
 	gw.Backends = gwWorkload.Backends
@@ -0,0 +1,497 @@
+package deployer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+)
+
+const (
+	defaultAutoscaleTolerance = 0.1
+	defaultWorkerNamePrefix   = "worker"
+	k8sNodeMetricsPath        = "/apis/metrics.k8s.io/v1beta1/nodes"
+)
+
+// K8sWorkerUsage is the resource usage of a k8s worker as ratios of its capacity
+type K8sWorkerUsage struct {
+	CPU    float64 `json:"cpu"`
+	Memory float64 `json:"memory"`
+}
+
+// K8sMetricsSource reports the resource usage of the workers of a k8s cluster by worker name
+type K8sMetricsSource interface {
+	WorkersUsage(ctx context.Context, cluster *workloads.K8sCluster) (map[string]K8sWorkerUsage, error)
+}
+
+// K8sAutoscalePolicy configures how a k8s autoscaler sizes the workers of a cluster
+type K8sAutoscalePolicy struct {
+	MinWorkers int
+	MaxWorkers int
+	// TargetUsage is the average worker usage ratio the autoscaler keeps the cluster around, e.g. 0.6
+	TargetUsage float64
+	// Tolerance is the ratio around the target usage where the cluster is not scaled, defaults to 0.1
+	Tolerance float64
+	// DrainPeriod is how long the workers have to stay under used before they are removed
+	DrainPeriod time.Duration
+	// Worker is the spec of added workers, defaults to the spec of the last worker
+	Worker *workloads.K8sNode
+	// WorkerNamePrefix prefixes the names of added workers, defaults to worker
+	WorkerNamePrefix string
+	// NodeFilter selects the nodes of added workers
+	NodeFilter types.NodeFilter
+}
+
+// K8sScaleDecision is the outcome of a k8s autoscaler reconciliation
+type K8sScaleDecision struct {
+	Workers int
+	Desired int
+	// Usage is the average usage ratio of the workers, the highest of cpu and memory
+	Usage   float64
+	Added   []string
+	Removed []string
+	// DrainingUntil is set while removing workers waits for the drain period
+	DrainingUntil time.Time
+}
+
+// K8sAutoscaler adds and removes the workers of a deployed k8s cluster to keep their usage around a target
+type K8sAutoscaler struct {
+	client  *TFPluginClient
+	cluster *workloads.K8sCluster
+	network *workloads.ZNet
+	metrics K8sMetricsSource
+	policy  K8sAutoscalePolicy
+
+	now           func() time.Time
+	drainingSince time.Time
+	// nodes added to the network by the autoscaler
+	addedNodes map[uint32]bool
+}
+
+// NewK8sAutoscaler creates an autoscaler for a deployed k8s cluster,
+// the nodes of added workers are added to the network of the cluster
+func NewK8sAutoscaler(client *TFPluginClient, cluster *workloads.K8sCluster, network *workloads.ZNet, metrics K8sMetricsSource, policy K8sAutoscalePolicy) (*K8sAutoscaler, error) {
+	if cluster.Master == nil || len(cluster.NodeDeploymentID) == 0 {
+		return nil, errors.New("k8s cluster must be deployed to be autoscaled")
+	}
+	if network == nil || network.Name != cluster.NetworkName {
+		return nil, fmt.Errorf("network %s of the k8s cluster is required", cluster.NetworkName)
+	}
+	if metrics == nil {
+		return nil, errors.New("k8s metrics source is required")
+	}
+
+	if policy.MinWorkers < 0 || policy.MaxWorkers < policy.MinWorkers || policy.MaxWorkers == 0 {
+		return nil, fmt.Errorf("invalid workers range [%d, %d]", policy.MinWorkers, policy.MaxWorkers)
+	}
+	if policy.TargetUsage <= 0 || policy.TargetUsage > 1 {
+		return nil, fmt.Errorf("target usage %f must be in (0, 1]", policy.TargetUsage)
+	}
+	if policy.Tolerance == 0 {
+		policy.Tolerance = defaultAutoscaleTolerance
+	}
+	if policy.WorkerNamePrefix == "" {
+		policy.WorkerNamePrefix = defaultWorkerNamePrefix
+	}
+	if policy.Worker == nil {
+		if len(cluster.Workers) == 0 {
+			return nil, errors.New("worker spec is required for clusters without workers")
+		}
+		worker := cluster.Workers[len(cluster.Workers)-1]
+		policy.Worker = &worker
+	}
+	if policy.Worker.VM == nil {
+		return nil, errors.New("worker spec is missing its vm")
+	}
+
+	return &K8sAutoscaler{
+		client:     client,
+		cluster:    cluster,
+		network:    network,
+		metrics:    metrics,
+		policy:     policy,
+		now:        time.Now,
+		addedNodes: make(map[uint32]bool),
+	}, nil
+}
+
+// Run reconciles the cluster every interval until the context is done
+func (a *K8sAutoscaler) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		decision, err := a.Reconcile(ctx)
+		if err != nil {
+			log.Error().Err(err).Str("master", a.cluster.Master.Name).Msg("failed to autoscale k8s cluster")
+		} else if len(decision.Added) != 0 || len(decision.Removed) != 0 {
+			log.Info().Strs("added", decision.Added).Strs("removed", decision.Removed).Float64("usage", decision.Usage).Msg("autoscaled k8s cluster")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Reconcile reads the usage of the workers once and scales the cluster if needed.
+// workers are added right away, but removed only once the cluster stayed under used for the drain period
+func (a *K8sAutoscaler) Reconcile(ctx context.Context) (K8sScaleDecision, error) {
+	current := len(a.cluster.Workers)
+	decision := K8sScaleDecision{Workers: current, Desired: current}
+
+	usage, err := a.metrics.WorkersUsage(ctx, a.cluster)
+	if err != nil {
+		return decision, errors.Wrap(err, "failed to get k8s workers usage")
+	}
+
+	decision.Usage = a.averageUsage(usage)
+	decision.Desired = a.desiredWorkers(current, decision.Usage)
+
+	switch {
+	case decision.Desired > current:
+		a.drainingSince = time.Time{}
+		decision.Added, err = a.scaleUp(ctx, decision.Desired-current)
+		return decision, err
+
+	case decision.Desired < current:
+		now := a.now()
+		if a.drainingSince.IsZero() {
+			a.drainingSince = now
+		}
+		if drained := a.drainingSince.Add(a.policy.DrainPeriod); now.Before(drained) {
+			decision.DrainingUntil = drained
+			return decision, nil
+		}
+
+		a.drainingSince = time.Time{}
+		decision.Removed, err = a.scaleDown(ctx, current-decision.Desired)
+		return decision, err
+	}
+
+	a.drainingSince = time.Time{}
+	return decision, nil
+}
+
+// averageUsage returns the average usage of the workers reporting metrics, the target usage if none does
+func (a *K8sAutoscaler) averageUsage(usage map[string]K8sWorkerUsage) float64 {
+	var total float64
+	var count int
+	for _, worker := range a.cluster.Workers {
+		u, ok := usage[worker.Name]
+		if !ok {
+			continue
+		}
+		total += math.Max(u.CPU, u.Memory)
+		count++
+	}
+
+	if count == 0 {
+		return a.policy.TargetUsage
+	}
+	return total / float64(count)
+}
+
+// desiredWorkers returns the workers count bringing the average usage to the target
+func (a *K8sAutoscaler) desiredWorkers(current int, usage float64) int {
+	desired := current
+	if ratio := usage / a.policy.TargetUsage; current != 0 && math.Abs(ratio-1) > a.policy.Tolerance {
+		desired = int(math.Ceil(float64(current) * ratio))
+	}
+
+	return min(max(desired, a.policy.MinWorkers), a.policy.MaxWorkers)
+}
+
+func (a *K8sAutoscaler) scaleUp(ctx context.Context, count int) ([]string, error) {
+	template := a.policy.Worker
+
+	filter := a.policy.NodeFilter
+	mru := template.MemoryMB * uint64(gridtypes.Megabyte)
+	sru := template.DiskSizeGB * uint64(gridtypes.Gigabyte)
+	filter.FreeMRU = &mru
+	filter.FreeSRU = &sru
+	if len(filter.Status) == 0 {
+		filter.Status = []string{"up"}
+	}
+
+	nodes, err := FilterNodes(ctx, *a.client, filter, []uint64{sru}, nil, nil, uint64(count))
+	if err != nil {
+		return nil, errors.Wrap(err, "could not find nodes for k8s workers")
+	}
+
+	networkNodes := slices.Clone(a.network.Nodes)
+	workers := a.cluster.Workers
+	var added []string
+	for i := 0; i < count; i++ {
+		nodeID := uint32(nodes[i%len(nodes)].NodeID)
+		if !slices.Contains(a.network.Nodes, nodeID) {
+			a.network.Nodes = append(a.network.Nodes, nodeID)
+		}
+
+		vm := *template.VM
+		vm.Name = a.workerName()
+		vm.NodeID = nodeID
+		vm.IP = ""
+		vm.ComputedIP, vm.ComputedIP6, vm.PlanetaryIP, vm.MyceliumIP, vm.ConsoleURL = "", "", "", "", ""
+		vm.MyceliumIPSeed = nil
+		vm.Zlogs = slices.Clone(template.Zlogs)
+		for j := range vm.Zlogs {
+			vm.Zlogs[j].Zmachine = vm.Name
+		}
+
+		a.cluster.Workers = append(a.cluster.Workers, workloads.K8sNode{VM: &vm, DiskSizeGB: template.DiskSizeGB})
+		added = append(added, vm.Name)
+	}
+
+	if len(a.network.Nodes) != len(networkNodes) {
+		if err := a.client.NetworkDeployer.Deploy(ctx, a.network); err != nil {
+			a.network.Nodes, a.cluster.Workers = networkNodes, workers
+			return nil, errors.Wrapf(err, "failed to add worker nodes to network %s", a.network.Name)
+		}
+		for _, node := range a.network.Nodes[len(networkNodes):] {
+			a.addedNodes[node] = true
+		}
+	}
+
+	if err := a.client.K8sDeployer.Deploy(ctx, a.cluster); err != nil {
+		// failed deployments are reverted by the deployer
+		a.cluster.Workers = workers
+		return nil, errors.Wrapf(err, "failed to add workers %v", added)
+	}
+
+	return added, nil
+}
+
+func (a *K8sAutoscaler) scaleDown(ctx context.Context, count int) ([]string, error) {
+	// the latest workers are removed first
+	kept := len(a.cluster.Workers) - count
+	var removed []string
+	for _, worker := range a.cluster.Workers[kept:] {
+		removed = append(removed, worker.Name)
+	}
+
+	workers := a.cluster.Workers
+	a.cluster.Workers = slices.Clone(workers[:kept])
+	if err := a.client.K8sDeployer.Deploy(ctx, a.cluster); err != nil {
+		a.cluster.Workers = workers
+		return nil, errors.Wrapf(err, "failed to remove workers %v", removed)
+	}
+
+	// remove the nodes the autoscaler added to the network once no worker uses them
+	used := make(map[uint32]bool)
+	for _, master := range a.cluster.MasterNodes() {
+		used[master.NodeID] = true
+	}
+	for _, worker := range a.cluster.Workers {
+		used[worker.NodeID] = true
+	}
+	nodes := slices.DeleteFunc(slices.Clone(a.network.Nodes), func(node uint32) bool {
+		return a.addedNodes[node] && !used[node]
+	})
+	if len(nodes) != len(a.network.Nodes) {
+		a.network.Nodes = nodes
+		if err := a.client.NetworkDeployer.Deploy(ctx, a.network); err != nil {
+			return removed, errors.Wrapf(err, "failed to remove unused nodes from network %s", a.network.Name)
+		}
+		for node := range a.addedNodes {
+			if !used[node] {
+				delete(a.addedNodes, node)
+			}
+		}
+	}
+
+	return removed, nil
+}
+
+// workerName returns the first free worker name with the policy prefix
+func (a *K8sAutoscaler) workerName() string {
+	names := make(map[string]bool)
+	for _, master := range a.cluster.MasterNodes() {
+		names[master.Name] = true
+	}
+	for _, worker := range a.cluster.Workers {
+		names[worker.Name] = true
+	}
+
+	for i := 0; ; i++ {
+		name := fmt.Sprintf("%s%d", a.policy.WorkerNamePrefix, i)
+		if !names[name] {
+			return name
+		}
+	}
+}
+
+// NodeStatisticsMetrics reports the usage of each worker as the used capacity of its node from the node statistics.
+// zos reports reserved capacity, so this tracks how loaded the worker nodes are rather than the load of the workers
+type NodeStatisticsMetrics struct {
+	client *TFPluginClient
+}
+
+// NewNodeStatisticsMetrics creates a metrics source reading the statistics of the worker nodes
+func NewNodeStatisticsMetrics(client *TFPluginClient) NodeStatisticsMetrics {
+	return NodeStatisticsMetrics{client: client}
+}
+
+// WorkersUsage returns the usage of the workers from the statistics of their nodes
+func (m NodeStatisticsMetrics) WorkersUsage(ctx context.Context, cluster *workloads.K8sCluster) (map[string]K8sWorkerUsage, error) {
+	nodes := make(map[uint32]K8sWorkerUsage)
+	usage := make(map[string]K8sWorkerUsage)
+	for _, worker := range cluster.Workers {
+		if u, ok := nodes[worker.NodeID]; ok {
+			usage[worker.Name] = u
+			continue
+		}
+
+		nodeClient, err := m.client.NcPool.GetNodeClient(m.client.SubstrateConn, worker.NodeID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not get node client for node %d", worker.NodeID)
+		}
+
+		total, used, err := nodeClient.Statistics(ctx)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not get statistics of node %d", worker.NodeID)
+		}
+
+		var u K8sWorkerUsage
+		if total.CRU != 0 {
+			u.CPU = float64(used.CRU) / float64(total.CRU)
+		}
+		if total.MRU != 0 {
+			u.Memory = float64(used.MRU) / float64(total.MRU)
+		}
+		nodes[worker.NodeID] = u
+		usage[worker.Name] = u
+	}
+
+	return usage, nil
+}
+
+// K8sMetricsAPI reports the usage of the workers from the kubernetes metrics api of the cluster, served by metrics-server
+type K8sMetricsAPI struct {
+	// URL of the kubernetes api server
+	URL string
+	// Token is a bearer token allowed to read node metrics
+	Token  string
+	Client *http.Client
+}
+
+type k8sNodeMetricsList struct {
+	Items []struct {
+		Metadata struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+		Usage struct {
+			CPU    string `json:"cpu"`
+			Memory string `json:"memory"`
+		} `json:"usage"`
+	} `json:"items"`
+}
+
+// WorkersUsage returns the usage of the workers relative to their cpu and memory
+func (m K8sMetricsAPI) WorkersUsage(ctx context.Context, cluster *workloads.K8sCluster) (map[string]K8sWorkerUsage, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(m.URL, "/")+k8sNodeMetricsPath, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create node metrics request")
+	}
+	if m.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+m.Token)
+	}
+
+	client := m.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	response, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get node metrics")
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get node metrics: %s", response.Status)
+	}
+
+	var metrics k8sNodeMetricsList
+	if err := json.NewDecoder(response.Body).Decode(&metrics); err != nil {
+		return nil, errors.Wrap(err, "failed to decode node metrics")
+	}
+
+	workers := make(map[string]*workloads.K8sNode)
+	for i := range cluster.Workers {
+		workers[cluster.Workers[i].Name] = &cluster.Workers[i]
+	}
+
+	usage := make(map[string]K8sWorkerUsage)
+	for _, item := range metrics.Items {
+		worker, ok := workers[item.Metadata.Name]
+		if !ok || worker.CPU == 0 || worker.MemoryMB == 0 {
+			continue
+		}
+
+		cpu, err := parseK8sQuantity(item.Usage.CPU)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid cpu usage of worker %s", worker.Name)
+		}
+		memory, err := parseK8sQuantity(item.Usage.Memory)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid memory usage of worker %s", worker.Name)
+		}
+
+		usage[worker.Name] = K8sWorkerUsage{
+			CPU:    cpu / float64(worker.CPU),
+			Memory: memory / float64(worker.MemoryMB*uint64(gridtypes.Megabyte)),
+		}
+	}
+
+	return usage, nil
+}
+
+var k8sQuantitySuffixes = map[string]float64{
+	"n":  1e-9,
+	"u":  1e-6,
+	"m":  1e-3,
+	"k":  1e3,
+	"M":  1e6,
+	"G":  1e9,
+	"T":  1e12,
+	"Ki": 1 << 10,
+	"Mi": 1 << 20,
+	"Gi": 1 << 30,
+	"Ti": 1 << 40,
+}
+
+// parseK8sQuantity parses kubernetes resource quantities like 250m or 512Mi
+func parseK8sQuantity(quantity string) (float64, error) {
+	number := strings.TrimRightFunc(quantity, func(r rune) bool {
+		return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+	})
+
+	multiplier := 1.0
+	if suffix := quantity[len(number):]; suffix != "" {
+		var ok bool
+		if multiplier, ok = k8sQuantitySuffixes[suffix]; !ok {
+			return 0, fmt.Errorf("unsupported quantity suffix '%s'", suffix)
+		}
+	}
+
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid quantity '%s'", quantity)
+	}
+
+	return value * multiplier, nil
+}
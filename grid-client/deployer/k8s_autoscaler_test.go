@@ -0,0 +1,190 @@
+package deployer
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/zos"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+)
+
+// staticMetrics reports the same usage for all the workers
+type staticMetrics struct {
+	usage float64
+}
+
+func (m *staticMetrics) WorkersUsage(ctx context.Context, cluster *workloads.K8sCluster) (map[string]K8sWorkerUsage, error) {
+	usage := make(map[string]K8sWorkerUsage)
+	for _, worker := range cluster.Workers {
+		usage[worker.Name] = K8sWorkerUsage{CPU: m.usage, Memory: m.usage / 2}
+	}
+	return usage, nil
+}
+
+func TestK8sAutoscaler(t *testing.T) {
+	// serves the k8s flist
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer hub.Close()
+
+	grid := newSimulatedGrid(t, 4)
+	tfPluginClient, err := NewTFPluginClient(simulationMnemonic, WithSimulation(grid))
+	require.NoError(t, err)
+	defer tfPluginClient.Close()
+
+	ctx := context.Background()
+	network := workloads.ZNet{
+		Name:  "k8snet",
+		Nodes: []uint32{1},
+		IPRange: zos.IPNet{IPNet: net.IPNet{
+			IP:   net.IPv4(10, 20, 0, 0),
+			Mask: net.CIDRMask(16, 32),
+		}},
+	}
+	require.NoError(t, tfPluginClient.NetworkDeployer.Deploy(ctx, &network))
+
+	node := func(name string) workloads.K8sNode {
+		return workloads.K8sNode{
+			VM:         &workloads.VM{Name: name, NodeID: 1, NetworkName: network.Name, CPU: 2, MemoryMB: 2048},
+			DiskSizeGB: 10,
+		}
+	}
+	master := node("master")
+	cluster := workloads.K8sCluster{
+		Master:      &master,
+		Workers:     []workloads.K8sNode{node("worker0")},
+		Token:       "token1234",
+		NetworkName: network.Name,
+		Flist:       hub.URL + "/k3s.flist",
+	}
+	require.NoError(t, tfPluginClient.K8sDeployer.Deploy(ctx, &cluster))
+
+	t.Run("node statistics", func(t *testing.T) {
+		usage, err := NewNodeStatisticsMetrics(&tfPluginClient).WorkersUsage(ctx, &cluster)
+		require.NoError(t, err)
+		assert.Greater(t, usage["worker0"].CPU, 0.0)
+		assert.Greater(t, usage["worker0"].Memory, 0.0)
+	})
+
+	metrics := &staticMetrics{}
+	autoscaler, err := NewK8sAutoscaler(&tfPluginClient, &cluster, &network, metrics, K8sAutoscalePolicy{
+		MinWorkers:  1,
+		MaxWorkers:  3,
+		TargetUsage: 0.5,
+		DrainPeriod: time.Hour,
+		NodeFilter:  types.NodeFilter{NodeIDs: []uint64{4}},
+	})
+	require.NoError(t, err)
+
+	now := time.Now()
+	autoscaler.now = func() time.Time { return now }
+
+	t.Run("within tolerance", func(t *testing.T) {
+		metrics.usage = 0.52
+		decision, err := autoscaler.Reconcile(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, decision.Desired)
+		assert.Empty(t, decision.Added)
+	})
+
+	t.Run("scale up", func(t *testing.T) {
+		metrics.usage = 0.9
+		decision, err := autoscaler.Reconcile(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"worker1"}, decision.Added)
+		require.Len(t, cluster.Workers, 2)
+		assert.Equal(t, uint32(4), cluster.Workers[1].NodeID)
+		assert.Contains(t, network.Nodes, uint32(4))
+		assert.NotEmpty(t, cluster.Workers[1].IP)
+		assert.Len(t, grid.Contracts(tfPluginClient.TwinID), 4)
+	})
+
+	t.Run("scale up is capped", func(t *testing.T) {
+		metrics.usage = 2
+		decision, err := autoscaler.Reconcile(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 3, decision.Desired)
+		assert.Len(t, cluster.Workers, 3)
+	})
+
+	t.Run("scale down waits for the drain period", func(t *testing.T) {
+		metrics.usage = 0.1
+		decision, err := autoscaler.Reconcile(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, decision.Desired)
+		assert.Equal(t, now.Add(time.Hour), decision.DrainingUntil)
+		assert.Len(t, cluster.Workers, 3)
+
+		now = now.Add(time.Hour)
+		decision, err = autoscaler.Reconcile(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"worker1", "worker2"}, decision.Removed)
+		assert.Equal(t, []string{"worker0"}, []string{cluster.Workers[0].Name})
+		assert.Equal(t, []uint32{1}, network.Nodes)
+		assert.Len(t, grid.Contracts(tfPluginClient.TwinID), 2)
+	})
+
+	t.Run("usage recovering cancels the drain", func(t *testing.T) {
+		metrics.usage = 0.9
+		_, err := autoscaler.Reconcile(ctx)
+		require.NoError(t, err)
+		require.Len(t, cluster.Workers, 2)
+
+		metrics.usage = 0.1
+		decision, err := autoscaler.Reconcile(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, now.Add(time.Hour), decision.DrainingUntil)
+
+		metrics.usage = 0.5
+		decision, err = autoscaler.Reconcile(ctx)
+		require.NoError(t, err)
+		assert.True(t, decision.DrainingUntil.IsZero())
+
+		now = now.Add(time.Hour)
+		metrics.usage = 0.1
+		decision, err = autoscaler.Reconcile(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, decision.Removed)
+		assert.Equal(t, now.Add(time.Hour), decision.DrainingUntil)
+		assert.Len(t, cluster.Workers, 2)
+	})
+}
+
+func TestK8sMetricsAPI(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != k8sNodeMetricsPath || r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"items": [
+			{"metadata": {"name": "master"}, "usage": {"cpu": "1", "memory": "1Gi"}},
+			{"metadata": {"name": "worker0"}, "usage": {"cpu": "500000000n", "memory": "1024Mi"}},
+			{"metadata": {"name": "worker1"}, "usage": {"cpu": "1500m", "memory": "524288Ki"}}
+		]}`))
+	}))
+	defer server.Close()
+
+	cluster := workloads.K8sCluster{Workers: []workloads.K8sNode{
+		{VM: &workloads.VM{Name: "worker0", CPU: 2, MemoryMB: 2048}},
+		{VM: &workloads.VM{Name: "worker1", CPU: 2, MemoryMB: 2048}},
+	}}
+
+	usage, err := K8sMetricsAPI{URL: server.URL, Token: "secret"}.WorkersUsage(context.Background(), &cluster)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]K8sWorkerUsage{
+		"worker0": {CPU: 0.25, Memory: 0.5},
+		"worker1": {CPU: 0.75, Memory: 0.25},
+	}, usage)
+
+	_, err = K8sMetricsAPI{URL: server.URL}.WorkersUsage(context.Background(), &cluster)
+	assert.Error(t, err)
+
+	_, err = parseK8sQuantity("5Pi")
+	assert.Error(t, err)
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"slices"
 
 	"github.com/pkg/errors"
 	zerolog "github.com/rs/zerolog/log"
@@ -51,7 +52,9 @@ func (d *K8sDeployer) Validate(ctx context.Context, k8sCluster *workloads.K8sClu
 
 	// validate cluster nodes
 	var nodes []uint32
-	nodes = append(nodes, k8sCluster.Master.NodeID)
+	for _, master := range k8sCluster.MasterNodes() {
+		nodes = append(nodes, master.NodeID)
+	}
 	for _, worker := range k8sCluster.Workers {
 		if !workloads.Contains(nodes, worker.NodeID) {
 			nodes = append(nodes, worker.NodeID)
@@ -67,20 +70,8 @@ func (d *K8sDeployer) generateVersionlessDeployments(k8sCluster *workloads.K8sCl
 		return nil, errors.Wrap(err, "failed to assign node ips")
 	}
 	deployments := make(map[uint32]zosTypes.Deployment)
-	nodeWorkloads := make(map[uint32][]zosTypes.Workload)
-
-	masterWorkloads := k8sCluster.Master.MasterZosWorkload(k8sCluster)
-	for _, m := range masterWorkloads {
-		nodeWorkloads[k8sCluster.Master.NodeID] = append(nodeWorkloads[k8sCluster.Master.NodeID], zosTypes.NewWorkloadFromZosWorkload(m))
-	}
-	for _, w := range k8sCluster.Workers {
-		workerWorkloads := w.WorkerZosWorkload(k8sCluster)
-		for _, wr := range workerWorkloads {
-			nodeWorkloads[w.NodeID] = append(nodeWorkloads[w.NodeID], zosTypes.NewWorkloadFromZosWorkload(wr))
-		}
-	}
 
-	for node, ws := range nodeWorkloads {
+	for node, ws := range k8sWorkloads(k8sCluster) {
 		dl := workloads.NewGridDeployment(d.tfPluginClient.TwinID, 0, ws)
 		dl.Metadata, err = k8sCluster.GenerateMetadata()
 		if err != nil {
@@ -92,6 +83,26 @@ func (d *K8sDeployer) generateVersionlessDeployments(k8sCluster *workloads.K8sCl
 	return deployments, nil
 }
 
+// k8sWorkloads returns the grid workloads of a k8s cluster grouped by node
+func k8sWorkloads(k8sCluster *workloads.K8sCluster) map[uint32][]zosTypes.Workload {
+	nodeWorkloads := make(map[uint32][]zosTypes.Workload)
+
+	for _, master := range k8sCluster.MasterNodes() {
+		masterWorkloads := master.MasterZosWorkload(k8sCluster)
+		for _, m := range masterWorkloads {
+			nodeWorkloads[master.NodeID] = append(nodeWorkloads[master.NodeID], zosTypes.NewWorkloadFromZosWorkload(m))
+		}
+	}
+	for _, w := range k8sCluster.Workers {
+		workerWorkloads := w.WorkerZosWorkload(k8sCluster)
+		for _, wr := range workerWorkloads {
+			nodeWorkloads[w.NodeID] = append(nodeWorkloads[w.NodeID], zosTypes.NewWorkloadFromZosWorkload(wr))
+		}
+	}
+
+	return nodeWorkloads
+}
+
 // Deploy deploys a k8s cluster deployment
 func (d *K8sDeployer) Deploy(ctx context.Context, k8sCluster *workloads.K8sCluster) error {
 	if err := d.tfPluginClient.State.AssignNodesIPRange(k8sCluster); err != nil {
@@ -123,9 +134,13 @@ func (d *K8sDeployer) Deploy(ctx context.Context, k8sCluster *workloads.K8sClust
 	// error is not returned immediately before updating state because of untracked failed deployments
 	if contractID, ok := k8sCluster.NodeDeploymentID[k8sCluster.Master.NodeID]; ok && contractID != 0 {
 		d.tfPluginClient.State.StoreContractIDs(k8sCluster.Master.NodeID, contractID)
+		for _, m := range k8sCluster.Masters {
+			d.tfPluginClient.State.StoreContractIDs(m.NodeID, k8sCluster.NodeDeploymentID[m.NodeID])
+		}
 		for _, w := range k8sCluster.Workers {
 			d.tfPluginClient.State.StoreContractIDs(w.NodeID, k8sCluster.NodeDeploymentID[w.NodeID])
 		}
+		storeDeploymentsInfo(d.tfPluginClient.State, k8sCluster.NodeDeploymentID, newDeployments)
 	}
 
 	return err
@@ -178,19 +193,71 @@ func (d *K8sDeployer) BatchDeploy(ctx context.Context, k8sClusters []*workloads.
 			return d.tfPluginClient.sentry.error(errors.Wrapf(err, "failed to update cluster with master name '%s' state", k8sCluster.Master.Name))
 		}
 	}
+	storeBatchDeploymentsInfo(d.tfPluginClient.State, newDls)
 
 	return d.tfPluginClient.sentry.error(err)
 }
 
+// Plan returns the changes deploying the k8s cluster would make without sending any extrinsic
+func (d *K8sDeployer) Plan(ctx context.Context, k8sCluster *workloads.K8sCluster) (Plan, error) {
+	newDeployments, err := d.prepareDeployments(ctx, k8sCluster)
+	if err != nil {
+		return Plan{}, d.tfPluginClient.sentry.error(err)
+	}
+
+	plan, err := planDeployments(ctx, d.tfPluginClient, d.deployer, k8sCluster.NodeDeploymentID, newDeployments)
+	return plan, d.tfPluginClient.sentry.error(err)
+}
+
+// BatchPlan returns the changes batch deploying the k8s clusters would make without sending any extrinsic
+func (d *K8sDeployer) BatchPlan(ctx context.Context, k8sClusters []*workloads.K8sCluster) (Plan, error) {
+	newDeployments := make(map[uint32][]zosTypes.Deployment)
+
+	for _, k8sCluster := range k8sClusters {
+		dls, err := d.prepareDeployments(ctx, k8sCluster)
+		if err != nil {
+			return Plan{}, d.tfPluginClient.sentry.error(err)
+		}
+
+		for nodeID, dl := range dls {
+			newDeployments[nodeID] = append(newDeployments[nodeID], dl)
+		}
+	}
+
+	plan, err := planBatchDeployments(ctx, d.tfPluginClient, newDeployments)
+	return plan, d.tfPluginClient.sentry.error(err)
+}
+
+// prepareDeployments validates the cluster and generates its grid deployments the same way deploying does
+func (d *K8sDeployer) prepareDeployments(ctx context.Context, k8sCluster *workloads.K8sCluster) (map[uint32]zosTypes.Deployment, error) {
+	if err := d.tfPluginClient.State.AssignNodesIPRange(k8sCluster); err != nil {
+		return nil, err
+	}
+
+	if err := k8sCluster.InvalidateBrokenAttributes(d.tfPluginClient.SubstrateConn); err != nil {
+		return nil, err
+	}
+
+	assignNodesFlistsAndEntryPoints(k8sCluster)
+
+	if err := d.Validate(ctx, k8sCluster); err != nil {
+		return nil, err
+	}
+
+	newDeployments, err := d.generateVersionlessDeployments(k8sCluster)
+	return newDeployments, errors.Wrap(err, "could not generate k8s grid deployments")
+}
+
 // Cancel cancels a k8s cluster deployment
 func (d *K8sDeployer) Cancel(ctx context.Context, k8sCluster *workloads.K8sCluster) (err error) {
+	masters := k8sCluster.MasterNodes()
 	for nodeID, contractID := range k8sCluster.NodeDeploymentID {
-		if k8sCluster.Master.NodeID == nodeID {
+		if idx := slices.IndexFunc(masters, func(m workloads.K8sNode) bool { return m.NodeID == nodeID }); idx >= 0 {
 			err = d.deployer.Cancel(ctx, contractID)
 			if err != nil {
-				return d.tfPluginClient.sentry.error(errors.Wrapf(err, "could not cancel master %s, contract %d", k8sCluster.Master.Name, contractID))
+				return d.tfPluginClient.sentry.error(errors.Wrapf(err, "could not cancel master %s, contract %d", masters[idx].Name, contractID))
 			}
-			d.tfPluginClient.State.CurrentNodeDeployments[nodeID] = workloads.Delete(d.tfPluginClient.State.CurrentNodeDeployments[nodeID], contractID)
+			d.tfPluginClient.State.RemoveContractIDs(nodeID, contractID)
 			delete(k8sCluster.NodeDeploymentID, nodeID)
 			continue
 		}
@@ -200,7 +267,7 @@ func (d *K8sDeployer) Cancel(ctx context.Context, k8sCluster *workloads.K8sClust
 				if err != nil {
 					return d.tfPluginClient.sentry.error(errors.Wrapf(err, "could not cancel worker %s, contract %d", worker.Name, contractID))
 				}
-				d.tfPluginClient.State.CurrentNodeDeployments[nodeID] = workloads.Delete(d.tfPluginClient.State.CurrentNodeDeployments[nodeID], contractID)
+				d.tfPluginClient.State.RemoveContractIDs(nodeID, contractID)
 				delete(k8sCluster.NodeDeploymentID, nodeID)
 				break
 			}
@@ -211,7 +278,10 @@ func (d *K8sDeployer) Cancel(ctx context.Context, k8sCluster *workloads.K8sClust
 }
 
 func (d *K8sDeployer) updateStateFromDeployments(k8sCluster *workloads.K8sCluster, newDl map[uint32][]zosTypes.Deployment) error {
-	k8sNodes := []uint32{k8sCluster.Master.NodeID}
+	k8sNodes := []uint32{}
+	for _, m := range k8sCluster.MasterNodes() {
+		k8sNodes = append(k8sNodes, m.NodeID)
+	}
 	for _, w := range k8sCluster.Workers {
 		k8sNodes = append(k8sNodes, w.NodeID)
 	}
@@ -226,19 +296,18 @@ func (d *K8sDeployer) updateStateFromDeployments(k8sCluster *workloads.K8sCluste
 			}
 
 			if dlData.Name == k8sCluster.Master.Name {
-				k8sCluster.NodeDeploymentID[k8sCluster.Master.NodeID] = newDl.ContractID
+				k8sCluster.NodeDeploymentID[k8sNode] = newDl.ContractID
 			}
 		}
 	}
 
 	if contractID, ok := k8sCluster.NodeDeploymentID[k8sCluster.Master.NodeID]; ok && contractID != 0 {
-		if !workloads.Contains(d.tfPluginClient.State.CurrentNodeDeployments[k8sCluster.Master.NodeID], contractID) {
-			d.tfPluginClient.State.CurrentNodeDeployments[k8sCluster.Master.NodeID] = append(d.tfPluginClient.State.CurrentNodeDeployments[k8sCluster.Master.NodeID], contractID)
+		d.tfPluginClient.State.StoreContractIDs(k8sCluster.Master.NodeID, contractID)
+		for _, m := range k8sCluster.Masters {
+			d.tfPluginClient.State.StoreContractIDs(m.NodeID, k8sCluster.NodeDeploymentID[m.NodeID])
 		}
 		for _, w := range k8sCluster.Workers {
-			if !workloads.Contains(d.tfPluginClient.State.CurrentNodeDeployments[w.NodeID], k8sCluster.NodeDeploymentID[w.NodeID]) {
-				d.tfPluginClient.State.CurrentNodeDeployments[w.NodeID] = append(d.tfPluginClient.State.CurrentNodeDeployments[w.NodeID], k8sCluster.NodeDeploymentID[w.NodeID])
-			}
+			d.tfPluginClient.State.StoreContractIDs(w.NodeID, k8sCluster.NodeDeploymentID[w.NodeID])
 		}
 	}
 
@@ -295,6 +364,7 @@ func (d *K8sDeployer) UpdateFromRemote(ctx context.Context, k8sCluster *workload
 	workloadComputedIP := make(map[string]string)
 	workloadComputedIP6 := make(map[string]string)
 	workloadObj := make(map[string]gridtypes.Workload)
+	workloadZlogs := make(map[string][]workloads.Zlog)
 
 	publicIPs := make(map[string]string)
 	publicIP6s := make(map[string]string)
@@ -304,6 +374,7 @@ func (d *K8sDeployer) UpdateFromRemote(ctx context.Context, k8sCluster *workload
 			if w.Type == zosTypes.ZMachineType {
 				workloadNodeID[w.Name] = node
 				workloadObj[w.Name] = *w.Workload3()
+				workloadZlogs[w.Name] = workloads.ZlogsFromDeployment(&dl, w.Name)
 
 			} else if w.Type == zosTypes.PublicIPType {
 				ipResult := zos.PublicIPResult{}
@@ -346,7 +417,29 @@ func (d *K8sDeployer) UpdateFromRemote(ctx context.Context, k8sCluster *workload
 		if err != nil {
 			return d.tfPluginClient.sentry.error(errors.Wrap(err, "failed to get master node from workload"))
 		}
+		m.Zlogs = workloadZlogs[k8sCluster.Master.Name]
 		k8sCluster.Master = &m
+		serverFlags, err := workloads.K3sServerFlags(masterWorkload)
+		if err != nil {
+			return d.tfPluginClient.sentry.error(errors.Wrap(err, "failed to get master server flags"))
+		}
+		k8sCluster.Endpoint = serverFlags[workloads.K3sTLSSANFlag]
+	}
+	// update additional masters
+	masters := make([]workloads.K8sNode, 0)
+	for _, m := range k8sCluster.Masters {
+		masterNodeID, ok := workloadNodeID[m.Name]
+		if !ok {
+			continue
+		}
+		delete(workloadNodeID, m.Name)
+
+		m, err := workloads.NewK8sNodeFromWorkload(workloadObj[m.Name], masterNodeID, workloadDiskSize[m.Name], workloadComputedIP[m.Name], workloadComputedIP6[m.Name])
+		if err != nil {
+			return d.tfPluginClient.sentry.error(errors.Wrap(err, "failed to get master node from workload"))
+		}
+		m.Zlogs = workloadZlogs[m.Name]
+		masters = append(masters, m)
 	}
 	// update workers
 	workers := make([]workloads.K8sNode, 0)
@@ -366,11 +459,12 @@ func (d *K8sDeployer) UpdateFromRemote(ctx context.Context, k8sCluster *workload
 		if err != nil {
 			return d.tfPluginClient.sentry.error(errors.Wrap(err, "failed to get worker data from workload"))
 		}
+		w.Zlogs = workloadZlogs[w.Name]
 		workers = append(workers, w)
 	}
-	// add missing workers (in case of failed deletions)
+	// add missing masters and workers (in case of failed deletions)
 	for name, workerNodeID := range workloadNodeID {
-		if name == k8sCluster.Master.Name {
+		if k8sCluster.Master != nil && name == k8sCluster.Master.Name {
 			continue
 		}
 		workerWorkload := workloadObj[name]
@@ -381,8 +475,14 @@ func (d *K8sDeployer) UpdateFromRemote(ctx context.Context, k8sCluster *workload
 		if err != nil {
 			return d.tfPluginClient.sentry.error(errors.Wrap(err, "failed to get worker data from workload"))
 		}
+		w.Zlogs = workloadZlogs[name]
+		if w.IsMaster() {
+			masters = append(masters, w)
+			continue
+		}
 		workers = append(workers, w)
 	}
+	k8sCluster.Masters = masters
 	k8sCluster.Workers = workers
 	zerolog.Debug().Msg("after updateFromRemote\n")
 	enc := json.NewEncoder(log.Writer())
@@ -415,10 +515,12 @@ func (d *K8sDeployer) removeDeletedContracts(k8sCluster *workloads.K8sCluster) e
 func (d *K8sDeployer) getK8sUsedIPs(k8s *workloads.K8sCluster) map[uint32][]byte {
 	usedIPs := make(map[uint32][]byte)
 
-	if k8s.Master.IP != "" {
-		ip := net.ParseIP(k8s.Master.IP).To4()
-		if ip != nil {
-			usedIPs[k8s.Master.NodeID] = append(usedIPs[k8s.Master.NodeID], ip[3])
+	for _, m := range k8s.MasterNodes() {
+		if m.IP != "" {
+			ip := net.ParseIP(m.IP).To4()
+			if ip != nil {
+				usedIPs[m.NodeID] = append(usedIPs[m.NodeID], ip[3])
+			}
 		}
 	}
 
@@ -462,6 +564,17 @@ func (d *K8sDeployer) assignNodesIPs(k8sCluster *workloads.K8sCluster) error {
 		}
 		k8sCluster.Master.IP = ip
 	}
+	for idx, m := range k8sCluster.Masters {
+		masterNodeRange := k8sCluster.NodesIPRange[m.NodeID]
+		if m.IP != "" && masterNodeRange.Contains(net.ParseIP(m.IP)) {
+			continue
+		}
+		ip, err := d.getK8sFreeIP(masterNodeRange, m.NodeID, k8sCluster)
+		if err != nil {
+			return errors.Wrap(err, "failed to find free ip for master")
+		}
+		k8sCluster.Masters[idx].IP = ip
+	}
 	for idx, w := range k8sCluster.Workers {
 		workerNodeRange := k8sCluster.NodesIPRange[w.NodeID]
 		if w.IP != "" && workerNodeRange.Contains(net.ParseIP(w.IP)) {
@@ -481,15 +594,20 @@ func assignNodesFlistsAndEntryPoints(k *workloads.K8sCluster) {
 		k.Flist = k.Master.Flist
 	}
 	if k.Entrypoint == "" {
-		if k.Master.Entrypoint != "" {
+		// a master running k3s server can't share its command with the other nodes
+		if k.Master.Entrypoint != "" && !workloads.IsK3sServerEntrypoint(k.Master.Entrypoint) {
 			k.Entrypoint = k.Master.Entrypoint
 		} else {
-			k.Entrypoint = "/sbin/zinit init" // set default value
+			k.Entrypoint = workloads.K8sFlistEntrypoint // set default value
 		}
 	}
 
 	k.Master.Flist = k.Flist
 	k.Master.Entrypoint = k.Entrypoint
+	for i := range k.Masters {
+		k.Masters[i].Flist = k.Flist
+		k.Masters[i].Entrypoint = k.Entrypoint
+	}
 	for i := range k.Workers {
 		k.Workers[i].Flist = k.Flist
 		k.Workers[i].Entrypoint = k.Entrypoint
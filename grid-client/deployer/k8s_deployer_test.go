@@ -5,12 +5,15 @@ import (
 	"fmt"
 	"math/big"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
 	"github.com/golang/mock/gomock"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
 	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/mocks"
 	client "github.com/threefoldtech/tfgrid-sdk-go/grid-client/node"
@@ -19,6 +22,7 @@ import (
 	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
 	zosTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-client/zos"
 	"github.com/threefoldtech/zos/pkg/gridtypes"
+	"github.com/threefoldtech/zos/pkg/gridtypes/zos"
 )
 
 func constructTestK8s(t *testing.T, mock bool) (
@@ -319,6 +323,111 @@ func TestK8sDeployer(t *testing.T) {
 	})
 }
 
+func TestK8sDeployerHA(t *testing.T) {
+	// serves the k8s flist
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer hub.Close()
+
+	grid := newSimulatedGrid(t, 3)
+	tfPluginClient, err := NewTFPluginClient(simulationMnemonic, WithSimulation(grid))
+	require.NoError(t, err)
+	defer tfPluginClient.Close()
+
+	ctx := context.Background()
+	network := workloads.ZNet{
+		Name:  "hanet",
+		Nodes: []uint32{1, 2, 3},
+		IPRange: zosTypes.IPNet{IPNet: net.IPNet{
+			IP:   net.IPv4(10, 20, 0, 0),
+			Mask: net.CIDRMask(16, 32),
+		}},
+	}
+	require.NoError(t, tfPluginClient.NetworkDeployer.Deploy(ctx, &network))
+
+	node := func(name string, nodeID uint32) workloads.K8sNode {
+		return workloads.K8sNode{
+			VM:         &workloads.VM{Name: name, NodeID: nodeID, NetworkName: network.Name, CPU: 2, MemoryMB: 2048},
+			DiskSizeGB: 10,
+		}
+	}
+	master := node("master", 1)
+	cluster := workloads.K8sCluster{
+		Master:      &master,
+		Masters:     []workloads.K8sNode{node("master1", 2)},
+		Workers:     []workloads.K8sNode{node("worker0", 1)},
+		Token:       "token1234",
+		NetworkName: network.Name,
+		Flist:       hub.URL + "/k3s.flist",
+		Endpoint:    "k8s.example.com",
+	}
+
+	t.Run("invalid masters", func(t *testing.T) {
+		assert.ErrorContains(t, tfPluginClient.K8sDeployer.Deploy(ctx, &cluster), "1, 3 or 5 masters")
+
+		cluster.Masters = append(cluster.Masters, node("master2", 2))
+		assert.ErrorContains(t, tfPluginClient.K8sDeployer.Deploy(ctx, &cluster), "different nodes")
+
+		// the masters run k3s server without the flist init authorizing ssh keys
+		cluster.SSHKey = "ssh-ed25519 key"
+		assert.ErrorContains(t, tfPluginClient.K8sDeployer.Deploy(ctx, &cluster), "ssh keys are not supported")
+		cluster.SSHKey = ""
+	})
+
+	cluster.Masters[1].NodeID = 3
+	require.NoError(t, tfPluginClient.K8sDeployer.Deploy(ctx, &cluster))
+	assert.Len(t, cluster.NodeDeploymentID, 3)
+
+	t.Run("load from grid", func(t *testing.T) {
+		loaded, err := tfPluginClient.State.LoadK8sFromGrid(ctx, network.Nodes, master.Name)
+		require.NoError(t, err)
+
+		assert.Equal(t, "master", loaded.Master.Name)
+		assert.Empty(t, loaded.Master.EnvVars["K3S_URL"])
+		require.Len(t, loaded.Masters, 2)
+		assert.Equal(t, "master1", loaded.Masters[0].Name)
+		assert.Equal(t, uint32(3), loaded.Masters[1].NodeID)
+		assert.Empty(t, loaded.Masters[0].EnvVars["K3S_URL"])
+		require.Len(t, loaded.Workers, 1)
+		assert.Equal(t, "https://k8s.example.com:6443", loaded.Workers[0].EnvVars["K3S_URL"])
+		assert.Equal(t, cluster.Endpoint, loaded.Endpoint)
+	})
+
+	t.Run("update from remote", func(t *testing.T) {
+		cluster.Masters = nil
+		require.NoError(t, tfPluginClient.K8sDeployer.UpdateFromRemote(ctx, &cluster))
+		require.Len(t, cluster.Masters, 2)
+		assert.Len(t, cluster.Workers, 1)
+		assert.Equal(t, "k8s.example.com", cluster.Endpoint)
+	})
+
+	t.Run("add worker to loaded cluster", func(t *testing.T) {
+		loaded, err := tfPluginClient.State.LoadK8sFromGrid(ctx, network.Nodes, master.Name)
+		require.NoError(t, err)
+		assert.Equal(t, workloads.K8sFlistEntrypoint, loaded.Entrypoint)
+
+		loaded.Workers = append(loaded.Workers, node("worker1", 2))
+		require.NoError(t, tfPluginClient.K8sDeployer.Deploy(ctx, &loaded))
+
+		dls, err := tfPluginClient.K8sDeployer.deployer.GetDeployments(ctx, map[uint32]uint64{2: loaded.NodeDeploymentID[2]})
+		require.NoError(t, err)
+		dl := dls[2]
+		wl, err := dl.Get("worker1")
+		require.NoError(t, err)
+		data, err := wl.Workload3().WorkloadData()
+		require.NoError(t, err)
+		vm := data.(*zos.ZMachine)
+		assert.Equal(t, workloads.K8sFlistEntrypoint, vm.Entrypoint)
+		assert.Equal(t, "https://k8s.example.com:6443", vm.Env["K3S_URL"])
+
+		cluster.NodeDeploymentID = loaded.NodeDeploymentID
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		require.NoError(t, tfPluginClient.K8sDeployer.Cancel(ctx, &cluster))
+		assert.Empty(t, cluster.NodeDeploymentID)
+	})
+}
+
 func ExampleK8sDeployer_Deploy() {
 	const mnemonic = "<mnemonics goes here>"
 	const network = "<dev, test, qa, main>"
@@ -0,0 +1,108 @@
+package deployer
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/simulation"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+	zosTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-client/zos"
+)
+
+func TestNetworkAccessPeers(t *testing.T) {
+	tfPluginClient, err := NewTFPluginClient(simulationMnemonic, WithSimulation(simulation.NewGrid()))
+	require.NoError(t, err)
+	defer tfPluginClient.Close()
+
+	ctx := context.Background()
+	network := workloads.ZNet{
+		Name:  "team",
+		Nodes: []uint32{1, 2},
+		IPRange: zosTypes.IPNet{IPNet: net.IPNet{
+			IP:   net.IPv4(10, 20, 0, 0),
+			Mask: net.CIDRMask(16, 32),
+		}},
+		AccessPeers: []workloads.WGAccessPeer{{Name: "alice"}, {Name: "bob"}},
+	}
+	require.NoError(t, tfPluginClient.NetworkDeployer.Deploy(ctx, &network))
+	require.NotNil(t, network.AccessSubnet)
+	require.NotZero(t, network.PublicNodeID)
+	assert.False(t, network.AddWGAccess)
+
+	versions := func() map[uint32]uint32 {
+		t.Helper()
+		versions := map[uint32]uint32{}
+		for nodeID, contractID := range network.NodeDeploymentID {
+			nodeClient, err := tfPluginClient.NcPool.GetNodeClient(tfPluginClient.SubstrateConn, nodeID)
+			require.NoError(t, err)
+			dl, err := nodeClient.DeploymentGet(ctx, contractID)
+			require.NoError(t, err)
+			versions[nodeID] = dl.Version
+		}
+		return versions
+	}
+
+	t.Run("peers", func(t *testing.T) {
+		alice, bob := network.AccessPeers[0], network.AccessPeers[1]
+		assert.True(t, network.AccessSubnet.Contains(alice.IP.IP))
+		assert.True(t, network.AccessSubnet.Contains(bob.IP.IP))
+		assert.NotEqual(t, alice.IP.String(), bob.IP.String())
+		assert.NotEqual(t, alice.PrivateKey, bob.PrivateKey)
+
+		config, err := network.AccessPeerConfig("alice")
+		require.NoError(t, err)
+		assert.Contains(t, config, "Address = "+alice.IP.IP.String())
+		assert.Contains(t, config, "PrivateKey = "+alice.PrivateKey.String())
+		assert.Contains(t, config, "PublicKey = "+network.Keys[network.PublicNodeID].PublicKey().String())
+	})
+
+	t.Run("add peer updates only the public node", func(t *testing.T) {
+		before := versions()
+		require.NoError(t, network.AddAccessPeer("carol"))
+		assert.Error(t, network.AddAccessPeer("carol"))
+		require.NoError(t, tfPluginClient.NetworkDeployer.Deploy(ctx, &network))
+
+		after := versions()
+		for nodeID, version := range before {
+			if nodeID == network.PublicNodeID {
+				assert.Greater(t, after[nodeID], version)
+				continue
+			}
+			assert.Equal(t, version, after[nodeID])
+		}
+	})
+
+	t.Run("revoke peer updates only the public node", func(t *testing.T) {
+		before := versions()
+		require.NoError(t, network.RevokeAccessPeer("bob"))
+		require.NoError(t, tfPluginClient.NetworkDeployer.Deploy(ctx, &network))
+
+		after := versions()
+		for nodeID, version := range before {
+			if nodeID == network.PublicNodeID {
+				assert.Greater(t, after[nodeID], version)
+				continue
+			}
+			assert.Equal(t, version, after[nodeID])
+		}
+	})
+
+	t.Run("load from grid", func(t *testing.T) {
+		loaded, err := tfPluginClient.State.LoadNetworkFromGrid(ctx, network.Name)
+		require.NoError(t, err)
+		assert.False(t, loaded.AddWGAccess)
+		assert.Equal(t, network.AccessSubnet.String(), loaded.AccessSubnet.String())
+		require.Len(t, loaded.AccessPeers, 2)
+
+		for i, peer := range loaded.AccessPeers {
+			assert.Equal(t, network.AccessPeers[i].Name, peer.Name)
+			assert.Equal(t, network.AccessPeers[i].PrivateKey, peer.PrivateKey)
+			assert.Equal(t, network.AccessPeers[i].IP.String(), peer.IP.String())
+			assert.Equal(t, strings.TrimSpace(network.AccessPeers[i].WGConfig), strings.TrimSpace(peer.WGConfig))
+		}
+	})
+}
@@ -132,6 +132,8 @@ func (d *NetworkDeployer) Deploy(ctx context.Context, znet workloads.Network) er
 		}
 	}
 
+	storeDeploymentsInfo(d.tfPluginClient.State, znet.GetNodeDeploymentID(), newDeployments)
+
 	for nodeID, contract := range oldDeployments {
 		// public node is removed
 		if _, ok := znet.GetNodeDeploymentID()[nodeID]; !ok {
@@ -191,10 +193,53 @@ func (d *NetworkDeployer) BatchDeploy(ctx context.Context, zNets []workloads.Net
 			return d.tfPluginClient.sentry.error(errors.Wrapf(err, "failed to update network '%s' state", znet.GetName()))
 		}
 	}
+	storeBatchDeploymentsInfo(d.tfPluginClient.State, newDls)
 
 	return d.tfPluginClient.sentry.error(multiErr)
 }
 
+// Plan returns the changes deploying the network would make without sending any extrinsic
+func (d *NetworkDeployer) Plan(ctx context.Context, znet workloads.Network) (Plan, error) {
+	zNets, err := d.Validate(ctx, []workloads.Network{znet})
+	if err != nil {
+		return Plan{}, d.tfPluginClient.sentry.error(err)
+	}
+
+	nodeDeployments, err := d.generateVersionlessDeployments(ctx, zNets)
+	if err != nil {
+		return Plan{}, d.tfPluginClient.sentry.error(errors.Wrap(err, "could not generate deployments data"))
+	}
+
+	newDeployments := make(map[uint32]zos.Deployment)
+	for node, deployments := range nodeDeployments {
+		if len(deployments) != 1 {
+			// this should never happen
+			log.Debug().Uint32("node id", node).Msgf("got number of deployment %d, should be 1", len(deployments))
+			continue
+		}
+		newDeployments[node] = deployments[0]
+	}
+
+	plan, err := planDeployments(ctx, d.tfPluginClient, d.deployer, znet.GetNodeDeploymentID(), newDeployments)
+	return plan, d.tfPluginClient.sentry.error(err)
+}
+
+// BatchPlan returns the changes batch deploying the networks would make without sending any extrinsic
+func (d *NetworkDeployer) BatchPlan(ctx context.Context, zNets []workloads.Network) (Plan, error) {
+	filteredZNets, err := d.Validate(ctx, zNets)
+	if err != nil {
+		return Plan{}, d.tfPluginClient.sentry.error(err)
+	}
+
+	newDeployments, err := d.generateVersionlessDeployments(ctx, filteredZNets)
+	if err != nil {
+		return Plan{}, d.tfPluginClient.sentry.error(errors.Wrap(err, "could not generate deployments data"))
+	}
+
+	plan, err := planBatchDeployments(ctx, d.tfPluginClient, newDeployments)
+	return plan, d.tfPluginClient.sentry.error(err)
+}
+
 // Cancel cancels all the deployments
 func (d *NetworkDeployer) Cancel(ctx context.Context, znet workloads.Network) error {
 	err := validateAccountBalanceForExtrinsics(d.tfPluginClient.SubstrateConn, d.tfPluginClient.Identity)
@@ -210,7 +255,7 @@ func (d *NetworkDeployer) Cancel(ctx context.Context, znet workloads.Network) er
 		znetDeploymentsIDs := znet.GetNodeDeploymentID()
 		delete(znetDeploymentsIDs, nodeID)
 		znet.SetNodeDeploymentID(znetDeploymentsIDs)
-		d.tfPluginClient.State.CurrentNodeDeployments[nodeID] = workloads.Delete(d.tfPluginClient.State.CurrentNodeDeployments[nodeID], contractID)
+		d.tfPluginClient.State.RemoveContractIDs(nodeID, contractID)
 	}
 
 	// delete network from state if all contracts was deleted
@@ -245,7 +290,7 @@ func (d *NetworkDeployer) BatchCancel(ctx context.Context, znets []workloads.Net
 	}
 	for _, znet := range znets {
 		for nodeID, contractID := range znet.GetNodeDeploymentID() {
-			d.tfPluginClient.State.CurrentNodeDeployments[nodeID] = workloads.Delete(d.tfPluginClient.State.CurrentNodeDeployments[nodeID], contractID)
+			d.tfPluginClient.State.RemoveContractIDs(nodeID, contractID)
 		}
 
 		d.tfPluginClient.State.Networks.DeleteNetwork(znet.GetName())
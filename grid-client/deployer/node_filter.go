@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"math"
 	"net"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
@@ -21,6 +22,14 @@ import (
 
 const requestedPagesPerIteration = 5
 
+const (
+	// DefaultCandidateNodesLimit is the maximum number of candidate nodes ranked by placement and packing,
+	// it is large enough to spread groups over many farms and countries
+	DefaultCandidateNodesLimit = 500
+	// candidateNodesPageSize is the proxy page size used to list candidate nodes
+	candidateNodesPageSize = 100
+)
+
 var ErrNoNodesMatchesResources = errors.New("could not find enough nodes with specified options")
 
 // FilterNodes filters nodes using proxy
@@ -114,6 +123,59 @@ func FilterNodes(ctx context.Context, tfPlugin TFPluginClient, options types.Nod
 	return []types.Node{}, ErrNoNodesMatchesResources
 }
 
+// FilterCandidateNodes returns up to maxNodes nodes matching the options going through the proxy pages in order.
+// unlike FilterNodes, it doesn't stop at the first page without a limit nor fails with a limit if fewer nodes match
+func FilterCandidateNodes(ctx context.Context, tfPlugin TFPluginClient, options types.NodeFilter, ssdDisks, hddDisks, rootfs []uint64, maxNodes uint64) ([]types.Node, error) {
+	if maxNodes == 0 {
+		maxNodes = DefaultCandidateNodesLimit
+	}
+
+	if options.AvailableFor == nil {
+		twinID := uint64(tfPlugin.TwinID)
+		options.AvailableFor = &twinID
+	}
+	options.Healthy = &trueVal
+
+	limit := types.Limit{Size: candidateNodesPageSize, RetCount: true}
+	pagesCount, err := getPagesCount(ctx, tfPlugin, options, limit)
+	if err != nil {
+		return []types.Node{}, tfPlugin.sentry.error(err)
+	}
+
+	var nodes []types.Node
+	for page := 1; page <= pagesCount && uint64(len(nodes)) < maxNodes; page++ {
+		limit.Page = uint64(page)
+
+		output := make(chan types.Node)
+		var pageErr error
+		go func() {
+			defer close(output)
+			pageErr = getNodes(ctx, tfPlugin, options, ssdDisks, hddDisks, rootfs, limit, output)
+		}()
+
+		for node := range output {
+			nodes = append(nodes, node)
+		}
+		if pageErr != nil {
+			return []types.Node{}, tfPlugin.sentry.error(pageErr)
+		}
+	}
+
+	if len(nodes) == 0 {
+		opts, err := serializeOptions(options)
+		if err != nil {
+			log.Debug().Err(err).Send()
+		}
+		log.Debug().Str("options", opts).Err(ErrNoNodesMatchesResources).Send()
+		return []types.Node{}, ErrNoNodesMatchesResources
+	}
+
+	if uint64(len(nodes)) > maxNodes {
+		nodes = nodes[:maxNodes]
+	}
+	return nodes, nil
+}
+
 func getNodes(ctx context.Context, tfPlugin TFPluginClient, options types.NodeFilter, ssdDisks, hddDisks, rootfs []uint64, limit types.Limit, output chan<- types.Node) error {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
@@ -127,6 +189,11 @@ func getNodes(ctx context.Context, tfPlugin TFPluginClient, options types.NodeFi
 		return nil
 	}
 
+	// capacity reserved by in-flight deployments of the client is not free
+	nodes = slices.DeleteFunc(nodes, func(node types.Node) bool {
+		return !tfPlugin.Reservations.fits(node, options)
+	})
+
 	// if no storage needed
 	if options.FreeSRU == nil && options.FreeHRU == nil {
 		for _, node := range nodes {
@@ -158,6 +225,7 @@ func getNodes(ctx context.Context, tfPlugin TFPluginClient, options types.NodeFi
 			log.Debug().Err(err).Int("node ID", node.NodeID).Msg("failed to get node pools")
 			continue
 		}
+		pools = tfPlugin.Reservations.reservedPools(uint32(node.NodeID), pools)
 
 		if !hasEnoughStorage(pools, hddDisks, zos.HDDDevice) {
 			log.Debug().Err(err).Int("node ID", node.NodeID).Msg("no enough HDDs in node")
@@ -253,6 +321,44 @@ func GetPublicNode(ctx context.Context, tfPlugin TFPluginClient, preferredNodes
 	return 0, errors.New("no nodes with public ipv4")
 }
 
+// FilterDistinctNodes returns count nodes matching the options with no two nodes in the same farm if distinctFarms is set.
+// the disks are the storage needed on each of the returned nodes
+func FilterDistinctNodes(ctx context.Context, tfPlugin TFPluginClient, options types.NodeFilter, count int, distinctFarms bool, ssdDisks, hddDisks, rootfs []uint64) ([]types.Node, error) {
+	if count <= 0 {
+		return []types.Node{}, nil
+	}
+
+	nodes, err := FilterNodes(ctx, tfPlugin, options, ssdDisks, hddDisks, rootfs)
+	if err != nil {
+		return []types.Node{}, err
+	}
+
+	farms := make(map[int]struct{})
+	seen := make(map[int]struct{})
+	distinct := make([]types.Node, 0, count)
+	for _, node := range nodes {
+		if _, ok := seen[node.NodeID]; ok {
+			continue
+		}
+		if _, ok := farms[node.FarmID]; ok && distinctFarms {
+			continue
+		}
+
+		seen[node.NodeID] = struct{}{}
+		farms[node.FarmID] = struct{}{}
+		distinct = append(distinct, node)
+		if len(distinct) == count {
+			return distinct, nil
+		}
+	}
+
+	kind := "nodes"
+	if distinctFarms {
+		kind = "farms"
+	}
+	return []types.Node{}, errors.Wrapf(ErrNoNodesMatchesResources, "found %d distinct %s out of %d", len(distinct), kind, count)
+}
+
 // hasEnoughStorage checks if all deployment storage requirements can be satisfied with node's pools based on given disks order.
 func hasEnoughStorage(pools []client.PoolMetrics, storages []uint64, poolType zos.DeviceType) bool {
 	if len(storages) == 0 {
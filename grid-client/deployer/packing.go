@@ -0,0 +1,427 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	client "github.com/threefoldtech/tfgrid-sdk-go/grid-client/node"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+	"github.com/threefoldtech/zos/pkg/gridtypes/zos"
+)
+
+// PackingObjective is what packing workloads on nodes minimizes
+type PackingObjective string
+
+const (
+	// PackMinNodes uses as few nodes as possible
+	PackMinNodes PackingObjective = "min_nodes"
+	// PackMinCost prefers the nodes that cost less to use, nodes rented by the twin and shared nodes cost nothing extra
+	PackMinCost PackingObjective = "min_cost"
+)
+
+// PackingItem is a set of workloads deployed together on one node, sizes are in bytes.
+// like the node filter, CRU is the number of cores the node must have and is not summed between items
+type PackingItem struct {
+	Name      string
+	CRU       uint64
+	MRU       uint64
+	SSDDisks  []uint64
+	HDDDisks  []uint64
+	RootFS    []uint64
+	PublicIPs uint64
+}
+
+// PackingNode is a candidate node with its storage pools, nil pools skip the pools checks
+type PackingNode struct {
+	Node  types.Node
+	Pools []client.PoolMetrics
+	// Cost is the cost of using the node with PackMinCost
+	Cost float64
+}
+
+// PackingPlan is the assignment of packed items to nodes
+type PackingPlan struct {
+	// Assignments maps the item names to their node ids
+	Assignments map[string]uint32
+	// Nodes are the used nodes in the order they were used
+	Nodes []uint32
+	Cost  float64
+}
+
+// NewPackingItem returns the capacity needed by a deployment
+func NewPackingItem(dl workloads.Deployment) PackingItem {
+	item := PackingItem{Name: dl.Name}
+
+	for _, disk := range dl.Disks {
+		item.SSDDisks = append(item.SSDDisks, disk.SizeGB*uint64(gridtypes.Gigabyte))
+	}
+	for _, volume := range dl.Volumes {
+		item.SSDDisks = append(item.SSDDisks, volume.SizeGB*uint64(gridtypes.Gigabyte))
+	}
+	for _, zdb := range dl.Zdbs {
+		item.HDDDisks = append(item.HDDDisks, zdb.SizeGB*uint64(gridtypes.Gigabyte))
+	}
+	for _, vm := range dl.Vms {
+		item.MRU += vm.MemoryMB * uint64(gridtypes.Megabyte)
+		item.CRU = max(item.CRU, uint64(vm.CPU))
+		item.RootFS = append(item.RootFS, vm.RootfsSizeMB*uint64(gridtypes.Megabyte))
+		if vm.PublicIP {
+			item.PublicIPs++
+		}
+	}
+	for _, vm := range dl.VmsLight {
+		item.MRU += vm.MemoryMB * uint64(gridtypes.Megabyte)
+		item.CRU = max(item.CRU, uint64(vm.CPU))
+		item.RootFS = append(item.RootFS, vm.RootfsSizeMB*uint64(gridtypes.Megabyte))
+	}
+
+	return item
+}
+
+// SRU returns the total ssd storage of the item
+func (i *PackingItem) SRU() uint64 {
+	var sru uint64
+	for _, size := range append(slices.Clone(i.SSDDisks), i.RootFS...) {
+		sru += size
+	}
+	return sru
+}
+
+// HRU returns the total hdd storage of the item
+func (i *PackingItem) HRU() uint64 {
+	var hru uint64
+	for _, size := range i.HDDDisks {
+		hru += size
+	}
+	return hru
+}
+
+// PackDeployments assigns nodes matching the filter to the deployments, packing them on a minimal set of nodes.
+// the node ids of the deployments are set, their networks must then include the used nodes.
+// the optional limit is the maximum number of candidate nodes, DefaultCandidateNodesLimit if not set
+func (t *TFPluginClient) PackDeployments(ctx context.Context, filter types.NodeFilter, dls []*workloads.Deployment, objective PackingObjective, optionalLimit ...uint64) (PackingPlan, error) {
+	items := make([]PackingItem, 0, len(dls))
+	for _, dl := range dls {
+		items = append(items, NewPackingItem(*dl))
+	}
+
+	nodes, err := t.PackingNodes(ctx, filter, optionalLimit...)
+	if err != nil {
+		return PackingPlan{}, err
+	}
+
+	plan, err := Pack(items, nodes, objective)
+	if err != nil {
+		return PackingPlan{}, err
+	}
+
+	for _, dl := range dls {
+		dl.NodeID = plan.Assignments[dl.Name]
+	}
+	return plan, nil
+}
+
+// PackingNodes returns the nodes matching the filter from all the proxy pages with their storage pools as packing candidates.
+// nodes rented by the twin cost nothing, other dedicated nodes cost their price
+func (t *TFPluginClient) PackingNodes(ctx context.Context, filter types.NodeFilter, optionalLimit ...uint64) ([]PackingNode, error) {
+	var limit uint64
+	if len(optionalLimit) > 0 {
+		limit = optionalLimit[0]
+	}
+
+	nodes, err := FilterCandidateNodes(ctx, *t, filter, nil, nil, nil, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get packing candidate nodes")
+	}
+
+	var wg sync.WaitGroup
+	candidates := make([]*PackingNode, len(nodes))
+	for i, node := range nodes {
+		wg.Add(1)
+		go func(i int, node types.Node) {
+			defer wg.Done()
+
+			nodeClient, err := t.NcPool.GetNodeClient(t.SubstrateConn, uint32(node.NodeID))
+			if err != nil {
+				log.Debug().Err(err).Int("node ID", node.NodeID).Msg("failed to get node client")
+				return
+			}
+			pools, err := nodeClient.Pools(ctx)
+			if err != nil {
+				log.Debug().Err(err).Int("node ID", node.NodeID).Msg("failed to get node pools")
+				return
+			}
+
+			// capacity reserved by in-flight deployments of the client is used
+			reserved := t.Reservations.Reserved(uint32(node.NodeID))
+			node.UsedResources.MRU += gridtypes.Unit(reserved.MRU)
+			node.UsedResources.SRU += gridtypes.Unit(reserved.SRU())
+			node.UsedResources.HRU += gridtypes.Unit(reserved.HRU())
+			node.FarmFreeIps -= min(node.FarmFreeIps, uint(t.Reservations.farmReservedIPs(node.FarmID)))
+
+			candidate := PackingNode{Node: node, Pools: t.Reservations.reservedPools(uint32(node.NodeID), pools)}
+			if node.Dedicated && node.RentedByTwinID != uint(t.TwinID) {
+				candidate.Cost = node.PriceUsd
+			}
+			candidates[i] = &candidate
+		}(i, node)
+	}
+	wg.Wait()
+
+	packingNodes := make([]PackingNode, 0, len(nodes))
+	for _, candidate := range candidates {
+		if candidate != nil {
+			packingNodes = append(packingNodes, *candidate)
+		}
+	}
+	return packingNodes, nil
+}
+
+// Pack assigns the items to the nodes using best fit decreasing.
+// the largest items are placed first on the used node they fit best, a new node is used only if none fits
+func Pack(items []PackingItem, nodes []PackingNode, objective PackingObjective) (PackingPlan, error) {
+	if objective != PackMinNodes && objective != PackMinCost {
+		return PackingPlan{}, fmt.Errorf("invalid packing objective '%s'", objective)
+	}
+
+	names := make(map[string]struct{}, len(items))
+	for _, item := range items {
+		if _, ok := names[item.Name]; ok {
+			return PackingPlan{}, fmt.Errorf("packing item name '%s' is duplicated", item.Name)
+		}
+		names[item.Name] = struct{}{}
+	}
+
+	bins := make([]*packingBin, 0, len(nodes))
+	farmIPs := map[int]uint64{}
+	for _, node := range nodes {
+		bins = append(bins, newPackingBin(node))
+		farmIPs[node.Node.FarmID] = uint64(node.Node.FarmFreeIps)
+	}
+	sortPackingBins(bins, objective)
+
+	sorted := slices.Clone(items)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].MRU != sorted[j].MRU {
+			return sorted[i].MRU > sorted[j].MRU
+		}
+		if sorted[i].SRU() != sorted[j].SRU() {
+			return sorted[i].SRU() > sorted[j].SRU()
+		}
+		return sorted[i].HRU() > sorted[j].HRU()
+	})
+
+	plan := PackingPlan{Assignments: make(map[string]uint32, len(items))}
+	for _, item := range sorted {
+		var best *packingBin
+		for _, bin := range bins {
+			if !bin.used || !bin.fits(item, farmIPs) {
+				continue
+			}
+			// best fit is the used node left with the least free memory
+			if best == nil || bin.free.MRU < best.free.MRU {
+				best = bin
+			}
+		}
+
+		if best == nil {
+			for _, bin := range bins {
+				if !bin.used && bin.fits(item, farmIPs) {
+					best = bin
+					break
+				}
+			}
+		}
+
+		if best == nil {
+			return PackingPlan{}, errors.Wrapf(
+				ErrNoNodesMatchesResources,
+				"could not pack '%s' after packing %d out of %d items: %s",
+				item.Name, len(plan.Assignments), len(items), infeasibleReason(item, nodes),
+			)
+		}
+
+		if !best.used {
+			best.used = true
+			plan.Nodes = append(plan.Nodes, uint32(best.node.Node.NodeID))
+			plan.Cost += best.node.Cost
+		}
+		best.add(item, farmIPs)
+		plan.Assignments[item.Name] = uint32(best.node.Node.NodeID)
+	}
+
+	return plan, nil
+}
+
+// packingBin is a node with its capacity left while packing
+type packingBin struct {
+	node  PackingNode
+	free  types.Capacity
+	pools []client.PoolMetrics
+	used  bool
+}
+
+func newPackingBin(node PackingNode) *packingBin {
+	total, used := node.Node.TotalResources, node.Node.UsedResources
+	free := types.Capacity{CRU: total.CRU}
+	if total.MRU > used.MRU {
+		free.MRU = total.MRU - used.MRU
+	}
+	if total.SRU > used.SRU {
+		free.SRU = total.SRU - used.SRU
+	}
+	if total.HRU > used.HRU {
+		free.HRU = total.HRU - used.HRU
+	}
+
+	return &packingBin{node: node, free: free, pools: slices.Clone(node.Pools)}
+}
+
+func (b *packingBin) fits(item PackingItem, farmIPs map[int]uint64) bool {
+	if item.CRU > b.free.CRU ||
+		gridtypes.Unit(item.MRU) > b.free.MRU ||
+		gridtypes.Unit(item.SRU()) > b.free.SRU ||
+		gridtypes.Unit(item.HRU()) > b.free.HRU ||
+		item.PublicIPs > farmIPs[b.node.Node.FarmID] {
+		return false
+	}
+
+	if b.pools == nil {
+		return true
+	}
+	pools := slices.Clone(b.pools)
+	return reserveStorage(pools, packingSSDs(item), zos.SSDDevice) && reserveStorage(pools, item.HDDDisks, zos.HDDDevice)
+}
+
+func (b *packingBin) add(item PackingItem, farmIPs map[int]uint64) {
+	b.free.MRU -= gridtypes.Unit(item.MRU)
+	b.free.SRU -= gridtypes.Unit(item.SRU())
+	b.free.HRU -= gridtypes.Unit(item.HRU())
+	farmIPs[b.node.Node.FarmID] -= item.PublicIPs
+
+	if b.pools != nil {
+		reserveStorage(b.pools, packingSSDs(item), zos.SSDDevice)
+		reserveStorage(b.pools, item.HDDDisks, zos.HDDDevice)
+	}
+}
+
+// sortPackingBins orders the nodes to use, nodes rented by the twin or cheaper first then the ones with more free capacity
+func sortPackingBins(bins []*packingBin, objective PackingObjective) {
+	sort.SliceStable(bins, func(i, j int) bool {
+		a, b := bins[i], bins[j]
+		if objective == PackMinCost && a.node.Cost != b.node.Cost {
+			return a.node.Cost < b.node.Cost
+		}
+		if aRented, bRented := a.node.Node.RentedByTwinID != 0 && a.node.Cost == 0, b.node.Node.RentedByTwinID != 0 && b.node.Cost == 0; aRented != bRented {
+			return aRented
+		}
+		if a.free.MRU != b.free.MRU {
+			return a.free.MRU > b.free.MRU
+		}
+		if a.free.SRU != b.free.SRU {
+			return a.free.SRU > b.free.SRU
+		}
+		return a.node.Node.NodeID < b.node.Node.NodeID
+	})
+}
+
+// packingSSDs returns the ssd disks of an item in the order zos provisions them
+func packingSSDs(item PackingItem) []uint64 {
+	ssds := slices.Clone(item.SSDDisks)
+	sort.Slice(ssds, func(i, j int) bool { return ssds[i] > ssds[j] })
+	return append(ssds, item.RootFS...)
+}
+
+// reserveStorage reserves the storages on the pools of a type the same way hasEnoughStorage checks them.
+// the pools are only updated if all the storages fit
+func reserveStorage(pools []client.PoolMetrics, storages []uint64, poolType zos.DeviceType) bool {
+	if len(storages) == 0 {
+		return true
+	}
+
+	var indexes []int
+	for i, pool := range pools {
+		if pool.Type == poolType {
+			indexes = append(indexes, i)
+		}
+	}
+	if len(indexes) == 0 {
+		return false
+	}
+
+	reserved := slices.Clone(pools)
+	for _, storage := range storages {
+		// assuming zos provision to the largest pool always
+		largest := indexes[0]
+		for _, i := range indexes[1:] {
+			if reserved[i].Size-reserved[i].Used > reserved[largest].Size-reserved[largest].Used {
+				largest = i
+			}
+		}
+		if reserved[largest].Size-reserved[largest].Used < gridtypes.Unit(storage) {
+			return false
+		}
+		reserved[largest].Used += gridtypes.Unit(storage)
+	}
+
+	copy(pools, reserved)
+	return true
+}
+
+// infeasibleReason explains why an item can't be packed, either no candidate can hold it or the candidates are full
+func infeasibleReason(item PackingItem, nodes []PackingNode) string {
+	if len(nodes) == 0 {
+		return "no candidate nodes"
+	}
+
+	var maxCRU uint64
+	var maxMRU, maxSRU, maxHRU gridtypes.Unit
+	farmIPs := map[int]uint64{}
+	poolsFit := false
+	for _, node := range nodes {
+		bin := newPackingBin(node)
+		maxCRU = max(maxCRU, bin.free.CRU)
+		maxMRU = max(maxMRU, bin.free.MRU)
+		maxSRU = max(maxSRU, bin.free.SRU)
+		maxHRU = max(maxHRU, bin.free.HRU)
+		farmIPs[node.Node.FarmID] = uint64(node.Node.FarmFreeIps)
+
+		pools := slices.Clone(node.Pools)
+		if node.Pools == nil || (reserveStorage(pools, packingSSDs(item), zos.SSDDevice) && reserveStorage(pools, item.HDDDisks, zos.HDDDevice)) {
+			poolsFit = true
+		}
+	}
+	var maxIPs uint64
+	for _, ips := range farmIPs {
+		maxIPs = max(maxIPs, ips)
+	}
+
+	switch {
+	case item.CRU > maxCRU:
+		return fmt.Sprintf("it needs %d cores but the candidate nodes have at most %d", item.CRU, maxCRU)
+	case gridtypes.Unit(item.MRU) > maxMRU:
+		return fmt.Sprintf("it needs %s of memory but the candidate nodes have at most %s free", packingSize(gridtypes.Unit(item.MRU)), packingSize(maxMRU))
+	case gridtypes.Unit(item.SRU()) > maxSRU:
+		return fmt.Sprintf("it needs %s of ssd storage but the candidate nodes have at most %s free", packingSize(gridtypes.Unit(item.SRU())), packingSize(maxSRU))
+	case gridtypes.Unit(item.HRU()) > maxHRU:
+		return fmt.Sprintf("it needs %s of hdd storage but the candidate nodes have at most %s free", packingSize(gridtypes.Unit(item.HRU())), packingSize(maxHRU))
+	case item.PublicIPs > maxIPs:
+		return fmt.Sprintf("it needs %d public ips but the candidate farms have at most %d free", item.PublicIPs, maxIPs)
+	case !poolsFit:
+		return "its disks don't fit in the storage pools of any candidate node"
+	}
+
+	return fmt.Sprintf("the %d candidate nodes don't have enough capacity left", len(nodes))
+}
+
+// packingSize formats a size in GB
+func packingSize(size gridtypes.Unit) string {
+	return fmt.Sprintf("%.2f GB", float64(size)/float64(gridtypes.Gigabyte))
+}
@@ -0,0 +1,217 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	client "github.com/threefoldtech/tfgrid-sdk-go/grid-client/node"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/simulation"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+	zosTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-client/zos"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+	"github.com/threefoldtech/zos/pkg/gridtypes/zos"
+)
+
+func packingNode(id, farmID int, memoryGB uint64, ips uint) PackingNode {
+	return PackingNode{
+		Node: types.Node{
+			NodeID:         id,
+			FarmID:         farmID,
+			FarmFreeIps:    ips,
+			TotalResources: types.Capacity{CRU: 8, MRU: gridtypes.Unit(memoryGB) * gridtypes.Gigabyte, SRU: 1 * gridtypes.Terabyte},
+		},
+		Pools: []client.PoolMetrics{{Type: zos.SSDDevice, Size: 1 * gridtypes.Terabyte}},
+	}
+}
+
+func packingVM(name string, memoryGB uint64) PackingItem {
+	return PackingItem{
+		Name:   name,
+		CRU:    1,
+		MRU:    memoryGB * uint64(gridtypes.Gigabyte),
+		RootFS: []uint64{2 * uint64(gridtypes.Gigabyte)},
+	}
+}
+
+func TestPack(t *testing.T) {
+	t.Run("minimal nodes", func(t *testing.T) {
+		nodes := []PackingNode{packingNode(1, 1, 16, 0), packingNode(2, 1, 16, 0), packingNode(3, 1, 16, 0)}
+		var items []PackingItem
+		for i := 0; i < 8; i++ {
+			items = append(items, packingVM(fmt.Sprintf("vm%d", i), 4))
+		}
+
+		plan, err := Pack(items, nodes, PackMinNodes)
+		require.NoError(t, err)
+		assert.Equal(t, []uint32{1, 2}, plan.Nodes)
+		assert.Len(t, plan.Assignments, 8)
+	})
+
+	t.Run("best fit decreasing", func(t *testing.T) {
+		nodes := []PackingNode{packingNode(1, 1, 10, 0), packingNode(2, 1, 10, 0)}
+		items := []PackingItem{packingVM("a", 3), packingVM("b", 6), packingVM("c", 4), packingVM("d", 7)}
+
+		// in order first fit would need 3 nodes
+		plan, err := Pack(items, nodes, PackMinNodes)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]uint32{"d": 1, "b": 2, "c": 2, "a": 1}, plan.Assignments)
+	})
+
+	t.Run("rented nodes first", func(t *testing.T) {
+		rented := packingNode(2, 1, 8, 0)
+		rented.Node.Dedicated = true
+		rented.Node.RentedByTwinID = 7
+		nodes := []PackingNode{packingNode(1, 1, 16, 0), rented}
+
+		plan, err := Pack([]PackingItem{packingVM("a", 4)}, nodes, PackMinNodes)
+		require.NoError(t, err)
+		assert.Equal(t, []uint32{2}, plan.Nodes)
+	})
+
+	t.Run("minimal cost", func(t *testing.T) {
+		dedicated := packingNode(1, 1, 32, 0)
+		dedicated.Cost = 50
+		nodes := []PackingNode{dedicated, packingNode(2, 1, 8, 0), packingNode(3, 1, 8, 0)}
+		items := []PackingItem{packingVM("a", 4), packingVM("b", 4), packingVM("c", 4)}
+
+		plan, err := Pack(items, nodes, PackMinNodes)
+		require.NoError(t, err)
+		assert.Equal(t, []uint32{1}, plan.Nodes)
+		assert.Equal(t, 50.0, plan.Cost)
+
+		plan, err = Pack(items, nodes, PackMinCost)
+		require.NoError(t, err)
+		assert.Equal(t, []uint32{2, 3}, plan.Nodes)
+		assert.Zero(t, plan.Cost)
+	})
+
+	t.Run("storage pools", func(t *testing.T) {
+		node := packingNode(1, 1, 16, 0)
+		node.Pools = []client.PoolMetrics{
+			{Type: zos.SSDDevice, Size: 10 * gridtypes.Gigabyte},
+			{Type: zos.SSDDevice, Size: 10 * gridtypes.Gigabyte},
+		}
+		disk := func(name string) PackingItem {
+			item := packingVM(name, 1)
+			item.SSDDisks = []uint64{6 * uint64(gridtypes.Gigabyte)}
+			item.RootFS = nil
+			return item
+		}
+
+		// the total free ssd is enough for a third disk but no pool can hold it
+		_, err := Pack([]PackingItem{disk("a"), disk("b")}, []PackingNode{node}, PackMinNodes)
+		require.NoError(t, err)
+		_, err = Pack([]PackingItem{disk("a"), disk("b"), disk("c")}, []PackingNode{node}, PackMinNodes)
+		assert.ErrorIs(t, err, ErrNoNodesMatchesResources)
+	})
+
+	t.Run("public ips are shared by the farm", func(t *testing.T) {
+		nodes := []PackingNode{packingNode(1, 1, 16, 1), packingNode(2, 1, 16, 1), packingNode(3, 2, 16, 1)}
+		items := []PackingItem{packingVM("a", 1), packingVM("b", 1)}
+		items[0].PublicIPs, items[1].PublicIPs = 1, 1
+
+		plan, err := Pack(items, nodes, PackMinNodes)
+		require.NoError(t, err)
+		assert.Equal(t, []uint32{1, 3}, plan.Nodes)
+	})
+
+	t.Run("infeasible", func(t *testing.T) {
+		nodes := []PackingNode{packingNode(1, 1, 8, 0), packingNode(2, 1, 8, 0)}
+
+		_, err := Pack([]PackingItem{packingVM("big", 12)}, nodes, PackMinNodes)
+		assert.ErrorIs(t, err, ErrNoNodesMatchesResources)
+		assert.ErrorContains(t, err, "needs 12.00 GB of memory but the candidate nodes have at most 8.00 GB free")
+
+		items := []PackingItem{packingVM("a", 6), packingVM("b", 6), packingVM("c", 6)}
+		_, err = Pack(items, nodes, PackMinNodes)
+		assert.ErrorIs(t, err, ErrNoNodesMatchesResources)
+		assert.ErrorContains(t, err, "after packing 2 out of 3 items")
+
+		cores := packingVM("cores", 1)
+		cores.CRU = 16
+		_, err = Pack([]PackingItem{cores}, nodes, PackMinNodes)
+		assert.ErrorContains(t, err, "needs 16 cores")
+
+		ip := packingVM("ip", 1)
+		ip.PublicIPs = 1
+		_, err = Pack([]PackingItem{ip}, nodes, PackMinNodes)
+		assert.ErrorContains(t, err, "public ips")
+	})
+
+	t.Run("invalid items", func(t *testing.T) {
+		_, err := Pack([]PackingItem{packingVM("a", 1), packingVM("a", 1)}, nil, PackMinNodes)
+		assert.ErrorContains(t, err, "duplicated")
+
+		_, err = Pack(nil, nil, "cheapest")
+		assert.Error(t, err)
+	})
+}
+
+func TestPackDeployments(t *testing.T) {
+	tfPluginClient, err := NewTFPluginClient(simulationMnemonic, WithSimulation(simulation.NewGrid()))
+	require.NoError(t, err)
+	defer tfPluginClient.Close()
+
+	var dls []*workloads.Deployment
+	for i := 0; i < 4; i++ {
+		vm := workloads.VM{
+			Name:        fmt.Sprintf("vm%d", i),
+			Flist:       "https://hub.grid.tf/tf-official-apps/base:latest.flist",
+			CPU:         1,
+			MemoryMB:    1024,
+			NetworkName: "packed",
+		}
+		dl := workloads.NewDeployment(vm.Name, 0, "", nil, "packed", nil, nil, []workloads.VM{vm}, nil, nil, nil)
+		dls = append(dls, &dl)
+	}
+
+	plan, err := tfPluginClient.PackDeployments(context.Background(), types.NodeFilter{Status: []string{"up"}}, dls, PackMinNodes)
+	require.NoError(t, err)
+	require.Len(t, plan.Nodes, 1)
+	for _, dl := range dls {
+		assert.Equal(t, plan.Nodes[0], dl.NodeID)
+	}
+}
+
+func TestPackDeploymentsPages(t *testing.T) {
+	grid := simulation.NewEmptyGrid()
+	require.NoError(t, grid.AddFarm(simulation.Farm{ID: 1, Name: "farm", PricingPolicyID: simulation.DefaultPricingPolicyID}))
+	for id := uint32(1); id <= 2*candidateNodesPageSize; id++ {
+		require.NoError(t, grid.AddNode(simulation.Node{
+			ID:     id,
+			FarmID: 1,
+			Total:  zosTypes.Capacity{CRU: 8, MRU: 8 * zosTypes.Gigabyte, SRU: 100 * zosTypes.Gigabyte},
+		}))
+	}
+	// the only node fitting all the vms is listed on the last proxy page
+	require.NoError(t, grid.AddNode(simulation.Node{
+		ID:     1000,
+		FarmID: 1,
+		Total:  zosTypes.Capacity{CRU: 8, MRU: 64 * zosTypes.Gigabyte, SRU: 512 * zosTypes.Gigabyte},
+	}))
+
+	tfPluginClient, err := NewTFPluginClient(simulationMnemonic, WithSimulation(grid))
+	require.NoError(t, err)
+	defer tfPluginClient.Close()
+
+	var dls []*workloads.Deployment
+	for i := 0; i < 8; i++ {
+		vm := workloads.VM{Name: fmt.Sprintf("vm%d", i), CPU: 1, MemoryMB: 4 * 1024, NetworkName: "packed"}
+		dl := workloads.NewDeployment(vm.Name, 0, "", nil, "packed", nil, nil, []workloads.VM{vm}, nil, nil, nil)
+		dls = append(dls, &dl)
+	}
+
+	filter := types.NodeFilter{Status: []string{"up"}}
+	plan, err := tfPluginClient.PackDeployments(context.Background(), filter, dls, PackMinNodes)
+	require.NoError(t, err)
+	assert.Equal(t, []uint32{1000}, plan.Nodes)
+
+	// the large node is not a candidate, two vms fit on each small node
+	plan, err = tfPluginClient.PackDeployments(context.Background(), filter, dls, PackMinNodes, candidateNodesPageSize)
+	require.NoError(t, err)
+	assert.Equal(t, []uint32{1, 2, 3, 4}, plan.Nodes)
+}
@@ -0,0 +1,545 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+)
+
+const (
+	// nodes up for this long get the full uptime score
+	placementUptimeTarget = 30 * 24 * 60 * 60
+	// half the earth circumference, the farthest two points can be
+	placementMaxDistanceKM = 20015.0
+	earthRadiusKM          = 6371.0
+)
+
+// PlacementRuleKind is the kind of an affinity or anti-affinity placement rule
+type PlacementRuleKind string
+
+const (
+	// SameFarm places nodes in the same farm
+	SameFarm PlacementRuleKind = "same_farm"
+	// DifferentFarm places nodes in different farms
+	DifferentFarm PlacementRuleKind = "different_farm"
+	// DifferentCountry places nodes in different countries
+	DifferentCountry PlacementRuleKind = "different_country"
+)
+
+// PlacementRule constrains the nodes of a placement group.
+// the rule applies between the replicas of the group, or between the group and another group placed before it
+type PlacementRule struct {
+	Kind PlacementRuleKind
+	// Group is the name of the other group, empty for the replicas of the group itself
+	Group string
+}
+
+// PlacementHints are soft location preferences, nodes matching them score higher
+type PlacementHints struct {
+	Countries []string
+	// Latitude and Longitude prefer nodes close to a location as an approximation of latency
+	Latitude  *float64
+	Longitude *float64
+}
+
+// PlacementGroup is a group of replicas of the same deployment placed on distinct nodes
+type PlacementGroup struct {
+	Name     string
+	Replicas int
+	// Filter selects the candidate nodes, its FreeMRU, FreeSRU and FreeHRU are the capacity of each replica
+	Filter   types.NodeFilter
+	SSDDisks []uint64
+	HDDDisks []uint64
+	RootFS   []uint64
+	Rules    []PlacementRule
+	Hints    PlacementHints
+}
+
+// PlacementWeights are the weights of the scores of a node, a zero weight ignores a score
+type PlacementWeights struct {
+	Price         float64
+	Headroom      float64
+	Uptime        float64
+	Location      float64
+	FarmDiversity float64
+}
+
+// DefaultPlacementWeights favors spreading the replicas of a group over farms
+var DefaultPlacementWeights = PlacementWeights{Price: 1, Headroom: 1, Uptime: 1, Location: 1, FarmDiversity: 2}
+
+// NodeScore is the score of a node for a placement group, the criteria scores are between 0 and 1
+type NodeScore struct {
+	Node          types.Node
+	Score         float64
+	Price         float64
+	Headroom      float64
+	Uptime        float64
+	Location      float64
+	FarmDiversity float64
+}
+
+// GroupPlacement is the placement of a group, Alternatives are the other candidates ranked by score
+type GroupPlacement struct {
+	Group        string
+	Nodes        []NodeScore
+	Alternatives []NodeScore
+}
+
+// NodeIDs returns the ids of the nodes chosen for the group
+func (g *GroupPlacement) NodeIDs() []uint32 {
+	ids := make([]uint32, 0, len(g.Nodes))
+	for _, node := range g.Nodes {
+		ids = append(ids, uint32(node.Node.NodeID))
+	}
+	return ids
+}
+
+// PlacementPlan is the placement of groups of deployments planned together
+type PlacementPlan struct {
+	Groups []GroupPlacement
+}
+
+// Group returns the placement of a group by name
+func (p *PlacementPlan) Group(name string) (GroupPlacement, bool) {
+	idx := slices.IndexFunc(p.Groups, func(g GroupPlacement) bool { return g.Group == name })
+	if idx < 0 {
+		return GroupPlacement{}, false
+	}
+	return p.Groups[idx], true
+}
+
+// PlacementEngine ranks the candidate nodes of groups of deployments by score instead of taking the first matching nodes
+type PlacementEngine struct {
+	client  *TFPluginClient
+	Weights PlacementWeights
+	// CandidateLimit is the maximum number of candidate nodes of a group, DefaultCandidateNodesLimit if not set
+	CandidateLimit uint64
+}
+
+// NewPlacementEngine creates a placement engine using the default weights
+func NewPlacementEngine(client *TFPluginClient) *PlacementEngine {
+	return &PlacementEngine{client: client, Weights: DefaultPlacementWeights}
+}
+
+// Plan fetches the candidate nodes of the groups from all the proxy pages then places them in order.
+// nodes can be shared between groups, the capacity taken by the groups placed before is accounted for
+func (e *PlacementEngine) Plan(ctx context.Context, groups ...PlacementGroup) (PlacementPlan, error) {
+	if err := validatePlacementGroups(groups); err != nil {
+		return PlacementPlan{}, err
+	}
+
+	candidates := make(map[string][]types.Node, len(groups))
+	for _, group := range groups {
+		nodes, err := FilterCandidateNodes(ctx, *e.client, group.Filter, group.SSDDisks, group.HDDDisks, group.RootFS, e.CandidateLimit)
+		if err != nil {
+			return PlacementPlan{}, errors.Wrapf(err, "failed to get candidate nodes of group %s", group.Name)
+		}
+		candidates[group.Name] = nodes
+	}
+
+	return e.Place(groups, candidates)
+}
+
+// Place places the groups in order on their candidate nodes by group name
+func (e *PlacementEngine) Place(groups []PlacementGroup, candidates map[string][]types.Node) (PlacementPlan, error) {
+	if err := validatePlacementGroups(groups); err != nil {
+		return PlacementPlan{}, err
+	}
+
+	p := placer{
+		weights:   e.Weights,
+		allocated: map[int]types.Capacity{},
+		placed:    map[string][]types.Node{},
+	}
+
+	var plan PlacementPlan
+	for _, group := range groups {
+		placement, err := p.placeGroup(group, candidates[group.Name])
+		if err != nil {
+			return PlacementPlan{}, err
+		}
+		plan.Groups = append(plan.Groups, placement)
+	}
+
+	return plan, nil
+}
+
+func validatePlacementGroups(groups []PlacementGroup) error {
+	names := map[string]struct{}{}
+	for _, group := range groups {
+		if group.Name == "" {
+			return errors.New("placement group name cannot be empty")
+		}
+		if _, ok := names[group.Name]; ok {
+			return fmt.Errorf("placement group name '%s' is duplicated", group.Name)
+		}
+		if group.Replicas <= 0 {
+			return fmt.Errorf("placement group '%s' replicas must be positive", group.Name)
+		}
+
+		for _, rule := range group.Rules {
+			if rule.Kind != SameFarm && rule.Kind != DifferentFarm && rule.Kind != DifferentCountry {
+				return fmt.Errorf("invalid placement rule '%s' of group '%s'", rule.Kind, group.Name)
+			}
+			if rule.Group == "" || rule.Group == group.Name {
+				continue
+			}
+			if _, ok := names[rule.Group]; !ok {
+				return fmt.Errorf("placement rule of group '%s' refers to group '%s' which must be placed before it", group.Name, rule.Group)
+			}
+		}
+
+		names[group.Name] = struct{}{}
+	}
+
+	return nil
+}
+
+// placer holds the state of the groups placed so far
+type placer struct {
+	weights   PlacementWeights
+	allocated map[int]types.Capacity
+	placed    map[string][]types.Node
+}
+
+// candidate is a node eligible for a group with its scores that don't depend on the other replicas
+type candidate struct {
+	node     types.Node
+	price    float64
+	headroom float64
+	uptime   float64
+	location float64
+}
+
+func (p *placer) placeGroup(group PlacementGroup, nodes []types.Node) (GroupPlacement, error) {
+	candidates := p.candidates(group, nodes)
+
+	var chosen []candidate
+	if hasRule(group, SameFarm) {
+		farms := map[int][]candidate{}
+		for _, c := range candidates {
+			farms[c.node.FarmID] = append(farms[c.node.FarmID], c)
+		}
+
+		best := math.Inf(-1)
+		for _, farmCandidates := range farms {
+			selected := p.selectNodes(group, farmCandidates)
+			if len(selected) != group.Replicas {
+				continue
+			}
+			// farms are compared by the sum of their scores, ties go to the lower farm id
+			total := 0.0
+			for _, c := range selected {
+				total += p.score(c, nil).Score
+			}
+			if total > best || (total == best && selected[0].node.FarmID < chosen[0].node.FarmID) {
+				best, chosen = total, selected
+			}
+		}
+	} else {
+		chosen = p.selectNodes(group, candidates)
+	}
+
+	if len(chosen) != group.Replicas {
+		return GroupPlacement{}, errors.Wrapf(
+			ErrNoNodesMatchesResources,
+			"could only place %d out of %d replicas of group '%s' from %d candidates",
+			len(chosen), group.Replicas, group.Name, len(candidates),
+		)
+	}
+
+	placement := GroupPlacement{Group: group.Name}
+	for i, c := range chosen {
+		placement.Nodes = append(placement.Nodes, p.score(c, chosen[:i]))
+		p.placed[group.Name] = append(p.placed[group.Name], c.node)
+
+		allocated := p.allocated[c.node.NodeID]
+		request := placementRequest(group.Filter)
+		allocated.MRU += request.MRU
+		allocated.SRU += request.SRU
+		allocated.HRU += request.HRU
+		p.allocated[c.node.NodeID] = allocated
+	}
+
+	for _, c := range candidates {
+		if slices.ContainsFunc(chosen, func(ch candidate) bool { return ch.node.NodeID == c.node.NodeID }) {
+			continue
+		}
+		placement.Alternatives = append(placement.Alternatives, p.score(c, chosen))
+	}
+	sortNodeScores(placement.Alternatives)
+
+	return placement, nil
+}
+
+// candidates returns the nodes with enough capacity left matching the rules with the groups placed before
+func (p *placer) candidates(group PlacementGroup, nodes []types.Node) []candidate {
+	request := placementRequest(group.Filter)
+
+	var eligible []types.Node
+	seen := map[int]struct{}{}
+	for _, node := range nodes {
+		if _, ok := seen[node.NodeID]; ok {
+			continue
+		}
+		seen[node.NodeID] = struct{}{}
+
+		if !p.matchesGroupRules(group, node) {
+			continue
+		}
+		free := p.free(node)
+		if free.MRU < request.MRU || free.SRU < request.SRU || free.HRU < request.HRU {
+			continue
+		}
+		eligible = append(eligible, node)
+	}
+
+	minPrice, maxPrice := math.Inf(1), math.Inf(-1)
+	for _, node := range eligible {
+		minPrice = math.Min(minPrice, node.PriceUsd)
+		maxPrice = math.Max(maxPrice, node.PriceUsd)
+	}
+
+	candidates := make([]candidate, 0, len(eligible))
+	for _, node := range eligible {
+		price := 1.0
+		if maxPrice > minPrice {
+			price = (maxPrice - node.PriceUsd) / (maxPrice - minPrice)
+		}
+
+		candidates = append(candidates, candidate{
+			node:     node,
+			price:    price,
+			headroom: headroomScore(node.TotalResources, p.free(node), request),
+			uptime:   math.Min(float64(node.Uptime)/placementUptimeTarget, 1),
+			location: locationScore(node, group.Hints),
+		})
+	}
+
+	return candidates
+}
+
+// selectNodes greedily picks the best scored candidates for the replicas of a group respecting its own rules
+func (p *placer) selectNodes(group PlacementGroup, candidates []candidate) []candidate {
+	var chosen []candidate
+	for len(chosen) < group.Replicas {
+		bestIdx := -1
+		var best NodeScore
+		for i, c := range candidates {
+			if !p.matchesReplicaRules(group, c.node, chosen) {
+				continue
+			}
+			score := p.score(c, chosen)
+			if bestIdx < 0 || score.Score > best.Score || (score.Score == best.Score && c.node.NodeID < best.Node.NodeID) {
+				bestIdx, best = i, score
+			}
+		}
+		if bestIdx < 0 {
+			break
+		}
+
+		chosen = append(chosen, candidates[bestIdx])
+		candidates = slices.Delete(slices.Clone(candidates), bestIdx, bestIdx+1)
+	}
+
+	return chosen
+}
+
+// score scores a candidate given the replicas already chosen for its group
+func (p *placer) score(c candidate, chosen []candidate) NodeScore {
+	sameFarm := 0
+	for _, ch := range chosen {
+		if ch.node.FarmID == c.node.FarmID {
+			sameFarm++
+		}
+	}
+
+	s := NodeScore{
+		Node:          c.node,
+		Price:         c.price,
+		Headroom:      c.headroom,
+		Uptime:        c.uptime,
+		Location:      c.location,
+		FarmDiversity: 1 / float64(1+sameFarm),
+	}
+
+	w := p.weights
+	total := w.Price + w.Headroom + w.Uptime + w.Location + w.FarmDiversity
+	if total > 0 {
+		s.Score = (w.Price*s.Price + w.Headroom*s.Headroom + w.Uptime*s.Uptime + w.Location*s.Location + w.FarmDiversity*s.FarmDiversity) / total
+	}
+	return s
+}
+
+// matchesGroupRules checks the rules of a group with the groups placed before it
+func (p *placer) matchesGroupRules(group PlacementGroup, node types.Node) bool {
+	for _, rule := range group.Rules {
+		if rule.Group == "" || rule.Group == group.Name {
+			continue
+		}
+
+		others := p.placed[rule.Group]
+		switch rule.Kind {
+		case SameFarm:
+			if !slices.ContainsFunc(others, func(n types.Node) bool { return n.FarmID == node.FarmID }) {
+				return false
+			}
+		case DifferentFarm:
+			if slices.ContainsFunc(others, func(n types.Node) bool { return n.FarmID == node.FarmID }) {
+				return false
+			}
+		case DifferentCountry:
+			if slices.ContainsFunc(others, func(n types.Node) bool { return strings.EqualFold(n.Country, node.Country) }) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// matchesReplicaRules checks the rules between the replicas of a group, replicas are always on distinct nodes
+func (p *placer) matchesReplicaRules(group PlacementGroup, node types.Node, chosen []candidate) bool {
+	for _, c := range chosen {
+		if c.node.NodeID == node.NodeID {
+			return false
+		}
+
+		for _, rule := range group.Rules {
+			if rule.Group != "" && rule.Group != group.Name {
+				continue
+			}
+
+			switch rule.Kind {
+			case SameFarm:
+				if c.node.FarmID != node.FarmID {
+					return false
+				}
+			case DifferentFarm:
+				if c.node.FarmID == node.FarmID {
+					return false
+				}
+			case DifferentCountry:
+				if strings.EqualFold(c.node.Country, node.Country) {
+					return false
+				}
+			}
+		}
+	}
+
+	return true
+}
+
+// free returns the free capacity of a node after the groups placed before
+func (p *placer) free(node types.Node) types.Capacity {
+	allocated := p.allocated[node.NodeID]
+	sub := func(total, used, allocated gridtypes.Unit) gridtypes.Unit {
+		if total < used+allocated {
+			return 0
+		}
+		return total - used - allocated
+	}
+
+	return types.Capacity{
+		MRU: sub(node.TotalResources.MRU, node.UsedResources.MRU, allocated.MRU),
+		SRU: sub(node.TotalResources.SRU, node.UsedResources.SRU, allocated.SRU),
+		HRU: sub(node.TotalResources.HRU, node.UsedResources.HRU, allocated.HRU),
+	}
+}
+
+func hasRule(group PlacementGroup, kind PlacementRuleKind) bool {
+	return slices.ContainsFunc(group.Rules, func(r PlacementRule) bool {
+		return r.Kind == kind && (r.Group == "" || r.Group == group.Name)
+	})
+}
+
+// placementRequest returns the capacity of a replica from the free capacity asked by a node filter
+func placementRequest(filter types.NodeFilter) types.Capacity {
+	var request types.Capacity
+	if filter.FreeMRU != nil {
+		request.MRU = gridtypes.Unit(*filter.FreeMRU)
+	}
+	if filter.FreeSRU != nil {
+		request.SRU = gridtypes.Unit(*filter.FreeSRU)
+	}
+	if filter.FreeHRU != nil {
+		request.HRU = gridtypes.Unit(*filter.FreeHRU)
+	}
+	return request
+}
+
+// headroomScore is the average ratio of the memory and storage left free on a node after placing a replica
+func headroomScore(total, free, request types.Capacity) float64 {
+	var sum float64
+	var count int
+	for _, r := range []struct{ total, free, request gridtypes.Unit }{
+		{total.MRU, free.MRU, request.MRU},
+		{total.SRU, free.SRU, request.SRU},
+		{total.HRU, free.HRU, request.HRU},
+	} {
+		if r.total == 0 {
+			continue
+		}
+		count++
+		if r.free > r.request {
+			sum += float64(r.free-r.request) / float64(r.total)
+		}
+	}
+
+	if count == 0 {
+		return 0
+	}
+	return sum / float64(count)
+}
+
+// locationScore scores how well a node matches the location hints, nodes score 1 without hints
+func locationScore(node types.Node, hints PlacementHints) float64 {
+	var sum float64
+	var count int
+
+	if len(hints.Countries) != 0 {
+		count++
+		if slices.ContainsFunc(hints.Countries, func(c string) bool { return strings.EqualFold(c, node.Country) }) {
+			sum++
+		}
+	}
+
+	if hints.Latitude != nil && hints.Longitude != nil {
+		count++
+		if node.Location.Latitude != nil && node.Location.Longitude != nil {
+			distance := haversineKM(*hints.Latitude, *hints.Longitude, *node.Location.Latitude, *node.Location.Longitude)
+			sum += math.Max(0, 1-distance/placementMaxDistanceKM)
+		}
+	}
+
+	if count == 0 {
+		return 1
+	}
+	return sum / float64(count)
+}
+
+// haversineKM returns the great circle distance in km between two points
+func haversineKM(lat1, lon1, lat2, lon2 float64) float64 {
+	rad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat, dLon := rad(lat2-lat1), rad(lon2-lon1)
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(rad(lat1))*math.Cos(rad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKM * math.Asin(math.Sqrt(a))
+}
+
+// sortNodeScores sorts scores from the highest, ties go to the lower node id
+func sortNodeScores(scores []NodeScore) {
+	sort.SliceStable(scores, func(i, j int) bool {
+		if scores[i].Score != scores[j].Score {
+			return scores[i].Score > scores[j].Score
+		}
+		return scores[i].Node.NodeID < scores[j].Node.NodeID
+	})
+}
@@ -0,0 +1,206 @@
+package deployer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/simulation"
+	zosTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-client/zos"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+)
+
+func placementNode(id, farmID int, country string, price float64) types.Node {
+	return types.Node{
+		NodeID:         id,
+		FarmID:         farmID,
+		Country:        country,
+		PriceUsd:       price,
+		Uptime:         placementUptimeTarget,
+		TotalResources: types.Capacity{CRU: 8, MRU: 64 * gridtypes.Gigabyte, SRU: 1 * gridtypes.Terabyte},
+	}
+}
+
+func TestPlacementEngine(t *testing.T) {
+	nodes := []types.Node{
+		placementNode(1, 1, "Belgium", 10),
+		placementNode(2, 1, "Belgium", 10),
+		placementNode(3, 1, "Belgium", 11),
+		placementNode(4, 2, "Belgium", 12),
+		placementNode(5, 3, "Egypt", 20),
+	}
+	engine := NewPlacementEngine(nil)
+
+	place := func(groups ...PlacementGroup) (PlacementPlan, error) {
+		candidates := map[string][]types.Node{}
+		for _, group := range groups {
+			candidates[group.Name] = nodes
+		}
+		return engine.Place(groups, candidates)
+	}
+
+	t.Run("ranked by score", func(t *testing.T) {
+		plan, err := place(PlacementGroup{Name: "app", Replicas: 1})
+		require.NoError(t, err)
+		group, ok := plan.Group("app")
+		require.True(t, ok)
+		assert.Equal(t, []uint32{1}, group.NodeIDs())
+
+		var alternatives []int
+		for _, score := range group.Alternatives {
+			alternatives = append(alternatives, score.Node.NodeID)
+		}
+		// alternatives are ranked as a next replica, favoring other farms
+		assert.Equal(t, []int{4, 2, 5, 3}, alternatives)
+	})
+
+	t.Run("spread over farms", func(t *testing.T) {
+		plan, err := place(PlacementGroup{Name: "app", Replicas: 2})
+		require.NoError(t, err)
+		assert.Equal(t, []uint32{1, 4}, plan.Groups[0].NodeIDs())
+	})
+
+	t.Run("different farm", func(t *testing.T) {
+		plan, err := place(PlacementGroup{Name: "db", Replicas: 3, Rules: []PlacementRule{{Kind: DifferentFarm}}})
+		require.NoError(t, err)
+		assert.Equal(t, []uint32{1, 4, 5}, plan.Groups[0].NodeIDs())
+
+		_, err = place(PlacementGroup{Name: "db", Replicas: 4, Rules: []PlacementRule{{Kind: DifferentFarm}}})
+		assert.ErrorIs(t, err, ErrNoNodesMatchesResources)
+	})
+
+	t.Run("different country", func(t *testing.T) {
+		plan, err := place(PlacementGroup{Name: "db", Replicas: 2, Rules: []PlacementRule{{Kind: DifferentCountry}}})
+		require.NoError(t, err)
+		assert.Equal(t, []uint32{1, 5}, plan.Groups[0].NodeIDs())
+	})
+
+	t.Run("same farm", func(t *testing.T) {
+		plan, err := place(PlacementGroup{Name: "app", Replicas: 3, Rules: []PlacementRule{{Kind: SameFarm}}})
+		require.NoError(t, err)
+		assert.Equal(t, []uint32{1, 2, 3}, plan.Groups[0].NodeIDs())
+	})
+
+	t.Run("rules between groups", func(t *testing.T) {
+		plan, err := place(
+			PlacementGroup{Name: "db", Replicas: 1},
+			PlacementGroup{Name: "cache", Replicas: 2, Rules: []PlacementRule{{Kind: SameFarm, Group: "db"}}},
+			PlacementGroup{Name: "backup", Replicas: 1, Rules: []PlacementRule{{Kind: DifferentCountry, Group: "db"}}},
+		)
+		require.NoError(t, err)
+		assert.Equal(t, []uint32{1}, plan.Groups[0].NodeIDs())
+		assert.Equal(t, []uint32{1, 2}, plan.Groups[1].NodeIDs())
+		assert.Equal(t, []uint32{5}, plan.Groups[2].NodeIDs())
+
+		_, err = place(PlacementGroup{Name: "cache", Replicas: 1, Rules: []PlacementRule{{Kind: SameFarm, Group: "db"}}})
+		assert.Error(t, err)
+	})
+
+	t.Run("capacity shared between groups", func(t *testing.T) {
+		memory := uint64(40 * gridtypes.Gigabyte)
+		nodes := []types.Node{placementNode(1, 1, "Belgium", 10), placementNode(2, 1, "Belgium", 12)}
+		groups := []PlacementGroup{
+			{Name: "a", Replicas: 1, Filter: types.NodeFilter{FreeMRU: &memory}},
+			{Name: "b", Replicas: 1, Filter: types.NodeFilter{FreeMRU: &memory}},
+		}
+
+		plan, err := engine.Place(groups, map[string][]types.Node{"a": nodes, "b": nodes})
+		require.NoError(t, err)
+		assert.Equal(t, []uint32{1}, plan.Groups[0].NodeIDs())
+		assert.Equal(t, []uint32{2}, plan.Groups[1].NodeIDs())
+	})
+
+	t.Run("location hints", func(t *testing.T) {
+		cairoLat, cairoLon := 30.04, 31.24
+		group := PlacementGroup{Name: "africa", Replicas: 1, Hints: PlacementHints{Countries: []string{"egypt"}}}
+		engine := PlacementEngine{Weights: PlacementWeights{Price: 1, Location: 2}}
+		plan, err := engine.Place([]PlacementGroup{group}, map[string][]types.Node{group.Name: nodes})
+		require.NoError(t, err)
+		assert.Equal(t, []uint32{5}, plan.Groups[0].NodeIDs())
+
+		assert.InDelta(t, 1, locationScore(types.Node{Location: types.Location{Latitude: &cairoLat, Longitude: &cairoLon}}, PlacementHints{Latitude: &cairoLat, Longitude: &cairoLon}), 1e-9)
+		assert.Zero(t, locationScore(types.Node{}, PlacementHints{Latitude: &cairoLat, Longitude: &cairoLon}))
+	})
+
+	t.Run("invalid groups", func(t *testing.T) {
+		_, err := place(PlacementGroup{Name: "app"})
+		assert.Error(t, err)
+
+		_, err = place(
+			PlacementGroup{Name: "web", Replicas: 1, Rules: []PlacementRule{{Kind: DifferentFarm, Group: "db"}}},
+			PlacementGroup{Name: "db", Replicas: 1},
+		)
+		assert.ErrorContains(t, err, "must be placed before it")
+	})
+}
+
+func TestPlacementEnginePlan(t *testing.T) {
+	grid := simulation.NewGrid()
+	require.NoError(t, grid.AddFarm(simulation.Farm{ID: 2, Name: "second-farm"}))
+	require.NoError(t, grid.AddNode(simulation.Node{
+		ID:      4,
+		FarmID:  2,
+		Country: "Egypt",
+		Total:   zosTypes.Capacity{CRU: 8, MRU: 32 * zosTypes.Gigabyte, SRU: 512 * zosTypes.Gigabyte},
+	}))
+
+	tfPluginClient, err := NewTFPluginClient(simulationMnemonic, WithSimulation(grid))
+	require.NoError(t, err)
+	defer tfPluginClient.Close()
+
+	memory := uint64(2 * zosTypes.Gigabyte)
+	plan, err := NewPlacementEngine(&tfPluginClient).Plan(context.Background(), PlacementGroup{
+		Name:     "ha",
+		Replicas: 2,
+		Filter:   types.NodeFilter{FreeMRU: &memory},
+		Rules:    []PlacementRule{{Kind: DifferentFarm}},
+	})
+	require.NoError(t, err)
+
+	group := plan.Groups[0]
+	require.Len(t, group.Nodes, 2)
+	assert.NotEqual(t, group.Nodes[0].Node.FarmID, group.Nodes[1].Node.FarmID)
+	assert.Contains(t, group.NodeIDs(), uint32(4))
+	assert.Len(t, group.Alternatives, 2)
+}
+
+func TestPlacementEnginePlanPages(t *testing.T) {
+	grid := simulation.NewGrid()
+	for id := uint32(4); id < 4+2*candidateNodesPageSize; id++ {
+		require.NoError(t, grid.AddNode(simulation.Node{
+			ID:     id,
+			FarmID: 1,
+			Total:  zosTypes.Capacity{CRU: 8, MRU: 32 * zosTypes.Gigabyte, SRU: 512 * zosTypes.Gigabyte},
+		}))
+	}
+	// the only node of another farm is listed on the last proxy page
+	require.NoError(t, grid.AddFarm(simulation.Farm{ID: 2, Name: "second-farm"}))
+	require.NoError(t, grid.AddNode(simulation.Node{
+		ID:     1000,
+		FarmID: 2,
+		Total:  zosTypes.Capacity{CRU: 8, MRU: 32 * zosTypes.Gigabyte, SRU: 512 * zosTypes.Gigabyte},
+	}))
+
+	tfPluginClient, err := NewTFPluginClient(simulationMnemonic, WithSimulation(grid))
+	require.NoError(t, err)
+	defer tfPluginClient.Close()
+
+	memory := uint64(2 * zosTypes.Gigabyte)
+	group := PlacementGroup{
+		Name:     "ha",
+		Replicas: 2,
+		Filter:   types.NodeFilter{FreeMRU: &memory},
+		Rules:    []PlacementRule{{Kind: DifferentFarm}},
+	}
+
+	engine := NewPlacementEngine(&tfPluginClient)
+	plan, err := engine.Plan(context.Background(), group)
+	require.NoError(t, err)
+	assert.Contains(t, plan.Groups[0].NodeIDs(), uint32(1000))
+
+	engine.CandidateLimit = candidateNodesPageSize
+	_, err = engine.Plan(context.Background(), group)
+	assert.Error(t, err)
+}
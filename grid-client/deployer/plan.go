@@ -0,0 +1,339 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/zos"
+)
+
+// ChangeAction is the action a plan takes on a node contract
+type ChangeAction string
+
+const (
+	// ActionCreate creates a new node contract
+	ActionCreate ChangeAction = "create"
+	// ActionUpdate updates an existing node contract
+	ActionUpdate ChangeAction = "update"
+	// ActionCancel cancels an existing node contract
+	ActionCancel ChangeAction = "cancel"
+	// ActionNone leaves an existing node contract untouched
+	ActionNone ChangeAction = "none"
+)
+
+// Plan is the set of changes a deploy would make, computed without sending any extrinsic
+type Plan struct {
+	Contracts []ContractChange `json:"contracts"`
+	// NameContracts are the names that need a new name contract
+	NameContracts []string `json:"name_contracts,omitempty"`
+	// Capacity is the total capacity delta of all contracts
+	Capacity CapacityDelta `json:"capacity"`
+	// PublicIPs is the delta of the reserved public IPs
+	PublicIPs int64 `json:"public_ips"`
+	// MonthlyCost is the estimated monthly cost in TFT of the planned contracts
+	MonthlyCost float64 `json:"monthly_cost"`
+	// MonthlyCostDelta is the difference of the estimated monthly cost in TFT
+	MonthlyCostDelta float64 `json:"monthly_cost_delta"`
+}
+
+// ContractChange is the change planned for a single node contract
+type ContractChange struct {
+	NodeID uint32 `json:"node_id"`
+	// ContractID is zero for contracts to be created
+	ContractID uint64          `json:"contract_id,omitempty"`
+	Action     ChangeAction    `json:"action"`
+	Name       string          `json:"name"`
+	Type       string          `json:"type"`
+	Workloads  WorkloadChanges `json:"workloads"`
+	Capacity   CapacityDelta   `json:"capacity"`
+	PublicIPs  int64           `json:"public_ips"`
+	// MonthlyCost is the estimated monthly cost in TFT of the contract after the change
+	MonthlyCost float64 `json:"monthly_cost"`
+	// MonthlyCostDelta is the difference of the contract estimated monthly cost in TFT
+	MonthlyCostDelta float64 `json:"monthly_cost_delta"`
+
+	oldCapacity zos.Capacity
+	newCapacity zos.Capacity
+	oldIPs      int64
+	newIPs      int64
+}
+
+// WorkloadChanges are the names of the changed workloads of a deployment, compared by hash
+type WorkloadChanges struct {
+	Added   []string `json:"added,omitempty"`
+	Changed []string `json:"changed,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+// CapacityDelta is a signed capacity difference, MRU, SRU and HRU are in bytes
+type CapacityDelta struct {
+	CRU int64 `json:"cru"`
+	MRU int64 `json:"mru"`
+	SRU int64 `json:"sru"`
+	HRU int64 `json:"hru"`
+}
+
+// HasChanges returns true if applying the plan changes anything on the grid
+func (p *Plan) HasChanges() bool {
+	if len(p.NameContracts) != 0 {
+		return true
+	}
+
+	for _, c := range p.Contracts {
+		if c.Action != ActionNone {
+			return true
+		}
+	}
+	return false
+}
+
+// Summary returns a short description of the plan
+func (p *Plan) Summary() string {
+	count := make(map[ChangeAction]int)
+	for _, c := range p.Contracts {
+		count[c.Action]++
+	}
+
+	return fmt.Sprintf(
+		"%d to create, %d to update, %d to cancel, %d name contracts to create; monthly cost: %.2f TFT (%+.2f TFT)",
+		count[ActionCreate], count[ActionUpdate], count[ActionCancel], len(p.NameContracts), p.MonthlyCost, p.MonthlyCostDelta,
+	)
+}
+
+func (c *CapacityDelta) add(cap zos.Capacity, sign int64) {
+	c.CRU += sign * int64(cap.CRU)
+	c.MRU += sign * int64(cap.MRU)
+	c.SRU += sign * int64(cap.SRU)
+	c.HRU += sign * int64(cap.HRU)
+}
+
+// planDeployments plans the changes of a deploy from the old deployments' IDs to the new deployments
+func planDeployments(
+	ctx context.Context,
+	tfPluginClient *TFPluginClient,
+	deployer MockDeployer,
+	oldDeploymentIDs map[uint32]uint64,
+	newDeployments map[uint32]zos.Deployment,
+) (Plan, error) {
+	oldDeployments, err := deployer.GetDeployments(ctx, oldDeploymentIDs)
+	if err != nil {
+		return Plan{}, errors.Wrap(err, "failed to get current deployments")
+	}
+
+	var changes []ContractChange
+	for node, contractID := range oldDeploymentIDs {
+		if _, ok := newDeployments[node]; ok {
+			continue
+		}
+
+		oldDl := oldDeployments[node]
+		change, err := diffDeployment(node, contractID, &oldDl, nil)
+		if err != nil {
+			return Plan{}, err
+		}
+		changes = append(changes, change)
+	}
+
+	for node, dl := range newDeployments {
+		var oldDl *zos.Deployment
+		contractID, ok := oldDeploymentIDs[node]
+		if ok {
+			dl := oldDeployments[node]
+			oldDl = &dl
+		}
+
+		dl := dl
+		change, err := diffDeployment(node, contractID, oldDl, &dl)
+		if err != nil {
+			return Plan{}, err
+		}
+		changes = append(changes, change)
+	}
+
+	return newPlan(ctx, tfPluginClient, changes)
+}
+
+// planBatchDeployments plans a batch deploy, every batch deployment creates a new contract
+func planBatchDeployments(ctx context.Context, tfPluginClient *TFPluginClient, deployments map[uint32][]zos.Deployment) (Plan, error) {
+	var changes []ContractChange
+	for node, dls := range deployments {
+		for _, dl := range dls {
+			dl := dl
+			change, err := diffDeployment(node, 0, nil, &dl)
+			if err != nil {
+				return Plan{}, err
+			}
+			changes = append(changes, change)
+		}
+	}
+
+	return newPlan(ctx, tfPluginClient, changes)
+}
+
+// newPlan sorts the changes and calculates the plan totals and costs
+func newPlan(ctx context.Context, tfPluginClient *TFPluginClient, changes []ContractChange) (Plan, error) {
+	sort.SliceStable(changes, func(i, j int) bool {
+		if changes[i].NodeID != changes[j].NodeID {
+			return changes[i].NodeID < changes[j].NodeID
+		}
+		return changes[i].Name < changes[j].Name
+	})
+
+	plan := Plan{Contracts: changes}
+	// costs are estimated the same way EstimateDeployment does, using the pricing policy of the nodes farms
+	e := newEstimator(tfPluginClient)
+
+	for idx := range plan.Contracts {
+		change := &plan.Contracts[idx]
+
+		oldCost, err := e.contractCost(ctx, change.Name, change.NodeID, change.oldCapacity, change.oldIPs)
+		if err != nil {
+			return Plan{}, errors.Wrapf(err, "could not estimate cost of contract %d on node %d", change.ContractID, change.NodeID)
+		}
+
+		newCost, err := e.contractCost(ctx, change.Name, change.NodeID, change.newCapacity, change.newIPs)
+		if err != nil {
+			return Plan{}, errors.Wrapf(err, "could not estimate cost of deployment %s on node %d", change.Name, change.NodeID)
+		}
+
+		change.MonthlyCost = newCost
+		change.MonthlyCostDelta = newCost - oldCost
+
+		plan.Capacity.CRU += change.Capacity.CRU
+		plan.Capacity.MRU += change.Capacity.MRU
+		plan.Capacity.SRU += change.Capacity.SRU
+		plan.Capacity.HRU += change.Capacity.HRU
+		plan.PublicIPs += change.PublicIPs
+		plan.MonthlyCost += change.MonthlyCost
+		plan.MonthlyCostDelta += change.MonthlyCostDelta
+	}
+
+	return plan, nil
+}
+
+// diffDeployment compares the old deployment of a node contract with the new one,
+// a nil old deployment means a contract creation and a nil new deployment means a cancellation
+func diffDeployment(nodeID uint32, contractID uint64, oldDl, newDl *zos.Deployment) (ContractChange, error) {
+	change := ContractChange{NodeID: nodeID, ContractID: contractID}
+
+	var err error
+	var oldHashes, newHashes map[string]string
+
+	if oldDl != nil {
+		change.oldCapacity, change.oldIPs, err = deploymentResources(*oldDl)
+		if err != nil {
+			return change, errors.Wrapf(err, "could not read deployment %d resources", contractID)
+		}
+		change.Capacity.add(change.oldCapacity, -1)
+		change.PublicIPs -= change.oldIPs
+
+		oldHashes, err = GetWorkloadHashes(*oldDl)
+		if err != nil {
+			return change, errors.Wrap(err, "could not get old workloads hashes")
+		}
+		change.setDeploymentData(oldDl.Metadata)
+	}
+
+	if newDl != nil {
+		// versions are matched on a copy so the hashes compare the workloads data only
+		dl := *newDl
+		dl.Workloads = slices.Clone(newDl.Workloads)
+		if oldDl != nil {
+			matchOldVersions(oldDl, &dl)
+		}
+
+		change.newCapacity, change.newIPs, err = deploymentResources(dl)
+		if err != nil {
+			return change, errors.Wrapf(err, "could not read new deployment resources on node %d", nodeID)
+		}
+		change.Capacity.add(change.newCapacity, 1)
+		change.PublicIPs += change.newIPs
+
+		newHashes, err = GetWorkloadHashes(dl)
+		if err != nil {
+			return change, errors.Wrap(err, "could not get new workloads hashes")
+		}
+		change.setDeploymentData(dl.Metadata)
+
+		if oldDl != nil {
+			change.Action, err = updateAction(*oldDl, dl)
+			if err != nil {
+				return change, err
+			}
+		}
+	}
+
+	switch {
+	case oldDl == nil:
+		change.Action = ActionCreate
+	case newDl == nil:
+		change.Action = ActionCancel
+	}
+
+	for name, hash := range newHashes {
+		oldHash, ok := oldHashes[name]
+		if !ok {
+			change.Workloads.Added = append(change.Workloads.Added, name)
+		} else if oldHash != hash {
+			change.Workloads.Changed = append(change.Workloads.Changed, name)
+		}
+	}
+
+	for name := range oldHashes {
+		if _, ok := newHashes[name]; !ok {
+			change.Workloads.Removed = append(change.Workloads.Removed, name)
+		}
+	}
+
+	slices.Sort(change.Workloads.Added)
+	slices.Sort(change.Workloads.Changed)
+	slices.Sort(change.Workloads.Removed)
+
+	return change, nil
+}
+
+// updateAction decides if an existing deployment needs an update the same way the deployer does
+func updateAction(oldDl, newDl zos.Deployment) (ChangeAction, error) {
+	oldHash, err := HashDeployment(oldDl)
+	if err != nil {
+		return "", errors.Wrap(err, "could not get deployment hash")
+	}
+
+	newHash, err := HashDeployment(newDl)
+	if err != nil {
+		return "", errors.Wrap(err, "could not get deployment hash")
+	}
+
+	if oldHash == newHash && SameWorkloadsNames(newDl, oldDl) {
+		return ActionNone, nil
+	}
+	return ActionUpdate, nil
+}
+
+func (c *ContractChange) setDeploymentData(metadata string) {
+	data, err := workloads.ParseDeploymentData(metadata)
+	if err != nil {
+		return
+	}
+
+	c.Name = data.Name
+	c.Type = data.Type
+}
+
+func deploymentResources(dl zos.Deployment) (zos.Capacity, int64, error) {
+	cap, err := Capacity(dl)
+	if err != nil {
+		return cap, 0, err
+	}
+
+	publicIPs, err := CountDeploymentPublicIPs(dl)
+	if err != nil {
+		return cap, 0, errors.Wrap(err, "failed to count deployment public IPs")
+	}
+
+	return cap, int64(publicIPs), nil
+}
@@ -0,0 +1,120 @@
+package deployer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/calculator"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/mocks"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+	zosTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-client/zos"
+	proxyTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+)
+
+func deploymentWithDisks(name string, disks map[string]uint64) zosTypes.Deployment {
+	dl := workloads.NewGridDeployment(twinID, 0, []zosTypes.Workload{})
+	for diskName, size := range disks {
+		disk := workloads.Disk{Name: diskName, SizeGB: size}
+		dl.Workloads = append(dl.Workloads, disk.ZosWorkload())
+	}
+	dl.Metadata = `{"version":3,"type":"vm","name":"` + name + `","projectName":"vm/` + name + `"}`
+	return dl
+}
+
+func TestPlanDeployments(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	sub := mocks.NewMockSubstrateExt(ctrl)
+	proxyCl := mocks.NewMockClient(ctrl)
+	deployer := mocks.NewMockDeployer(ctrl)
+
+	tfPluginClient := TFPluginClient{
+		SubstrateConn:   sub,
+		GridProxyClient: proxyCl,
+		Calculator:      calculator.NewCalculator(sub, substrate.Identity(nil)),
+	}
+
+	// costs are in tft at a price of 2 mUSD
+	sub.EXPECT().GetTFTPrice().Return(types.U32(2), nil).AnyTimes()
+	sub.EXPECT().GetPricingPolicy(uint32(1)).Return(substrate.PricingPolicy{
+		SU:  substrate.Policy{Value: 2},
+		CU:  substrate.Policy{Value: 2},
+		IPU: substrate.Policy{Value: 2},
+	}, nil).AnyTimes()
+	proxyCl.EXPECT().Node(gomock.Any(), gomock.Any()).Return(proxyTypes.NodeWithNestedCapacity{FarmID: 1}, nil).AnyTimes()
+	proxyCl.EXPECT().Farms(gomock.Any(), gomock.Any(), gomock.Any()).Return([]proxyTypes.Farm{{FarmID: 1, PricingPolicyID: 1}}, 1, nil).AnyTimes()
+
+	oldIDs := map[uint32]uint64{1: 10, 2: 20, 4: 40}
+	oldDeployments := map[uint32]zosTypes.Deployment{
+		1: deploymentWithDisks("updated", map[string]uint64{"d0": 200, "d1": 10, "d2": 20}),
+		2: deploymentWithDisks("canceled", map[string]uint64{"d": 200}),
+		4: deploymentWithDisks("unchanged", map[string]uint64{"d": 10}),
+	}
+	newDeployments := map[uint32]zosTypes.Deployment{
+		1: deploymentWithDisks("updated", map[string]uint64{"d1": 10, "d2": 40, "d3": 10}),
+		3: deploymentWithDisks("created", map[string]uint64{"d": 400}),
+		4: deploymentWithDisks("unchanged", map[string]uint64{"d": 10}),
+	}
+
+	deployer.EXPECT().GetDeployments(gomock.Any(), oldIDs).Return(oldDeployments, nil)
+
+	plan, err := planDeployments(context.Background(), &tfPluginClient, deployer, oldIDs, newDeployments)
+	require.NoError(t, err)
+	require.Len(t, plan.Contracts, 4)
+
+	updated, canceled, created, unchanged := plan.Contracts[0], plan.Contracts[1], plan.Contracts[2], plan.Contracts[3]
+
+	assert.Equal(t, ActionUpdate, updated.Action)
+	assert.Equal(t, uint64(10), updated.ContractID)
+	assert.Equal(t, "updated", updated.Name)
+	assert.Equal(t, WorkloadChanges{Added: []string{"d3"}, Changed: []string{"d2"}, Removed: []string{"d0"}}, updated.Workloads)
+	assert.Equal(t, -170*int64(gridtypes.Gigabyte), updated.Capacity.SRU)
+
+	assert.Equal(t, ActionCancel, canceled.Action)
+	assert.Equal(t, []string{"d"}, canceled.Workloads.Removed)
+	assert.Equal(t, float64(0), canceled.MonthlyCost)
+	assert.InDelta(t, -0.7305, canceled.MonthlyCostDelta, 1e-9)
+
+	assert.Equal(t, ActionCreate, created.Action)
+	assert.Zero(t, created.ContractID)
+	assert.Equal(t, []string{"d"}, created.Workloads.Added)
+	assert.InDelta(t, 1.461, created.MonthlyCost, 1e-9)
+
+	// the plan and the estimate of the same deployment agree
+	estimate, err := tfPluginClient.EstimateDeployment(context.Background(), workloads.Deployment{
+		Name:   "created",
+		NodeID: 3,
+		Disks:  []workloads.Disk{{Name: "d", SizeGB: 400}},
+	})
+	require.NoError(t, err)
+	assert.InDelta(t, estimate.MonthlyCost, created.MonthlyCost, 1e-9)
+
+	assert.Equal(t, ActionNone, unchanged.Action)
+	assert.Equal(t, WorkloadChanges{}, unchanged.Workloads)
+
+	assert.Equal(t, 30*int64(gridtypes.Gigabyte), plan.Capacity.SRU)
+	assert.True(t, plan.HasChanges())
+	assert.Contains(t, plan.Summary(), "1 to create, 1 to update, 1 to cancel")
+	assert.Contains(t, plan.Summary(), "TFT")
+}
+
+func TestPlanNoChanges(t *testing.T) {
+	dl := deploymentWithDisks("vm", map[string]uint64{"d": 10})
+
+	change, err := diffDeployment(1, 10, &dl, &dl)
+	require.NoError(t, err)
+	assert.Equal(t, ActionNone, change.Action)
+
+	plan := Plan{Contracts: []ContractChange{change}}
+	assert.False(t, plan.HasChanges())
+
+	plan.NameContracts = []string{"gw"}
+	assert.True(t, plan.HasChanges())
+}
@@ -0,0 +1,448 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/zos"
+)
+
+const defaultReconcileInterval = 5 * time.Minute
+
+// DriftKind is the kind of a difference between a deployed resource and its desired state
+type DriftKind string
+
+const (
+	// DriftWorkloadError for workloads in error state
+	DriftWorkloadError DriftKind = "error"
+	// DriftWorkloadDeleted for workloads deleted by the node
+	DriftWorkloadDeleted DriftKind = "deleted"
+	// DriftWorkloadChanged for workloads that do not match the desired workloads
+	DriftWorkloadChanged DriftKind = "drifted"
+	// DriftWorkloadMissing for desired workloads that are not in the deployment
+	DriftWorkloadMissing DriftKind = "missing"
+	// DriftDeploymentMissing for deployments whose contract is not valid anymore
+	DriftDeploymentMissing DriftKind = "deployment_missing"
+	// DriftNodeUnreachable for deployments that could not be read from their node
+	DriftNodeUnreachable DriftKind = "unreachable"
+)
+
+// DriftEvent is emitted by the reconciler for every drift it detects
+type DriftEvent struct {
+	Time time.Time `json:"time"`
+	// Target is the name the resource is watched with
+	Target     string    `json:"target"`
+	NodeID     uint32    `json:"node_id"`
+	ContractID uint64    `json:"contract_id"`
+	Workload   string    `json:"workload,omitempty"`
+	Kind       DriftKind `json:"kind"`
+	Message    string    `json:"message,omitempty"`
+	// Redeployed is set if the drift was fixed, ContractID is then the contract of the redeployed deployment
+	Redeployed    bool  `json:"redeployed"`
+	RedeployError error `json:"-"`
+}
+
+// ReconcilerOpt is used to configure a reconciler
+type ReconcilerOpt func(*Reconciler)
+
+// WithReconcileInterval sets the interval between reconciliation passes
+func WithReconcileInterval(interval time.Duration) ReconcilerOpt {
+	return func(r *Reconciler) {
+		r.interval = interval
+	}
+}
+
+// WithRedeploy enables redeploying drifted deployments to their desired state
+func WithRedeploy() ReconcilerOpt {
+	return func(r *Reconciler) {
+		r.redeploy = true
+	}
+}
+
+// WithDriftHandler sets a callback called with every drift event
+func WithDriftHandler(handler func(DriftEvent)) ReconcilerOpt {
+	return func(r *Reconciler) {
+		r.handlers = append(r.handlers, handler)
+	}
+}
+
+// WithDriftEvents sends every drift event to the given channel, sending blocks the reconciler
+func WithDriftEvents(events chan<- DriftEvent) ReconcilerOpt {
+	return func(r *Reconciler) {
+		r.handlers = append(r.handlers, func(event DriftEvent) {
+			events <- event
+		})
+	}
+}
+
+// reconcileTarget is the desired state of a watched resource
+type reconcileTarget struct {
+	contracts         map[uint32]uint64
+	desired           map[uint32]zos.Deployment
+	solutionProviders map[uint32]*uint64
+}
+
+// Reconciler periodically compares watched resources with the deployments on their nodes,
+// it reports workloads in error, deleted or drifted states and optionally redeploys them
+type Reconciler struct {
+	tfPluginClient *TFPluginClient
+	deployer       MockDeployer
+
+	interval time.Duration
+	redeploy bool
+	handlers []func(DriftEvent)
+
+	mu      sync.Mutex
+	targets map[string]*reconcileTarget
+}
+
+// NewReconciler generates a new reconciler
+func NewReconciler(tfPluginClient *TFPluginClient, opts ...ReconcilerOpt) *Reconciler {
+	deployer := NewDeployer(*tfPluginClient, true)
+	r := &Reconciler{
+		tfPluginClient: tfPluginClient,
+		deployer:       &deployer,
+		interval:       defaultReconcileInterval,
+		targets:        make(map[string]*reconcileTarget),
+	}
+
+	for _, o := range opts {
+		o(r)
+	}
+
+	return r
+}
+
+// Watch watches the deployments of the given contracts, desired has the desired grid deployment of every node
+func (r *Reconciler) Watch(name string, contracts map[uint32]uint64, desired map[uint32]zos.Deployment, solutionProviders map[uint32]*uint64) error {
+	for nodeID := range desired {
+		if contracts[nodeID] == 0 {
+			return errors.Errorf("deployment of %s on node %d is not deployed", name, nodeID)
+		}
+	}
+
+	target := reconcileTarget{
+		contracts:         make(map[uint32]uint64),
+		desired:           make(map[uint32]zos.Deployment),
+		solutionProviders: solutionProviders,
+	}
+	for nodeID, dl := range desired {
+		target.contracts[nodeID] = contracts[nodeID]
+		target.desired[nodeID] = dl
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.targets[name] = &target
+	return nil
+}
+
+// WatchDeployment watches a deployed deployment
+func (r *Reconciler) WatchDeployment(ctx context.Context, dl *workloads.Deployment) error {
+	d := r.tfPluginClient.DeploymentDeployer
+	dls, err := d.generateVersionlessDeployments(ctx, []*workloads.Deployment{dl})
+	if err != nil {
+		return errors.Wrapf(err, "could not generate deployment %s", dl.Name)
+	}
+
+	if len(dls[dl.NodeID]) == 0 {
+		return errors.Errorf("could not generate deployment %s", dl.Name)
+	}
+
+	return r.Watch(
+		dl.Name,
+		map[uint32]uint64{dl.NodeID: dl.ContractID},
+		map[uint32]zos.Deployment{dl.NodeID: dls[dl.NodeID][0]},
+		map[uint32]*uint64{dl.NodeID: dl.SolutionProvider},
+	)
+}
+
+// WatchK8s watches a deployed kubernetes cluster
+func (r *Reconciler) WatchK8s(k8sCluster *workloads.K8sCluster) error {
+	d := r.tfPluginClient.K8sDeployer
+	dls, err := d.generateVersionlessDeployments(k8sCluster)
+	if err != nil {
+		return errors.Wrapf(err, "could not generate kubernetes cluster %s", k8sCluster.Master.Name)
+	}
+
+	return r.Watch(k8sCluster.Master.Name, k8sCluster.NodeDeploymentID, dls, nil)
+}
+
+// WatchGatewayName watches a deployed name gateway
+func (r *Reconciler) WatchGatewayName(gw *workloads.GatewayNameProxy) error {
+	d := r.tfPluginClient.GatewayNameDeployer
+	dls, err := d.generateVersionlessDeployments(gw)
+	if err != nil {
+		return errors.Wrapf(err, "could not generate gateway %s", gw.Name)
+	}
+
+	return r.Watch(gw.Name, gw.NodeDeploymentID, dls, nil)
+}
+
+// WatchGatewayFQDN watches a deployed fqdn gateway
+func (r *Reconciler) WatchGatewayFQDN(ctx context.Context, gw *workloads.GatewayFQDNProxy) error {
+	d := r.tfPluginClient.GatewayFQDNDeployer
+	dls, err := d.generateVersionlessDeployments(ctx, gw)
+	if err != nil {
+		return errors.Wrapf(err, "could not generate gateway %s", gw.Name)
+	}
+
+	return r.Watch(gw.Name, gw.NodeDeploymentID, dls, nil)
+}
+
+// Unwatch stops watching a resource
+func (r *Reconciler) Unwatch(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.targets, name)
+}
+
+// Contracts returns the current contracts of a watched resource, they change if the resource is redeployed
+func (r *Reconciler) Contracts(name string) map[uint32]uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	target, ok := r.targets[name]
+	if !ok {
+		return nil
+	}
+
+	contracts := make(map[uint32]uint64, len(target.contracts))
+	for nodeID, contractID := range target.contracts {
+		contracts[nodeID] = contractID
+	}
+	return contracts
+}
+
+// Run reconciles the watched resources every interval until the context is canceled
+func (r *Reconciler) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		r.Reconcile(ctx)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Reconcile runs a single reconciliation pass over the watched resources and returns the detected drifts
+func (r *Reconciler) Reconcile(ctx context.Context) []DriftEvent {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.targets))
+	for name := range r.targets {
+		names = append(names, name)
+	}
+	r.mu.Unlock()
+	sort.Strings(names)
+
+	var events []DriftEvent
+	for _, name := range names {
+		r.mu.Lock()
+		target, ok := r.targets[name]
+		r.mu.Unlock()
+		if !ok {
+			continue
+		}
+
+		nodes := make([]uint32, 0, len(target.desired))
+		for nodeID := range target.desired {
+			nodes = append(nodes, nodeID)
+		}
+		sort.Slice(nodes, func(i, j int) bool { return nodes[i] < nodes[j] })
+
+		for _, nodeID := range nodes {
+			nodeEvents := r.reconcileNode(ctx, name, target, nodeID)
+			for _, event := range nodeEvents {
+				for _, handler := range r.handlers {
+					handler(event)
+				}
+			}
+			events = append(events, nodeEvents...)
+		}
+	}
+
+	return events
+}
+
+// reconcileNode compares the deployment of a target on a node with its desired state and redeploys it if enabled
+func (r *Reconciler) reconcileNode(ctx context.Context, name string, target *reconcileTarget, nodeID uint32) []DriftEvent {
+	r.mu.Lock()
+	contractID := target.contracts[nodeID]
+	desired := target.desired[nodeID]
+	r.mu.Unlock()
+
+	newEvent := func(kind DriftKind, workload, message string) DriftEvent {
+		return DriftEvent{
+			Time:       time.Now(),
+			Target:     name,
+			NodeID:     nodeID,
+			ContractID: contractID,
+			Workload:   workload,
+			Kind:       kind,
+			Message:    message,
+		}
+	}
+
+	dls, err := r.deployer.GetDeployments(ctx, map[uint32]uint64{nodeID: contractID})
+	if err != nil {
+		valid, validErr := r.tfPluginClient.SubstrateConn.IsValidContract(contractID)
+		if validErr != nil || valid {
+			return []DriftEvent{newEvent(DriftNodeUnreachable, "", err.Error())}
+		}
+
+		event := newEvent(DriftDeploymentMissing, "", fmt.Sprintf("contract %d is not valid anymore", contractID))
+		if r.redeploy {
+			r.redeployNode(ctx, target, nodeID, nil, &event)
+		}
+		return []DriftEvent{event}
+	}
+
+	events, broken, err := driftOf(dls[nodeID], desired)
+	if err != nil {
+		return []DriftEvent{newEvent(DriftWorkloadChanged, "", err.Error())}
+	}
+
+	for idx := range events {
+		events[idx].Time = time.Now()
+		events[idx].Target = name
+		events[idx].NodeID = nodeID
+		events[idx].ContractID = contractID
+	}
+
+	if !r.redeploy || len(events) == 0 {
+		return events
+	}
+
+	r.redeployNode(ctx, target, nodeID, broken, &events[0])
+	for idx := range events[1:] {
+		events[idx+1].Redeployed = events[0].Redeployed
+		events[idx+1].RedeployError = events[0].RedeployError
+		events[idx+1].ContractID = events[0].ContractID
+	}
+
+	return events
+}
+
+// redeployNode deploys the desired deployment of a target on a node.
+// broken workloads and drifted vms are removed then added back so the node provisions them again,
+// a nil contract means the deployment is created again.
+func (r *Reconciler) redeployNode(ctx context.Context, target *reconcileTarget, nodeID uint32, broken map[string]bool, event *DriftEvent) {
+	r.mu.Lock()
+	oldIDs := map[uint32]uint64{nodeID: target.contracts[nodeID]}
+	desired := target.desired[nodeID]
+	r.mu.Unlock()
+
+	if event.Kind == DriftDeploymentMissing {
+		oldIDs = map[uint32]uint64{}
+	}
+
+	solutionProvider := map[uint32]*uint64{nodeID: target.solutionProviders[nodeID]}
+
+	if len(broken) != 0 {
+		healthy := desired
+		healthy.Workloads = nil
+		for _, wl := range desired.Workloads {
+			if !broken[wl.Name] {
+				healthy.Workloads = append(healthy.Workloads, wl)
+			}
+		}
+
+		ids, err := r.deployer.Deploy(ctx, oldIDs, map[uint32]zos.Deployment{nodeID: healthy}, solutionProvider)
+		if err != nil {
+			event.RedeployError = errors.Wrap(err, "could not remove broken workloads")
+			return
+		}
+		oldIDs = ids
+	}
+
+	ids, err := r.deployer.Deploy(ctx, oldIDs, map[uint32]zos.Deployment{nodeID: desired}, solutionProvider)
+	if err != nil {
+		event.RedeployError = err
+		return
+	}
+
+	contractID := ids[nodeID]
+	if contractID != event.ContractID {
+		r.tfPluginClient.State.RemoveContractIDs(nodeID, event.ContractID)
+		r.tfPluginClient.State.StoreContractIDs(nodeID, contractID)
+	}
+
+	r.mu.Lock()
+	target.contracts[nodeID] = contractID
+	r.mu.Unlock()
+
+	event.ContractID = contractID
+	event.Redeployed = true
+	log.Info().Str("target", event.Target).Uint32("node", nodeID).Uint64("contract", contractID).Msg("redeployed drifted deployment")
+}
+
+// driftOf compares a live deployment with the desired one and returns the drifts and the workloads that must be provisioned again
+func driftOf(live, desired zos.Deployment) ([]DriftEvent, map[string]bool, error) {
+	var events []DriftEvent
+	broken := make(map[string]bool)
+
+	// versions are not part of the desired state
+	desired.Workloads = append([]zos.Workload{}, desired.Workloads...)
+	matchOldVersions(&live, &desired)
+
+	liveHashes, err := GetWorkloadHashes(live)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	desiredHashes, err := GetWorkloadHashes(desired)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	liveWorkloads := make(map[string]zos.Workload)
+	for _, wl := range live.Workloads {
+		liveWorkloads[wl.Name] = wl
+	}
+
+	for _, wl := range desired.Workloads {
+		liveWl, ok := liveWorkloads[wl.Name]
+		if !ok {
+			events = append(events, DriftEvent{Workload: wl.Name, Kind: DriftWorkloadMissing})
+			continue
+		}
+
+		switch liveWl.Result.State {
+		case zos.StateError:
+			events = append(events, DriftEvent{Workload: wl.Name, Kind: DriftWorkloadError, Message: liveWl.Result.Error})
+			broken[wl.Name] = true
+			continue
+		case zos.StateDeleted:
+			events = append(events, DriftEvent{Workload: wl.Name, Kind: DriftWorkloadDeleted, Message: liveWl.Result.Error})
+			broken[wl.Name] = true
+			continue
+		}
+
+		if liveHashes[wl.Name] != desiredHashes[wl.Name] {
+			events = append(events, DriftEvent{Workload: wl.Name, Kind: DriftWorkloadChanged, Message: "workload does not match its desired state"})
+			// zos can't update vms in place so drifted vms are provisioned again
+			if wl.Type == zos.ZMachineType || wl.Type == zos.ZMachineLightType {
+				broken[wl.Name] = true
+			}
+		}
+	}
+
+	for _, wl := range live.Workloads {
+		if _, ok := desiredHashes[wl.Name]; !ok && wl.Result.State != zos.StateDeleted {
+			events = append(events, DriftEvent{Workload: wl.Name, Kind: DriftWorkloadChanged, Message: "workload is not in the desired state"})
+		}
+	}
+
+	return events, broken, nil
+}
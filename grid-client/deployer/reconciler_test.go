@@ -0,0 +1,216 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/mocks"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/state"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+	zosTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-client/zos"
+)
+
+func liveDeployment(desired zosTypes.Deployment, states map[string]zosTypes.ResultState) zosTypes.Deployment {
+	live := desired
+	live.Workloads = append([]zosTypes.Workload{}, desired.Workloads...)
+	for idx, wl := range live.Workloads {
+		live.Workloads[idx].Result.State = zosTypes.StateOk
+		if state, ok := states[wl.Name]; ok {
+			live.Workloads[idx].Result.State = state
+			live.Workloads[idx].Result.Error = "failure"
+		}
+	}
+	return live
+}
+
+func newTestReconciler(t *testing.T, opts ...ReconcilerOpt) (*Reconciler, *mocks.MockDeployer, *mocks.MockSubstrateExt) {
+	ctrl := gomock.NewController(t)
+	t.Cleanup(ctrl.Finish)
+
+	sub := mocks.NewMockSubstrateExt(ctrl)
+	deployer := mocks.NewMockDeployer(ctrl)
+
+	tfPluginClient := TFPluginClient{
+		SubstrateConn: sub,
+		State:         state.NewState(nil, sub),
+	}
+
+	r := NewReconciler(&tfPluginClient, opts...)
+	r.deployer = deployer
+	return r, deployer, sub
+}
+
+func TestReconcilerHealthy(t *testing.T) {
+	r, deployer, _ := newTestReconciler(t)
+
+	desired := deploymentWithDisks("vm", map[string]uint64{"d1": 10, "d2": 20})
+	require.NoError(t, r.Watch("vm", map[uint32]uint64{1: 10}, map[uint32]zosTypes.Deployment{1: desired}, nil))
+
+	deployer.EXPECT().
+		GetDeployments(gomock.Any(), map[uint32]uint64{1: 10}).
+		Return(map[uint32]zosTypes.Deployment{1: liveDeployment(desired, nil)}, nil)
+
+	assert.Empty(t, r.Reconcile(context.Background()))
+}
+
+func TestReconcilerDrift(t *testing.T) {
+	var handled []DriftEvent
+	r, deployer, _ := newTestReconciler(t, WithDriftHandler(func(e DriftEvent) { handled = append(handled, e) }))
+
+	desired := deploymentWithDisks("vm", map[string]uint64{"d1": 10, "d2": 20, "d3": 30})
+	// d1 failed, d2 was resized, d3 was dropped and d4 was added
+	live := liveDeployment(
+		deploymentWithDisks("vm", map[string]uint64{"d1": 10, "d2": 40, "d4": 10}),
+		map[string]zosTypes.ResultState{"d1": zosTypes.StateError},
+	)
+
+	require.NoError(t, r.Watch("vm", map[uint32]uint64{1: 10}, map[uint32]zosTypes.Deployment{1: desired}, nil))
+
+	deployer.EXPECT().
+		GetDeployments(gomock.Any(), map[uint32]uint64{1: 10}).
+		Return(map[uint32]zosTypes.Deployment{1: live}, nil)
+
+	events := r.Reconcile(context.Background())
+	assert.Equal(t, events, handled)
+
+	kinds := make(map[string]DriftKind)
+	for _, e := range events {
+		assert.Equal(t, "vm", e.Target)
+		assert.Equal(t, uint64(10), e.ContractID)
+		assert.False(t, e.Redeployed)
+		kinds[e.Workload] = e.Kind
+	}
+
+	assert.Equal(t, map[string]DriftKind{
+		"d1": DriftWorkloadError,
+		"d2": DriftWorkloadChanged,
+		"d3": DriftWorkloadMissing,
+		"d4": DriftWorkloadChanged,
+	}, kinds)
+}
+
+func TestReconcilerRedeploy(t *testing.T) {
+	t.Run("broken workloads", func(t *testing.T) {
+		r, deployer, _ := newTestReconciler(t, WithRedeploy())
+
+		desired := deploymentWithDisks("vm", map[string]uint64{"d1": 10, "d2": 20})
+		live := liveDeployment(desired, map[string]zosTypes.ResultState{"d1": zosTypes.StateDeleted})
+		require.NoError(t, r.Watch("vm", map[uint32]uint64{1: 10}, map[uint32]zosTypes.Deployment{1: desired}, nil))
+
+		deployer.EXPECT().
+			GetDeployments(gomock.Any(), map[uint32]uint64{1: 10}).
+			Return(map[uint32]zosTypes.Deployment{1: live}, nil)
+
+		gomock.InOrder(
+			deployer.EXPECT().
+				Deploy(gomock.Any(), map[uint32]uint64{1: 10}, gomock.Any(), gomock.Any()).
+				DoAndReturn(func(_ context.Context, oldIDs map[uint32]uint64, dls map[uint32]zosTypes.Deployment, _ map[uint32]*uint64) (map[uint32]uint64, error) {
+					require.Len(t, dls[1].Workloads, 1)
+					assert.Equal(t, "d2", dls[1].Workloads[0].Name)
+					return oldIDs, nil
+				}),
+			deployer.EXPECT().
+				Deploy(gomock.Any(), map[uint32]uint64{1: 10}, map[uint32]zosTypes.Deployment{1: desired}, gomock.Any()).
+				Return(map[uint32]uint64{1: 10}, nil),
+		)
+
+		events := r.Reconcile(context.Background())
+		require.Len(t, events, 1)
+		assert.Equal(t, DriftWorkloadDeleted, events[0].Kind)
+		assert.True(t, events[0].Redeployed)
+		assert.NoError(t, events[0].RedeployError)
+	})
+
+	t.Run("drifted vm", func(t *testing.T) {
+		r, deployer, _ := newTestReconciler(t, WithRedeploy())
+
+		vmDeployment := func(cpu uint8) zosTypes.Deployment {
+			dl := deploymentWithDisks("vm", map[string]uint64{"d": 10})
+			vm := workloads.VM{Name: "vm", Flist: "flist", NetworkName: "net", CPU: cpu, MemoryMB: 1024}
+			dl.Workloads = append(dl.Workloads, vm.ZosWorkload()...)
+			return dl
+		}
+		desired := vmDeployment(1)
+		live := liveDeployment(vmDeployment(2), nil)
+		require.NoError(t, r.Watch("vm", map[uint32]uint64{1: 10}, map[uint32]zosTypes.Deployment{1: desired}, nil))
+
+		deployer.EXPECT().
+			GetDeployments(gomock.Any(), map[uint32]uint64{1: 10}).
+			Return(map[uint32]zosTypes.Deployment{1: live}, nil)
+
+		// the node only accepts versions the deployer can upgrade to
+		current := live
+		upgrade := func(_ context.Context, oldIDs map[uint32]uint64, dls map[uint32]zosTypes.Deployment, _ map[uint32]*uint64) (map[uint32]uint64, error) {
+			dl := dls[1]
+			dl.Workloads = append([]zosTypes.Workload{}, dl.Workloads...)
+			if _, err := assignVersions(&current, &dl); err != nil {
+				return nil, err
+			}
+			current = dl
+			return oldIDs, nil
+		}
+		gomock.InOrder(
+			deployer.EXPECT().
+				Deploy(gomock.Any(), map[uint32]uint64{1: 10}, gomock.Any(), gomock.Any()).
+				DoAndReturn(func(ctx context.Context, oldIDs map[uint32]uint64, dls map[uint32]zosTypes.Deployment, sp map[uint32]*uint64) (map[uint32]uint64, error) {
+					for _, wl := range dls[1].Workloads {
+						assert.NotEqual(t, "vm", wl.Name)
+					}
+					return upgrade(ctx, oldIDs, dls, sp)
+				}),
+			deployer.EXPECT().
+				Deploy(gomock.Any(), map[uint32]uint64{1: 10}, map[uint32]zosTypes.Deployment{1: desired}, gomock.Any()).
+				DoAndReturn(upgrade),
+		)
+
+		events := r.Reconcile(context.Background())
+		require.Len(t, events, 1)
+		assert.Equal(t, DriftWorkloadChanged, events[0].Kind)
+		assert.Equal(t, "vm", events[0].Workload)
+		assert.True(t, events[0].Redeployed)
+		assert.NoError(t, events[0].RedeployError)
+	})
+
+	t.Run("missing deployment", func(t *testing.T) {
+		r, deployer, sub := newTestReconciler(t, WithRedeploy())
+
+		desired := deploymentWithDisks("vm", map[string]uint64{"d": 10})
+		require.NoError(t, r.Watch("vm", map[uint32]uint64{1: 10}, map[uint32]zosTypes.Deployment{1: desired}, nil))
+
+		deployer.EXPECT().
+			GetDeployments(gomock.Any(), map[uint32]uint64{1: 10}).
+			Return(nil, errors.New("deployment not found"))
+		sub.EXPECT().IsValidContract(uint64(10)).Return(false, nil)
+		deployer.EXPECT().
+			Deploy(gomock.Any(), map[uint32]uint64{}, map[uint32]zosTypes.Deployment{1: desired}, gomock.Any()).
+			Return(map[uint32]uint64{1: 11}, nil)
+
+		events := r.Reconcile(context.Background())
+		require.Len(t, events, 1)
+		assert.Equal(t, DriftDeploymentMissing, events[0].Kind)
+		assert.True(t, events[0].Redeployed)
+		assert.Equal(t, uint64(11), events[0].ContractID)
+		assert.Equal(t, map[uint32]uint64{1: 11}, r.Contracts("vm"))
+	})
+
+	t.Run("unreachable node", func(t *testing.T) {
+		r, deployer, sub := newTestReconciler(t, WithRedeploy())
+
+		desired := deploymentWithDisks("vm", map[string]uint64{"d": 10})
+		require.NoError(t, r.Watch("vm", map[uint32]uint64{1: 10}, map[uint32]zosTypes.Deployment{1: desired}, nil))
+
+		deployer.EXPECT().
+			GetDeployments(gomock.Any(), map[uint32]uint64{1: 10}).
+			Return(nil, errors.New("timeout"))
+		sub.EXPECT().IsValidContract(uint64(10)).Return(true, nil)
+
+		events := r.Reconcile(context.Background())
+		require.Len(t, events, 1)
+		assert.Equal(t, DriftNodeUnreachable, events[0].Kind)
+		assert.False(t, events[0].Redeployed)
+	})
+}
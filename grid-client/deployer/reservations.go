@@ -0,0 +1,232 @@
+package deployer
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	client "github.com/threefoldtech/tfgrid-sdk-go/grid-client/node"
+	zosTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-client/zos"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+	"github.com/threefoldtech/zos/pkg/gridtypes/zos"
+)
+
+// DefaultReservationTimeout is how long a reservation is kept if it is never released, it covers waiting for a deployment
+const DefaultReservationTimeout = time.Hour
+
+// Reservation is capacity claimed on a node by an in-flight deployment
+type Reservation struct {
+	NodeID  uint32
+	Item    PackingItem
+	Expires time.Time
+}
+
+// ReservationLedger remembers the capacity claimed on nodes by in-flight deployments of the client.
+// node filtering subtracts the claimed capacity so concurrent deployments don't pick the same nearly full node
+type ReservationLedger struct {
+	mu      sync.Mutex
+	next    uint64
+	timeout time.Duration
+	nodes   map[uint32]map[uint64]Reservation
+	// farms are the farms of the nodes seen while filtering, used to share farm public ips
+	farms map[uint32]int
+	now   func() time.Time
+}
+
+// NewReservationLedger returns a ledger where reservations expire after the timeout if not released
+func NewReservationLedger(timeout time.Duration) *ReservationLedger {
+	if timeout <= 0 {
+		timeout = DefaultReservationTimeout
+	}
+
+	return &ReservationLedger{
+		timeout: timeout,
+		nodes:   make(map[uint32]map[uint64]Reservation),
+		farms:   make(map[uint32]int),
+		now:     time.Now,
+	}
+}
+
+// Reserve claims capacity on a node and returns a function to release it, releasing twice is a no-op
+func (l *ReservationLedger) Reserve(nodeID uint32, item PackingItem) (release func()) {
+	if l == nil {
+		return func() {}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	id := l.next
+	l.next++
+	if l.nodes[nodeID] == nil {
+		l.nodes[nodeID] = make(map[uint64]Reservation)
+	}
+	l.nodes[nodeID][id] = Reservation{NodeID: nodeID, Item: item, Expires: l.now().Add(l.timeout)}
+
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		delete(l.nodes[nodeID], id)
+		if len(l.nodes[nodeID]) == 0 {
+			delete(l.nodes, nodeID)
+		}
+	}
+}
+
+// Reservations returns the reservations of a node that didn't expire
+func (l *ReservationLedger) Reservations(nodeID uint32) []Reservation {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.prune()
+	reservations := make([]Reservation, 0, len(l.nodes[nodeID]))
+	for _, reservation := range l.nodes[nodeID] {
+		reservations = append(reservations, reservation)
+	}
+	return reservations
+}
+
+// Reserved returns the total capacity claimed on a node, disks of all the reservations are merged
+func (l *ReservationLedger) Reserved(nodeID uint32) PackingItem {
+	var reserved PackingItem
+	for _, reservation := range l.Reservations(nodeID) {
+		reserved.MRU += reservation.Item.MRU
+		reserved.CRU = max(reserved.CRU, reservation.Item.CRU)
+		reserved.SSDDisks = append(reserved.SSDDisks, reservation.Item.SSDDisks...)
+		reserved.HDDDisks = append(reserved.HDDDisks, reservation.Item.HDDDisks...)
+		reserved.RootFS = append(reserved.RootFS, reservation.Item.RootFS...)
+		reserved.PublicIPs += reservation.Item.PublicIPs
+	}
+	return reserved
+}
+
+// setFarm records the farm of a node to account for the public ips reserved on the farm
+func (l *ReservationLedger) setFarm(nodeID uint32, farmID int) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.farms[nodeID] = farmID
+}
+
+// farmReservedIPs returns the public ips claimed on the known nodes of a farm
+func (l *ReservationLedger) farmReservedIPs(farmID int) uint64 {
+	if l == nil {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.prune()
+	var ips uint64
+	for nodeID, reservations := range l.nodes {
+		if farm, ok := l.farms[nodeID]; !ok || farm != farmID {
+			continue
+		}
+		for _, reservation := range reservations {
+			ips += reservation.Item.PublicIPs
+		}
+	}
+	return ips
+}
+
+// prune drops the expired reservations, the lock must be held
+func (l *ReservationLedger) prune() {
+	now := l.now()
+	for nodeID, reservations := range l.nodes {
+		for id, reservation := range reservations {
+			if now.After(reservation.Expires) {
+				delete(reservations, id)
+			}
+		}
+		if len(reservations) == 0 {
+			delete(l.nodes, nodeID)
+		}
+	}
+}
+
+// fits checks if a node returned by the proxy still matches the filter free resources after subtracting the reservations
+func (l *ReservationLedger) fits(node types.Node, options types.NodeFilter) bool {
+	if l == nil {
+		return true
+	}
+
+	l.setFarm(uint32(node.NodeID), node.FarmID)
+	reserved := l.Reserved(uint32(node.NodeID))
+	farmIPs := l.farmReservedIPs(node.FarmID)
+	if reserved.MRU == 0 && reserved.SRU() == 0 && reserved.HRU() == 0 && farmIPs == 0 {
+		return true
+	}
+
+	free := newPackingBin(PackingNode{Node: node}).free
+	fitsFree := func(needed *uint64, free gridtypes.Unit, reserved uint64) bool {
+		return needed == nil || uint64(freeAfterReserved(free, reserved)) >= *needed
+	}
+
+	return fitsFree(options.FreeMRU, free.MRU, reserved.MRU) &&
+		fitsFree(options.FreeSRU, free.SRU, reserved.SRU()) &&
+		fitsFree(options.FreeHRU, free.HRU, reserved.HRU()) &&
+		(options.FreeIPs == nil || uint64(node.FarmFreeIps) >= *options.FreeIPs+farmIPs)
+}
+
+// freeAfterReserved subtracts the reserved capacity from the free one
+func freeAfterReserved(free gridtypes.Unit, reserved uint64) gridtypes.Unit {
+	if uint64(free) < reserved {
+		return 0
+	}
+	return free - gridtypes.Unit(reserved)
+}
+
+// reservedPools returns a copy of the node pools with the reserved disks of the node used
+func (l *ReservationLedger) reservedPools(nodeID uint32, pools []client.PoolMetrics) []client.PoolMetrics {
+	reserved := l.Reserved(nodeID)
+	pools = slices.Clone(pools)
+
+	// a failed reservation means the pools are already full, the disks checks will fail anyway
+	reserveStorage(pools, packingSSDs(reserved), zos.SSDDevice)
+	reserveStorage(pools, reserved.HDDDisks, zos.HDDDevice)
+	return pools
+}
+
+// deploymentReservation returns the capacity a zos deployment claims on its node
+func deploymentReservation(dl zosTypes.Deployment) (PackingItem, error) {
+	var item PackingItem
+	for _, wl := range dl.Workloads {
+		wlCap, err := wl.Capacity()
+		if err != nil {
+			return PackingItem{}, errors.Wrapf(err, "could not get workload %s capacity", wl.Name)
+		}
+
+		item.MRU += wlCap.MRU
+		item.CRU = max(item.CRU, wlCap.CRU)
+		switch {
+		case wl.Type == zosTypes.ZMachineType || wl.Type == zosTypes.ZMachineLightType:
+			if wlCap.SRU != 0 {
+				item.RootFS = append(item.RootFS, wlCap.SRU)
+			}
+		case wlCap.SRU != 0:
+			item.SSDDisks = append(item.SSDDisks, wlCap.SRU)
+		}
+		if wlCap.HRU != 0 {
+			item.HDDDisks = append(item.HDDDisks, wlCap.HRU)
+		}
+	}
+
+	ips, err := CountDeploymentPublicIPs(dl)
+	if err != nil {
+		return PackingItem{}, errors.Wrap(err, "failed to count deployment public IPs")
+	}
+	item.PublicIPs = uint64(ips)
+
+	return item, nil
+}
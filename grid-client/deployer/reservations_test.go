@@ -0,0 +1,152 @@
+package deployer
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	client "github.com/threefoldtech/tfgrid-sdk-go/grid-client/node"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/simulation"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+	zosTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-client/zos"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+	"github.com/threefoldtech/zos/pkg/gridtypes/zos"
+)
+
+func TestReservationLedger(t *testing.T) {
+	gb := uint64(gridtypes.Gigabyte)
+
+	t.Run("reserve and release", func(t *testing.T) {
+		ledger := NewReservationLedger(0)
+		releaseA := ledger.Reserve(1, PackingItem{MRU: 2 * gb, SSDDisks: []uint64{10 * gb}, PublicIPs: 1})
+		releaseB := ledger.Reserve(1, PackingItem{MRU: 4 * gb, HDDDisks: []uint64{20 * gb}})
+		ledger.Reserve(2, PackingItem{MRU: 8 * gb})
+
+		reserved := ledger.Reserved(1)
+		assert.Equal(t, 6*gb, reserved.MRU)
+		assert.Equal(t, 10*gb, reserved.SRU())
+		assert.Equal(t, 20*gb, reserved.HRU())
+		assert.Equal(t, uint64(1), reserved.PublicIPs)
+
+		releaseA()
+		releaseA()
+		assert.Equal(t, 4*gb, ledger.Reserved(1).MRU)
+		releaseB()
+		assert.Empty(t, ledger.Reservations(1))
+		assert.Len(t, ledger.Reservations(2), 1)
+	})
+
+	t.Run("expiry", func(t *testing.T) {
+		ledger := NewReservationLedger(time.Minute)
+		now := time.Now()
+		ledger.now = func() time.Time { return now }
+
+		ledger.Reserve(1, PackingItem{MRU: gb})
+		assert.Len(t, ledger.Reservations(1), 1)
+
+		now = now.Add(2 * time.Minute)
+		assert.Empty(t, ledger.Reservations(1))
+	})
+
+	t.Run("fits", func(t *testing.T) {
+		ledger := NewReservationLedger(0)
+		node := types.Node{
+			NodeID:         1,
+			FarmID:         1,
+			FarmFreeIps:    1,
+			TotalResources: types.Capacity{MRU: 8 * gridtypes.Gigabyte, SRU: 100 * gridtypes.Gigabyte},
+		}
+		memory, ips := 4*gb, uint64(1)
+		options := types.NodeFilter{FreeMRU: &memory, FreeIPs: &ips}
+		assert.True(t, ledger.fits(node, options))
+
+		release := ledger.Reserve(1, PackingItem{MRU: 2 * gb})
+		assert.True(t, ledger.fits(node, options))
+		ledger.Reserve(1, PackingItem{MRU: 4 * gb})
+		assert.False(t, ledger.fits(node, options))
+		release()
+		assert.True(t, ledger.fits(node, options))
+
+		// public ips reserved on another node of the farm
+		ledger.setFarm(2, 1)
+		ledger.Reserve(2, PackingItem{PublicIPs: 1})
+		assert.False(t, ledger.fits(node, options))
+	})
+
+	t.Run("pools", func(t *testing.T) {
+		ledger := NewReservationLedger(0)
+		pools := []client.PoolMetrics{
+			{Type: zos.SSDDevice, Size: 20 * gridtypes.Gigabyte},
+			{Type: zos.HDDDevice, Size: 50 * gridtypes.Gigabyte},
+		}
+		ledger.Reserve(1, PackingItem{SSDDisks: []uint64{15 * gb}, HDDDisks: []uint64{10 * gb}})
+
+		reserved := ledger.reservedPools(1, pools)
+		assert.Equal(t, 15*gridtypes.Gigabyte, reserved[0].Used)
+		assert.Equal(t, 10*gridtypes.Gigabyte, reserved[1].Used)
+		assert.Zero(t, pools[0].Used)
+		assert.False(t, hasEnoughStorage(reserved, []uint64{10 * gb}, zos.SSDDevice))
+	})
+}
+
+func TestReservationsDeploy(t *testing.T) {
+	// serves the flist of the vm
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer hub.Close()
+
+	grid := simulation.NewGrid()
+	require.NoError(t, grid.AddNode(simulation.Node{
+		ID:     4,
+		FarmID: 1,
+		Total:  zosTypes.Capacity{CRU: 4, MRU: 8 * zosTypes.Gigabyte, SRU: 100 * zosTypes.Gigabyte},
+	}))
+
+	tfPluginClient, err := NewTFPluginClient(simulationMnemonic, WithSimulation(grid))
+	require.NoError(t, err)
+	defer tfPluginClient.Close()
+
+	ctx := context.Background()
+	memory := uint64(4 * gridtypes.Gigabyte)
+	filter := types.NodeFilter{NodeIDs: []uint64{4}, FreeMRU: &memory}
+
+	nodes, err := FilterNodes(ctx, tfPluginClient, filter, nil, nil, nil)
+	require.NoError(t, err)
+	require.Len(t, nodes, 1)
+
+	release := tfPluginClient.Reservations.Reserve(4, PackingItem{MRU: 6 * uint64(gridtypes.Gigabyte)})
+	_, err = FilterNodes(ctx, tfPluginClient, filter, nil, nil, nil)
+	assert.ErrorIs(t, err, ErrNoNodesMatchesResources)
+
+	network := workloads.ZNet{
+		Name:  "reserved",
+		Nodes: []uint32{4},
+		IPRange: zosTypes.IPNet{IPNet: net.IPNet{
+			IP:   net.IPv4(10, 20, 0, 0),
+			Mask: net.CIDRMask(16, 32),
+		}},
+	}
+	require.NoError(t, tfPluginClient.NetworkDeployer.Deploy(ctx, &network))
+
+	vm := workloads.VM{
+		Name:        "vm",
+		NodeID:      4,
+		Flist:       hub.URL + "/app.flist",
+		CPU:         1,
+		MemoryMB:    4 * 1024,
+		NetworkName: network.Name,
+	}
+	dl := workloads.NewDeployment("reserved", 4, "", nil, network.Name, nil, nil, []workloads.VM{vm}, nil, nil, nil)
+	err = tfPluginClient.DeploymentDeployer.Deploy(ctx, &dl)
+	assert.ErrorContains(t, err, "does not have enough resources")
+
+	release()
+	require.NoError(t, tfPluginClient.DeploymentDeployer.Deploy(ctx, &dl))
+	assert.NotZero(t, dl.ContractID)
+	assert.Empty(t, tfPluginClient.Reservations.Reservations(4))
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	baseLog "log"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
@@ -19,6 +20,7 @@ import (
 	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/calculator"
 	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/graphql"
 	client "github.com/threefoldtech/tfgrid-sdk-go/grid-client/node"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/simulation"
 	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/state"
 	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/subi"
 	proxy "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/client"
@@ -47,6 +49,7 @@ type TFPluginClient struct {
 	RMB             rmb.Client
 	SubstrateConn   subi.SubstrateExt
 	NcPool          client.NodeClientGetter
+	DNSResolver     DNSResolver
 
 	// deployers
 	DeploymentDeployer  DeploymentDeployer
@@ -68,6 +71,12 @@ type TFPluginClient struct {
 	cancelRelayContext context.CancelFunc
 
 	sentry gridSentry
+
+	// deployment events observers
+	observers *observers
+
+	// Reservations are the capacity claimed by in-flight deployments, subtracted while filtering nodes
+	Reservations *ReservationLedger
 }
 
 type pluginCfg struct {
@@ -80,6 +89,12 @@ type pluginCfg struct {
 	rmbTimeout    int
 	showLogs      bool
 	rmbInMemCache bool
+	stateStore    state.StateStore
+	pricingSource calculator.PricingSource
+	simulation    *simulation.Grid
+	dnsResolver   DNSResolver
+	// reservationTimeout is how long in-flight deployments keep their capacity reserved if not released
+	reservationTimeout time.Duration
 }
 
 type PluginOpt func(*pluginCfg)
@@ -138,6 +153,34 @@ func WithGraphQlURL(graphqlURLs ...string) PluginOpt {
 	}
 }
 
+// WithStateStore persists the client state in the given store so it survives restarts
+func WithStateStore(store state.StateStore) PluginOpt {
+	return func(p *pluginCfg) {
+		p.stateStore = store
+	}
+}
+
+// WithDNSResolver resolves the fqdn of gateways with the given resolver instead of the system one
+func WithDNSResolver(resolver DNSResolver) PluginOpt {
+	return func(p *pluginCfg) {
+		p.dnsResolver = resolver
+	}
+}
+
+// WithReservationTimeout expires the capacity reservations of in-flight deployments after the timeout instead of the default one
+func WithReservationTimeout(timeout time.Duration) PluginOpt {
+	return func(p *pluginCfg) {
+		p.reservationTimeout = timeout
+	}
+}
+
+// WithPricingSource calculates costs from the given source instead of live tfchain data
+func WithPricingSource(source calculator.PricingSource) PluginOpt {
+	return func(p *pluginCfg) {
+		p.pricingSource = source
+	}
+}
+
 func parsePluginOpts(opts ...PluginOpt) (pluginCfg, error) {
 	cfg := pluginCfg{
 		network:       "main",
@@ -149,6 +192,7 @@ func parsePluginOpts(opts ...PluginOpt) (pluginCfg, error) {
 		rmbTimeout:    60, // default rmbTimeout is 60
 		showLogs:      false,
 		rmbInMemCache: true,
+		dnsResolver:   net.DefaultResolver,
 	}
 
 	for _, o := range opts {
@@ -251,6 +295,17 @@ func NewTFPluginClient(
 	tfPluginClient.proxyURLs = cfg.proxyURLs
 	tfPluginClient.graphqlURLs = cfg.graphqlURLs
 	tfPluginClient.relayURLs = cfg.relayURLs
+	tfPluginClient.DNSResolver = cfg.dnsResolver
+
+	if cfg.simulation != nil {
+		if err := tfPluginClient.connectSimulation(cfg, keyPair.Public()); err != nil {
+			return TFPluginClient{}, err
+		}
+		if err := tfPluginClient.initDeployers(cfg); err != nil {
+			return TFPluginClient{}, err
+		}
+		return tfPluginClient, nil
+	}
 
 	manager := subi.NewManager(tfPluginClient.substrateURLs...)
 	sub, err := manager.SubstrateExt()
@@ -332,27 +387,46 @@ func NewTFPluginClient(
 	}
 	tfPluginClient.GridProxyClient = proxy.NewRetryingClient(gridProxyClient)
 
-	ncPool := client.NewNodeClientPool(tfPluginClient.RMB, tfPluginClient.RMBTimeout)
-	tfPluginClient.NcPool = ncPool
+	if err := tfPluginClient.initDeployers(cfg); err != nil {
+		return TFPluginClient{}, err
+	}
+
+	return tfPluginClient, nil
+}
+
+// initDeployers creates the node clients pool, the deployers, the contracts getter, the state and the calculator
+func (t *TFPluginClient) initDeployers(cfg pluginCfg) (err error) {
+	t.NcPool = client.NewNodeClientPool(t.RMB, t.RMBTimeout)
+
+	t.observers = newObservers()
+	t.Reservations = NewReservationLedger(cfg.reservationTimeout)
 
-	tfPluginClient.DeploymentDeployer = NewDeploymentDeployer(&tfPluginClient)
-	tfPluginClient.NetworkDeployer = NewNetworkDeployer(&tfPluginClient)
-	tfPluginClient.GatewayFQDNDeployer = NewGatewayFqdnDeployer(&tfPluginClient)
-	tfPluginClient.K8sDeployer = NewK8sDeployer(&tfPluginClient)
-	tfPluginClient.GatewayNameDeployer = NewGatewayNameDeployer(&tfPluginClient)
+	t.DeploymentDeployer = NewDeploymentDeployer(t)
+	t.NetworkDeployer = NewNetworkDeployer(t)
+	t.GatewayFQDNDeployer = NewGatewayFqdnDeployer(t)
+	t.K8sDeployer = NewK8sDeployer(t)
+	t.GatewayNameDeployer = NewGatewayNameDeployer(t)
 
-	tfPluginClient.graphQl, err = graphql.NewGraphQl(tfPluginClient.graphqlURLs...)
+	t.graphQl, err = graphql.NewGraphQl(t.graphqlURLs...)
 	if err != nil {
-		return TFPluginClient{}, errors.Wrapf(err, "could not create a new graphql with urls: %v", tfPluginClient.graphqlURLs)
+		return errors.Wrapf(err, "could not create a new graphql with urls: %v", t.graphqlURLs)
 	}
 
-	tfPluginClient.ContractsGetter = graphql.NewContractsGetter(tfPluginClient.TwinID, tfPluginClient.graphQl, tfPluginClient.SubstrateConn, tfPluginClient.NcPool)
+	t.ContractsGetter = graphql.NewContractsGetter(t.TwinID, t.graphQl, t.SubstrateConn, t.NcPool)
 
-	tfPluginClient.State = state.NewState(tfPluginClient.NcPool, tfPluginClient.SubstrateConn)
+	t.State = state.NewState(t.NcPool, t.SubstrateConn)
+	if cfg.stateStore != nil {
+		if err := t.State.AttachStore(t.TwinID, cfg.stateStore); err != nil {
+			return errors.Wrap(err, "could not load persisted state")
+		}
+	}
 
-	tfPluginClient.Calculator = calculator.NewCalculator(tfPluginClient.SubstrateConn, tfPluginClient.Identity)
+	t.Calculator = calculator.NewCalculator(t.SubstrateConn, t.Identity)
+	if cfg.pricingSource != nil {
+		t.Calculator = calculator.NewCalculatorFromSource(cfg.pricingSource, t.Identity)
+	}
 
-	return tfPluginClient, nil
+	return nil
 }
 
 // Close closes the relay connection and the substrate connection
@@ -366,7 +440,14 @@ func (t *TFPluginClient) Close() {
 
 // BatchCancelContract to cancel a batch of contracts
 func (t *TFPluginClient) BatchCancelContract(contracts []uint64) error {
-	return t.SubstrateConn.BatchCancelContract(t.Identity, contracts)
+	if err := t.SubstrateConn.BatchCancelContract(t.Identity, contracts); err != nil {
+		return err
+	}
+
+	for _, contractID := range contracts {
+		t.observers.emit(Event{Type: EventContractCanceled, ContractID: contractID})
+	}
+	return nil
 }
 
 func generateSessionID() string {
@@ -0,0 +1,386 @@
+package deployer
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/graphql"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+	proxyTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// billsPageSize is the number of bills fetched per proxy request
+	billsPageSize = 200
+	// billingWorkers is the number of contracts bills fetched concurrently
+	billingWorkers = 10
+	// tftUnit is the number of billed units in one TFT
+	tftUnit = 1e7
+)
+
+// BillingGroupBy is the grouping of a billing report export
+type BillingGroupBy string
+
+const (
+	// BillingByContract exports a line per contract
+	BillingByContract BillingGroupBy = "contract"
+	// BillingByDeployment exports a line per project and deployment name
+	BillingByDeployment BillingGroupBy = "deployment"
+	// BillingByProject exports a line per project
+	BillingByProject BillingGroupBy = "project"
+)
+
+// BillingQuery selects the contracts and the time window of a billing report
+type BillingQuery struct {
+	// From and To limit the bills to [From, To), unset bounds are ignored
+	From time.Time
+	To   time.Time
+	// ProjectName limits the report to a project, name contracts are matched through their gateway deployments
+	ProjectName string
+	// States are the contracts states, all states if empty so deleted contracts billed in the window are counted
+	States []string
+}
+
+// Bill is a single billing report of a contract
+type Bill struct {
+	// AmountBilled is in units of 1e-7 TFT
+	AmountBilled uint64    `json:"amount_billed"`
+	Discount     string    `json:"discount,omitempty"`
+	Timestamp    time.Time `json:"timestamp"`
+}
+
+// ContractCost is what a contract was billed in the report window
+type ContractCost struct {
+	ContractID uint64 `json:"contract_id"`
+	// Type is node, name or rent
+	Type           string `json:"type"`
+	State          string `json:"state"`
+	NodeID         uint32 `json:"node_id,omitempty"`
+	ProjectName    string `json:"project_name"`
+	DeploymentName string `json:"deployment_name"`
+	// AmountBilled is in units of 1e-7 TFT
+	AmountBilled  uint64    `json:"amount_billed"`
+	TFT           float64   `json:"tft"`
+	FirstBilledAt time.Time `json:"first_billed_at"`
+	LastBilledAt  time.Time `json:"last_billed_at"`
+	// Bills are the contract bills in the window, oldest first
+	Bills []Bill `json:"bills"`
+}
+
+// BillingGroup is the total billed for a project or a deployment of a project
+type BillingGroup struct {
+	ProjectName    string   `json:"project_name"`
+	DeploymentName string   `json:"deployment_name,omitempty"`
+	Contracts      []uint64 `json:"contracts"`
+	Bills          int      `json:"bills"`
+	// AmountBilled is in units of 1e-7 TFT
+	AmountBilled uint64  `json:"amount_billed"`
+	TFT          float64 `json:"tft"`
+}
+
+// BillingReport is the billing of contracts over a time window, contracts without deployment data are grouped under empty names
+type BillingReport struct {
+	From        time.Time      `json:"from"`
+	To          time.Time      `json:"to"`
+	Contracts   []ContractCost `json:"contracts"`
+	Deployments []BillingGroup `json:"deployments"`
+	Projects    []BillingGroup `json:"projects"`
+	// AmountBilled is in units of 1e-7 TFT
+	AmountBilled uint64  `json:"amount_billed"`
+	TFT          float64 `json:"tft"`
+}
+
+// billingOwner is the project and deployment a contract is billed to
+type billingOwner struct {
+	project    string
+	deployment string
+}
+
+// BillingReport returns what the twin contracts were billed in the query window, bills are loaded from the grid proxy
+func (t *TFPluginClient) BillingReport(ctx context.Context, query BillingQuery) (BillingReport, error) {
+	contractsQuery := graphql.ContractsQuery{States: query.States}
+	if !query.To.IsZero() {
+		contractsQuery.CreatedBefore = query.To
+	}
+
+	contracts, err := t.ContractsGetter.ListContracts(ctx, contractsQuery)
+	if err != nil {
+		return BillingReport{}, errors.Wrap(err, "failed to list contracts")
+	}
+
+	if query.ProjectName != "" {
+		owners := billingOwners(contracts)
+		projectContracts := make([]graphql.ContractInfo, 0, len(contracts))
+		for _, contract := range contracts {
+			if owners[contract.ContractID].project == query.ProjectName {
+				projectContracts = append(projectContracts, contract)
+			}
+		}
+		contracts = projectContracts
+	}
+
+	bills, err := t.contractsBills(ctx, contracts, query.From)
+	if err != nil {
+		return BillingReport{}, err
+	}
+
+	return AggregateBills(contracts, bills, query.From, query.To), nil
+}
+
+// ProjectBillingReport returns what the contracts of a project were billed between from and to
+func (t *TFPluginClient) ProjectBillingReport(ctx context.Context, projectName string, from, to time.Time) (BillingReport, error) {
+	if projectName == "" {
+		return BillingReport{}, errors.New("project name is required")
+	}
+	return t.BillingReport(ctx, BillingQuery{From: from, To: to, ProjectName: projectName})
+}
+
+// contractsBills loads the bills of the contracts concurrently, bills older than from are not needed
+func (t *TFPluginClient) contractsBills(ctx context.Context, contracts []graphql.ContractInfo, from time.Time) (map[uint64][]proxyTypes.ContractBilling, error) {
+	var mu sync.Mutex
+	bills := make(map[uint64][]proxyTypes.ContractBilling, len(contracts))
+
+	group, ctx := errgroup.WithContext(ctx)
+	group.SetLimit(billingWorkers)
+	for _, contract := range contracts {
+		contractID := contract.ContractID
+		group.Go(func() error {
+			contractBills, err := t.contractBills(ctx, contractID, from)
+			if err != nil {
+				return err
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			bills[contractID] = contractBills
+			return nil
+		})
+	}
+
+	return bills, group.Wait()
+}
+
+// contractBills pages through the bills of a contract, the proxy returns the newest bills first
+func (t *TFPluginClient) contractBills(ctx context.Context, contractID uint64, from time.Time) ([]proxyTypes.ContractBilling, error) {
+	var bills []proxyTypes.ContractBilling
+	for page := uint64(1); ; page++ {
+		pageBills, _, err := t.GridProxyClient.ContractBills(ctx, uint32(contractID), proxyTypes.Limit{Size: billsPageSize, Page: page})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get bills of contract %d", contractID)
+		}
+		bills = append(bills, pageBills...)
+
+		if len(pageBills) < billsPageSize {
+			return bills, nil
+		}
+		if oldest := pageBills[len(pageBills)-1]; !from.IsZero() && billTime(oldest).Before(from) {
+			return bills, nil
+		}
+	}
+}
+
+// AggregateBills sums the bills of the contracts in [from, to) per contract, deployment and project.
+// unset bounds are ignored and bills of contracts not in the list are skipped
+func AggregateBills(contracts []graphql.ContractInfo, bills map[uint64][]proxyTypes.ContractBilling, from, to time.Time) BillingReport {
+	report := BillingReport{
+		From:        from,
+		To:          to,
+		Contracts:   []ContractCost{},
+		Deployments: []BillingGroup{},
+		Projects:    []BillingGroup{},
+	}
+
+	owners := billingOwners(contracts)
+	deployments := map[billingOwner]*BillingGroup{}
+	projects := map[string]*BillingGroup{}
+
+	for _, contract := range contracts {
+		owner := owners[contract.ContractID]
+		cost := ContractCost{
+			ContractID:     contract.ContractID,
+			Type:           billingContractType(contract.Kind),
+			State:          contract.State,
+			NodeID:         contract.NodeID,
+			ProjectName:    owner.project,
+			DeploymentName: owner.deployment,
+			Bills:          []Bill{},
+		}
+
+		for _, bill := range bills[contract.ContractID] {
+			timestamp := billTime(bill)
+			if (!from.IsZero() && timestamp.Before(from)) || (!to.IsZero() && !timestamp.Before(to)) {
+				continue
+			}
+			cost.Bills = append(cost.Bills, Bill{AmountBilled: bill.AmountBilled, Discount: bill.DiscountReceived, Timestamp: timestamp})
+			cost.AmountBilled += bill.AmountBilled
+		}
+
+		sort.SliceStable(cost.Bills, func(i, j int) bool { return cost.Bills[i].Timestamp.Before(cost.Bills[j].Timestamp) })
+		if len(cost.Bills) != 0 {
+			cost.FirstBilledAt = cost.Bills[0].Timestamp
+			cost.LastBilledAt = cost.Bills[len(cost.Bills)-1].Timestamp
+		}
+		cost.TFT = billedTFT(cost.AmountBilled)
+		report.Contracts = append(report.Contracts, cost)
+		report.AmountBilled += cost.AmountBilled
+
+		if deployments[owner] == nil {
+			deployments[owner] = &BillingGroup{ProjectName: owner.project, DeploymentName: owner.deployment}
+		}
+		deployments[owner].add(cost)
+
+		if projects[owner.project] == nil {
+			projects[owner.project] = &BillingGroup{ProjectName: owner.project}
+		}
+		projects[owner.project].add(cost)
+	}
+
+	for _, group := range deployments {
+		report.Deployments = append(report.Deployments, *group)
+	}
+	for _, group := range projects {
+		report.Projects = append(report.Projects, *group)
+	}
+	sortBillingGroups(report.Deployments)
+	sortBillingGroups(report.Projects)
+	report.TFT = billedTFT(report.AmountBilled)
+
+	return report
+}
+
+func (g *BillingGroup) add(cost ContractCost) {
+	g.Contracts = append(g.Contracts, cost.ContractID)
+	g.Bills += len(cost.Bills)
+	g.AmountBilled += cost.AmountBilled
+	g.TFT = billedTFT(g.AmountBilled)
+}
+
+// WriteJSON writes the report as indented json
+func (r BillingReport) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// WriteCSV writes a line per contract, deployment or project with a header line
+func (r BillingReport) WriteCSV(w io.Writer, by BillingGroupBy) error {
+	writer := csv.NewWriter(w)
+
+	var records [][]string
+	switch by {
+	case BillingByContract:
+		records = append(records, []string{"contract_id", "type", "state", "node_id", "project_name", "deployment_name", "bills", "amount_billed", "tft", "first_billed_at", "last_billed_at"})
+		for _, cost := range r.Contracts {
+			records = append(records, []string{
+				strconv.FormatUint(cost.ContractID, 10),
+				cost.Type,
+				cost.State,
+				strconv.FormatUint(uint64(cost.NodeID), 10),
+				cost.ProjectName,
+				cost.DeploymentName,
+				strconv.Itoa(len(cost.Bills)),
+				strconv.FormatUint(cost.AmountBilled, 10),
+				formatTFT(cost.TFT),
+				formatBillTime(cost.FirstBilledAt),
+				formatBillTime(cost.LastBilledAt),
+			})
+		}
+	case BillingByDeployment, BillingByProject:
+		groups := r.Projects
+		if by == BillingByDeployment {
+			groups = r.Deployments
+		}
+		records = append(records, []string{"project_name", "deployment_name", "contracts", "bills", "amount_billed", "tft"})
+		for _, group := range groups {
+			records = append(records, []string{
+				group.ProjectName,
+				group.DeploymentName,
+				strconv.Itoa(len(group.Contracts)),
+				strconv.Itoa(group.Bills),
+				strconv.FormatUint(group.AmountBilled, 10),
+				formatTFT(group.TFT),
+			})
+		}
+	default:
+		return fmt.Errorf("invalid billing grouping '%s'", by)
+	}
+
+	if err := writer.WriteAll(records); err != nil {
+		return errors.Wrap(err, "failed to write billing csv")
+	}
+	return nil
+}
+
+// billingOwners maps the contracts to their project and deployment names.
+// name contracts have no deployment data, they are owned by the gateway name deployment of the same name
+func billingOwners(contracts []graphql.ContractInfo) map[uint64]billingOwner {
+	owners := make(map[uint64]billingOwner, len(contracts))
+	gateways := map[string]billingOwner{}
+	for _, contract := range contracts {
+		if contract.Kind != graphql.NodeContractKind {
+			continue
+		}
+		owner := billingOwner{project: contract.Deployment.ProjectName, deployment: contract.Deployment.Name}
+		owners[contract.ContractID] = owner
+		if contract.Deployment.Type == workloads.GatewayNameType {
+			gateways[contract.Deployment.Name] = owner
+		}
+	}
+
+	for _, contract := range contracts {
+		if contract.Kind == graphql.NameContractKind {
+			owners[contract.ContractID] = gateways[contract.Name]
+		}
+	}
+	return owners
+}
+
+func billingContractType(kind graphql.ContractKind) string {
+	switch kind {
+	case graphql.NodeContractKind:
+		return "node"
+	case graphql.NameContractKind:
+		return "name"
+	case graphql.RentContractKind:
+		return "rent"
+	}
+	return string(kind)
+}
+
+func sortBillingGroups(groups []BillingGroup) {
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].ProjectName != groups[j].ProjectName {
+			return groups[i].ProjectName < groups[j].ProjectName
+		}
+		return groups[i].DeploymentName < groups[j].DeploymentName
+	})
+}
+
+// billTime returns the time of a proxy bill, timestamps are in seconds
+func billTime(bill proxyTypes.ContractBilling) time.Time {
+	return time.Unix(int64(bill.Timestamp), 0)
+}
+
+func billedTFT(amount uint64) float64 {
+	return float64(amount) / tftUnit
+}
+
+func formatTFT(tft float64) string {
+	return strconv.FormatFloat(tft, 'f', 7, 64)
+}
+
+func formatBillTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,180 @@
+package deployer
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/graphql"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/simulation"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+	proxyTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+)
+
+func billingContract(id uint64, kind graphql.ContractKind, project, name, typ string) graphql.ContractInfo {
+	return graphql.ContractInfo{
+		Kind:       kind,
+		ContractID: id,
+		State:      "Created",
+		Deployment: workloads.DeploymentData{Type: typ, Name: name, ProjectName: project},
+	}
+}
+
+func recordedBills(contractID uint64, start time.Time, amounts ...uint64) []proxyTypes.ContractBilling {
+	var bills []proxyTypes.ContractBilling
+	// the proxy returns the newest bills first
+	for i := len(amounts) - 1; i >= 0; i-- {
+		bills = append(bills, proxyTypes.ContractBilling{
+			ContractId:   contractID,
+			AmountBilled: amounts[i],
+			Timestamp:    uint64(start.Add(time.Duration(i) * time.Hour).Unix()),
+		})
+	}
+	return bills
+}
+
+func TestAggregateBills(t *testing.T) {
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	name := billingContract(3, graphql.NameContractKind, "", "", "")
+	name.Name = "gw"
+	rent := billingContract(4, graphql.RentContractKind, "", "", "")
+	rent.NodeID = 7
+	contracts := []graphql.ContractInfo{
+		billingContract(1, graphql.NodeContractKind, "web", "vm", workloads.VMType),
+		billingContract(2, graphql.NodeContractKind, "web", "gw", workloads.GatewayNameType),
+		name,
+		rent,
+		billingContract(5, graphql.NodeContractKind, "db", "vm", workloads.VMType),
+	}
+	bills := map[uint64][]proxyTypes.ContractBilling{
+		1:  recordedBills(1, start, 100, 200, 300),
+		2:  recordedBills(2, start, 10, 10),
+		3:  recordedBills(3, start, 5),
+		4:  recordedBills(4, start, 1e7),
+		5:  recordedBills(5, start.Add(-time.Hour), 1000, 2000),
+		42: recordedBills(42, start, 1),
+	}
+
+	t.Run("window", func(t *testing.T) {
+		report := AggregateBills(contracts, bills, start, start.Add(2*time.Hour))
+		require.Len(t, report.Contracts, 5)
+
+		vm := report.Contracts[0]
+		assert.Equal(t, uint64(300), vm.AmountBilled)
+		assert.Len(t, vm.Bills, 2)
+		assert.Equal(t, start, vm.FirstBilledAt.UTC())
+		assert.Equal(t, start.Add(time.Hour), vm.LastBilledAt.UTC())
+
+		gateway := report.Contracts[2]
+		assert.Equal(t, "name", gateway.Type)
+		assert.Equal(t, "web", gateway.ProjectName)
+		assert.Equal(t, "gw", gateway.DeploymentName)
+
+		assert.Equal(t, "rent", report.Contracts[3].Type)
+		assert.Equal(t, 1.0, report.Contracts[3].TFT)
+		// the first bill of the db contract is before the window
+		assert.Equal(t, uint64(2000), report.Contracts[4].AmountBilled)
+
+		assert.Equal(t, uint64(300+20+5+1e7+2000), report.AmountBilled)
+	})
+
+	t.Run("groups", func(t *testing.T) {
+		report := AggregateBills(contracts, bills, time.Time{}, time.Time{})
+
+		assert.Equal(t, []BillingGroup{
+			{ProjectName: "", Contracts: []uint64{4}, Bills: 1, AmountBilled: 1e7, TFT: 1},
+			{ProjectName: "db", Contracts: []uint64{5}, Bills: 2, AmountBilled: 3000, TFT: 0.0003},
+			{ProjectName: "web", Contracts: []uint64{1, 2, 3}, Bills: 6, AmountBilled: 625, TFT: 0.0000625},
+		}, report.Projects)
+
+		require.Len(t, report.Deployments, 4)
+		assert.Equal(t, BillingGroup{ProjectName: "web", DeploymentName: "gw", Contracts: []uint64{2, 3}, Bills: 3, AmountBilled: 25, TFT: 0.0000025}, report.Deployments[2])
+		assert.Equal(t, "vm", report.Deployments[3].DeploymentName)
+		assert.Equal(t, uint64(600), report.Deployments[3].AmountBilled)
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		report := AggregateBills(contracts, bills, start, start.Add(2*time.Hour))
+
+		var buf bytes.Buffer
+		require.NoError(t, report.WriteCSV(&buf, BillingByContract))
+		records, err := csv.NewReader(&buf).ReadAll()
+		require.NoError(t, err)
+		require.Len(t, records, 6)
+		assert.Equal(t, []string{"1", "node", "Created", "0", "web", "vm", "2", "300", "0.0000300", "2024-03-01T00:00:00Z", "2024-03-01T01:00:00Z"}, records[1])
+
+		buf.Reset()
+		require.NoError(t, report.WriteCSV(&buf, BillingByProject))
+		records, err = csv.NewReader(&buf).ReadAll()
+		require.NoError(t, err)
+		assert.Equal(t, [][]string{
+			{"project_name", "deployment_name", "contracts", "bills", "amount_billed", "tft"},
+			{"", "", "1", "1", "10000000", "1.0000000"},
+			{"db", "", "1", "1", "2000", "0.0002000"},
+			{"web", "", "3", "5", "325", "0.0000325"},
+		}, records)
+
+		assert.Error(t, report.WriteCSV(&buf, "node"))
+	})
+
+	t.Run("json", func(t *testing.T) {
+		report := AggregateBills(contracts, bills, start, start.Add(2*time.Hour))
+
+		var buf bytes.Buffer
+		require.NoError(t, report.WriteJSON(&buf))
+
+		var decoded BillingReport
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+		assert.Equal(t, report.AmountBilled, decoded.AmountBilled)
+		assert.Len(t, decoded.Contracts, 5)
+		assert.Len(t, decoded.Contracts[0].Bills, 2)
+	})
+}
+
+func TestBillingReport(t *testing.T) {
+	grid := simulation.NewGrid()
+	tfPluginClient, err := NewTFPluginClient(simulationMnemonic, WithSimulation(grid))
+	require.NoError(t, err)
+	defer tfPluginClient.Close()
+
+	projects := []string{"web", "web", "db"}
+	var contractIDs []uint64
+	for i, project := range projects {
+		data, err := json.Marshal(workloads.DeploymentData{Type: workloads.VMType, Name: fmt.Sprintf("vm%d", i), ProjectName: project})
+		require.NoError(t, err)
+		contractID, err := tfPluginClient.SubstrateConn.CreateNodeContract(tfPluginClient.Identity, 1, string(data), fmt.Sprintf("hash%d", i), 0, nil)
+		require.NoError(t, err)
+		contractIDs = append(contractIDs, contractID)
+	}
+
+	now := time.Now().Truncate(time.Second)
+	for i := 0; i < billsPageSize+10; i++ {
+		require.NoError(t, grid.BillContract(contractIDs[0], 100, now.Add(-time.Duration(i)*time.Minute)))
+	}
+	require.NoError(t, grid.BillContract(contractIDs[1], 50, now))
+	require.NoError(t, grid.BillContract(contractIDs[2], 1000, now))
+
+	ctx := context.Background()
+	report, err := tfPluginClient.BillingReport(ctx, BillingQuery{})
+	require.NoError(t, err)
+	assert.Len(t, report.Contracts, 3)
+	assert.Equal(t, uint64((billsPageSize+10)*100+50+1000), report.AmountBilled)
+
+	report, err = tfPluginClient.ProjectBillingReport(ctx, "web", now.Add(-time.Hour+time.Second), now.Add(time.Second))
+	require.NoError(t, err)
+	require.Len(t, report.Contracts, 2)
+	assert.Len(t, report.Contracts[0].Bills, 60)
+	assert.Equal(t, uint64(60*100+50), report.AmountBilled)
+	require.Len(t, report.Projects, 1)
+	assert.Equal(t, "web", report.Projects[0].ProjectName)
+
+	_, err = tfPluginClient.ProjectBillingReport(ctx, "", time.Time{}, time.Time{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,336 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/calculator"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/zos"
+	proxyTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+)
+
+// CostItemKind is the kind of a cost estimate line
+type CostItemKind string
+
+const (
+	// CostCompute for the compute units of a node contract
+	CostCompute CostItemKind = "compute"
+	// CostStorage for the storage units of a node contract
+	CostStorage CostItemKind = "storage"
+	// CostIPv4 for the public ipv4s of a node contract
+	CostIPv4 CostItemKind = "ipv4"
+	// CostNameContract for the name contract of a name gateway
+	CostNameContract CostItemKind = "name_contract"
+	// CostRent for renting a dedicated node
+	CostRent CostItemKind = "rent"
+	// CostExtraFee for the extra fee the farmer sets on a dedicated node
+	CostExtraFee CostItemKind = "extra_fee"
+)
+
+// CostItem is a line of a cost estimate, costs are monthly in TFT at the current tft price
+type CostItem struct {
+	Kind        CostItemKind `json:"kind"`
+	Description string       `json:"description"`
+	NodeID      uint32       `json:"node_id,omitempty"`
+	Units       float64      `json:"units"`
+	UnitPrice   float64      `json:"unit_price"`
+	MonthlyCost float64      `json:"monthly_cost"`
+}
+
+// CostEstimate is an itemized monthly cost estimate in TFT, costs use the same unit as calculator.UnitPrices
+type CostEstimate struct {
+	Items       []CostItem `json:"items"`
+	MonthlyCost float64    `json:"monthly_cost"`
+}
+
+func (e *CostEstimate) add(item CostItem) {
+	if item.MonthlyCost == 0 {
+		return
+	}
+	e.Items = append(e.Items, item)
+	e.MonthlyCost += item.MonthlyCost
+}
+
+// EstimateDeployment estimates the monthly cost of a deployment
+func (t *TFPluginClient) EstimateDeployment(ctx context.Context, dl workloads.Deployment) (CostEstimate, error) {
+	wls, err := deploymentWorkloads(&dl)
+	if err != nil {
+		return CostEstimate{}, err
+	}
+
+	e := newEstimator(t)
+	if err := e.addDeployment(ctx, dl.Name, dl.NodeID, wls); err != nil {
+		return CostEstimate{}, err
+	}
+
+	return e.estimate, nil
+}
+
+// EstimateK8sCluster estimates the monthly cost of a kubernetes cluster
+func (t *TFPluginClient) EstimateK8sCluster(ctx context.Context, k8sCluster workloads.K8sCluster) (CostEstimate, error) {
+	if k8sCluster.Master == nil {
+		return CostEstimate{}, errors.New("kubernetes cluster master is required")
+	}
+
+	nodeWorkloads := k8sWorkloads(&k8sCluster)
+
+	nodes := make([]uint32, 0, len(nodeWorkloads))
+	for nodeID := range nodeWorkloads {
+		nodes = append(nodes, nodeID)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i] < nodes[j] })
+
+	e := newEstimator(t)
+	for _, nodeID := range nodes {
+		if err := e.addDeployment(ctx, k8sCluster.Master.Name, nodeID, nodeWorkloads[nodeID]); err != nil {
+			return CostEstimate{}, err
+		}
+	}
+
+	return e.estimate, nil
+}
+
+// EstimateNetwork estimates the monthly cost of a network, network traffic is billed by usage and is not estimated
+func (t *TFPluginClient) EstimateNetwork(ctx context.Context, znet workloads.Network) (CostEstimate, error) {
+	nodes := append([]uint32{}, znet.GetNodes()...)
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i] < nodes[j] })
+
+	e := newEstimator(t)
+	for _, nodeID := range nodes {
+		wl := znet.ZosWorkload(znet.GetIPRange(), "", 0, nil, "", nil)
+		if err := e.addDeployment(ctx, znet.GetName(), nodeID, []zos.Workload{wl}); err != nil {
+			return CostEstimate{}, err
+		}
+	}
+
+	return e.estimate, nil
+}
+
+// EstimateGatewayName estimates the monthly cost of a name gateway including its name contract
+func (t *TFPluginClient) EstimateGatewayName(ctx context.Context, gw workloads.GatewayNameProxy) (CostEstimate, error) {
+	e := newEstimator(t)
+
+	wl := zos.NewWorkloadFromZosWorkload(gw.ZosWorkload())
+	if err := e.addDeployment(ctx, gw.Name, gw.NodeID, []zos.Workload{wl}); err != nil {
+		return CostEstimate{}, err
+	}
+
+	if gw.NameContractID == 0 {
+		prices, err := e.prices(ctx, gw.NodeID)
+		if err != nil {
+			return CostEstimate{}, err
+		}
+
+		e.estimate.add(CostItem{
+			Kind:        CostNameContract,
+			Description: fmt.Sprintf("name contract %s", gw.Name),
+			Units:       1,
+			UnitPrice:   prices.UniqueName,
+			MonthlyCost: prices.UniqueName,
+		})
+	}
+
+	return e.estimate, nil
+}
+
+// estimator prices grid deployments using the pricing policy of their nodes farms
+type estimator struct {
+	tfPluginClient *TFPluginClient
+	estimate       CostEstimate
+
+	nodes        map[uint32]proxyTypes.NodeWithNestedCapacity
+	farmPolicies map[int]uint32
+	rented       map[uint32]bool
+}
+
+func newEstimator(tfPluginClient *TFPluginClient) *estimator {
+	return &estimator{
+		tfPluginClient: tfPluginClient,
+		nodes:          make(map[uint32]proxyTypes.NodeWithNestedCapacity),
+		farmPolicies:   make(map[int]uint32),
+		rented:         make(map[uint32]bool),
+	}
+}
+
+func (e *estimator) node(ctx context.Context, nodeID uint32) (proxyTypes.NodeWithNestedCapacity, error) {
+	if node, ok := e.nodes[nodeID]; ok {
+		return node, nil
+	}
+
+	node, err := e.tfPluginClient.GridProxyClient.Node(ctx, nodeID)
+	if err != nil {
+		return node, errors.Wrapf(err, "could not get node %d", nodeID)
+	}
+
+	e.nodes[nodeID] = node
+	return node, nil
+}
+
+// prices returns the unit prices of a node using the pricing policy of its farm and its certification
+func (e *estimator) prices(ctx context.Context, nodeID uint32) (calculator.UnitPrices, error) {
+	node, err := e.node(ctx, nodeID)
+	if err != nil {
+		return calculator.UnitPrices{}, err
+	}
+
+	policyID, ok := e.farmPolicies[node.FarmID]
+	if !ok {
+		farmID := uint64(node.FarmID)
+		farms, _, err := e.tfPluginClient.GridProxyClient.Farms(ctx, proxyTypes.FarmFilter{FarmID: &farmID}, proxyTypes.Limit{Page: 1, Size: 1})
+		if err != nil {
+			return calculator.UnitPrices{}, errors.Wrapf(err, "could not get farm %d", node.FarmID)
+		}
+		if len(farms) == 0 {
+			return calculator.UnitPrices{}, errors.Errorf("could not find farm %d", node.FarmID)
+		}
+
+		policyID = uint32(farms[0].PricingPolicyID)
+		e.farmPolicies[node.FarmID] = policyID
+	}
+
+	return e.tfPluginClient.Calculator.UnitPrices(policyID, node.CertificationType == "Certified")
+}
+
+// addDeployment adds the cost of a grid deployment of the given workloads on a node.
+// workloads on dedicated nodes are not billed, the node rent is billed instead if it is not rented by the twin yet.
+func (e *estimator) addDeployment(ctx context.Context, name string, nodeID uint32, wls []zos.Workload) error {
+	dl := workloads.NewGridDeployment(e.tfPluginClient.TwinID, 0, wls)
+
+	cap, err := Capacity(dl)
+	if err != nil {
+		return errors.Wrapf(err, "could not compute capacity of %s", name)
+	}
+
+	publicIPs, err := CountDeploymentPublicIPs(dl)
+	if err != nil {
+		return errors.Wrapf(err, "could not count public ips of %s", name)
+	}
+
+	items, err := e.contractItems(ctx, name, nodeID, cap, int64(publicIPs))
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		e.estimate.add(item)
+	}
+
+	node, err := e.node(ctx, nodeID)
+	if err != nil {
+		return err
+	}
+
+	prices, err := e.prices(ctx, nodeID)
+	if err != nil {
+		return err
+	}
+
+	rentedByTwin := node.Rented && node.RentedByTwinID == uint(e.tfPluginClient.TwinID)
+	if node.Dedicated && !rentedByTwin && !e.rented[nodeID] {
+		e.rented[nodeID] = true
+		e.addRent(node, prices)
+	}
+
+	return nil
+}
+
+// contractItems returns the cost items of a node contract with the given capacity and public ips,
+// the capacity of contracts on dedicated nodes is not billed
+func (e *estimator) contractItems(ctx context.Context, name string, nodeID uint32, cap zos.Capacity, publicIPs int64) ([]CostItem, error) {
+	node, err := e.node(ctx, nodeID)
+	if err != nil {
+		return nil, err
+	}
+
+	prices, err := e.prices(ctx, nodeID)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []CostItem
+	dedicated := node.Dedicated || node.Rented
+	if !dedicated {
+		cu := calculator.ComputeUnits(float64(cap.CRU), bytesToGB(cap.MRU))
+		items = append(items, CostItem{
+			Kind:        CostCompute,
+			Description: fmt.Sprintf("compute of %s on node %d", name, nodeID),
+			NodeID:      nodeID,
+			Units:       cu,
+			UnitPrice:   prices.CU,
+			MonthlyCost: cu * prices.CU,
+		})
+
+		su := calculator.StorageUnits(bytesToGB(cap.HRU), bytesToGB(cap.SRU))
+		items = append(items, CostItem{
+			Kind:        CostStorage,
+			Description: fmt.Sprintf("storage of %s on node %d", name, nodeID),
+			NodeID:      nodeID,
+			Units:       su,
+			UnitPrice:   prices.SU,
+			MonthlyCost: su * prices.SU,
+		})
+	}
+
+	items = append(items, CostItem{
+		Kind:        CostIPv4,
+		Description: fmt.Sprintf("public ipv4 of %s on node %d", name, nodeID),
+		NodeID:      nodeID,
+		Units:       float64(publicIPs),
+		UnitPrice:   prices.IPv4,
+		MonthlyCost: float64(publicIPs) * prices.IPv4,
+	})
+
+	return items, nil
+}
+
+// contractCost returns the monthly cost of a node contract with the given capacity and public ips
+func (e *estimator) contractCost(ctx context.Context, name string, nodeID uint32, cap zos.Capacity, publicIPs int64) (float64, error) {
+	items, err := e.contractItems(ctx, name, nodeID, cap, publicIPs)
+	if err != nil {
+		return 0, err
+	}
+
+	var cost float64
+	for _, item := range items {
+		cost += item.MonthlyCost
+	}
+	return cost, nil
+}
+
+// addRent adds the cost of renting a whole node with the dedicated nodes discount and the farmer extra fee
+func (e *estimator) addRent(node proxyTypes.NodeWithNestedCapacity, prices calculator.UnitPrices) {
+	nodeID := uint32(node.NodeID)
+	total := node.Capacity.Total
+	discount := 1 - prices.DedicatedDiscount/100
+
+	cu := calculator.ComputeUnits(float64(total.CRU), bytesToGB(uint64(total.MRU)))
+	su := calculator.StorageUnits(bytesToGB(uint64(total.HRU)), bytesToGB(uint64(total.SRU)))
+	rent := (cu*prices.CU + su*prices.SU) * discount
+
+	e.estimate.add(CostItem{
+		Kind:        CostRent,
+		Description: fmt.Sprintf("rent of dedicated node %d with %.0f%% discount", nodeID, prices.DedicatedDiscount),
+		NodeID:      nodeID,
+		Units:       1,
+		UnitPrice:   rent,
+		MonthlyCost: rent,
+	})
+
+	// extra fee is set in mUSD per month
+	extraFee := prices.Fee(node.ExtraFee)
+	e.estimate.add(CostItem{
+		Kind:        CostExtraFee,
+		Description: fmt.Sprintf("extra fee of dedicated node %d", nodeID),
+		NodeID:      nodeID,
+		Units:       1,
+		UnitPrice:   extraFee,
+		MonthlyCost: extraFee,
+	})
+}
+
+func bytesToGB(bytes uint64) float64 {
+	return float64(bytes) / float64(gridtypes.Gigabyte)
+}
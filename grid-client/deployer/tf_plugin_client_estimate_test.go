@@ -0,0 +1,163 @@
+package deployer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/calculator"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/mocks"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+	proxyTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+)
+
+func TestEstimateDeployment(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	sub := mocks.NewMockSubstrateExt(ctrl)
+	proxyCl := mocks.NewMockClient(ctrl)
+
+	tfPluginClient := TFPluginClient{
+		TwinID:          twinID,
+		SubstrateConn:   sub,
+		GridProxyClient: proxyCl,
+		Calculator:      calculator.NewCalculator(sub, substrate.Identity(nil)),
+	}
+
+	sub.EXPECT().GetTFTPrice().Return(types.U32(1), nil).AnyTimes()
+	sub.EXPECT().GetPricingPolicy(uint32(2)).Return(substrate.PricingPolicy{
+		CU:                     substrate.Policy{Value: 10},
+		SU:                     substrate.Policy{Value: 5},
+		IPU:                    substrate.Policy{Value: 1},
+		UniqueName:             substrate.Policy{Value: 1},
+		DedicatedNodesDiscount: 50,
+	}, nil).AnyTimes()
+
+	farmID := uint64(1)
+	proxyCl.EXPECT().
+		Farms(gomock.Any(), proxyTypes.FarmFilter{FarmID: &farmID}, gomock.Any()).
+		Return([]proxyTypes.Farm{{FarmID: 1, PricingPolicyID: 2}}, 1, nil).
+		Times(2)
+
+	proxyCl.EXPECT().Node(gomock.Any(), uint32(1)).Return(proxyTypes.NodeWithNestedCapacity{NodeID: 1, FarmID: 1}, nil)
+	proxyCl.EXPECT().Node(gomock.Any(), uint32(2)).Return(proxyTypes.NodeWithNestedCapacity{
+		NodeID:    2,
+		FarmID:    1,
+		Dedicated: true,
+		ExtraFee:  1000,
+		Capacity: proxyTypes.CapacityResult{Total: proxyTypes.Capacity{
+			CRU: 4,
+			MRU: 8 * gridtypes.Gigabyte,
+			SRU: 200 * gridtypes.Gigabyte,
+		}},
+	}, nil)
+
+	dl := workloads.Deployment{
+		Name:   "dl",
+		Disks:  []workloads.Disk{{Name: "disk", SizeGB: 200}},
+		Vms:    []workloads.VM{{Name: "vm", Flist: "flist", NetworkName: "net", CPU: 2, MemoryMB: 4096, PublicIP: true}},
+		NodeID: 1,
+	}
+
+	t.Run("shared node", func(t *testing.T) {
+		estimate, err := tfPluginClient.EstimateDeployment(context.Background(), dl)
+		require.NoError(t, err)
+		require.Len(t, estimate.Items, 3)
+
+		costs := make(map[CostItemKind]float64)
+		for _, item := range estimate.Items {
+			assert.Equal(t, uint32(1), item.NodeID)
+			costs[item.Kind] = item.MonthlyCost
+		}
+
+		assert.InDelta(t, 7.305, costs[CostCompute], 1e-9)
+		// 200 GB disk and the vm 2 GB default rootfs
+		assert.InDelta(t, 3.689025, costs[CostStorage], 1e-9)
+		assert.InDelta(t, 0.7305, costs[CostIPv4], 1e-9)
+		assert.InDelta(t, 11.724525, estimate.MonthlyCost, 1e-9)
+	})
+
+	t.Run("dedicated node", func(t *testing.T) {
+		dl.NodeID = 2
+		estimate, err := tfPluginClient.EstimateDeployment(context.Background(), dl)
+		require.NoError(t, err)
+
+		costs := make(map[CostItemKind]float64)
+		for _, item := range estimate.Items {
+			costs[item.Kind] = item.MonthlyCost
+		}
+
+		assert.NotContains(t, costs, CostCompute)
+		assert.NotContains(t, costs, CostStorage)
+		assert.InDelta(t, 0.7305, costs[CostIPv4], 1e-9)
+		assert.InDelta(t, 9.13125, costs[CostRent], 1e-9)
+		assert.InDelta(t, 1, costs[CostExtraFee], 1e-9)
+	})
+}
+
+func TestEstimateTFTPrice(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	sub := mocks.NewMockSubstrateExt(ctrl)
+	proxyCl := mocks.NewMockClient(ctrl)
+
+	tfPluginClient := TFPluginClient{
+		TwinID:          twinID,
+		SubstrateConn:   sub,
+		GridProxyClient: proxyCl,
+		Calculator:      calculator.NewCalculator(sub, substrate.Identity(nil)),
+	}
+
+	// every item is converted with the same tft price
+	sub.EXPECT().GetTFTPrice().Return(types.U32(2), nil).AnyTimes()
+	sub.EXPECT().GetPricingPolicy(uint32(2)).Return(substrate.PricingPolicy{
+		CU:                     substrate.Policy{Value: 10},
+		SU:                     substrate.Policy{Value: 5},
+		IPU:                    substrate.Policy{Value: 1},
+		DedicatedNodesDiscount: 50,
+	}, nil).AnyTimes()
+
+	farmID := uint64(1)
+	proxyCl.EXPECT().
+		Farms(gomock.Any(), proxyTypes.FarmFilter{FarmID: &farmID}, gomock.Any()).
+		Return([]proxyTypes.Farm{{FarmID: 1, PricingPolicyID: 2}}, 1, nil)
+	proxyCl.EXPECT().Node(gomock.Any(), uint32(2)).Return(proxyTypes.NodeWithNestedCapacity{
+		NodeID:    2,
+		FarmID:    1,
+		Dedicated: true,
+		ExtraFee:  1000,
+		Capacity: proxyTypes.CapacityResult{Total: proxyTypes.Capacity{
+			CRU: 4,
+			MRU: 8 * gridtypes.Gigabyte,
+			SRU: 200 * gridtypes.Gigabyte,
+		}},
+	}, nil)
+
+	dl := workloads.Deployment{
+		Name:   "dl",
+		Vms:    []workloads.VM{{Name: "vm", Flist: "flist", NetworkName: "net", CPU: 2, MemoryMB: 4096, PublicIP: true}},
+		NodeID: 2,
+	}
+
+	estimate, err := tfPluginClient.EstimateDeployment(context.Background(), dl)
+	require.NoError(t, err)
+
+	costs := make(map[CostItemKind]float64)
+	var total float64
+	for _, item := range estimate.Items {
+		costs[item.Kind] = item.MonthlyCost
+		total += item.MonthlyCost
+	}
+
+	assert.InDelta(t, 0.7305/2, costs[CostIPv4], 1e-9)
+	assert.InDelta(t, 9.13125/2, costs[CostRent], 1e-9)
+	assert.InDelta(t, 0.5, costs[CostExtraFee], 1e-9)
+	assert.InDelta(t, total, estimate.MonthlyCost, 1e-9)
+}
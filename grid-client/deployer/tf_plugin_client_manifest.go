@@ -0,0 +1,365 @@
+package deployer
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/graphql"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/manifest"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+)
+
+// ApplyResult is the result of applying a manifest
+type ApplyResult struct {
+	// Outputs are the attributes of the applied resources
+	Outputs manifest.Outputs
+	// Canceled are the contracts of the resources removed from the manifest
+	Canceled []uint64
+}
+
+// liveContracts are the contracts of a project grouped by the resources owning them
+type liveContracts struct {
+	// deployments maps a deployment type and name to its node contracts
+	deployments   map[string]map[uint32]uint64
+	nameContracts map[string]uint64
+}
+
+type nodeContract struct {
+	nodeID     uint32
+	contractID uint64
+}
+
+// Apply converges the live deployments of the manifest project toward the manifest.
+// resources are deployed in dependency order, then the project contracts of resources
+// that were removed from the manifest are canceled.
+func (t *TFPluginClient) Apply(ctx context.Context, m manifest.Manifest) (ApplyResult, error) {
+	result := ApplyResult{Outputs: manifest.Outputs{}}
+
+	if err := m.Validate(); err != nil {
+		return result, errors.Wrap(err, "invalid manifest")
+	}
+
+	resources, err := m.Order()
+	if err != nil {
+		return result, errors.Wrap(err, "invalid manifest")
+	}
+
+	contracts, err := t.ContractsGetter.ListContractsOfProjectName(m.Project)
+	if err != nil {
+		return result, errors.Wrapf(err, "could not load contracts of project %s", m.Project)
+	}
+
+	live, err := newLiveContracts(contracts)
+	if err != nil {
+		return result, err
+	}
+
+	// live contracts are needed in the state to load the live resources
+	for _, ids := range live.deployments {
+		for nodeID, contractID := range ids {
+			t.State.StoreContractIDs(nodeID, contractID)
+		}
+	}
+
+	for _, resource := range resources {
+		log.Info().Str("project", m.Project).Stringer("resource", resource).Msg("applying")
+		if err := t.applyResource(ctx, m.Project, resource, live, result.Outputs); err != nil {
+			return result, errors.Wrapf(err, "could not apply %s", resource)
+		}
+	}
+
+	removed := removedContracts(resources, live)
+	if len(removed) == 0 {
+		return result, nil
+	}
+
+	for _, c := range removed {
+		result.Canceled = append(result.Canceled, c.contractID)
+	}
+
+	log.Info().Str("project", m.Project).Uints64("contracts", result.Canceled).Msg("canceling removed resources")
+	if err := t.BatchCancelContract(result.Canceled); err != nil {
+		return ApplyResult{Outputs: result.Outputs}, errors.Wrapf(err, "could not cancel removed resources of project %s", m.Project)
+	}
+
+	for _, c := range removed {
+		t.State.RemoveContractIDs(c.nodeID, c.contractID)
+	}
+
+	return result, nil
+}
+
+func (t *TFPluginClient) applyResource(ctx context.Context, project string, resource manifest.Resource, live liveContracts, outputs manifest.Outputs) error {
+	switch spec := resource.Spec.(type) {
+	case manifest.Network:
+		return t.applyNetwork(ctx, project, spec, live, outputs)
+	case manifest.Deployment:
+		return t.applyDeployment(ctx, project, spec, live, outputs)
+	case manifest.K8sCluster:
+		return t.applyK8sCluster(ctx, project, spec, live, outputs)
+	case manifest.GatewayName:
+		return t.applyGatewayName(ctx, project, spec, live, outputs)
+	case manifest.GatewayFQDN:
+		return t.applyGatewayFQDN(ctx, project, spec, live, outputs)
+	}
+
+	return errors.Errorf("unsupported resource kind %s", resource.Kind)
+}
+
+func (t *TFPluginClient) applyNetwork(ctx context.Context, project string, spec manifest.Network, live liveContracts, outputs manifest.Outputs) error {
+	znet, err := spec.ZNet(project)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := live.deployments[liveKey(workloads.NetworkType, spec.Name)]; ok {
+		current, err := t.State.LoadNetworkFromGrid(ctx, spec.Name)
+		if err != nil {
+			return errors.Wrapf(err, "could not load network %s", spec.Name)
+		}
+
+		// keep the live keys and ranges so the network is updated in place
+		znet.NodeDeploymentID = current.NodeDeploymentID
+		znet.NodesIPRange = current.NodesIPRange
+		znet.Keys = current.Keys
+		znet.WGPort = current.WGPort
+		znet.ExternalIP = current.ExternalIP
+		znet.ExternalSK = current.ExternalSK
+		znet.PublicNodeID = current.PublicNodeID
+		for nodeID, key := range current.MyceliumKeys {
+			if _, ok := znet.MyceliumKeys[nodeID]; ok {
+				znet.MyceliumKeys[nodeID] = key
+			}
+		}
+	}
+
+	if err := t.NetworkDeployer.Deploy(ctx, &znet); err != nil {
+		return err
+	}
+
+	outputs.SetNetwork(&znet)
+	return nil
+}
+
+func (t *TFPluginClient) applyDeployment(ctx context.Context, project string, spec manifest.Deployment, live liveContracts, outputs manifest.Outputs) error {
+	spec, err := outputs.ResolveDeployment(spec)
+	if err != nil {
+		return err
+	}
+
+	dl, err := spec.Deployment(project)
+	if err != nil {
+		return err
+	}
+
+	if ids, ok := live.deployments[liveKey(workloads.VMType, spec.Name)]; ok {
+		dl.NodeDeploymentID = ids
+
+		if contractID, ok := ids[dl.NodeID]; ok {
+			dl.ContractID = contractID
+
+			current, err := t.State.LoadDeploymentFromGrid(ctx, dl.NodeID, dl.Name)
+			if err != nil {
+				return errors.Wrapf(err, "could not load deployment %s", dl.Name)
+			}
+			keepVMsIdentity(dl.Vms, current.Vms)
+		}
+	}
+
+	if err := t.DeploymentDeployer.Deploy(ctx, &dl); err != nil {
+		return err
+	}
+
+	if err := t.DeploymentDeployer.Sync(ctx, &dl); err != nil {
+		return errors.Wrapf(err, "could not read deployment %s outputs", dl.Name)
+	}
+
+	outputs.SetDeployment(&dl)
+	return nil
+}
+
+func (t *TFPluginClient) applyK8sCluster(ctx context.Context, project string, spec manifest.K8sCluster, live liveContracts, outputs manifest.Outputs) error {
+	cluster, err := spec.Cluster(project)
+	if err != nil {
+		return err
+	}
+
+	if ids, ok := live.deployments[liveKey(workloads.K8sType, spec.Name)]; ok {
+		cluster.NodeDeploymentID = ids
+
+		var nodeIDs []uint32
+		for nodeID := range ids {
+			nodeIDs = append(nodeIDs, nodeID)
+		}
+
+		current, err := t.State.LoadK8sFromGrid(ctx, nodeIDs, spec.Name)
+		if err != nil {
+			return errors.Wrapf(err, "could not load kubernetes cluster %s", spec.Name)
+		}
+
+		var currentVMs []workloads.VM
+		for _, n := range append(current.MasterNodes(), current.Workers...) {
+			if n.VM != nil {
+				currentVMs = append(currentVMs, *n.VM)
+			}
+		}
+
+		keepVMIdentity(cluster.Master.VM, currentVMs)
+		for _, m := range cluster.Masters {
+			keepVMIdentity(m.VM, currentVMs)
+		}
+		for _, w := range cluster.Workers {
+			keepVMIdentity(w.VM, currentVMs)
+		}
+	}
+
+	if err := t.K8sDeployer.Deploy(ctx, &cluster); err != nil {
+		return err
+	}
+
+	if err := t.K8sDeployer.UpdateFromRemote(ctx, &cluster); err != nil {
+		return errors.Wrapf(err, "could not read kubernetes cluster %s outputs", spec.Name)
+	}
+
+	outputs.SetK8sCluster(&cluster)
+	return nil
+}
+
+func (t *TFPluginClient) applyGatewayName(ctx context.Context, project string, spec manifest.GatewayName, live liveContracts, outputs manifest.Outputs) error {
+	spec, err := outputs.ResolveGatewayName(spec)
+	if err != nil {
+		return err
+	}
+
+	gw := spec.Proxy(project)
+	if ids, ok := live.deployments[liveKey(workloads.GatewayNameType, spec.Name)]; ok {
+		gw.NodeDeploymentID = ids
+		gw.ContractID = ids[gw.NodeID]
+	}
+	gw.NameContractID = live.nameContracts[spec.Name]
+
+	if err := t.GatewayNameDeployer.Deploy(ctx, &gw); err != nil {
+		return err
+	}
+
+	if err := t.GatewayNameDeployer.Sync(ctx, &gw); err != nil {
+		return errors.Wrapf(err, "could not read gateway %s outputs", gw.Name)
+	}
+
+	outputs.SetGatewayName(&gw)
+	return nil
+}
+
+func (t *TFPluginClient) applyGatewayFQDN(ctx context.Context, project string, spec manifest.GatewayFQDN, live liveContracts, outputs manifest.Outputs) error {
+	spec, err := outputs.ResolveGatewayFQDN(spec)
+	if err != nil {
+		return err
+	}
+
+	gw := spec.Proxy(project)
+	if ids, ok := live.deployments[liveKey(workloads.GatewayFQDNType, spec.Name)]; ok {
+		gw.NodeDeploymentID = ids
+		gw.ContractID = ids[gw.NodeID]
+	}
+
+	if err := t.GatewayFQDNDeployer.Deploy(ctx, &gw); err != nil {
+		return err
+	}
+
+	outputs.SetGatewayFQDN(&gw)
+	return nil
+}
+
+// newLiveContracts groups the project contracts by the type and name of their deployment data
+func newLiveContracts(contracts graphql.Contracts) (liveContracts, error) {
+	live := liveContracts{
+		deployments:   make(map[string]map[uint32]uint64),
+		nameContracts: make(map[string]uint64),
+	}
+
+	for _, contract := range contracts.NodeContracts {
+		contractID, err := strconv.ParseUint(contract.ContractID, 0, 64)
+		if err != nil {
+			return live, errors.Wrapf(err, "could not parse contract %s into uint64", contract.ContractID)
+		}
+
+		data, err := workloads.ParseDeploymentData(contract.DeploymentData)
+		if err != nil {
+			log.Warn().Err(err).Str("id", contract.ContractID).Msg("got contract with invalid metadata")
+			continue
+		}
+
+		key := liveKey(data.Type, data.Name)
+		if _, ok := live.deployments[key]; !ok {
+			live.deployments[key] = make(map[uint32]uint64)
+		}
+		live.deployments[key][contract.NodeID] = contractID
+	}
+
+	for _, contract := range contracts.NameContracts {
+		contractID, err := strconv.ParseUint(contract.ContractID, 0, 64)
+		if err != nil {
+			return live, errors.Wrapf(err, "could not parse contract %s into uint64", contract.ContractID)
+		}
+		live.nameContracts[contract.Name] = contractID
+	}
+
+	return live, nil
+}
+
+// removedContracts returns the live contracts of resources that are not in the manifest anymore
+func removedContracts(resources []manifest.Resource, live liveContracts) []nodeContract {
+	desired := make(map[string]bool)
+	desiredNames := make(map[string]bool)
+	for _, r := range resources {
+		desired[liveKey(r.Kind.DeploymentType(), r.Name)] = true
+		if r.Kind == manifest.KindGatewayName {
+			desiredNames[r.Name] = true
+		}
+	}
+
+	var removed []nodeContract
+	for key, ids := range live.deployments {
+		if desired[key] {
+			continue
+		}
+		for nodeID, contractID := range ids {
+			removed = append(removed, nodeContract{nodeID: nodeID, contractID: contractID})
+		}
+	}
+
+	for name, contractID := range live.nameContracts {
+		if !desiredNames[name] {
+			removed = append(removed, nodeContract{contractID: contractID})
+		}
+	}
+
+	return removed
+}
+
+// keepVMsIdentity keeps the private IPs and mycelium seeds of the live vms so they are not changed by an update
+func keepVMsIdentity(vms []workloads.VM, current []workloads.VM) {
+	for idx := range vms {
+		keepVMIdentity(&vms[idx], current)
+	}
+}
+
+func keepVMIdentity(vm *workloads.VM, current []workloads.VM) {
+	for _, c := range current {
+		if c.Name != vm.Name || c.NodeID != vm.NodeID {
+			continue
+		}
+
+		vm.IP = c.IP
+		if len(vm.MyceliumIPSeed) != 0 && len(c.MyceliumIPSeed) != 0 {
+			vm.MyceliumIPSeed = c.MyceliumIPSeed
+		}
+		return
+	}
+}
+
+func liveKey(deploymentType, name string) string {
+	return deploymentType + "/" + name
+}
@@ -0,0 +1,453 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/state"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+	zosTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-client/zos"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+	"github.com/threefoldtech/zos/pkg/gridtypes/zos"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// MigrationResult describes a deployment migrated to a new node
+type MigrationResult struct {
+	OldNodeID     uint32 `json:"old_node_id"`
+	NewNodeID     uint32 `json:"new_node_id"`
+	OldContractID uint64 `json:"old_contract_id"`
+	NewContractID uint64 `json:"new_contract_id"`
+	// IPs maps the old addresses of the deployment workloads to their new ones
+	IPs map[string]string `json:"ips"`
+	// Gateways are the names of the gateways whose backends were updated
+	Gateways []string `json:"gateways"`
+}
+
+// Migrate moves a deployment off its node, usually because the node is down or deleted.
+// a replacement node is picked using the target filter, the network is extended to it with a new ip range
+// and the deployment is created there. gateways of the deployment project with backends pointing at the old addresses
+// are updated then the old contracts are canceled. data of disks and zdbs is not migrated.
+// dl is updated to the migrated deployment.
+func (t *TFPluginClient) Migrate(ctx context.Context, dl *workloads.Deployment, targetFilter types.NodeFilter) (MigrationResult, error) {
+	result := MigrationResult{
+		OldNodeID:     dl.NodeID,
+		OldContractID: dl.ContractID,
+		IPs:           make(map[string]string),
+	}
+
+	filter, ssd, hdd, rootfs := migrationFilter(*dl, targetFilter)
+	nodes, err := FilterNodes(ctx, *t, filter, ssd, hdd, rootfs, 1)
+	if err != nil {
+		return result, errors.Wrapf(err, "could not find a node to migrate deployment %s to", dl.Name)
+	}
+	if len(nodes) == 0 {
+		return result, errors.Wrapf(ErrNoNodesMatchesResources, "could not find a node to migrate deployment %s to", dl.Name)
+	}
+	result.NewNodeID = uint32(nodes[0].NodeID)
+
+	log.Info().Str("deployment", dl.Name).Uint32("from", result.OldNodeID).Uint32("to", result.NewNodeID).Msg("migrating")
+
+	contracts, err := t.ContractsGetter.ListContractsByTwinID([]string{"Created, GracePeriod"})
+	if err != nil {
+		return result, errors.Wrap(err, "could not list contracts")
+	}
+
+	// the old node may be down so only the contracts of the other nodes are loaded
+	live := state.NewState(t.NcPool, t.SubstrateConn)
+	nodeContracts := make(map[string]map[uint32]uint64)
+	projects := make(map[string]string)
+	for _, contract := range contracts.NodeContracts {
+		data, err := workloads.ParseDeploymentData(contract.DeploymentData)
+		if err != nil {
+			continue
+		}
+
+		contractID, err := strconv.ParseUint(contract.ContractID, 0, 64)
+		if err != nil {
+			return result, errors.Wrapf(err, "could not parse contract %s into uint64", contract.ContractID)
+		}
+
+		key := liveKey(data.Type, data.Name)
+		if _, ok := nodeContracts[key]; !ok {
+			nodeContracts[key] = make(map[uint32]uint64)
+		}
+		nodeContracts[key][contract.NodeID] = contractID
+		projects[key] = data.ProjectName
+
+		if contract.NodeID != result.OldNodeID {
+			live.StoreContractIDs(contract.NodeID, contractID)
+		}
+	}
+
+	if len(dl.NetworkName) != 0 {
+		if err := t.migrateNetwork(ctx, live, *dl, nodeContracts[liveKey(workloads.NetworkType, dl.NetworkName)], result); err != nil {
+			return result, err
+		}
+	}
+
+	oldIPs := deploymentIPs(*dl)
+
+	newDl := *dl
+	newDl.NodeID = result.NewNodeID
+	newDl.ContractID = 0
+	newDl.NodeDeploymentID = nil
+	newDl.IPrange = ""
+	newDl.Vms = slices.Clone(dl.Vms)
+	for idx := range newDl.Vms {
+		newDl.Vms[idx].NodeID = result.NewNodeID
+		newDl.Vms[idx].IP = ""
+	}
+	newDl.VmsLight = slices.Clone(dl.VmsLight)
+	for idx := range newDl.VmsLight {
+		newDl.VmsLight[idx].NodeID = result.NewNodeID
+		newDl.VmsLight[idx].IP = ""
+	}
+
+	if err := t.DeploymentDeployer.Deploy(ctx, &newDl); err != nil {
+		return result, errors.Wrapf(err, "could not deploy %s on node %d", dl.Name, result.NewNodeID)
+	}
+	result.NewContractID = newDl.ContractID
+
+	if err := t.DeploymentDeployer.Sync(ctx, &newDl); err != nil {
+		return result, errors.Wrapf(err, "could not read migrated deployment %s", dl.Name)
+	}
+
+	newIPs := deploymentIPs(newDl)
+	for key, ip := range oldIPs {
+		if newIP, ok := newIPs[key]; ok && newIP != ip {
+			result.IPs[ip] = newIP
+		}
+	}
+
+	result.Gateways, err = t.migrateGateways(ctx, live, *dl, nodeContracts, projects, result.IPs)
+	if err != nil {
+		return result, err
+	}
+
+	if result.OldContractID != 0 {
+		if err := t.BatchCancelContract([]uint64{result.OldContractID}); err != nil {
+			return result, errors.Wrapf(err, "could not cancel old contract %d of deployment %s", result.OldContractID, dl.Name)
+		}
+		t.State.RemoveContractIDs(result.OldNodeID, result.OldContractID)
+	}
+
+	*dl = newDl
+	return result, nil
+}
+
+// migrateNetwork replaces the old node of a network with the new one, the old node network contract is canceled
+func (t *TFPluginClient) migrateNetwork(ctx context.Context, live *state.State, dl workloads.Deployment, contracts map[uint32]uint64, result MigrationResult) error {
+	name := dl.NetworkName
+
+	var znet workloads.Network
+	if n, err := live.LoadNetworkFromGrid(ctx, name); err == nil {
+		znet = &n
+	} else if n, lightErr := live.LoadNetworkLightFromGrid(ctx, name); lightErr == nil {
+		znet = &n
+	} else {
+		// the network has no reachable node left, usually it only existed on the old node
+		log.Debug().Err(err).Str("network", name).Msg("could not load network from its live nodes, rebuilding it")
+		if znet, err = t.rebuildNetwork(dl, result.NewNodeID); err != nil {
+			return errors.Wrapf(err, "could not load network %s", name)
+		}
+	}
+
+	var nodes []uint32
+	for _, nodeID := range znet.GetNodes() {
+		if nodeID != result.OldNodeID && nodeID != result.NewNodeID {
+			nodes = append(nodes, nodeID)
+		}
+	}
+	znet.SetNodes(append(nodes, result.NewNodeID))
+
+	if znet.GetPublicNodeID() == result.OldNodeID {
+		znet.SetPublicNodeID(0)
+	}
+
+	ipRanges := znet.GetNodesIPRange()
+	delete(ipRanges, result.OldNodeID)
+	znet.SetNodesIPRange(ipRanges)
+
+	if keys := znet.GetMyceliumKeys(); len(keys) != 0 {
+		if _, ok := keys[result.NewNodeID]; !ok {
+			key, err := workloads.RandomMyceliumKey()
+			if err != nil {
+				return errors.Wrapf(err, "could not generate mycelium key of network %s", name)
+			}
+			keys[result.NewNodeID] = key
+		}
+		delete(keys, result.OldNodeID)
+		znet.SetMyceliumKeys(keys)
+	}
+
+	// the contract on the old node is kept so it gets canceled by the deployer
+	nodeDeploymentIDs := znet.GetNodeDeploymentID()
+	if contractID, ok := contracts[result.OldNodeID]; ok {
+		nodeDeploymentIDs[result.OldNodeID] = contractID
+	}
+	znet.SetNodeDeploymentID(nodeDeploymentIDs)
+
+	return errors.Wrapf(t.NetworkDeployer.Deploy(ctx, znet), "could not add node %d to network %s", result.NewNodeID, name)
+}
+
+// rebuildNetwork describes the network of a deployment from the client state or the deployment ips.
+// node subnets are /24 subnets of a /16 network range, the mycelium keys of the new node are generated if the deployment uses mycelium
+func (t *TFPluginClient) rebuildNetwork(dl workloads.Deployment, newNodeID uint32) (workloads.Network, error) {
+	network := t.State.Networks.GetNetwork(dl.NetworkName)
+	subnet := network.GetNodeSubnet(dl.NodeID)
+	if len(subnet) == 0 {
+		subnet = dl.IPrange
+	}
+
+	ips := []string{subnet}
+	for _, vm := range dl.Vms {
+		ips = append(ips, vm.IP)
+	}
+	for _, vm := range dl.VmsLight {
+		ips = append(ips, vm.IP)
+	}
+
+	var ip net.IP
+	for _, address := range ips {
+		if parsed, _, err := net.ParseCIDR(address); err == nil {
+			ip = parsed
+		} else {
+			ip = net.ParseIP(address)
+		}
+		if ip.To4() != nil {
+			break
+		}
+	}
+	if ip.To4() == nil {
+		return nil, errors.Errorf("could not find the ip range of network %s in the state or the deployment ips", dl.NetworkName)
+	}
+
+	ipRange := zosTypes.IPNet{IPNet: net.IPNet{IP: ip.To4().Mask(net.CIDRMask(16, 32)), Mask: net.CIDRMask(16, 32)}}
+
+	myceliumKeys := make(map[uint32][]byte)
+	mycelium := len(dl.VmsLight) != 0
+	for _, vm := range dl.Vms {
+		mycelium = mycelium || len(vm.MyceliumIPSeed) != 0
+	}
+	if mycelium {
+		key, err := workloads.RandomMyceliumKey()
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not generate mycelium key of network %s", dl.NetworkName)
+		}
+		myceliumKeys[newNodeID] = key
+	}
+
+	if len(dl.VmsLight) != 0 {
+		return &workloads.ZNetLight{
+			Name:             dl.NetworkName,
+			IPRange:          ipRange,
+			MyceliumKeys:     myceliumKeys,
+			NodesIPRange:     make(map[uint32]zosTypes.IPNet),
+			NodeDeploymentID: make(map[uint32]uint64),
+		}, nil
+	}
+
+	return &workloads.ZNet{
+		Name:             dl.NetworkName,
+		IPRange:          ipRange,
+		MyceliumKeys:     myceliumKeys,
+		NodesIPRange:     make(map[uint32]zosTypes.IPNet),
+		NodeDeploymentID: make(map[uint32]uint64),
+		Keys:             make(map[uint32]wgtypes.Key),
+		WGPort:           make(map[uint32]int),
+	}, nil
+}
+
+// migrateGateways updates the backends of the gateways of the deployment project that point at migrated ips.
+// private ips repeat across networks so they are only replaced in gateways joining the deployment network.
+func (t *TFPluginClient) migrateGateways(ctx context.Context, live *state.State, dl workloads.Deployment, nodeContracts map[string]map[uint32]uint64, projects map[string]string, ips map[string]string) ([]string, error) {
+	var updated []string
+	if len(ips) == 0 {
+		return updated, nil
+	}
+
+	publicIPs := maps.Clone(ips)
+	for key, ip := range deploymentIPs(dl) {
+		if strings.HasSuffix(key, "/ip") {
+			delete(publicIPs, ip)
+		}
+	}
+	// same default as the deployment metadata
+	project := dl.SolutionType
+	if len(project) == 0 {
+		project = fmt.Sprintf("vm/%s", dl.Name)
+	}
+	gatewayIPs := func(network string) map[string]string {
+		if len(dl.NetworkName) != 0 && network == dl.NetworkName {
+			return ips
+		}
+		return publicIPs
+	}
+
+	for key, ids := range nodeContracts {
+		deploymentType, name, _ := strings.Cut(key, "/")
+		if projects[key] != project {
+			continue
+		}
+
+		for nodeID := range ids {
+			switch deploymentType {
+			case workloads.GatewayNameType:
+				gw, err := live.LoadGatewayNameFromGrid(ctx, nodeID, name, name)
+				if err != nil {
+					log.Warn().Err(err).Str("gateway", name).Msg("could not load gateway to update its backends")
+					continue
+				}
+
+				var changed bool
+				if gw.Backends, changed = replaceBackends(gw.Backends, gatewayIPs(gw.Network)); !changed {
+					continue
+				}
+
+				// zos can't update a gateway workload so it is replaced within the same deployment
+				gw.WorkloadName = rotatedWorkloadName(gw.Name, gw.WorkloadName)
+				if err := t.GatewayNameDeployer.Deploy(ctx, &gw); err != nil {
+					return updated, errors.Wrapf(err, "could not update backends of gateway %s", name)
+				}
+				updated = append(updated, name)
+			case workloads.GatewayFQDNType:
+				gw, err := live.LoadGatewayFQDNFromGrid(ctx, nodeID, name, name)
+				if err != nil {
+					log.Warn().Err(err).Str("gateway", name).Msg("could not load gateway to update its backends")
+					continue
+				}
+
+				var changed bool
+				if gw.Backends, changed = replaceBackends(gw.Backends, gatewayIPs(gw.Network)); !changed {
+					continue
+				}
+
+				// zos can't update a gateway workload so it is replaced within the same deployment
+				gw.WorkloadName = rotatedWorkloadName(gw.Name, gw.WorkloadName)
+				if err := t.GatewayFQDNDeployer.Deploy(ctx, &gw); err != nil {
+					return updated, errors.Wrapf(err, "could not update backends of gateway %s", name)
+				}
+				updated = append(updated, name)
+			}
+		}
+	}
+
+	slices.Sort(updated)
+	return updated, nil
+}
+
+// migrationFilter adds the deployment resources to the filter of its target node and excludes its current node
+func migrationFilter(dl workloads.Deployment, filter types.NodeFilter) (types.NodeFilter, []uint64, []uint64, []uint64) {
+	item := NewPackingItem(dl)
+
+	if filter.FreeMRU == nil && item.MRU != 0 {
+		filter.FreeMRU = &item.MRU
+	}
+	if filter.TotalCRU == nil && item.CRU != 0 {
+		filter.TotalCRU = &item.CRU
+	}
+	if filter.FreeSRU == nil && len(item.SSDDisks)+len(item.RootFS) != 0 {
+		sru := item.SRU()
+		filter.FreeSRU = &sru
+	}
+	if filter.FreeHRU == nil && len(item.HDDDisks) != 0 {
+		hru := item.HRU()
+		filter.FreeHRU = &hru
+	}
+	if filter.FreeIPs == nil && item.PublicIPs != 0 {
+		filter.FreeIPs = &item.PublicIPs
+	}
+	if len(filter.Status) == 0 {
+		filter.Status = []string{"up"}
+	}
+
+	filter.Excluded = append(slices.Clone(filter.Excluded), uint64(dl.NodeID))
+	return filter, item.SSDDisks, item.HDDDisks, item.RootFS
+}
+
+// deploymentIPs returns the addresses of the deployment workloads keyed by workload and address kind
+func deploymentIPs(dl workloads.Deployment) map[string]string {
+	ips := make(map[string]string)
+	add := func(key, ip string) {
+		if len(ip) == 0 {
+			return
+		}
+		// public ips are stored with their mask
+		if parsed, _, err := net.ParseCIDR(ip); err == nil {
+			ip = parsed.String()
+		}
+		ips[key] = ip
+	}
+
+	for _, vm := range dl.Vms {
+		add("vm/"+vm.Name+"/ip", vm.IP)
+		add("vm/"+vm.Name+"/public_ip", vm.ComputedIP)
+		add("vm/"+vm.Name+"/public_ip6", vm.ComputedIP6)
+		add("vm/"+vm.Name+"/planetary_ip", vm.PlanetaryIP)
+		add("vm/"+vm.Name+"/mycelium_ip", vm.MyceliumIP)
+	}
+	for _, vm := range dl.VmsLight {
+		add("vm_light/"+vm.Name+"/ip", vm.IP)
+		add("vm_light/"+vm.Name+"/mycelium_ip", vm.MyceliumIP)
+	}
+	for _, zdb := range dl.Zdbs {
+		for idx, ip := range zdb.IPs {
+			add("zdb/"+zdb.Name+"/"+strconv.Itoa(idx), ip)
+		}
+	}
+
+	return ips
+}
+
+// replaceBackends replaces the hosts of the backends using the ips mapping
+func replaceBackends(backends []zos.Backend, ips map[string]string) ([]zos.Backend, bool) {
+	var changed bool
+	res := make([]zos.Backend, len(backends))
+
+	for idx, backend := range backends {
+		res[idx] = backend
+
+		host, port, err := splitBackend(string(backend))
+		if err != nil {
+			continue
+		}
+
+		newIP, ok := ips[host]
+		if !ok {
+			continue
+		}
+
+		if len(port) == 0 {
+			res[idx] = zos.Backend(strings.Replace(string(backend), host, newIP, 1))
+		} else {
+			res[idx] = zos.Backend(strings.Replace(string(backend), net.JoinHostPort(host, port), net.JoinHostPort(newIP, port), 1))
+		}
+		changed = true
+	}
+
+	return res, changed
+}
+
+// splitBackend returns the host and port of a backend which is either an url or a host:port address
+func splitBackend(backend string) (string, string, error) {
+	address := backend
+	if _, rest, ok := strings.Cut(backend, "://"); ok {
+		address, _, _ = strings.Cut(rest, "/")
+	}
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		// no port
+		return strings.Trim(address, "[]"), "", nil
+	}
+
+	return host, port, nil
+}
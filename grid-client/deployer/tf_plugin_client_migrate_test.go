@@ -0,0 +1,208 @@
+package deployer
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/simulation"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+	zosTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-client/zos"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+	"github.com/threefoldtech/zos/pkg/gridtypes/zos"
+)
+
+func TestMigrationFilter(t *testing.T) {
+	dl := workloads.Deployment{
+		NodeID: 5,
+		Disks:  []workloads.Disk{{Name: "d", SizeGB: 10}},
+		Zdbs:   []workloads.ZDB{{Name: "z", SizeGB: 20}},
+		Vms: []workloads.VM{
+			{Name: "a", CPU: 2, MemoryMB: 1024, RootfsSizeMB: 512, PublicIP: true},
+			{Name: "b", CPU: 4, MemoryMB: 2048},
+		},
+	}
+
+	farm := "farm"
+	filter, ssd, hdd, rootfs := migrationFilter(dl, types.NodeFilter{FarmName: &farm, Excluded: []uint64{7}})
+
+	assert.Equal(t, []uint64{10 * uint64(gridtypes.Gigabyte)}, ssd)
+	assert.Equal(t, []uint64{20 * uint64(gridtypes.Gigabyte)}, hdd)
+	assert.Equal(t, []uint64{512 * uint64(gridtypes.Megabyte), 0}, rootfs)
+
+	assert.Equal(t, &farm, filter.FarmName)
+	assert.Equal(t, []uint64{7, 5}, filter.Excluded)
+	assert.Equal(t, uint64(3072*gridtypes.Megabyte), *filter.FreeMRU)
+	assert.Equal(t, uint64(4), *filter.TotalCRU)
+	assert.Equal(t, 10*uint64(gridtypes.Gigabyte)+512*uint64(gridtypes.Megabyte), *filter.FreeSRU)
+	assert.Equal(t, 20*uint64(gridtypes.Gigabyte), *filter.FreeHRU)
+	assert.Equal(t, uint64(1), *filter.FreeIPs)
+	assert.Equal(t, []string{"up"}, filter.Status)
+}
+
+func TestReplaceBackends(t *testing.T) {
+	oldDl := workloads.Deployment{
+		Vms: []workloads.VM{{Name: "web", IP: "10.1.2.2", ComputedIP: "185.1.1.1/24", MyceliumIP: "400::1"}},
+	}
+	newDl := workloads.Deployment{
+		Vms: []workloads.VM{{Name: "web", IP: "10.1.3.2", ComputedIP: "185.2.2.2/24", MyceliumIP: "500::1"}},
+	}
+
+	oldIPs, newIPs := deploymentIPs(oldDl), deploymentIPs(newDl)
+	ips := make(map[string]string)
+	for key, ip := range oldIPs {
+		ips[ip] = newIPs[key]
+	}
+	assert.Equal(t, map[string]string{"10.1.2.2": "10.1.3.2", "185.1.1.1": "185.2.2.2", "400::1": "500::1"}, ips)
+
+	backends, changed := replaceBackends([]zos.Backend{
+		"http://10.1.2.2:8080",
+		"http://185.1.1.1",
+		"http://[400::1]:9000",
+		"10.1.2.2:443",
+		"http://10.1.2.20:8080",
+	}, ips)
+
+	assert.True(t, changed)
+	assert.Equal(t, []zos.Backend{
+		"http://10.1.3.2:8080",
+		"http://185.2.2.2",
+		"http://[500::1]:9000",
+		"10.1.3.2:443",
+		"http://10.1.2.20:8080",
+	}, backends)
+
+	_, changed = replaceBackends([]zos.Backend{"http://10.1.9.9:80"}, ips)
+	assert.False(t, changed)
+}
+
+func TestMigrateOffDownNode(t *testing.T) {
+	// serves the flist of the vm
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer hub.Close()
+
+	grid := simulation.NewGrid()
+	tfPluginClient, err := NewTFPluginClient(simulationMnemonic, WithSimulation(grid))
+	require.NoError(t, err)
+	defer tfPluginClient.Close()
+
+	ctx := context.Background()
+	network := workloads.ZNet{
+		Name:  "migrated",
+		Nodes: []uint32{1},
+		IPRange: zosTypes.IPNet{IPNet: net.IPNet{
+			IP:   net.IPv4(10, 20, 0, 0),
+			Mask: net.CIDRMask(16, 32),
+		}},
+	}
+	require.NoError(t, tfPluginClient.NetworkDeployer.Deploy(ctx, &network))
+	networkContract := network.NodeDeploymentID[1]
+
+	vm := workloads.VM{
+		Name:           "vm",
+		NodeID:         1,
+		Flist:          hub.URL + "/app.flist",
+		CPU:            1,
+		MemoryMB:       1024,
+		MyceliumIPSeed: []byte{1, 2, 3, 4, 5, 6},
+		NetworkName:    network.Name,
+	}
+	dl := workloads.NewDeployment("app", 1, "", nil, network.Name, nil, nil, []workloads.VM{vm}, nil, nil, nil)
+	require.NoError(t, tfPluginClient.DeploymentDeployer.Deploy(ctx, &dl))
+	require.NoError(t, tfPluginClient.DeploymentDeployer.Sync(ctx, &dl))
+	oldContract := dl.ContractID
+
+	// the network only exists on the node that went down
+	require.NoError(t, grid.SetNodeDown(1, true))
+	tfPluginClient.State.Networks.DeleteNetwork(network.Name)
+
+	result, err := tfPluginClient.Migrate(ctx, &dl, types.NodeFilter{})
+	require.NoError(t, err)
+	assert.NotEqual(t, uint32(1), result.NewNodeID)
+	assert.Equal(t, result.NewNodeID, dl.NodeID)
+	assert.NotZero(t, result.NewContractID)
+
+	ip := net.ParseIP(dl.Vms[0].IP)
+	require.NotNil(t, ip)
+	assert.True(t, network.IPRange.Contains(ip))
+	assert.NotEmpty(t, dl.Vms[0].MyceliumIP)
+
+	active := map[uint64]bool{}
+	for _, contract := range grid.Contracts(tfPluginClient.TwinID) {
+		active[uint64(contract.ContractID)] = true
+	}
+	assert.False(t, active[oldContract])
+	assert.False(t, active[networkContract])
+	assert.True(t, active[result.NewContractID])
+}
+
+func TestMigrateGatewaysOfProject(t *testing.T) {
+	// serves the flist of the vms
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer hub.Close()
+
+	grid := simulation.NewGrid()
+	tfPluginClient, err := NewTFPluginClient(simulationMnemonic, WithSimulation(grid))
+	require.NoError(t, err)
+	defer tfPluginClient.Close()
+
+	ctx := context.Background()
+	deployApp := func(name, project string) workloads.Deployment {
+		network := workloads.ZNet{
+			Name:  name + "net",
+			Nodes: []uint32{1, 2, 3},
+			IPRange: zosTypes.IPNet{IPNet: net.IPNet{
+				IP:   net.IPv4(10, 20, 0, 0),
+				Mask: net.CIDRMask(16, 32),
+			}},
+		}
+		require.NoError(t, tfPluginClient.NetworkDeployer.Deploy(ctx, &network))
+
+		vm := workloads.VM{Name: "vm", NodeID: 1, Flist: hub.URL + "/app.flist", CPU: 1, MemoryMB: 1024, NetworkName: network.Name}
+		dl := workloads.NewDeployment(name, 1, project, nil, network.Name, nil, nil, []workloads.VM{vm}, nil, nil, nil)
+		require.NoError(t, tfPluginClient.DeploymentDeployer.Deploy(ctx, &dl))
+		require.NoError(t, tfPluginClient.DeploymentDeployer.Sync(ctx, &dl))
+		return dl
+	}
+	deployGateway := func(name, project, network, backend string) {
+		gw := workloads.GatewayNameProxy{
+			NodeID:       3,
+			Name:         name,
+			Network:      network,
+			SolutionType: project,
+			Backends:     []zos.Backend{zos.Backend(backend)},
+		}
+		require.NoError(t, tfPluginClient.GatewayNameDeployer.Deploy(ctx, &gw))
+	}
+	backends := func(name string) []zos.Backend {
+		gw, err := tfPluginClient.State.LoadGatewayNameFromGrid(ctx, 3, name, name)
+		require.NoError(t, err)
+		return gw.Backends
+	}
+
+	app := deployApp("app", "app")
+	other := deployApp("other", "other")
+	// both vms got the same private ip in their own networks
+	require.Equal(t, app.Vms[0].IP, other.Vms[0].IP)
+	backend := "http://" + net.JoinHostPort(app.Vms[0].IP, "8080")
+
+	deployGateway("appgw", "app", app.NetworkName, backend)
+	deployGateway("othergw", "other", other.NetworkName, backend)
+	// a gateway of the project joining another network
+	deployGateway("appothergw", "app", other.NetworkName, backend)
+
+	result, err := tfPluginClient.Migrate(ctx, &app, types.NodeFilter{Excluded: []uint64{3}})
+	require.NoError(t, err)
+	require.Equal(t, uint32(2), result.NewNodeID)
+	require.NotEqual(t, other.Vms[0].IP, app.Vms[0].IP)
+
+	assert.Equal(t, []string{"appgw"}, result.Gateways)
+	assert.Equal(t, []zos.Backend{zos.Backend("http://" + net.JoinHostPort(app.Vms[0].IP, "8080"))}, backends("appgw"))
+	assert.Equal(t, []zos.Backend{zos.Backend(backend)}, backends("othergw"))
+	assert.Equal(t, []zos.Backend{zos.Backend(backend)}, backends("appothergw"))
+}
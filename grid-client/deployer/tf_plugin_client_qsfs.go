@@ -0,0 +1,313 @@
+package deployer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+)
+
+// QSFSMetaBackends is the number of metadata zdbs deployed for a qsfs, zstor requires exactly 4
+const QSFSMetaBackends = 4
+
+// QSFSSpec describes a qsfs and the zdb backends to deploy for it
+type QSFSSpec struct {
+	Name                 string
+	Description          string
+	Cache                int
+	MinimalShards        uint32
+	ExpectedShards       uint32
+	RedundantGroups      uint32
+	RedundantNodes       uint32
+	MaxZDBDataDirSize    uint32
+	CompressionAlgorithm string
+	// Groups is the number of data backend groups, each group has ExpectedShards zdbs. defaults to 1
+	Groups uint32
+	// DataZDBSizeGB is the size of each data zdb
+	DataZDBSizeGB uint64
+	// MetaZDBSizeGB is the size of each metadata zdb, defaults to 1
+	MetaZDBSizeGB uint64
+	// Password of the zdbs, a random password is generated if empty
+	Password string
+	// EncryptionKey is the hex encoded aes key of data and metadata, a random key is generated if empty
+	EncryptionKey string
+	// NodeFilter selects the nodes of the zdbs, the zdbs of a group are each deployed on a different node
+	NodeFilter types.NodeFilter
+	// DistinctFarms deploys the zdbs of a group on different farms instead of only different nodes
+	DistinctFarms bool
+	SolutionType  string
+}
+
+// ComposedQSFS is a qsfs workload wired to the zdb deployments backing it.
+// QSFS should be added to the deployment of the vms mounting it, which has to be updated after growing or shrinking
+type ComposedQSFS struct {
+	Spec QSFSSpec
+	QSFS workloads.QSFS
+	// Meta are the deployments of the metadata zdbs
+	Meta []*workloads.Deployment
+	// Groups are the deployments of the data zdbs of each group
+	Groups [][]*workloads.Deployment
+}
+
+// ComposeQSFS deploys the metadata and data zdbs described by the spec and returns the qsfs workload using them
+func (t *TFPluginClient) ComposeQSFS(ctx context.Context, spec QSFSSpec) (ComposedQSFS, error) {
+	if err := spec.setDefaults(); err != nil {
+		return ComposedQSFS{}, err
+	}
+
+	composed := ComposedQSFS{
+		Spec: spec,
+		QSFS: workloads.QSFS{
+			Name:                 spec.Name,
+			Description:          spec.Description,
+			Cache:                spec.Cache,
+			MinimalShards:        spec.MinimalShards,
+			ExpectedShards:       spec.ExpectedShards,
+			RedundantGroups:      spec.RedundantGroups,
+			RedundantNodes:       spec.RedundantNodes,
+			MaxZDBDataDirSize:    spec.MaxZDBDataDirSize,
+			EncryptionAlgorithm:  "AES",
+			EncryptionKey:        spec.EncryptionKey,
+			CompressionAlgorithm: spec.CompressionAlgorithm,
+			Metadata: workloads.Metadata{
+				Type:                "zdb",
+				Prefix:              spec.Name,
+				EncryptionAlgorithm: "AES",
+				EncryptionKey:       spec.EncryptionKey,
+			},
+		},
+	}
+
+	filter, hdd := spec.nodeFilter(spec.MetaZDBSizeGB)
+	nodes, err := FilterDistinctNodes(ctx, *t, filter, QSFSMetaBackends, spec.DistinctFarms, nil, hdd, nil)
+	if err != nil {
+		return ComposedQSFS{}, errors.Wrapf(err, "could not find nodes for qsfs %s metadata", spec.Name)
+	}
+	for i, node := range nodes {
+		name := fmt.Sprintf("%s_meta%d", spec.Name, i)
+		composed.Meta = append(composed.Meta, spec.zdbDeployment(name, uint32(node.NodeID), spec.MetaZDBSizeGB, workloads.ZDBModeUser))
+	}
+
+	if err := t.deployQSFSBackends(ctx, composed.Meta); err != nil {
+		return ComposedQSFS{}, errors.Wrapf(err, "failed to deploy qsfs %s metadata zdbs", spec.Name)
+	}
+
+	composed.QSFS.Metadata.Backends, err = t.qsfsBackends(ctx, composed.Meta)
+	if err != nil {
+		return ComposedQSFS{}, multierror.Append(errors.Wrapf(err, "failed to get qsfs %s metadata backends", spec.Name), t.cancelDeployments(ctx, composed.Meta))
+	}
+
+	composed.Spec.Groups = 0
+	if err := t.GrowQSFS(ctx, &composed, spec.Groups); err != nil {
+		return ComposedQSFS{}, multierror.Append(err, t.CancelQSFS(ctx, &composed))
+	}
+
+	return composed, nil
+}
+
+// GrowQSFS deploys the given number of new data groups and adds them to the qsfs workload
+func (t *TFPluginClient) GrowQSFS(ctx context.Context, composed *ComposedQSFS, groups uint32) error {
+	spec := composed.Spec
+	for g := spec.Groups; g < spec.Groups+groups; g++ {
+		filter, hdd := spec.nodeFilter(spec.DataZDBSizeGB)
+		nodes, err := FilterDistinctNodes(ctx, *t, filter, int(spec.ExpectedShards), spec.DistinctFarms, nil, hdd, nil)
+		if err != nil {
+			return errors.Wrapf(err, "could not find nodes for qsfs %s group %d", spec.Name, g)
+		}
+
+		group := make([]*workloads.Deployment, 0, len(nodes))
+		for i, node := range nodes {
+			name := fmt.Sprintf("%s_g%d_data%d", spec.Name, g, i)
+			group = append(group, spec.zdbDeployment(name, uint32(node.NodeID), spec.DataZDBSizeGB, workloads.ZDBModeSeq))
+		}
+
+		if err := t.deployQSFSBackends(ctx, group); err != nil {
+			return errors.Wrapf(err, "failed to deploy qsfs %s group %d", spec.Name, g)
+		}
+
+		backends, err := t.qsfsBackends(ctx, group)
+		if err != nil {
+			return multierror.Append(errors.Wrapf(err, "failed to get qsfs %s group %d backends", spec.Name, g), t.cancelDeployments(ctx, group))
+		}
+
+		composed.Groups = append(composed.Groups, group)
+		composed.QSFS.Groups = append(composed.QSFS.Groups, workloads.Group{Backends: backends})
+		composed.Spec.Groups++
+	}
+
+	return nil
+}
+
+// ShrinkQSFS removes the given number of the most recent data groups from the qsfs workload and cancels their zdbs.
+// the qsfs deployment should be updated first so zstor stops using the removed groups
+func (t *TFPluginClient) ShrinkQSFS(ctx context.Context, composed *ComposedQSFS, groups uint32) error {
+	if groups >= composed.Spec.Groups || composed.Spec.Groups-groups <= composed.Spec.RedundantGroups {
+		return errors.Errorf("qsfs %s needs more than %d redundant groups and at least one group, it has %d groups", composed.Spec.Name, composed.Spec.RedundantGroups, composed.Spec.Groups)
+	}
+
+	for ; groups > 0; groups-- {
+		last := len(composed.Groups) - 1
+		if err := t.cancelDeployments(ctx, composed.Groups[last]); err != nil {
+			return errors.Wrapf(err, "failed to cancel qsfs %s group %d", composed.Spec.Name, last)
+		}
+
+		composed.Groups = composed.Groups[:last]
+		composed.QSFS.Groups = composed.QSFS.Groups[:last]
+		composed.Spec.Groups--
+	}
+
+	return nil
+}
+
+// CancelQSFS cancels all the zdbs of the qsfs, the deployment of the qsfs workload itself is not canceled
+func (t *TFPluginClient) CancelQSFS(ctx context.Context, composed *ComposedQSFS) error {
+	for len(composed.Groups) > 0 {
+		last := len(composed.Groups) - 1
+		if err := t.cancelDeployments(ctx, composed.Groups[last]); err != nil {
+			return errors.Wrapf(err, "failed to cancel qsfs %s group %d", composed.Spec.Name, last)
+		}
+		composed.Groups = composed.Groups[:last]
+		composed.QSFS.Groups = composed.QSFS.Groups[:last]
+	}
+	composed.Spec.Groups = 0
+
+	if err := t.cancelDeployments(ctx, composed.Meta); err != nil {
+		return errors.Wrapf(err, "failed to cancel qsfs %s metadata", composed.Spec.Name)
+	}
+	composed.Meta = nil
+	composed.QSFS.Metadata.Backends = nil
+
+	return nil
+}
+
+func (t *TFPluginClient) deployQSFSBackends(ctx context.Context, dls []*workloads.Deployment) error {
+	if err := t.DeploymentDeployer.BatchDeploy(ctx, dls); err != nil {
+		return multierror.Append(err, t.cancelDeployments(ctx, dls))
+	}
+	return nil
+}
+
+// cancelDeployments cancels the deployments that have a contract
+func (t *TFPluginClient) cancelDeployments(ctx context.Context, dls []*workloads.Deployment) error {
+	var errs error
+	for _, dl := range dls {
+		if dl.ContractID == 0 {
+			continue
+		}
+		if err := t.DeploymentDeployer.Cancel(ctx, dl); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+	return errs
+}
+
+// qsfsBackends loads the zdbs of the deployments from the grid and returns their addresses
+func (t *TFPluginClient) qsfsBackends(ctx context.Context, dls []*workloads.Deployment) (workloads.Backends, error) {
+	backends := make(workloads.Backends, 0, len(dls))
+	for _, dl := range dls {
+		zdb, err := t.State.LoadZdbFromGrid(ctx, dl.NodeID, dl.Zdbs[0].Name, dl.Name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not load zdb %s", dl.Zdbs[0].Name)
+		}
+
+		ip := zdbBackendIP(zdb.IPs)
+		if ip == "" {
+			return nil, errors.Errorf("zdb %s on node %d has no ip", zdb.Name, dl.NodeID)
+		}
+
+		backends = append(backends, workloads.Backend{
+			Address:   fmt.Sprintf("[%s]:%d", ip, zdb.Port),
+			Namespace: zdb.Namespace,
+			Password:  dl.Zdbs[0].Password,
+		})
+	}
+	return backends, nil
+}
+
+// zdbBackendIP prefers the public ipv6 of a zdb over its yggdrasil and mycelium ones
+func zdbBackendIP(ips []string) string {
+	ipv6, yggdrasil, mycelium := classifyZDBIPs(ips)
+	for _, ip := range []string{ipv6, yggdrasil, mycelium} {
+		if ip != "" {
+			return ip
+		}
+	}
+	return ""
+}
+
+func (s *QSFSSpec) setDefaults() error {
+	if s.Groups == 0 {
+		s.Groups = 1
+	}
+	if s.MetaZDBSizeGB == 0 {
+		s.MetaZDBSizeGB = 1
+	}
+	if s.CompressionAlgorithm == "" {
+		s.CompressionAlgorithm = "snappy"
+	}
+
+	if s.ExpectedShards == 0 || s.DataZDBSizeGB == 0 {
+		return errors.New("qsfs expected shards and data zdb size are required")
+	}
+	if s.MinimalShards == 0 || s.MinimalShards > s.ExpectedShards {
+		return errors.New("qsfs minimal shards must be positive and not greater than expected shards")
+	}
+	if s.RedundantGroups >= s.Groups {
+		return errors.Errorf("qsfs needs more than %d groups to have %d redundant groups", s.RedundantGroups, s.RedundantGroups)
+	}
+
+	if s.Password == "" {
+		password, err := randomHex(16)
+		if err != nil {
+			return errors.Wrap(err, "failed to generate zdb password")
+		}
+		s.Password = password
+	}
+	if s.EncryptionKey == "" {
+		key, err := randomHex(32)
+		if err != nil {
+			return errors.Wrap(err, "failed to generate qsfs encryption key")
+		}
+		s.EncryptionKey = key
+	}
+
+	return nil
+}
+
+// nodeFilter returns the filter and hdd disks of a node hosting a zdb of the given size
+func (s *QSFSSpec) nodeFilter(sizeGB uint64) (types.NodeFilter, []uint64) {
+	filter := s.NodeFilter
+	hru := sizeGB * uint64(gridtypes.Gigabyte)
+	filter.FreeHRU = &hru
+	if len(filter.Status) == 0 {
+		filter.Status = []string{"up"}
+	}
+	return filter, []uint64{hru}
+}
+
+func (s *QSFSSpec) zdbDeployment(name string, nodeID uint32, sizeGB uint64, mode string) *workloads.Deployment {
+	zdb := workloads.ZDB{
+		Name:        name,
+		Password:    s.Password,
+		Public:      true,
+		SizeGB:      sizeGB,
+		Description: fmt.Sprintf("backend of qsfs %s", s.Name),
+		Mode:        mode,
+	}
+	dl := workloads.NewDeployment(name, nodeID, s.SolutionType, nil, "", nil, []workloads.ZDB{zdb}, nil, nil, nil, nil)
+	return &dl
+}
+
+func randomHex(n int) (string, error) {
+	key := make([]byte, n)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(key), nil
+}
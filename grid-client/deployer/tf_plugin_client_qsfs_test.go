@@ -0,0 +1,113 @@
+package deployer
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/simulation"
+	zosTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-client/zos"
+)
+
+func newSimulatedGrid(t *testing.T, nodes int) *simulation.Grid {
+	t.Helper()
+
+	grid := simulation.NewGrid()
+	for id := uint32(4); id <= uint32(nodes); id++ {
+		require.NoError(t, grid.AddNode(simulation.Node{
+			ID:     id,
+			FarmID: 1,
+			Total: zosTypes.Capacity{
+				CRU: 8,
+				MRU: 32 * zosTypes.Gigabyte,
+				SRU: 512 * zosTypes.Gigabyte,
+				HRU: 2048 * zosTypes.Gigabyte,
+			},
+		}))
+	}
+	return grid
+}
+
+func TestComposeQSFS(t *testing.T) {
+	grid := newSimulatedGrid(t, 5)
+
+	tfPluginClient, err := NewTFPluginClient(simulationMnemonic, WithSimulation(grid))
+	require.NoError(t, err)
+	defer tfPluginClient.Close()
+
+	ctx := context.Background()
+	spec := QSFSSpec{
+		Name:              "qsfs",
+		Cache:             1024,
+		MinimalShards:     2,
+		ExpectedShards:    4,
+		MaxZDBDataDirSize: 512,
+		DataZDBSizeGB:     10,
+	}
+
+	composed, err := tfPluginClient.ComposeQSFS(ctx, spec)
+	require.NoError(t, err)
+	require.NoError(t, composed.QSFS.Validate())
+
+	t.Run("backends", func(t *testing.T) {
+		require.Len(t, composed.QSFS.Metadata.Backends, QSFSMetaBackends)
+		require.Len(t, composed.QSFS.Groups, 1)
+		require.Len(t, composed.QSFS.Groups[0].Backends, 4)
+		assert.Len(t, composed.QSFS.EncryptionKey, 64)
+
+		nodes := map[uint32]bool{}
+		for _, dl := range composed.Groups[0] {
+			assert.False(t, nodes[dl.NodeID], "data zdbs of a group must be on different nodes")
+			nodes[dl.NodeID] = true
+			assert.Equal(t, "seq", dl.Zdbs[0].Mode)
+		}
+
+		for _, backend := range append(composed.QSFS.Metadata.Backends, composed.QSFS.Groups[0].Backends...) {
+			assert.True(t, strings.HasPrefix(backend.Address, "[2a10:"), backend.Address)
+			assert.True(t, strings.HasSuffix(backend.Address, "]:9900"), backend.Address)
+			assert.NotEmpty(t, backend.Namespace)
+			assert.Equal(t, composed.Spec.Password, backend.Password)
+		}
+		assert.Len(t, grid.Contracts(tfPluginClient.TwinID), 8)
+	})
+
+	t.Run("grow and shrink", func(t *testing.T) {
+		require.NoError(t, tfPluginClient.GrowQSFS(ctx, &composed, 1))
+		assert.Len(t, composed.QSFS.Groups, 2)
+		assert.Len(t, grid.Contracts(tfPluginClient.TwinID), 12)
+
+		require.NoError(t, tfPluginClient.ShrinkQSFS(ctx, &composed, 1))
+		assert.Len(t, composed.QSFS.Groups, 1)
+		assert.Equal(t, uint32(1), composed.Spec.Groups)
+		assert.Len(t, grid.Contracts(tfPluginClient.TwinID), 8)
+
+		assert.Error(t, tfPluginClient.ShrinkQSFS(ctx, &composed, 1))
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		require.NoError(t, tfPluginClient.CancelQSFS(ctx, &composed))
+		assert.Empty(t, composed.QSFS.Groups)
+		assert.Empty(t, grid.Contracts(tfPluginClient.TwinID))
+	})
+}
+
+func TestComposeQSFSDistinctFarms(t *testing.T) {
+	grid := newSimulatedGrid(t, 5)
+
+	tfPluginClient, err := NewTFPluginClient(simulationMnemonic, WithSimulation(grid))
+	require.NoError(t, err)
+	defer tfPluginClient.Close()
+
+	_, err = tfPluginClient.ComposeQSFS(context.Background(), QSFSSpec{
+		Name:           "qsfs",
+		MinimalShards:  2,
+		ExpectedShards: 4,
+		DataZDBSizeGB:  10,
+		DistinctFarms:  true,
+	})
+	assert.True(t, errors.Is(err, ErrNoNodesMatchesResources))
+	assert.Empty(t, grid.Contracts(tfPluginClient.TwinID))
+}
@@ -0,0 +1,50 @@
+package deployer
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/simulation"
+)
+
+// WithSimulation runs the client against an in-process simulated grid instead of tfchain, the relay and the grid proxy.
+// A new simulation.NewGrid is used unless a grid is given, sharing a grid lets tests inspect its ledger and nodes.
+func WithSimulation(grid ...*simulation.Grid) PluginOpt {
+	return func(p *pluginCfg) {
+		p.simulation = simulation.NewGrid()
+		if len(grid) > 0 && grid[0] != nil {
+			p.simulation = grid[0]
+		}
+	}
+}
+
+// connectSimulation wires the simulated chain, relay, proxy and graphql of the configured grid.
+// the account is registered on first use so no balance, kyc or sentry checks are done
+func (t *TFPluginClient) connectSimulation(cfg pluginCfg, publicKey []byte) error {
+	grid := cfg.simulation
+
+	t.SubstrateConn = grid.Substrate()
+	t.RMB = grid.RMB()
+	t.GridProxyClient = grid.Proxy()
+
+	twinID, err := t.SubstrateConn.GetTwinByPubKey(publicKey)
+	if err != nil {
+		return errors.Wrap(err, "failed to get simulated twin")
+	}
+	t.TwinID = twinID
+	t.sentry = gridSentry{twinID: twinID}
+
+	if cfg.rmbTimeout == 0 {
+		cfg.rmbTimeout = 60
+	}
+	t.RMBTimeout = time.Second * time.Duration(cfg.rmbTimeout)
+
+	graphqlURL, stop, err := grid.ServeGraphQL()
+	if err != nil {
+		return err
+	}
+	t.graphqlURLs = []string{graphqlURL}
+	t.cancelRelayContext = stop
+
+	return nil
+}
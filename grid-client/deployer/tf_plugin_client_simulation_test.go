@@ -0,0 +1,101 @@
+package deployer
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/simulation"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/zos"
+)
+
+const simulationMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+func TestSimulatedPluginClient(t *testing.T) {
+	grid := simulation.NewGrid()
+
+	tfPluginClient, err := NewTFPluginClient(simulationMnemonic, WithSimulation(grid))
+	require.NoError(t, err)
+	defer tfPluginClient.Close()
+
+	assert.NotZero(t, tfPluginClient.TwinID)
+
+	ctx := context.Background()
+
+	network := workloads.ZNet{
+		Name:  "simnet",
+		Nodes: []uint32{1},
+		IPRange: zos.IPNet{IPNet: net.IPNet{
+			IP:   net.IPv4(10, 20, 0, 0),
+			Mask: net.CIDRMask(16, 32),
+		}},
+		SolutionType: "simulation",
+	}
+	require.NoError(t, tfPluginClient.NetworkDeployer.Deploy(ctx, &network))
+
+	dl := workloads.NewDeployment(
+		"simdl", 1, "simulation", nil, network.Name,
+		[]workloads.Disk{{Name: "data", SizeGB: 10}},
+		[]workloads.ZDB{{Name: "zdb", Password: "password", SizeGB: 20, Mode: workloads.ZDBModeUser}},
+		nil, nil, nil, nil,
+	)
+
+	t.Run("deploy", func(t *testing.T) {
+		require.NoError(t, tfPluginClient.DeploymentDeployer.Deploy(ctx, &dl))
+		require.NotZero(t, dl.ContractID)
+
+		contracts, err := tfPluginClient.ContractsGetter.ListContractsByTwinID([]string{"Created"})
+		require.NoError(t, err)
+		assert.Len(t, contracts.NodeContracts, 2)
+
+		_, used, err := grid.NodeCapacity(1)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(10*1024*1024*1024), used.SRU)
+		assert.Equal(t, uint64(20*1024*1024*1024), used.HRU)
+
+		loaded, err := tfPluginClient.State.LoadDeploymentFromGrid(ctx, 1, dl.Name)
+		require.NoError(t, err)
+		require.Len(t, loaded.Zdbs, 1)
+		assert.Equal(t, uint32(9900), loaded.Zdbs[0].Port)
+	})
+
+	t.Run("update", func(t *testing.T) {
+		dl.Disks = append(dl.Disks, workloads.Disk{Name: "logs", SizeGB: 5})
+		require.NoError(t, tfPluginClient.DeploymentDeployer.Deploy(ctx, &dl))
+
+		_, used, err := grid.NodeCapacity(1)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(15*1024*1024*1024), used.SRU)
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		require.NoError(t, tfPluginClient.DeploymentDeployer.Cancel(ctx, &dl))
+		require.NoError(t, tfPluginClient.NetworkDeployer.Cancel(ctx, &network))
+
+		assert.Empty(t, grid.Contracts(tfPluginClient.TwinID))
+
+		_, used, err := grid.NodeCapacity(1)
+		require.NoError(t, err)
+		assert.Zero(t, used.SRU)
+		assert.Zero(t, used.HRU)
+	})
+}
+
+func TestSimulatedNodeDown(t *testing.T) {
+	grid := simulation.NewGrid()
+	require.NoError(t, grid.SetNodeDown(2, true))
+
+	tfPluginClient, err := NewTFPluginClient(simulationMnemonic, WithSimulation(grid))
+	require.NoError(t, err)
+	defer tfPluginClient.Close()
+
+	dl := workloads.NewDeployment(
+		"simdl", 2, "simulation", nil, "",
+		[]workloads.Disk{{Name: "data", SizeGB: 10}},
+		nil, nil, nil, nil, nil,
+	)
+	assert.Error(t, tfPluginClient.DeploymentDeployer.Deploy(context.Background(), &dl))
+}
@@ -0,0 +1,219 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+)
+
+// GrowDisk grows a disk of a deployed deployment.
+// zos can't resize a disk mounted by a running vm, so the vms mounting the disk are removed
+// then deployed again once the disk is resized. the data of the disk is kept
+func (t *TFPluginClient) GrowDisk(ctx context.Context, dl *workloads.Deployment, name string, sizeGB uint64) error {
+	idx := slices.IndexFunc(dl.Disks, func(d workloads.Disk) bool { return d.Name == name })
+	if idx < 0 {
+		return fmt.Errorf("disk '%s' not found in deployment %s", name, dl.Name)
+	}
+	if sizeGB < dl.Disks[idx].SizeGB {
+		return fmt.Errorf("cannot shrink disk '%s' from %d to %d GB", name, dl.Disks[idx].SizeGB, sizeGB)
+	}
+
+	return t.recreateVMs(ctx, dl, mountingVMs(dl, name), func(dl *workloads.Deployment) error {
+		dl.Disks[idx].SizeGB = sizeGB
+		return nil
+	})
+}
+
+// GrowVolume grows a volume of a deployed deployment, volumes are resized while mounted
+func (t *TFPluginClient) GrowVolume(ctx context.Context, dl *workloads.Deployment, name string, sizeGB uint64) error {
+	idx := slices.IndexFunc(dl.Volumes, func(v workloads.Volume) bool { return v.Name == name })
+	if idx < 0 {
+		return fmt.Errorf("volume '%s' not found in deployment %s", name, dl.Name)
+	}
+	if sizeGB < dl.Volumes[idx].SizeGB {
+		return fmt.Errorf("cannot shrink volume '%s' from %d to %d GB", name, dl.Volumes[idx].SizeGB, sizeGB)
+	}
+
+	return t.recreateVMs(ctx, dl, nil, func(dl *workloads.Deployment) error {
+		dl.Volumes[idx].SizeGB = sizeGB
+		return nil
+	})
+}
+
+// DetachVolume unmounts a disk or a volume from a vm of a deployed deployment.
+// the vm is recreated without the mount, the disk or volume and its data are kept
+func (t *TFPluginClient) DetachVolume(ctx context.Context, dl *workloads.Deployment, vm, volume string) error {
+	return t.recreateVMs(ctx, dl, []string{vm}, func(dl *workloads.Deployment) error {
+		mounts, err := vmMounts(dl, vm)
+		if err != nil {
+			return err
+		}
+
+		idx := slices.IndexFunc(*mounts, func(m workloads.Mount) bool { return m.Name == volume })
+		if idx < 0 {
+			return fmt.Errorf("'%s' is not mounted on vm '%s'", volume, vm)
+		}
+		*mounts = slices.Delete(*mounts, idx, idx+1)
+		return nil
+	})
+}
+
+// AttachVolume mounts a disk or a volume of a deployed deployment on a vm of the same deployment.
+// the vm is recreated with the new mount, a volume mounted on another vm is moved from it
+func (t *TFPluginClient) AttachVolume(ctx context.Context, dl *workloads.Deployment, vm, volume, mountPoint string) error {
+	if !slices.ContainsFunc(dl.Disks, func(d workloads.Disk) bool { return d.Name == volume }) &&
+		!slices.ContainsFunc(dl.Volumes, func(v workloads.Volume) bool { return v.Name == volume }) {
+		return fmt.Errorf("no disk or volume named '%s' in deployment %s", volume, dl.Name)
+	}
+
+	vms := []string{vm}
+	for _, name := range mountingVMs(dl, volume) {
+		if name == vm {
+			return fmt.Errorf("'%s' is already mounted on vm '%s'", volume, vm)
+		}
+		vms = append(vms, name)
+	}
+
+	return t.recreateVMs(ctx, dl, vms, func(dl *workloads.Deployment) error {
+		for _, name := range vms[1:] {
+			mounts, err := vmMounts(dl, name)
+			if err != nil {
+				return err
+			}
+			*mounts = slices.DeleteFunc(*mounts, func(m workloads.Mount) bool { return m.Name == volume })
+		}
+
+		mounts, err := vmMounts(dl, vm)
+		if err != nil {
+			return err
+		}
+		*mounts = append(*mounts, workloads.Mount{Name: volume, MountPoint: mountPoint})
+		return nil
+	})
+}
+
+// RecreateVM replaces a vm of a deployed deployment with a new spec of the same name, e.g. to upgrade its image.
+// zos can't update vms in place, so the vm is removed then deployed again while its disks and volumes are kept
+func (t *TFPluginClient) RecreateVM(ctx context.Context, dl *workloads.Deployment, vm workloads.VM) error {
+	idx := slices.IndexFunc(dl.Vms, func(v workloads.VM) bool { return v.Name == vm.Name })
+	if idx < 0 {
+		return fmt.Errorf("vm '%s' not found in deployment %s", vm.Name, dl.Name)
+	}
+
+	return t.recreateVMs(ctx, dl, []string{vm.Name}, func(dl *workloads.Deployment) error {
+		dl.Vms[idx] = vm
+		return nil
+	})
+}
+
+// RecreateVMLight replaces a vm-light of a deployed deployment with a new spec of the same name keeping its volumes
+func (t *TFPluginClient) RecreateVMLight(ctx context.Context, dl *workloads.Deployment, vm workloads.VMLight) error {
+	idx := slices.IndexFunc(dl.VmsLight, func(v workloads.VMLight) bool { return v.Name == vm.Name })
+	if idx < 0 {
+		return fmt.Errorf("vm-light '%s' not found in deployment %s", vm.Name, dl.Name)
+	}
+
+	return t.recreateVMs(ctx, dl, []string{vm.Name}, func(dl *workloads.Deployment) error {
+		dl.VmsLight[idx] = vm
+		return nil
+	})
+}
+
+// recreateVMs applies a change to a deployed deployment.
+// the given vms are removed in a first update along with the storage changes, then deployed again in a second one.
+// disks and volumes are separate workloads so they outlive the vms. if deploying the vms again fails,
+// the deployment is left with the new spec so deploying it again retries
+func (t *TFPluginClient) recreateVMs(ctx context.Context, dl *workloads.Deployment, vms []string, change func(dl *workloads.Deployment) error) error {
+	if dl.ContractID == 0 {
+		return fmt.Errorf("deployment %s is not deployed", dl.Name)
+	}
+
+	updated := cloneDeployment(dl)
+	if err := change(&updated); err != nil {
+		return err
+	}
+
+	if len(vms) != 0 {
+		removed := cloneDeployment(&updated)
+		removed.Vms = slices.DeleteFunc(removed.Vms, func(vm workloads.VM) bool { return slices.Contains(vms, vm.Name) })
+		removed.VmsLight = slices.DeleteFunc(removed.VmsLight, func(vm workloads.VMLight) bool { return slices.Contains(vms, vm.Name) })
+
+		err := t.DeploymentDeployer.Deploy(ctx, &removed)
+		dl.NodeDeploymentID, dl.ContractID = removed.NodeDeploymentID, removed.ContractID
+		if err != nil {
+			return errors.Wrapf(err, "failed to remove vms %v from deployment %s", vms, dl.Name)
+		}
+		updated.NodeDeploymentID, updated.ContractID = removed.NodeDeploymentID, removed.ContractID
+	}
+
+	err := t.DeploymentDeployer.Deploy(ctx, &updated)
+	*dl = updated
+	if err != nil && len(vms) != 0 {
+		return errors.Wrapf(err, "failed to deploy vms %v again in deployment %s, deploy it again to retry", vms, dl.Name)
+	}
+
+	return errors.Wrapf(err, "failed to update deployment %s", dl.Name)
+}
+
+// mountingVMs returns the vms of a deployment mounting a disk or a volume
+func mountingVMs(dl *workloads.Deployment, volume string) []string {
+	var vms []string
+	isMount := func(m workloads.Mount) bool { return m.Name == volume }
+
+	for _, vm := range dl.Vms {
+		if slices.ContainsFunc(vm.Mounts, isMount) {
+			vms = append(vms, vm.Name)
+		}
+	}
+	for _, vm := range dl.VmsLight {
+		if slices.ContainsFunc(vm.Mounts, isMount) {
+			vms = append(vms, vm.Name)
+		}
+	}
+
+	return vms
+}
+
+// vmMounts returns the mounts of a vm or a vm-light of a deployment
+func vmMounts(dl *workloads.Deployment, name string) (*[]workloads.Mount, error) {
+	for i := range dl.Vms {
+		if dl.Vms[i].Name == name {
+			return &dl.Vms[i].Mounts, nil
+		}
+	}
+	for i := range dl.VmsLight {
+		if dl.VmsLight[i].Name == name {
+			return &dl.VmsLight[i].Mounts, nil
+		}
+	}
+
+	return nil, fmt.Errorf("vm '%s' not found in deployment %s", name, dl.Name)
+}
+
+// cloneDeployment copies a deployment so changes to its workloads don't affect the original
+func cloneDeployment(dl *workloads.Deployment) workloads.Deployment {
+	clone := *dl
+	clone.Disks = slices.Clone(dl.Disks)
+	clone.Volumes = slices.Clone(dl.Volumes)
+	clone.Zdbs = slices.Clone(dl.Zdbs)
+	clone.QSFS = slices.Clone(dl.QSFS)
+	clone.NodeDeploymentID = maps.Clone(dl.NodeDeploymentID)
+
+	clone.Vms = slices.Clone(dl.Vms)
+	for i := range clone.Vms {
+		clone.Vms[i].Mounts = slices.Clone(clone.Vms[i].Mounts)
+		clone.Vms[i].Zlogs = slices.Clone(clone.Vms[i].Zlogs)
+	}
+
+	clone.VmsLight = slices.Clone(dl.VmsLight)
+	for i := range clone.VmsLight {
+		clone.VmsLight[i].Mounts = slices.Clone(clone.VmsLight[i].Mounts)
+		clone.VmsLight[i].Zlogs = slices.Clone(clone.VmsLight[i].Zlogs)
+	}
+
+	return clone
+}
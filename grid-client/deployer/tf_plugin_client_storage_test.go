@@ -0,0 +1,141 @@
+package deployer
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/simulation"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/zos"
+)
+
+func TestStorageLifecycle(t *testing.T) {
+	// serves the flists of the vms
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer hub.Close()
+
+	grid := simulation.NewGrid()
+	tfPluginClient, err := NewTFPluginClient(simulationMnemonic, WithSimulation(grid))
+	require.NoError(t, err)
+	defer tfPluginClient.Close()
+
+	ctx := context.Background()
+	network := workloads.ZNet{
+		Name:  "storagenet",
+		Nodes: []uint32{1},
+		IPRange: zos.IPNet{IPNet: net.IPNet{
+			IP:   net.IPv4(10, 20, 0, 0),
+			Mask: net.CIDRMask(16, 32),
+		}},
+	}
+	require.NoError(t, tfPluginClient.NetworkDeployer.Deploy(ctx, &network))
+
+	vm := func(name string, mounts ...workloads.Mount) workloads.VM {
+		return workloads.VM{
+			Name:        name,
+			NodeID:      1,
+			NetworkName: network.Name,
+			Flist:       hub.URL + "/ubuntu-22.04.flist",
+			CPU:         1,
+			MemoryMB:    512,
+			Mounts:      mounts,
+		}
+	}
+
+	dl := workloads.NewDeployment(
+		"storage", 1, "", nil, network.Name,
+		[]workloads.Disk{{Name: "data", SizeGB: 10}},
+		nil,
+		[]workloads.VM{vm("app", workloads.Mount{Name: "data", MountPoint: "/data"}), vm("worker")},
+		nil, nil,
+		[]workloads.Volume{{Name: "shared", SizeGB: 5}},
+	)
+	require.NoError(t, tfPluginClient.DeploymentDeployer.Deploy(ctx, &dl))
+
+	loaded := func() workloads.Deployment {
+		t.Helper()
+		loaded, err := tfPluginClient.State.LoadDeploymentFromGrid(ctx, 1, dl.Name)
+		require.NoError(t, err)
+		return loaded
+	}
+	mounts := func(vm string) []string {
+		t.Helper()
+		var names []string
+		for _, v := range loaded().Vms {
+			if v.Name != vm {
+				continue
+			}
+			for _, mount := range v.Mounts {
+				names = append(names, mount.Name)
+			}
+		}
+		return names
+	}
+	ip := dl.Vms[0].IP
+
+	t.Run("vms are not updated in place", func(t *testing.T) {
+		dl.Vms[0].CPU = 2
+		assert.ErrorContains(t, tfPluginClient.DeploymentDeployer.Deploy(ctx, &dl), "cannot be updated in place")
+		dl.Vms[0].CPU = 1
+	})
+
+	t.Run("grow disk", func(t *testing.T) {
+		assert.Error(t, tfPluginClient.GrowDisk(ctx, &dl, "data", 5))
+
+		require.NoError(t, tfPluginClient.GrowDisk(ctx, &dl, "data", 20))
+		assert.Equal(t, uint64(20), loaded().Disks[0].SizeGB)
+		assert.Equal(t, []string{"data"}, mounts("app"))
+		assert.Equal(t, ip, dl.Vms[0].IP)
+
+		_, used, err := grid.NodeCapacity(1)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(25*zos.Gigabyte), used.SRU-2*dl.Vms[0].MinRootSize())
+	})
+
+	t.Run("grow volume", func(t *testing.T) {
+		require.NoError(t, tfPluginClient.GrowVolume(ctx, &dl, "shared", 8))
+		assert.Equal(t, uint64(8), loaded().Volumes[0].SizeGB)
+	})
+
+	t.Run("attach and move volume", func(t *testing.T) {
+		require.NoError(t, tfPluginClient.AttachVolume(ctx, &dl, "app", "shared", "/shared"))
+		assert.ElementsMatch(t, []string{"data", "shared"}, mounts("app"))
+
+		assert.Error(t, tfPluginClient.AttachVolume(ctx, &dl, "app", "shared", "/shared"))
+		assert.Error(t, tfPluginClient.AttachVolume(ctx, &dl, "app", "missing", "/missing"))
+
+		require.NoError(t, tfPluginClient.AttachVolume(ctx, &dl, "worker", "shared", "/shared"))
+		assert.Equal(t, []string{"data"}, mounts("app"))
+		assert.Equal(t, []string{"shared"}, mounts("worker"))
+	})
+
+	t.Run("detach volume", func(t *testing.T) {
+		require.NoError(t, tfPluginClient.DetachVolume(ctx, &dl, "worker", "shared"))
+		assert.Empty(t, mounts("worker"))
+		assert.Len(t, loaded().Volumes, 1)
+
+		assert.Error(t, tfPluginClient.DetachVolume(ctx, &dl, "worker", "shared"))
+	})
+
+	t.Run("recreate vm", func(t *testing.T) {
+		upgraded := dl.Vms[0]
+		upgraded.Flist = hub.URL + "/ubuntu-24.04.flist"
+		upgraded.CPU = 2
+		require.NoError(t, tfPluginClient.RecreateVM(ctx, &dl, upgraded))
+
+		for _, vm := range loaded().Vms {
+			if vm.Name == "app" {
+				assert.Equal(t, upgraded.Flist, vm.Flist)
+				assert.Equal(t, uint8(2), vm.CPU)
+			}
+		}
+		assert.Equal(t, []string{"data"}, mounts("app"))
+		assert.Equal(t, uint64(20), loaded().Disks[0].SizeGB)
+		assert.Equal(t, ip, dl.Vms[0].IP)
+	})
+}
@@ -0,0 +1,332 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/zos"
+)
+
+// CompensationAction is the action taken to roll back a contract of a transaction
+type CompensationAction string
+
+const (
+	// CompensationCanceled is a contract created by the transaction and canceled
+	CompensationCanceled CompensationAction = "canceled"
+	// CompensationRestored is a contract updated by the transaction and restored to its old deployment
+	CompensationRestored CompensationAction = "restored"
+	// CompensationRecreated is a contract canceled by the transaction and recreated with its old deployment
+	CompensationRecreated CompensationAction = "recreated"
+)
+
+// Compensation is a rolled back contract of a transaction
+type Compensation struct {
+	Resource   string             `json:"resource"`
+	NodeID     uint32             `json:"node_id,omitempty"`
+	ContractID uint64             `json:"contract_id"`
+	Action     CompensationAction `json:"action"`
+	// Error is set if the contract could not be compensated and needs manual action
+	Error error `json:"-"`
+}
+
+// TransactionReport is the report of a committed transaction
+type TransactionReport struct {
+	// Applied are the resources applied in order, including the failed one if any
+	Applied []string `json:"applied"`
+	// Failed is the resource that failed, empty if the transaction succeeded
+	Failed string `json:"failed,omitempty"`
+	// Compensations are the contracts rolled back after a failure
+	Compensations []Compensation `json:"compensations,omitempty"`
+}
+
+// Transaction collects network, deployment, kubernetes and gateway operations and applies them in order.
+// if an operation fails, all the applied operations are rolled back.
+type Transaction struct {
+	tfPluginClient *TFPluginClient
+	deployer       MockDeployer
+	resources      []txResource
+}
+
+// txResource is a resource operation of a transaction
+type txResource struct {
+	name   string
+	deploy func(ctx context.Context) error
+	// contracts returns the node contracts and the name contract of the resource
+	contracts func() (map[uint32]uint64, uint64)
+	// reset sets the node contracts and the name contract of the resource after a rollback
+	reset func(nodeContracts map[uint32]uint64, nameContract uint64)
+}
+
+// txSnapshot is the state of a resource before it was applied
+type txSnapshot struct {
+	resource      txResource
+	nodeContracts map[uint32]uint64
+	nameContract  uint64
+	deployments   map[uint32]zos.Deployment
+}
+
+// NewTransaction creates a new empty transaction
+func (t *TFPluginClient) NewTransaction() *Transaction {
+	deployer := NewDeployer(*t, true)
+	return &Transaction{
+		tfPluginClient: t,
+		deployer:       &deployer,
+	}
+}
+
+// AddNetwork adds a network deployment to the transaction
+func (tx *Transaction) AddNetwork(znet workloads.Network) *Transaction {
+	tx.resources = append(tx.resources, txResource{
+		name:   fmt.Sprintf("network %s", znet.GetName()),
+		deploy: func(ctx context.Context) error { return tx.tfPluginClient.NetworkDeployer.Deploy(ctx, znet) },
+		contracts: func() (map[uint32]uint64, uint64) {
+			return znet.GetNodeDeploymentID(), 0
+		},
+		reset: func(nodeContracts map[uint32]uint64, _ uint64) {
+			znet.SetNodeDeploymentID(nodeContracts)
+		},
+	})
+	return tx
+}
+
+// AddDeployment adds a deployment to the transaction
+func (tx *Transaction) AddDeployment(dl *workloads.Deployment) *Transaction {
+	tx.resources = append(tx.resources, txResource{
+		name:   fmt.Sprintf("deployment %s", dl.Name),
+		deploy: func(ctx context.Context) error { return tx.tfPluginClient.DeploymentDeployer.Deploy(ctx, dl) },
+		contracts: func() (map[uint32]uint64, uint64) {
+			return dl.NodeDeploymentID, 0
+		},
+		reset: func(nodeContracts map[uint32]uint64, _ uint64) {
+			dl.NodeDeploymentID = nodeContracts
+			dl.ContractID = nodeContracts[dl.NodeID]
+		},
+	})
+	return tx
+}
+
+// AddK8sCluster adds a kubernetes cluster deployment to the transaction
+func (tx *Transaction) AddK8sCluster(k8sCluster *workloads.K8sCluster) *Transaction {
+	name := ""
+	if k8sCluster.Master != nil {
+		name = k8sCluster.Master.Name
+	}
+
+	tx.resources = append(tx.resources, txResource{
+		name:   fmt.Sprintf("kubernetes cluster %s", name),
+		deploy: func(ctx context.Context) error { return tx.tfPluginClient.K8sDeployer.Deploy(ctx, k8sCluster) },
+		contracts: func() (map[uint32]uint64, uint64) {
+			return k8sCluster.NodeDeploymentID, 0
+		},
+		reset: func(nodeContracts map[uint32]uint64, _ uint64) {
+			k8sCluster.NodeDeploymentID = nodeContracts
+		},
+	})
+	return tx
+}
+
+// AddGatewayName adds a name gateway deployment to the transaction
+func (tx *Transaction) AddGatewayName(gw *workloads.GatewayNameProxy) *Transaction {
+	tx.resources = append(tx.resources, txResource{
+		name:   fmt.Sprintf("gateway name %s", gw.Name),
+		deploy: func(ctx context.Context) error { return tx.tfPluginClient.GatewayNameDeployer.Deploy(ctx, gw) },
+		contracts: func() (map[uint32]uint64, uint64) {
+			return gw.NodeDeploymentID, gw.NameContractID
+		},
+		reset: func(nodeContracts map[uint32]uint64, nameContract uint64) {
+			gw.NodeDeploymentID = nodeContracts
+			gw.ContractID = nodeContracts[gw.NodeID]
+			gw.NameContractID = nameContract
+		},
+	})
+	return tx
+}
+
+// AddGatewayFQDN adds a fqdn gateway deployment to the transaction
+func (tx *Transaction) AddGatewayFQDN(gw *workloads.GatewayFQDNProxy) *Transaction {
+	tx.resources = append(tx.resources, txResource{
+		name:   fmt.Sprintf("gateway fqdn %s", gw.Name),
+		deploy: func(ctx context.Context) error { return tx.tfPluginClient.GatewayFQDNDeployer.Deploy(ctx, gw) },
+		contracts: func() (map[uint32]uint64, uint64) {
+			return gw.NodeDeploymentID, 0
+		},
+		reset: func(nodeContracts map[uint32]uint64, _ uint64) {
+			gw.NodeDeploymentID = nodeContracts
+			gw.ContractID = nodeContracts[gw.NodeID]
+		},
+	})
+	return tx
+}
+
+// Commit applies the transaction operations in order. if an operation fails, the contracts created
+// by the transaction are canceled and the updated ones are restored in reverse order, the report
+// lists every compensated contract.
+func (tx *Transaction) Commit(ctx context.Context) (TransactionReport, error) {
+	var report TransactionReport
+	snapshots := make([]txSnapshot, 0, len(tx.resources))
+
+	for _, resource := range tx.resources {
+		report.Applied = append(report.Applied, resource.name)
+
+		snapshot, err := tx.snapshot(ctx, resource)
+		if err == nil {
+			snapshots = append(snapshots, snapshot)
+			err = resource.deploy(ctx)
+		}
+
+		if err != nil {
+			report.Failed = resource.name
+			err = errors.Wrapf(err, "could not apply %s", resource.name)
+
+			if rerr := tx.rollback(ctx, snapshots, &report); rerr != nil {
+				return report, errors.Wrapf(err, "failed to roll back the transaction: %s; check the report for contracts to handle manually", rerr)
+			}
+			return report, err
+		}
+	}
+
+	return report, nil
+}
+
+// snapshot records the contracts and the deployments of a resource before applying it
+func (tx *Transaction) snapshot(ctx context.Context, resource txResource) (txSnapshot, error) {
+	nodeContracts, nameContract := resource.contracts()
+
+	snapshot := txSnapshot{
+		resource:      resource,
+		nodeContracts: copyContracts(nodeContracts),
+		nameContract:  nameContract,
+	}
+
+	if len(snapshot.nodeContracts) == 0 {
+		return snapshot, nil
+	}
+
+	deployments, err := tx.deployer.GetDeployments(ctx, snapshot.nodeContracts)
+	if err != nil {
+		return snapshot, errors.Wrapf(err, "could not get current deployments of %s to be able to roll it back", resource.name)
+	}
+	snapshot.deployments = deployments
+
+	return snapshot, nil
+}
+
+// rollback compensates the applied resources in reverse order
+func (tx *Transaction) rollback(ctx context.Context, snapshots []txSnapshot, report *TransactionReport) error {
+	var rollbackErr error
+
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		compensations, err := tx.compensate(ctx, snapshots[i])
+		report.Compensations = append(report.Compensations, compensations...)
+		if err != nil {
+			rollbackErr = multierror.Append(rollbackErr, err)
+		}
+	}
+
+	return rollbackErr
+}
+
+// compensate cancels the contracts a resource created and restores the deployments it updated or canceled
+func (tx *Transaction) compensate(ctx context.Context, snapshot txSnapshot) ([]Compensation, error) {
+	var compensations []Compensation
+	var compensateErr error
+
+	name := snapshot.resource.name
+	nodeContracts, nameContract := snapshot.resource.contracts()
+
+	// the contracts the resource kept from before the transaction
+	kept := make(map[uint32]uint64)
+	for _, nodeID := range sortedNodes(nodeContracts) {
+		contractID := nodeContracts[nodeID]
+		if snapshot.nodeContracts[nodeID] == contractID {
+			kept[nodeID] = contractID
+			continue
+		}
+
+		compensation := Compensation{Resource: name, NodeID: nodeID, ContractID: contractID, Action: CompensationCanceled}
+		if err := tx.cancel(contractID); err != nil {
+			compensation.Error = err
+			compensateErr = multierror.Append(compensateErr, err)
+			kept[nodeID] = contractID
+		} else {
+			tx.tfPluginClient.State.RemoveContractIDs(nodeID, contractID)
+		}
+		compensations = append(compensations, compensation)
+	}
+
+	resetNameContract := snapshot.nameContract
+	if nameContract != 0 && nameContract != snapshot.nameContract {
+		compensation := Compensation{Resource: name, ContractID: nameContract, Action: CompensationCanceled}
+		if err := tx.cancel(nameContract); err != nil {
+			compensation.Error = err
+			compensateErr = multierror.Append(compensateErr, err)
+			resetNameContract = nameContract
+		}
+		compensations = append(compensations, compensation)
+	}
+
+	restored := kept
+	if len(snapshot.deployments) != 0 {
+		// updated deployments are restored in place and canceled ones are recreated
+		currentContracts, err := tx.deployer.Deploy(ctx, kept, snapshot.deployments, nil)
+		if err != nil {
+			compensateErr = multierror.Append(compensateErr, errors.Wrapf(err, "could not restore deployments of %s", name))
+		}
+		restored = currentContracts
+
+		for _, nodeID := range sortedNodes(snapshot.nodeContracts) {
+			contractID, ok := currentContracts[nodeID]
+			compensation := Compensation{Resource: name, NodeID: nodeID, ContractID: contractID, Action: CompensationRestored}
+			if _, wasKept := kept[nodeID]; !wasKept {
+				compensation.Action = CompensationRecreated
+			}
+			if !ok {
+				compensation.ContractID = snapshot.nodeContracts[nodeID]
+				compensation.Error = err
+			}
+			compensations = append(compensations, compensation)
+
+			if ok {
+				tx.tfPluginClient.State.StoreContractIDs(nodeID, contractID)
+			}
+		}
+	}
+
+	snapshot.resource.reset(copyContracts(restored), resetNameContract)
+
+	return compensations, compensateErr
+}
+
+func (tx *Transaction) cancel(contractID uint64) error {
+	err := tx.tfPluginClient.SubstrateConn.EnsureContractCanceled(tx.tfPluginClient.Identity, contractID)
+	if err != nil && !strings.Contains(err.Error(), "ContractNotExists") {
+		return errors.Wrapf(err, "could not cancel contract %d", contractID)
+	}
+
+	log.Debug().Uint64("contract", contractID).Msg("transaction contract canceled")
+	tx.tfPluginClient.observers.emit(Event{Type: EventContractCanceled, ContractID: contractID, Message: "transaction rollback"})
+	return nil
+}
+
+func copyContracts(contracts map[uint32]uint64) map[uint32]uint64 {
+	copied := make(map[uint32]uint64, len(contracts))
+	for nodeID, contractID := range contracts {
+		copied[nodeID] = contractID
+	}
+	return copied
+}
+
+func sortedNodes(contracts map[uint32]uint64) []uint32 {
+	nodes := make([]uint32, 0, len(contracts))
+	for nodeID := range contracts {
+		nodes = append(nodes, nodeID)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i] < nodes[j] })
+	return nodes
+}
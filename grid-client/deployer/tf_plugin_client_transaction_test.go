@@ -0,0 +1,139 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/mocks"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/state"
+	zosTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-client/zos"
+)
+
+// fakeResource is a transaction resource setting its contracts when deployed
+type fakeResource struct {
+	nodeContracts map[uint32]uint64
+	nameContract  uint64
+}
+
+func (r *fakeResource) txResource(name string, deployed map[uint32]uint64, nameContract uint64, err error) txResource {
+	return txResource{
+		name: name,
+		deploy: func(context.Context) error {
+			r.nodeContracts = deployed
+			r.nameContract = nameContract
+			return err
+		},
+		contracts: func() (map[uint32]uint64, uint64) { return r.nodeContracts, r.nameContract },
+		reset: func(nodeContracts map[uint32]uint64, nameContract uint64) {
+			r.nodeContracts = nodeContracts
+			r.nameContract = nameContract
+		},
+	}
+}
+
+func newTestTransaction(t *testing.T) (*Transaction, *mocks.MockDeployer, *mocks.MockSubstrateExt) {
+	ctrl := gomock.NewController(t)
+	t.Cleanup(ctrl.Finish)
+
+	sub := mocks.NewMockSubstrateExt(ctrl)
+	deployer := mocks.NewMockDeployer(ctrl)
+
+	tfPluginClient := TFPluginClient{
+		SubstrateConn: sub,
+		State:         state.NewState(nil, sub),
+	}
+
+	tx := tfPluginClient.NewTransaction()
+	tx.deployer = deployer
+	return tx, deployer, sub
+}
+
+func TestTransactionCommit(t *testing.T) {
+	tx, _, _ := newTestTransaction(t)
+
+	var network, gateway fakeResource
+	tx.resources = append(tx.resources,
+		network.txResource("network net", map[uint32]uint64{1: 10}, 0, nil),
+		gateway.txResource("gateway name gw", map[uint32]uint64{2: 20}, 21, nil),
+	)
+
+	report, err := tx.Commit(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, TransactionReport{Applied: []string{"network net", "gateway name gw"}}, report)
+	assert.Equal(t, map[uint32]uint64{2: 20}, gateway.nodeContracts)
+}
+
+func TestTransactionRollback(t *testing.T) {
+	tx, deployer, sub := newTestTransaction(t)
+
+	network := fakeResource{}
+	gateway := fakeResource{}
+	deployment := fakeResource{nodeContracts: map[uint32]uint64{3: 30}}
+	last := fakeResource{}
+
+	tx.resources = append(tx.resources,
+		network.txResource("network net", map[uint32]uint64{1: 10}, 0, nil),
+		gateway.txResource("gateway name gw", map[uint32]uint64{2: 20}, 21, nil),
+		deployment.txResource("deployment vm", map[uint32]uint64{3: 30, 4: 40}, 0, errors.New("node 4 is down")),
+		last.txResource("gateway fqdn never", map[uint32]uint64{5: 50}, 0, nil),
+	)
+
+	oldDeployment := deploymentWithDisks("vm", map[string]uint64{"d": 10})
+	deployer.EXPECT().
+		GetDeployments(gomock.Any(), map[uint32]uint64{3: 30}).
+		Return(map[uint32]zosTypes.Deployment{3: oldDeployment}, nil)
+
+	gomock.InOrder(
+		sub.EXPECT().EnsureContractCanceled(gomock.Any(), uint64(40)).Return(nil),
+		deployer.EXPECT().
+			Deploy(gomock.Any(), map[uint32]uint64{3: 30}, map[uint32]zosTypes.Deployment{3: oldDeployment}, gomock.Any()).
+			Return(map[uint32]uint64{3: 30}, nil),
+		sub.EXPECT().EnsureContractCanceled(gomock.Any(), uint64(20)).Return(nil),
+		sub.EXPECT().EnsureContractCanceled(gomock.Any(), uint64(21)).Return(errors.New("ContractNotExists")),
+		sub.EXPECT().EnsureContractCanceled(gomock.Any(), uint64(10)).Return(nil),
+	)
+
+	report, err := tx.Commit(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "node 4 is down")
+
+	assert.Equal(t, []string{"network net", "gateway name gw", "deployment vm"}, report.Applied)
+	assert.Equal(t, "deployment vm", report.Failed)
+	assert.Equal(t, []Compensation{
+		{Resource: "deployment vm", NodeID: 4, ContractID: 40, Action: CompensationCanceled},
+		{Resource: "deployment vm", NodeID: 3, ContractID: 30, Action: CompensationRestored},
+		{Resource: "gateway name gw", NodeID: 2, ContractID: 20, Action: CompensationCanceled},
+		{Resource: "gateway name gw", ContractID: 21, Action: CompensationCanceled},
+		{Resource: "network net", NodeID: 1, ContractID: 10, Action: CompensationCanceled},
+	}, report.Compensations)
+
+	assert.Empty(t, network.nodeContracts)
+	assert.Empty(t, gateway.nodeContracts)
+	assert.Zero(t, gateway.nameContract)
+	assert.Equal(t, map[uint32]uint64{3: 30}, deployment.nodeContracts)
+	assert.Nil(t, last.nodeContracts)
+
+	t.Run("failed compensation", func(t *testing.T) {
+		tx, _, sub := newTestTransaction(t)
+
+		var network, deployment fakeResource
+		tx.resources = append(tx.resources,
+			network.txResource("network net", map[uint32]uint64{1: 10}, 0, nil),
+			deployment.txResource("deployment vm", nil, 0, errors.New("failed")),
+		)
+
+		sub.EXPECT().EnsureContractCanceled(gomock.Any(), uint64(10)).Return(errors.New("timeout"))
+
+		report, err := tx.Commit(context.Background())
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to roll back")
+
+		require.Len(t, report.Compensations, 1)
+		assert.Error(t, report.Compensations[0].Error)
+		assert.Equal(t, map[uint32]uint64{1: 10}, network.nodeContracts)
+	})
+}
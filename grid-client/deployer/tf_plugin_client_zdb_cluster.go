@@ -0,0 +1,354 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+)
+
+var (
+	yggdrasilRange = mustParseCIDR("200::/7")
+	myceliumRange  = mustParseCIDR("400::/7")
+)
+
+// ZDBClusterSpec describes a set of zdb namespaces deployed on different nodes
+type ZDBClusterSpec struct {
+	Name    string
+	Members int
+	SizeGB  uint64
+	// Mode is the zdb mode of the namespaces, defaults to user
+	Mode string
+	// Public gives the namespaces public ipv6 addresses
+	Public bool
+	// Password of the namespaces, a random password is generated if empty
+	Password string
+	// NodeFilter selects the nodes of the members, each member is deployed on a different node
+	NodeFilter types.NodeFilter
+	// DistinctFarms deploys each member on a different farm instead of only a different node
+	DistinctFarms bool
+	SolutionType  string
+}
+
+// ZDBClusterMember is a namespace of a zdb cluster and the deployment holding it
+type ZDBClusterMember struct {
+	Deployment *workloads.Deployment
+	// ZDB is the deployed namespace with its computed outputs
+	ZDB workloads.ZDB
+}
+
+// ZDBCluster is a set of zdb namespaces of the same size and password on different nodes
+type ZDBCluster struct {
+	Spec    ZDBClusterSpec
+	Members []ZDBClusterMember
+}
+
+// ZDBEndpoint is the address of a zdb cluster member
+type ZDBEndpoint struct {
+	Member    string `json:"member"`
+	NodeID    uint32 `json:"node_id"`
+	Namespace string `json:"namespace"`
+	Port      uint32 `json:"port"`
+	IPv6      string `json:"ipv6,omitempty"`
+	Yggdrasil string `json:"yggdrasil,omitempty"`
+	Mycelium  string `json:"mycelium,omitempty"`
+}
+
+// ZDBMemberHealth is the result of probing a zdb cluster member
+type ZDBMemberHealth struct {
+	Member  string `json:"member"`
+	NodeID  uint32 `json:"node_id"`
+	Healthy bool   `json:"healthy"`
+	Error   string `json:"error,omitempty"`
+}
+
+// DeployZDBCluster deploys the members of a zdb cluster each on a different node
+func (t *TFPluginClient) DeployZDBCluster(ctx context.Context, spec ZDBClusterSpec) (ZDBCluster, error) {
+	if err := spec.setDefaults(); err != nil {
+		return ZDBCluster{}, err
+	}
+
+	filter, hdd := spec.nodeFilter(nil)
+	nodes, err := FilterDistinctNodes(ctx, *t, filter, spec.Members, spec.DistinctFarms, nil, hdd, nil)
+	if err != nil {
+		return ZDBCluster{}, errors.Wrapf(err, "could not find nodes for zdb cluster %s", spec.Name)
+	}
+
+	cluster := ZDBCluster{Spec: spec}
+	dls := make([]*workloads.Deployment, 0, len(nodes))
+	for i, node := range nodes {
+		dl := spec.memberDeployment(i, uint32(node.NodeID))
+		dls = append(dls, dl)
+		cluster.Members = append(cluster.Members, ZDBClusterMember{Deployment: dl})
+	}
+
+	if err := t.DeploymentDeployer.BatchDeploy(ctx, dls); err != nil {
+		return ZDBCluster{}, multierror.Append(errors.Wrapf(err, "failed to deploy zdb cluster %s", spec.Name), t.cancelDeployments(ctx, dls))
+	}
+
+	for i := range cluster.Members {
+		if err := t.loadZDBClusterMember(ctx, &cluster.Members[i]); err != nil {
+			return ZDBCluster{}, multierror.Append(err, t.cancelDeployments(ctx, dls))
+		}
+	}
+
+	return cluster, nil
+}
+
+// CancelZDBCluster cancels the deployments of all the cluster members
+func (t *TFPluginClient) CancelZDBCluster(ctx context.Context, cluster *ZDBCluster) error {
+	for len(cluster.Members) > 0 {
+		last := len(cluster.Members) - 1
+		if err := t.DeploymentDeployer.Cancel(ctx, cluster.Members[last].Deployment); err != nil {
+			return errors.Wrapf(err, "failed to cancel zdb cluster %s member %s", cluster.Spec.Name, cluster.Members[last].ZDB.Name)
+		}
+		cluster.Members = cluster.Members[:last]
+	}
+	return nil
+}
+
+// RotateZDBClusterPassword updates the password of all the cluster members, a random password is generated if empty.
+// members already updated keep the new password if updating another member fails
+func (t *TFPluginClient) RotateZDBClusterPassword(ctx context.Context, cluster *ZDBCluster, password string) error {
+	if password == "" {
+		var err error
+		if password, err = randomHex(16); err != nil {
+			return errors.Wrap(err, "failed to generate zdb password")
+		}
+	}
+
+	for i := range cluster.Members {
+		member := &cluster.Members[i]
+		member.Deployment.Zdbs[0].Password = password
+		if err := t.DeploymentDeployer.Deploy(ctx, member.Deployment); err != nil {
+			return errors.Wrapf(err, "failed to update password of zdb cluster %s member %s", cluster.Spec.Name, member.Deployment.Name)
+		}
+		member.ZDB.Password = password
+	}
+
+	cluster.Spec.Password = password
+	return nil
+}
+
+// ProbeZDBCluster checks each member node is reachable and reports its namespace as deployed
+func (t *TFPluginClient) ProbeZDBCluster(ctx context.Context, cluster ZDBCluster) []ZDBMemberHealth {
+	health := make([]ZDBMemberHealth, 0, len(cluster.Members))
+	for _, member := range cluster.Members {
+		result := ZDBMemberHealth{Member: member.Deployment.Name, NodeID: member.Deployment.NodeID}
+		if err := t.probeZDBClusterMember(ctx, member); err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Healthy = true
+		}
+		health = append(health, result)
+	}
+	return health
+}
+
+// ReplaceFailedZDBClusterMembers redeploys the unhealthy members on new nodes not used by the cluster
+// and cancels their old deployments. it returns the names of the replaced members.
+// data of the replaced namespaces is not recovered
+func (t *TFPluginClient) ReplaceFailedZDBClusterMembers(ctx context.Context, cluster *ZDBCluster) ([]string, error) {
+	replaced := []string{}
+	for i, health := range t.ProbeZDBCluster(ctx, *cluster) {
+		if health.Healthy {
+			continue
+		}
+		log.Info().Str("cluster", cluster.Spec.Name).Str("member", health.Member).Str("reason", health.Error).Msg("replacing zdb cluster member")
+
+		if err := t.replaceZDBClusterMember(ctx, cluster, i); err != nil {
+			return replaced, errors.Wrapf(err, "failed to replace zdb cluster %s member %s", cluster.Spec.Name, health.Member)
+		}
+		replaced = append(replaced, health.Member)
+	}
+	return replaced, nil
+}
+
+// Endpoints returns the addresses of all the cluster members
+func (c *ZDBCluster) Endpoints() []ZDBEndpoint {
+	endpoints := make([]ZDBEndpoint, 0, len(c.Members))
+	for _, member := range c.Members {
+		endpoint := ZDBEndpoint{
+			Member:    member.Deployment.Name,
+			NodeID:    member.Deployment.NodeID,
+			Namespace: member.ZDB.Namespace,
+			Port:      member.ZDB.Port,
+		}
+		endpoint.IPv6, endpoint.Yggdrasil, endpoint.Mycelium = classifyZDBIPs(member.ZDB.IPs)
+		endpoints = append(endpoints, endpoint)
+	}
+	return endpoints
+}
+
+func (t *TFPluginClient) replaceZDBClusterMember(ctx context.Context, cluster *ZDBCluster, index int) error {
+	old := cluster.Members[index]
+
+	excluded := make([]uint64, 0, len(cluster.Members))
+	farms := []uint64{}
+	for _, member := range cluster.Members {
+		excluded = append(excluded, uint64(member.Deployment.NodeID))
+	}
+
+	filter, hdd := cluster.Spec.nodeFilter(excluded)
+	nodes, err := FilterNodes(ctx, *t, filter, nil, hdd, nil)
+	if err != nil {
+		return err
+	}
+
+	if cluster.Spec.DistinctFarms {
+		for i, member := range cluster.Members {
+			if i == index {
+				continue
+			}
+			node, err := t.GridProxyClient.Node(ctx, member.Deployment.NodeID)
+			if err != nil {
+				return errors.Wrapf(err, "could not get node %d", member.Deployment.NodeID)
+			}
+			farms = append(farms, uint64(node.FarmID))
+		}
+	}
+
+	var nodeID uint32
+	for _, node := range nodes {
+		if !slices.Contains(farms, uint64(node.FarmID)) {
+			nodeID = uint32(node.NodeID)
+			break
+		}
+	}
+	if nodeID == 0 {
+		return errors.Wrap(ErrNoNodesMatchesResources, "no node available in a farm not used by the cluster")
+	}
+
+	member := ZDBClusterMember{Deployment: cluster.Spec.memberDeployment(index, nodeID)}
+	if err := t.DeploymentDeployer.Deploy(ctx, member.Deployment); err != nil {
+		return multierror.Append(err, t.cancelDeployments(ctx, []*workloads.Deployment{member.Deployment}))
+	}
+	if err := t.loadZDBClusterMember(ctx, &member); err != nil {
+		return multierror.Append(err, t.cancelDeployments(ctx, []*workloads.Deployment{member.Deployment}))
+	}
+	cluster.Members[index] = member
+
+	// the old node may be down, canceling the contract releases it on the chain anyway
+	if err := t.DeploymentDeployer.Cancel(ctx, old.Deployment); err != nil {
+		log.Error().Err(err).Uint64("contract", old.Deployment.ContractID).Msg("failed to cancel replaced zdb cluster member")
+	}
+
+	return nil
+}
+
+func (t *TFPluginClient) probeZDBClusterMember(ctx context.Context, member ZDBClusterMember) error {
+	nodeClient, err := t.NcPool.GetNodeClient(t.SubstrateConn, member.Deployment.NodeID)
+	if err != nil {
+		return errors.Wrapf(err, "could not get node client for node %d", member.Deployment.NodeID)
+	}
+
+	dl, err := nodeClient.DeploymentGet(ctx, member.Deployment.ContractID)
+	if err != nil {
+		return errors.Wrapf(err, "could not get deployment %d", member.Deployment.ContractID)
+	}
+
+	for _, wl := range dl.Workloads {
+		if wl.Name != member.Deployment.Zdbs[0].Name {
+			continue
+		}
+		if !wl.Result.State.IsOkay() {
+			return errors.Errorf("zdb is in state %s: %s", wl.Result.State, wl.Result.Error)
+		}
+		return nil
+	}
+
+	return errors.Errorf("zdb %s not found in deployment %d", member.Deployment.Zdbs[0].Name, member.Deployment.ContractID)
+}
+
+func (t *TFPluginClient) loadZDBClusterMember(ctx context.Context, member *ZDBClusterMember) error {
+	dl := member.Deployment
+	zdb, err := t.State.LoadZdbFromGrid(ctx, dl.NodeID, dl.Zdbs[0].Name, dl.Name)
+	if err != nil {
+		return errors.Wrapf(err, "could not load zdb %s", dl.Zdbs[0].Name)
+	}
+	zdb.Password = dl.Zdbs[0].Password
+	member.ZDB = zdb
+	return nil
+}
+
+func (s *ZDBClusterSpec) setDefaults() error {
+	if s.Members <= 0 || s.SizeGB == 0 {
+		return errors.New("zdb cluster members and size are required")
+	}
+	if s.Mode == "" {
+		s.Mode = workloads.ZDBModeUser
+	}
+	if s.Password == "" {
+		password, err := randomHex(16)
+		if err != nil {
+			return errors.Wrap(err, "failed to generate zdb password")
+		}
+		s.Password = password
+	}
+	return nil
+}
+
+// nodeFilter returns the filter and hdd disks of a node hosting a member
+func (s *ZDBClusterSpec) nodeFilter(excluded []uint64) (types.NodeFilter, []uint64) {
+	filter := s.NodeFilter
+	hru := s.SizeGB * uint64(gridtypes.Gigabyte)
+	filter.FreeHRU = &hru
+	filter.Excluded = append(filter.Excluded, excluded...)
+	if len(filter.Status) == 0 {
+		filter.Status = []string{"up"}
+	}
+	return filter, []uint64{hru}
+}
+
+func (s *ZDBClusterSpec) memberDeployment(index int, nodeID uint32) *workloads.Deployment {
+	name := fmt.Sprintf("%s_%d", s.Name, index)
+	zdb := workloads.ZDB{
+		Name:        name,
+		Password:    s.Password,
+		Public:      s.Public,
+		SizeGB:      s.SizeGB,
+		Description: fmt.Sprintf("member of zdb cluster %s", s.Name),
+		Mode:        s.Mode,
+	}
+	dl := workloads.NewDeployment(name, nodeID, s.SolutionType, nil, "", nil, []workloads.ZDB{zdb}, nil, nil, nil, nil)
+	return &dl
+}
+
+// classifyZDBIPs splits the ips of a zdb into its public ipv6, yggdrasil and mycelium addresses
+func classifyZDBIPs(ips []string) (ipv6, yggdrasil, mycelium string) {
+	for _, ip := range ips {
+		parsed := net.ParseIP(ip)
+		if parsed == nil || parsed.To4() != nil {
+			continue
+		}
+
+		switch {
+		case yggdrasilRange.Contains(parsed):
+			if yggdrasil == "" {
+				yggdrasil = ip
+			}
+		case myceliumRange.Contains(parsed):
+			if mycelium == "" {
+				mycelium = ip
+			}
+		case parsed.IsGlobalUnicast() && ipv6 == "":
+			ipv6 = ip
+		}
+	}
+	return ipv6, yggdrasil, mycelium
+}
+
+func mustParseCIDR(cidr string) *net.IPNet {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return ipNet
+}
@@ -0,0 +1,105 @@
+package deployer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/simulation"
+	zosTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-client/zos"
+)
+
+func TestZDBCluster(t *testing.T) {
+	grid := newSimulatedGrid(t, 5)
+
+	tfPluginClient, err := NewTFPluginClient(simulationMnemonic, WithSimulation(grid))
+	require.NoError(t, err)
+	defer tfPluginClient.Close()
+
+	ctx := context.Background()
+	cluster, err := tfPluginClient.DeployZDBCluster(ctx, ZDBClusterSpec{Name: "storage", Members: 3, SizeGB: 10})
+	require.NoError(t, err)
+	require.Len(t, cluster.Members, 3)
+
+	nodes := func() map[uint32]bool {
+		nodes := map[uint32]bool{}
+		for _, member := range cluster.Members {
+			nodes[member.Deployment.NodeID] = true
+		}
+		return nodes
+	}
+
+	t.Run("endpoints", func(t *testing.T) {
+		assert.Len(t, nodes(), 3)
+
+		endpoints := cluster.Endpoints()
+		require.Len(t, endpoints, 3)
+		for _, endpoint := range endpoints {
+			assert.Empty(t, endpoint.IPv6)
+			assert.NotEmpty(t, endpoint.Yggdrasil)
+			assert.NotEmpty(t, endpoint.Mycelium)
+			assert.NotEmpty(t, endpoint.Namespace)
+			assert.Equal(t, uint32(9900), endpoint.Port)
+		}
+	})
+
+	t.Run("rotate password", func(t *testing.T) {
+		old := cluster.Spec.Password
+		require.NoError(t, tfPluginClient.RotateZDBClusterPassword(ctx, &cluster, ""))
+		assert.NotEqual(t, old, cluster.Spec.Password)
+
+		for _, member := range cluster.Members {
+			zdb, err := tfPluginClient.State.LoadZdbFromGrid(ctx, member.Deployment.NodeID, member.Deployment.Zdbs[0].Name, member.Deployment.Name)
+			require.NoError(t, err)
+			assert.Equal(t, cluster.Spec.Password, zdb.Password)
+		}
+	})
+
+	t.Run("replace failed member", func(t *testing.T) {
+		for _, health := range tfPluginClient.ProbeZDBCluster(ctx, cluster) {
+			assert.True(t, health.Healthy, health.Error)
+		}
+
+		down := cluster.Members[0].Deployment.NodeID
+		require.NoError(t, grid.SetNodeDown(down, true))
+
+		health := tfPluginClient.ProbeZDBCluster(ctx, cluster)
+		assert.False(t, health[0].Healthy)
+
+		replaced, err := tfPluginClient.ReplaceFailedZDBClusterMembers(ctx, &cluster)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"storage_0"}, replaced)
+		assert.False(t, nodes()[down])
+		assert.Len(t, nodes(), 3)
+		assert.Len(t, grid.Contracts(tfPluginClient.TwinID), 3)
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		require.NoError(t, tfPluginClient.CancelZDBCluster(ctx, &cluster))
+		assert.Empty(t, grid.Contracts(tfPluginClient.TwinID))
+	})
+}
+
+func TestZDBClusterDistinctFarms(t *testing.T) {
+	grid := newSimulatedGrid(t, 3)
+	require.NoError(t, grid.AddFarm(simulation.Farm{ID: 2, Name: "second-farm"}))
+	require.NoError(t, grid.AddNode(simulation.Node{
+		ID:     4,
+		FarmID: 2,
+		Total:  zosTypes.Capacity{CRU: 8, MRU: 32 * zosTypes.Gigabyte, HRU: 2048 * zosTypes.Gigabyte},
+	}))
+
+	tfPluginClient, err := NewTFPluginClient(simulationMnemonic, WithSimulation(grid))
+	require.NoError(t, err)
+	defer tfPluginClient.Close()
+
+	ctx := context.Background()
+	_, err = tfPluginClient.DeployZDBCluster(ctx, ZDBClusterSpec{Name: "storage", Members: 3, SizeGB: 10, DistinctFarms: true})
+	assert.ErrorIs(t, err, ErrNoNodesMatchesResources)
+
+	cluster, err := tfPluginClient.DeployZDBCluster(ctx, ZDBClusterSpec{Name: "storage", Members: 2, SizeGB: 10, DistinctFarms: true, Public: true})
+	require.NoError(t, err)
+	assert.NotEqual(t, cluster.Members[0].Deployment.NodeID, cluster.Members[1].Deployment.NodeID)
+	assert.NotEmpty(t, cluster.Endpoints()[0].IPv6)
+}
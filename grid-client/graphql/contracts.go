@@ -3,7 +3,6 @@ package graphql
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"strconv"
 	"strings"
@@ -57,58 +56,40 @@ func NewContractsGetter(twinID uint32, graphql GraphQl, substrateConn subi.Subst
 
 // ListContractsByTwinID returns contracts for a twinID
 func (c *ContractsGetter) ListContractsByTwinID(states []string) (Contracts, error) {
-	state := fmt.Sprintf(`[%v]`, strings.Join(states, ", "))
-	options := fmt.Sprintf(`(where: {twinID_eq: %v, state_in: %v}, orderBy: twinID_ASC)`, c.twinID, state)
-
-	nameContractsCount, err := c.graphql.GetItemTotalCount("nameContracts", options)
-	if err != nil {
-		return Contracts{}, err
-	}
-
-	nodeContractsCount, err := c.graphql.GetItemTotalCount("nodeContracts", options)
-	if err != nil {
-		return Contracts{}, err
-	}
-
-	rentContractsCount, err := c.graphql.GetItemTotalCount("rentContracts", options)
-	if err != nil {
-		return Contracts{}, err
-	}
-
-	contractsData, err := c.graphql.Query(fmt.Sprintf(`query getContracts($nameContractsCount: Int!, $nodeContractsCount: Int!, $rentContractsCount: Int!){
-            nameContracts(where: {twinID_eq: %v, state_in: %v}, limit: $nameContractsCount) {
-              contractID
-              state
-              name
-            }
-            nodeContracts(where: {twinID_eq: %v, state_in: %v}, limit: $nodeContractsCount) {
-              contractID
-              deploymentData
-              state
-              nodeID
-            }
-            rentContracts(where: {twinID_eq: %v, state_in: %v}, limit: $rentContractsCount) {
-              contractID
-              state
-              nodeID
-            }
-          }`, c.twinID, state, c.twinID, state, c.twinID, state),
-		map[string]interface{}{
-			"nodeContractsCount": nodeContractsCount,
-			"nameContractsCount": nameContractsCount,
-			"rentContractsCount": rentContractsCount,
-		})
-	if err != nil {
-		return Contracts{}, err
+	// states may be given as a comma separated list
+	var contractStates []string
+	for _, state := range states {
+		for _, s := range strings.Split(state, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				contractStates = append(contractStates, s)
+			}
+		}
 	}
 
-	contractsJSONData, err := json.Marshal(contractsData)
-	if err != nil {
-		return Contracts{}, err
-	}
+	listContracts := Contracts{
+		NameContracts: make([]Contract, 0),
+		NodeContracts: make([]Contract, 0),
+		RentContracts: make([]Contract, 0),
+	}
+	err := c.QueryContracts(context.Background(), ContractsQuery{States: contractStates}, func(info ContractInfo) error {
+		contract := Contract{
+			ContractID:     strconv.FormatUint(info.ContractID, 10),
+			State:          info.State,
+			DeploymentData: info.DeploymentData,
+			NodeID:         info.NodeID,
+			Name:           info.Name,
+		}
 
-	var listContracts Contracts
-	err = json.Unmarshal(contractsJSONData, &listContracts)
+		switch info.Kind {
+		case NodeContractKind:
+			listContracts.NodeContracts = append(listContracts.NodeContracts, contract)
+		case NameContractKind:
+			listContracts.NameContracts = append(listContracts.NameContracts, contract)
+		case RentContractKind:
+			listContracts.RentContracts = append(listContracts.RentContracts, contract)
+		}
+		return nil
+	})
 	if err != nil {
 		return Contracts{}, err
 	}
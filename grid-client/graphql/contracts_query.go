@@ -0,0 +1,355 @@
+package graphql
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+)
+
+// DefaultContractsPageSize is the number of contracts fetched per graphql request
+const DefaultContractsPageSize = 500
+
+// ContractKind is the kind of a contract
+type ContractKind string
+
+const (
+	// NodeContractKind is a deployment contract on a node
+	NodeContractKind ContractKind = "nodeContracts"
+	// NameContractKind is a gateway name contract
+	NameContractKind ContractKind = "nameContracts"
+	// RentContractKind is a dedicated node rent contract
+	RentContractKind ContractKind = "rentContracts"
+)
+
+// ContractKinds are all the contract kinds in listing order
+var ContractKinds = []ContractKind{NodeContractKind, NameContractKind, RentContractKind}
+
+// ContractsQuery filters the contracts of the twin
+type ContractsQuery struct {
+	// Kinds are the kinds of contracts to list, all kinds if empty
+	Kinds []ContractKind
+	// States are the contracts states (Created, GracePeriod, Deleted...), all states if empty
+	States []string
+	// NodeID lists only the node and rent contracts on the node
+	NodeID *uint32
+	// ProjectName and DeploymentType match the deployment data of node contracts, other kinds are skipped if set
+	ProjectName    string
+	DeploymentType string
+	// CreatedAfter and CreatedBefore limit the contracts creation time, unset bounds are ignored
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	// PageSize is the number of contracts per request, DefaultContractsPageSize if not set
+	PageSize int
+	// Offset skips the first contracts of each kind, pages after a cursor are not offset
+	Offset int
+	// Billing loads the billing reports summary of each contract
+	Billing bool
+}
+
+// ContractBilling is the summary of the billing reports of a contract
+type ContractBilling struct {
+	// AmountBilled is the total billed amount in units of 1e-7 TFT
+	AmountBilled uint64
+	Reports      int
+	LastBilledAt time.Time
+}
+
+// ContractInfo is a contract with its chain details
+type ContractInfo struct {
+	Kind               ContractKind
+	ContractID         uint64
+	TwinID             uint32
+	State              string
+	CreatedAt          time.Time
+	SolutionProviderID *uint64
+
+	// for node and rent contracts
+	NodeID uint32
+	// for node contracts
+	DeploymentData    string
+	DeploymentHash    string
+	NumberOfPublicIPs uint32
+	// Deployment is the parsed deployment data, empty if the data is invalid
+	Deployment workloads.DeploymentData
+	// for name contracts
+	Name string
+
+	// Billing is only loaded if requested
+	Billing *ContractBilling
+}
+
+// ContractsPage is a page of contracts of one kind
+type ContractsPage struct {
+	Contracts []ContractInfo
+	// Cursor is the last contract id of the page, pass it to get the next page
+	Cursor uint64
+	// More is true if the page is full and more contracts may follow
+	More bool
+}
+
+// graphQLContract is a contract as returned by graphql, big ints are strings
+type graphQLContract struct {
+	ContractID         string  `json:"contractID"`
+	TwinID             uint32  `json:"twinID"`
+	State              string  `json:"state"`
+	CreatedAt          string  `json:"createdAt"`
+	SolutionProviderID *uint64 `json:"solutionProviderID"`
+	NodeID             uint32  `json:"nodeID"`
+	DeploymentData     string  `json:"deploymentData"`
+	DeploymentHash     string  `json:"deploymentHash"`
+	NumberOfPublicIPs  uint32  `json:"numberOfPublicIPs"`
+	Name               string  `json:"name"`
+}
+
+type graphQLBillReport struct {
+	ContractID   string `json:"contractID"`
+	AmountBilled string `json:"amountBilled"`
+	Timestamp    string `json:"timestamp"`
+}
+
+var contractsFields = map[ContractKind]string{
+	NodeContractKind: "contractID twinID state createdAt solutionProviderID nodeID deploymentData deploymentHash numberOfPublicIPs",
+	NameContractKind: "contractID twinID state createdAt solutionProviderID name",
+	RentContractKind: "contractID twinID state createdAt solutionProviderID nodeID",
+}
+
+var contractsWhereInput = map[ContractKind]string{
+	NodeContractKind: "NodeContractWhereInput",
+	NameContractKind: "NameContractWhereInput",
+	RentContractKind: "RentContractWhereInput",
+}
+
+// QueryContracts calls fn for each contract of the twin matching the query, page by page.
+// it stops at the first error returned by fn
+func (c *ContractsGetter) QueryContracts(ctx context.Context, query ContractsQuery, fn func(ContractInfo) error) error {
+	kinds := query.Kinds
+	if len(kinds) == 0 {
+		kinds = ContractKinds
+	}
+
+	for _, kind := range kinds {
+		if kind != NodeContractKind && (query.ProjectName != "" || query.DeploymentType != "") {
+			continue
+		}
+		if kind == NameContractKind && query.NodeID != nil {
+			continue
+		}
+
+		var cursor uint64
+		for {
+			page, err := c.ContractsPage(ctx, kind, query, cursor)
+			if err != nil {
+				return err
+			}
+
+			for _, contract := range page.Contracts {
+				if err := fn(contract); err != nil {
+					return err
+				}
+			}
+
+			if !page.More {
+				break
+			}
+			cursor = page.Cursor
+		}
+	}
+
+	return nil
+}
+
+// ListContracts returns all the contracts of the twin matching the query
+func (c *ContractsGetter) ListContracts(ctx context.Context, query ContractsQuery) ([]ContractInfo, error) {
+	var contracts []ContractInfo
+	err := c.QueryContracts(ctx, query, func(contract ContractInfo) error {
+		contracts = append(contracts, contract)
+		return nil
+	})
+	return contracts, err
+}
+
+// ContractsPage returns the contracts of a kind after the cursor contract id ordered by contract id
+func (c *ContractsGetter) ContractsPage(ctx context.Context, kind ContractKind, query ContractsQuery, cursor uint64) (ContractsPage, error) {
+	fields, ok := contractsFields[kind]
+	if !ok {
+		return ContractsPage{}, errors.Errorf("invalid contract kind '%s'", kind)
+	}
+
+	pageSize := query.PageSize
+	if pageSize <= 0 {
+		pageSize = DefaultContractsPageSize
+	}
+
+	body := fmt.Sprintf(`query contracts($where: %s, $limit: Int, $offset: Int) {
+  %s(where: $where, orderBy: contractID_ASC, limit: $limit, offset: $offset) { %s }
+}`, contractsWhereInput[kind], kind, fields)
+
+	offset := 0
+	if cursor == 0 {
+		offset = query.Offset
+	}
+
+	var data map[ContractKind][]graphQLContract
+	variables := map[string]interface{}{"where": c.contractsWhere(kind, query, cursor), "limit": pageSize, "offset": offset}
+	if err := c.graphql.QueryContext(ctx, body, variables, &data); err != nil {
+		return ContractsPage{}, errors.Wrapf(err, "failed to query %s", kind)
+	}
+
+	page := ContractsPage{Cursor: cursor, More: len(data[kind]) == pageSize}
+	for _, contract := range data[kind] {
+		info, err := contract.info(kind)
+		if err != nil {
+			return ContractsPage{}, err
+		}
+		page.Cursor = info.ContractID
+
+		if query.ProjectName != "" && info.Deployment.ProjectName != query.ProjectName {
+			continue
+		}
+		if query.DeploymentType != "" && info.Deployment.Type != query.DeploymentType {
+			continue
+		}
+		page.Contracts = append(page.Contracts, info)
+	}
+
+	if query.Billing && len(page.Contracts) != 0 {
+		if err := c.loadBilling(ctx, page.Contracts, pageSize); err != nil {
+			return ContractsPage{}, err
+		}
+	}
+
+	return page, nil
+}
+
+// contractsWhere builds the graphql filter of a contracts query
+func (c *ContractsGetter) contractsWhere(kind ContractKind, query ContractsQuery, cursor uint64) map[string]interface{} {
+	where := map[string]interface{}{
+		"twinID_eq":     c.twinID,
+		"contractID_gt": strconv.FormatUint(cursor, 10),
+	}
+	if len(query.States) != 0 {
+		where["state_in"] = query.States
+	}
+	if query.NodeID != nil && kind != NameContractKind {
+		where["nodeID_eq"] = *query.NodeID
+	}
+	if !query.CreatedAfter.IsZero() {
+		where["createdAt_gte"] = strconv.FormatInt(query.CreatedAfter.Unix(), 10)
+	}
+	if !query.CreatedBefore.IsZero() {
+		where["createdAt_lte"] = strconv.FormatInt(query.CreatedBefore.Unix(), 10)
+	}
+	return where
+}
+
+// loadBilling sets the billing summary of the contracts from their bill reports
+func (c *ContractsGetter) loadBilling(ctx context.Context, contracts []ContractInfo, pageSize int) error {
+	ids := make([]string, 0, len(contracts))
+	billing := make(map[uint64]*ContractBilling, len(contracts))
+	for i := range contracts {
+		contracts[i].Billing = &ContractBilling{}
+		billing[contracts[i].ContractID] = contracts[i].Billing
+		ids = append(ids, strconv.FormatUint(contracts[i].ContractID, 10))
+	}
+
+	body := `query bills($where: ContractBillReportWhereInput, $limit: Int, $offset: Int) {
+  contractBillReports(where: $where, orderBy: id_ASC, limit: $limit, offset: $offset) { contractID amountBilled timestamp }
+}`
+
+	for offset := 0; ; offset += pageSize {
+		var data struct {
+			Reports []graphQLBillReport `json:"contractBillReports"`
+		}
+		variables := map[string]interface{}{
+			"where":  map[string]interface{}{"contractID_in": ids},
+			"limit":  pageSize,
+			"offset": offset,
+		}
+		if err := c.graphql.QueryContext(ctx, body, variables, &data); err != nil {
+			return errors.Wrap(err, "failed to query contracts bill reports")
+		}
+
+		for _, report := range data.Reports {
+			if err := report.addTo(billing); err != nil {
+				return err
+			}
+		}
+
+		if len(data.Reports) < pageSize {
+			return nil
+		}
+	}
+}
+
+func (r graphQLBillReport) addTo(billing map[uint64]*ContractBilling) error {
+	contractID, err := strconv.ParseUint(r.ContractID, 10, 64)
+	if err != nil {
+		return errors.Wrapf(err, "could not parse bill report contract id %s", r.ContractID)
+	}
+	summary, ok := billing[contractID]
+	if !ok {
+		return nil
+	}
+
+	amount, err := strconv.ParseUint(r.AmountBilled, 10, 64)
+	if err != nil {
+		return errors.Wrapf(err, "could not parse billed amount of contract %d", contractID)
+	}
+	timestamp, err := parseGraphQLTime(r.Timestamp)
+	if err != nil {
+		return errors.Wrapf(err, "could not parse bill report time of contract %d", contractID)
+	}
+
+	summary.AmountBilled += amount
+	summary.Reports++
+	if timestamp.After(summary.LastBilledAt) {
+		summary.LastBilledAt = timestamp
+	}
+	return nil
+}
+
+func (c graphQLContract) info(kind ContractKind) (ContractInfo, error) {
+	contractID, err := strconv.ParseUint(c.ContractID, 10, 64)
+	if err != nil {
+		return ContractInfo{}, errors.Wrapf(err, "could not parse contract id %s", c.ContractID)
+	}
+
+	info := ContractInfo{
+		Kind:               kind,
+		ContractID:         contractID,
+		TwinID:             c.TwinID,
+		State:              c.State,
+		SolutionProviderID: c.SolutionProviderID,
+		NodeID:             c.NodeID,
+		DeploymentData:     c.DeploymentData,
+		DeploymentHash:     c.DeploymentHash,
+		NumberOfPublicIPs:  c.NumberOfPublicIPs,
+		Name:               c.Name,
+	}
+
+	if c.CreatedAt != "" {
+		info.CreatedAt, err = parseGraphQLTime(c.CreatedAt)
+		if err != nil {
+			return ContractInfo{}, errors.Wrapf(err, "could not parse contract %d creation time", contractID)
+		}
+	}
+	if c.DeploymentData != "" {
+		// contracts not deployed by the sdk may have any deployment data
+		info.Deployment, _ = workloads.ParseDeploymentData(c.DeploymentData)
+	}
+
+	return info, nil
+}
+
+// parseGraphQLTime parses a graphql big int timestamp in seconds
+func parseGraphQLTime(timestamp string) (time.Time, error) {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(seconds, 0), nil
+}
@@ -0,0 +1,175 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/simulation"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+)
+
+func TestQueryContracts(t *testing.T) {
+	grid := simulation.NewGrid()
+	identity, err := substrate.NewIdentityFromSr25519Phrase("//Alice")
+	require.NoError(t, err)
+	twinID := grid.RegisterTwin(identity.PublicKey())
+
+	sub := grid.Substrate()
+	provider := uint64(3)
+	for i := 0; i < 5; i++ {
+		project := "web"
+		if i%2 == 1 {
+			project = "db"
+		}
+		data, err := json.Marshal(workloads.DeploymentData{Type: workloads.VMType, Name: fmt.Sprintf("vm%d", i), ProjectName: project})
+		require.NoError(t, err)
+		_, err = sub.CreateNodeContract(identity, uint32(i%2+1), string(data), fmt.Sprintf("hash%d", i), 0, &provider)
+		require.NoError(t, err)
+	}
+	_, err = sub.CreateNameContract(identity, "example")
+	require.NoError(t, err)
+	_, err = grid.RentNode(twinID, 3)
+	require.NoError(t, err)
+
+	server := httptest.NewServer(grid.GraphQL())
+	defer server.Close()
+
+	gql, err := NewGraphQl(server.URL)
+	require.NoError(t, err)
+	getter := NewContractsGetter(twinID, gql, nil, nil)
+	ctx := context.Background()
+
+	t.Run("all kinds paginated", func(t *testing.T) {
+		var ids []uint64
+		err := getter.QueryContracts(ctx, ContractsQuery{PageSize: 2}, func(contract ContractInfo) error {
+			ids = append(ids, contract.ContractID)
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []uint64{1, 2, 3, 4, 5, 6, 7}, ids)
+	})
+
+	t.Run("page cursor", func(t *testing.T) {
+		page, err := getter.ContractsPage(ctx, NodeContractKind, ContractsQuery{PageSize: 3}, 0)
+		require.NoError(t, err)
+		require.Len(t, page.Contracts, 3)
+		assert.True(t, page.More)
+		assert.Equal(t, uint64(3), page.Cursor)
+
+		page, err = getter.ContractsPage(ctx, NodeContractKind, ContractsQuery{PageSize: 3}, page.Cursor)
+		require.NoError(t, err)
+		require.Len(t, page.Contracts, 2)
+		assert.False(t, page.More)
+
+		page, err = getter.ContractsPage(ctx, NodeContractKind, ContractsQuery{PageSize: 3, Offset: 4}, 0)
+		require.NoError(t, err)
+		require.Len(t, page.Contracts, 1)
+		assert.Equal(t, uint64(5), page.Cursor)
+	})
+
+	t.Run("typed fields", func(t *testing.T) {
+		contracts, err := getter.ListContracts(ctx, ContractsQuery{Kinds: []ContractKind{NodeContractKind}, PageSize: 1})
+		require.NoError(t, err)
+		require.Len(t, contracts, 5)
+
+		contract := contracts[0]
+		assert.Equal(t, NodeContractKind, contract.Kind)
+		assert.Equal(t, twinID, contract.TwinID)
+		assert.Equal(t, "Created", contract.State)
+		assert.Equal(t, uint32(1), contract.NodeID)
+		assert.Equal(t, "hash0", contract.DeploymentHash)
+		assert.Equal(t, "web", contract.Deployment.ProjectName)
+		assert.Equal(t, "vm0", contract.Deployment.Name)
+		require.NotNil(t, contract.SolutionProviderID)
+		assert.Equal(t, provider, *contract.SolutionProviderID)
+		assert.WithinDuration(t, time.Now(), contract.CreatedAt, time.Minute)
+		assert.Nil(t, contract.Billing)
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		contracts, err := getter.ListContracts(ctx, ContractsQuery{ProjectName: "db", PageSize: 2})
+		require.NoError(t, err)
+		require.Len(t, contracts, 2)
+		for _, contract := range contracts {
+			assert.Equal(t, "db", contract.Deployment.ProjectName)
+		}
+
+		node := uint32(1)
+		contracts, err = getter.ListContracts(ctx, ContractsQuery{NodeID: &node})
+		require.NoError(t, err)
+		assert.Len(t, contracts, 3)
+
+		node = 3
+		contracts, err = getter.ListContracts(ctx, ContractsQuery{NodeID: &node})
+		require.NoError(t, err)
+		require.Len(t, contracts, 1)
+		assert.Equal(t, RentContractKind, contracts[0].Kind)
+
+		contracts, err = getter.ListContracts(ctx, ContractsQuery{States: []string{"Deleted"}})
+		require.NoError(t, err)
+		assert.Empty(t, contracts)
+
+		contracts, err = getter.ListContracts(ctx, ContractsQuery{CreatedAfter: time.Now().Add(time.Hour)})
+		require.NoError(t, err)
+		assert.Empty(t, contracts)
+
+		contracts, err = getter.ListContracts(ctx, ContractsQuery{CreatedBefore: time.Now().Add(time.Hour), Kinds: []ContractKind{NameContractKind}})
+		require.NoError(t, err)
+		require.Len(t, contracts, 1)
+		assert.Equal(t, "example", contracts[0].Name)
+	})
+
+	t.Run("billing", func(t *testing.T) {
+		contracts, err := getter.ListContracts(ctx, ContractsQuery{Kinds: []ContractKind{RentContractKind}, Billing: true})
+		require.NoError(t, err)
+		require.Len(t, contracts, 1)
+		require.NotNil(t, contracts[0].Billing)
+		assert.Zero(t, contracts[0].Billing.Reports)
+	})
+
+	t.Run("stop streaming", func(t *testing.T) {
+		stop := fmt.Errorf("stop")
+		count := 0
+		err := getter.QueryContracts(ctx, ContractsQuery{PageSize: 2}, func(ContractInfo) error {
+			count++
+			return stop
+		})
+		assert.ErrorIs(t, err, stop)
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("list by twin id", func(t *testing.T) {
+		contracts, err := getter.ListContractsByTwinID([]string{"Created, GracePeriod"})
+		require.NoError(t, err)
+		assert.Len(t, contracts.NodeContracts, 5)
+		assert.Len(t, contracts.NameContracts, 1)
+		assert.Len(t, contracts.RentContracts, 1)
+	})
+}
+
+func TestBillReports(t *testing.T) {
+	contracts := []ContractInfo{{ContractID: 1, Billing: &ContractBilling{}}}
+	billing := map[uint64]*ContractBilling{1: contracts[0].Billing}
+
+	reports := []graphQLBillReport{
+		{ContractID: "1", AmountBilled: "100", Timestamp: "1700000000"},
+		{ContractID: "1", AmountBilled: "50", Timestamp: "1700003600"},
+		{ContractID: "2", AmountBilled: "10", Timestamp: "1700003600"},
+	}
+	for _, report := range reports {
+		require.NoError(t, report.addTo(billing))
+	}
+
+	assert.Equal(t, uint64(150), contracts[0].Billing.AmountBilled)
+	assert.Equal(t, 2, contracts[0].Billing.Reports)
+	assert.Equal(t, time.Unix(1700003600, 0), contracts[0].Billing.LastBilledAt)
+
+	assert.Error(t, graphQLBillReport{ContractID: "1", AmountBilled: "x", Timestamp: "0"}.addTo(billing))
+}
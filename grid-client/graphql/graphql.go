@@ -3,10 +3,12 @@ package graphql
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/cenkalti/backoff"
@@ -39,9 +41,7 @@ func (g *GraphQl) GetItemTotalCount(itemName string, options string) (float64, e
 		return 0, err
 	}
 
-	bodyReader := bytes.NewReader(jsonBody)
-
-	countResponse, err := g.httpPost(bodyReader)
+	countResponse, err := g.httpPost(context.Background(), jsonBody)
 	if err != nil {
 		return 0, err
 	}
@@ -68,9 +68,7 @@ func (g *GraphQl) Query(body string, variables map[string]interface{}) (map[stri
 		return result, err
 	}
 
-	bodyReader := bytes.NewReader(jsonBody)
-
-	resp, err := g.httpPost(bodyReader)
+	resp, err := g.httpPost(context.Background(), jsonBody)
 	if err != nil {
 		return result, err
 	}
@@ -84,6 +82,43 @@ func (g *GraphQl) Query(body string, variables map[string]interface{}) (map[stri
 	return result, nil
 }
 
+// QueryContext queries graphql and decodes the response data into result
+func (g *GraphQl) QueryContext(ctx context.Context, body string, variables map[string]interface{}, result interface{}) error {
+	jsonBody, err := json.Marshal(map[string]interface{}{"query": body, "variables": variables})
+	if err != nil {
+		return errors.Wrap(err, "failed to encode graphql request")
+	}
+
+	resp, err := g.httpPost(ctx, jsonBody)
+	if err != nil {
+		return errors.Wrap(err, "graphql request failed")
+	}
+	defer resp.Body.Close()
+
+	var response struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return errors.Wrapf(err, "failed to decode graphql response with status code %d", resp.StatusCode)
+	}
+
+	if len(response.Errors) != 0 {
+		messages := make([]string, 0, len(response.Errors))
+		for _, e := range response.Errors {
+			messages = append(messages, e.Message)
+		}
+		return errors.Errorf("graphql query failed: %s", strings.Join(messages, "; "))
+	}
+	if resp.StatusCode >= 400 {
+		return errors.Errorf("request failed with status code: %d", resp.StatusCode)
+	}
+
+	return json.Unmarshal(response.Data, result)
+}
+
 func parseHTTPResponse(resp *http.Response) (map[string]interface{}, error) {
 	resBody, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -105,7 +140,7 @@ func parseHTTPResponse(resp *http.Response) (map[string]interface{}, error) {
 	return data, nil
 }
 
-func (g *GraphQl) httpPost(body io.Reader) (*http.Response, error) {
+func (g *GraphQl) httpPost(ctx context.Context, body []byte) (*http.Response, error) {
 	cl := &http.Client{
 		Timeout: 10 * time.Second,
 	}
@@ -125,7 +160,14 @@ func (g *GraphQl) httpPost(body io.Reader) (*http.Response, error) {
 		endpoint = g.urls[g.activeStackIdx]
 		log.Debug().Str("url", endpoint).Msg("checking")
 
-		resp, reqErr = cl.Post(endpoint, "application/json", body)
+		var req *http.Request
+		req, reqErr = http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+		if reqErr != nil {
+			return backoff.Permanent(reqErr)
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, reqErr = cl.Do(req)
 		if reqErr != nil &&
 			(errors.Is(reqErr, http.ErrAbortHandler) ||
 				errors.Is(reqErr, http.ErrHandlerTimeout) ||
@@ -0,0 +1,281 @@
+package manifest
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+)
+
+// Kind is the kind of a manifest resource
+type Kind string
+
+const (
+	// KindNetwork for networks
+	KindNetwork Kind = "network"
+	// KindDeployment for deployments
+	KindDeployment Kind = "deployment"
+	// KindKubernetes for kubernetes clusters
+	KindKubernetes Kind = "kubernetes"
+	// KindGatewayName for name gateways
+	KindGatewayName Kind = "gateway_name"
+	// KindGatewayFQDN for fqdn gateways
+	KindGatewayFQDN Kind = "gateway_fqdn"
+)
+
+// vms and zdbs are referenced by name but belong to a deployment
+const (
+	refVM  = "vm"
+	refZDB = "zdb"
+)
+
+var referenceRegex = regexp.MustCompile(`\$\{([a-z_]+)\.([A-Za-z0-9_-]+)\.([a-z0-9_]+)\}`)
+
+// referenceAttributes are the attributes that can be referenced for every reference kind
+var referenceAttributes = map[string][]string{
+	string(KindNetwork):     {"ip_range", "wg_config"},
+	refVM:                   {"ip", "public_ip", "public_ip6", "planetary_ip", "mycelium_ip"},
+	refZDB:                  {"ip", "port", "namespace", "password", "address"},
+	string(KindKubernetes):  {"master_ip", "master_public_ip", "master_public_ip6", "master_planetary_ip", "master_mycelium_ip"},
+	string(KindGatewayName): {"fqdn"},
+	string(KindGatewayFQDN): {"fqdn"},
+}
+
+// Resource is a manifest resource, Spec is one of Network, Deployment, K8sCluster, GatewayName or GatewayFQDN
+type Resource struct {
+	Kind Kind
+	Name string
+	Spec interface{}
+}
+
+// DeploymentType returns the type stored in the deployment data of the contracts of a resource kind
+func (k Kind) DeploymentType() string {
+	switch k {
+	case KindNetwork:
+		return workloads.NetworkType
+	case KindKubernetes:
+		return workloads.K8sType
+	case KindGatewayName:
+		return workloads.GatewayNameType
+	case KindGatewayFQDN:
+		return workloads.GatewayFQDNType
+	default:
+		return workloads.VMType
+	}
+}
+
+// String returns the resource identifier
+func (r Resource) String() string {
+	return fmt.Sprintf("%s.%s", r.Kind, r.Name)
+}
+
+// Order returns the manifest resources ordered so every resource comes after the resources it depends on.
+// a resource depends on the network it uses and on the resources it references.
+func (m *Manifest) Order() ([]Resource, error) {
+	resources, err := m.resources()
+	if err != nil {
+		return nil, err
+	}
+
+	// owners maps a reference prefix (kind.name) to the resource providing it
+	owners := make(map[string]int)
+	for idx, r := range resources {
+		owners[fmt.Sprintf("%s.%s", r.Kind, r.Name)] = idx
+
+		if dl, ok := r.Spec.(Deployment); ok {
+			for _, vm := range dl.VMs {
+				if err := addOwner(owners, refVM, vm.Name, idx); err != nil {
+					return nil, err
+				}
+			}
+			for _, zdb := range dl.ZDBs {
+				if err := addOwner(owners, refZDB, zdb.Name, idx); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	dependencies := make([][]int, len(resources))
+	for idx, r := range resources {
+		if network := networkOf(r.Spec); len(network) != 0 {
+			owner, ok := owners[fmt.Sprintf("%s.%s", KindNetwork, network)]
+			if !ok {
+				return nil, errors.Errorf("%s uses network %s which is not in the manifest", r, network)
+			}
+			dependencies[idx] = append(dependencies[idx], owner)
+		}
+
+		for _, field := range referenceFields(r.Spec) {
+			for _, match := range referenceRegex.FindAllStringSubmatch(field, -1) {
+				owner, err := referenceOwner(owners, match)
+				if err != nil {
+					return nil, errors.Wrapf(err, "invalid reference in %s", r)
+				}
+				if owner == idx {
+					return nil, errors.Errorf("%s cannot reference its own output %s", r, match[0])
+				}
+				dependencies[idx] = append(dependencies[idx], owner)
+			}
+		}
+	}
+
+	return sortResources(resources, dependencies)
+}
+
+// resources lists the manifest resources making sure names are unique per kind
+func (m *Manifest) resources() ([]Resource, error) {
+	var resources []Resource
+	for _, n := range m.Networks {
+		resources = append(resources, Resource{Kind: KindNetwork, Name: n.Name, Spec: n})
+	}
+	for _, d := range m.Deployments {
+		resources = append(resources, Resource{Kind: KindDeployment, Name: d.Name, Spec: d})
+	}
+	for _, k := range m.Kubernetes {
+		resources = append(resources, Resource{Kind: KindKubernetes, Name: k.Name, Spec: k})
+	}
+	for _, g := range m.GatewayNames {
+		resources = append(resources, Resource{Kind: KindGatewayName, Name: g.Name, Spec: g})
+	}
+	for _, g := range m.GatewayFQDNs {
+		resources = append(resources, Resource{Kind: KindGatewayFQDN, Name: g.Name, Spec: g})
+	}
+
+	names := make(map[string]bool)
+	for _, r := range resources {
+		if len(r.Name) == 0 {
+			return nil, errors.Errorf("%s name is required", r.Kind)
+		}
+		if names[r.String()] {
+			return nil, errors.Errorf("%s is defined more than once", r)
+		}
+		names[r.String()] = true
+	}
+
+	return resources, nil
+}
+
+func addOwner(owners map[string]int, kind, name string, owner int) error {
+	key := fmt.Sprintf("%s.%s", kind, name)
+	if _, ok := owners[key]; ok {
+		return errors.Errorf("%s is defined more than once", key)
+	}
+	owners[key] = owner
+	return nil
+}
+
+// referenceOwner returns the resource providing a reference after validating its attribute
+func referenceOwner(owners map[string]int, match []string) (int, error) {
+	kind, name, attribute := match[1], match[2], match[3]
+
+	attributes, ok := referenceAttributes[kind]
+	if !ok {
+		return 0, errors.Errorf("unknown kind %s in %s", kind, match[0])
+	}
+
+	if !slices.Contains(attributes, attribute) {
+		return 0, errors.Errorf("unknown attribute %s in %s, supported attributes are: %s", attribute, match[0], strings.Join(attributes, ", "))
+	}
+
+	owner, ok := owners[fmt.Sprintf("%s.%s", kind, name)]
+	if !ok {
+		return 0, errors.Errorf("%s %s referenced in %s is not in the manifest", kind, name, match[0])
+	}
+
+	return owner, nil
+}
+
+// sortResources sorts the resources topologically keeping the manifest order between independent resources
+func sortResources(resources []Resource, dependencies [][]int) ([]Resource, error) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	marks := make([]int, len(resources))
+	sorted := make([]Resource, 0, len(resources))
+
+	var visit func(idx int, path []string) error
+	visit = func(idx int, path []string) error {
+		path = append(path, resources[idx].String())
+
+		switch marks[idx] {
+		case visited:
+			return nil
+		case visiting:
+			return errors.Errorf("dependency cycle: %s", strings.Join(path, " -> "))
+		}
+
+		marks[idx] = visiting
+		for _, dep := range dependencies[idx] {
+			if err := visit(dep, path); err != nil {
+				return err
+			}
+		}
+		marks[idx] = visited
+
+		sorted = append(sorted, resources[idx])
+		return nil
+	}
+
+	for idx := range resources {
+		if err := visit(idx, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return sorted, nil
+}
+
+// networkOf returns the network a resource spec is deployed in
+func networkOf(spec interface{}) string {
+	switch s := spec.(type) {
+	case Deployment:
+		return s.NetworkName
+	case K8sCluster:
+		return s.NetworkName
+	case GatewayName:
+		return s.Network
+	case GatewayFQDN:
+		return s.Network
+	}
+	return ""
+}
+
+// referenceFields returns the fields of a resource spec that support references
+func referenceFields(spec interface{}) []string {
+	var fields []string
+
+	switch s := spec.(type) {
+	case Deployment:
+		for _, vm := range s.VMs {
+			for _, value := range vm.EnvVars {
+				fields = append(fields, value)
+			}
+		}
+		for _, q := range s.QSFS {
+			for _, b := range qsfsBackends(q) {
+				fields = append(fields, b.Address, b.Namespace, b.Password)
+			}
+		}
+	case GatewayName:
+		fields = append(fields, s.Backends...)
+	case GatewayFQDN:
+		fields = append(fields, s.Backends...)
+	}
+
+	return fields
+}
+
+func qsfsBackends(q QSFS) []QSFSBackend {
+	backends := append([]QSFSBackend{}, q.Metadata.Backends...)
+	for _, g := range q.Groups {
+		backends = append(backends, g.Backends...)
+	}
+	return backends
+}
@@ -0,0 +1,204 @@
+// Package manifest describes grid projects declaratively so they can be applied by the grid client.
+//
+// a manifest lists the networks, deployments (vms, disks, zdbs and qsfs), kubernetes clusters and
+// gateways of a project. string fields that support references can use the output of other resources
+// with the syntax ${kind.name.attribute}, for example a gateway backend "http://${vm.web.ip}:8080".
+package manifest
+
+import (
+	"bytes"
+	"os"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Manifest describes all the resources of a project
+type Manifest struct {
+	// Project is stored as the project name of every deployment, it is the ownership key of the manifest resources
+	Project      string        `yaml:"project" json:"project"`
+	Networks     []Network     `yaml:"networks" json:"networks"`
+	Deployments  []Deployment  `yaml:"deployments" json:"deployments"`
+	Kubernetes   []K8sCluster  `yaml:"kubernetes" json:"kubernetes"`
+	GatewayNames []GatewayName `yaml:"gateway_names" json:"gateway_names"`
+	GatewayFQDNs []GatewayFQDN `yaml:"gateway_fqdns" json:"gateway_fqdns"`
+}
+
+// Network is a network spanning multiple nodes
+type Network struct {
+	Name        string   `yaml:"name" json:"name"`
+	Description string   `yaml:"description" json:"description"`
+	Nodes       []uint32 `yaml:"nodes" json:"nodes"`
+	IPRange     string   `yaml:"ip_range" json:"ip_range"`
+	AddWGAccess bool     `yaml:"add_wg_access" json:"add_wg_access"`
+	Mycelium    bool     `yaml:"mycelium" json:"mycelium"`
+}
+
+// Deployment groups the vms, disks, zdbs and qsfs deployed on a node
+type Deployment struct {
+	Name        string `yaml:"name" json:"name"`
+	NodeID      uint32 `yaml:"node" json:"node"`
+	NetworkName string `yaml:"network" json:"network"`
+	VMs         []VM   `yaml:"vms" json:"vms"`
+	Disks       []Disk `yaml:"disks" json:"disks"`
+	ZDBs        []ZDB  `yaml:"zdbs" json:"zdbs"`
+	QSFS        []QSFS `yaml:"qsfs" json:"qsfs"`
+}
+
+// VM is a virtual machine, env vars values support references
+type VM struct {
+	Name         string            `yaml:"name" json:"name"`
+	Description  string            `yaml:"description" json:"description"`
+	Flist        string            `yaml:"flist" json:"flist"`
+	Entrypoint   string            `yaml:"entrypoint" json:"entrypoint"`
+	CPU          uint8             `yaml:"cpu" json:"cpu"`
+	MemoryMB     uint64            `yaml:"memory" json:"memory"`
+	RootfsSizeMB uint64            `yaml:"rootfs_size" json:"rootfs_size"`
+	PublicIP     bool              `yaml:"public_ip" json:"public_ip"`
+	PublicIP6    bool              `yaml:"public_ip6" json:"public_ip6"`
+	Planetary    bool              `yaml:"planetary" json:"planetary"`
+	Mycelium     bool              `yaml:"mycelium" json:"mycelium"`
+	Mounts       []Mount           `yaml:"mounts" json:"mounts"`
+	EnvVars      map[string]string `yaml:"env_vars" json:"env_vars"`
+}
+
+// Mount mounts a disk or a qsfs of the same deployment in a vm
+type Mount struct {
+	Name       string `yaml:"name" json:"name"`
+	MountPoint string `yaml:"mount_point" json:"mount_point"`
+}
+
+// Disk is a vm disk
+type Disk struct {
+	Name        string `yaml:"name" json:"name"`
+	SizeGB      uint64 `yaml:"size" json:"size"`
+	Description string `yaml:"description" json:"description"`
+}
+
+// ZDB is a zdb namespace
+type ZDB struct {
+	Name        string `yaml:"name" json:"name"`
+	Description string `yaml:"description" json:"description"`
+	Password    string `yaml:"password" json:"password"`
+	Public      bool   `yaml:"public" json:"public"`
+	SizeGB      uint64 `yaml:"size" json:"size"`
+	Mode        string `yaml:"mode" json:"mode"`
+}
+
+// QSFS is a quantum safe file system, backends fields support references
+type QSFS struct {
+	Name                 string       `yaml:"name" json:"name"`
+	Description          string       `yaml:"description" json:"description"`
+	Cache                int          `yaml:"cache" json:"cache"`
+	MinimalShards        uint32       `yaml:"minimal_shards" json:"minimal_shards"`
+	ExpectedShards       uint32       `yaml:"expected_shards" json:"expected_shards"`
+	RedundantGroups      uint32       `yaml:"redundant_groups" json:"redundant_groups"`
+	RedundantNodes       uint32       `yaml:"redundant_nodes" json:"redundant_nodes"`
+	MaxZDBDataDirSize    uint32       `yaml:"max_zdb_data_dir_size" json:"max_zdb_data_dir_size"`
+	EncryptionKey        string       `yaml:"encryption_key" json:"encryption_key"`
+	CompressionAlgorithm string       `yaml:"compression_algorithm" json:"compression_algorithm"`
+	Metadata             QSFSMetadata `yaml:"metadata" json:"metadata"`
+	Groups               []QSFSGroup  `yaml:"groups" json:"groups"`
+}
+
+// QSFSMetadata is the qsfs metadata store
+type QSFSMetadata struct {
+	Type          string        `yaml:"type" json:"type"`
+	Prefix        string        `yaml:"prefix" json:"prefix"`
+	EncryptionKey string        `yaml:"encryption_key" json:"encryption_key"`
+	Backends      []QSFSBackend `yaml:"backends" json:"backends"`
+}
+
+// QSFSGroup is a group of qsfs data backends
+type QSFSGroup struct {
+	Backends []QSFSBackend `yaml:"backends" json:"backends"`
+}
+
+// QSFSBackend is a zdb backend of a qsfs
+type QSFSBackend struct {
+	Address   string `yaml:"address" json:"address"`
+	Namespace string `yaml:"namespace" json:"namespace"`
+	Password  string `yaml:"password" json:"password"`
+}
+
+// K8sCluster is a kubernetes cluster, its name is the name of the master node.
+// masters are the additional masters of a highly available cluster, workers register through the endpoint if set
+type K8sCluster struct {
+	Name        string    `yaml:"name" json:"name"`
+	NetworkName string    `yaml:"network" json:"network"`
+	Token       string    `yaml:"token" json:"token"`
+	SSHKey      string    `yaml:"ssh_key" json:"ssh_key"`
+	Flist       string    `yaml:"flist" json:"flist"`
+	Master      K8sNode   `yaml:"master" json:"master"`
+	Masters     []K8sNode `yaml:"masters,omitempty" json:"masters,omitempty"`
+	Workers     []K8sNode `yaml:"workers" json:"workers"`
+	Endpoint    string    `yaml:"endpoint,omitempty" json:"endpoint,omitempty"`
+}
+
+// K8sNode is a kubernetes master or worker node, the master node name is ignored
+type K8sNode struct {
+	Name       string `yaml:"name" json:"name"`
+	NodeID     uint32 `yaml:"node" json:"node"`
+	CPU        uint8  `yaml:"cpu" json:"cpu"`
+	MemoryMB   uint64 `yaml:"memory" json:"memory"`
+	DiskSizeGB uint64 `yaml:"disk_size" json:"disk_size"`
+	PublicIP   bool   `yaml:"public_ip" json:"public_ip"`
+	PublicIP6  bool   `yaml:"public_ip6" json:"public_ip6"`
+	Planetary  bool   `yaml:"planetary" json:"planetary"`
+	Mycelium   bool   `yaml:"mycelium" json:"mycelium"`
+}
+
+// GatewayName is a name gateway, backends support references
+type GatewayName struct {
+	Name           string   `yaml:"name" json:"name"`
+	NodeID         uint32   `yaml:"node" json:"node"`
+	Backends       []string `yaml:"backends" json:"backends"`
+	TLSPassthrough bool     `yaml:"tls_passthrough" json:"tls_passthrough"`
+	Network        string   `yaml:"network" json:"network"`
+	Description    string   `yaml:"description" json:"description"`
+}
+
+// GatewayFQDN is a fqdn gateway, backends support references
+type GatewayFQDN struct {
+	Name           string   `yaml:"name" json:"name"`
+	NodeID         uint32   `yaml:"node" json:"node"`
+	FQDN           string   `yaml:"fqdn" json:"fqdn"`
+	Backends       []string `yaml:"backends" json:"backends"`
+	TLSPassthrough bool     `yaml:"tls_passthrough" json:"tls_passthrough"`
+	Network        string   `yaml:"network" json:"network"`
+	Description    string   `yaml:"description" json:"description"`
+}
+
+// Parse parses a YAML or JSON manifest and validates it
+func Parse(data []byte) (Manifest, error) {
+	var m Manifest
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&m); err != nil {
+		return Manifest{}, errors.Wrap(err, "could not decode manifest")
+	}
+
+	return m, m.Validate()
+}
+
+// Load reads and parses a manifest file
+func Load(path string) (Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Manifest{}, errors.Wrapf(err, "could not read manifest %s", path)
+	}
+
+	return Parse(data)
+}
+
+// Validate validates the manifest structure and its references,
+// resources data is validated by the deployers while applying
+func (m *Manifest) Validate() error {
+	if len(m.Project) == 0 {
+		return errors.New("manifest project is required")
+	}
+
+	_, err := m.Order()
+	return err
+}
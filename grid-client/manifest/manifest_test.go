@@ -0,0 +1,166 @@
+package manifest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const yamlManifest = `
+project: shop
+networks:
+  - name: net
+    nodes: [11, 12]
+    ip_range: 10.20.0.0/16
+gateway_names:
+  - name: shop
+    node: 14
+    backends: ["http://${vm.web.ip}:8080"]
+deployments:
+  - name: backend
+    node: 11
+    network: net
+    vms:
+      - name: web
+        flist: https://hub.grid.tf/tf-official-apps/base:latest.flist
+        cpu: 2
+        memory: 1024
+        env_vars:
+          DB: ${zdb.db.address}
+  - name: storage
+    node: 12
+    network: net
+    zdbs:
+      - name: db
+        size: 10
+        password: pass
+`
+
+const jsonManifest = `{
+  "project": "shop",
+  "networks": [{"name": "net", "nodes": [11], "ip_range": "10.20.0.0/16"}],
+  "deployments": [{
+    "name": "backend", "node": 11, "network": "net",
+    "vms": [{"name": "web", "cpu": 2, "memory": 1024}]
+  }],
+  "gateway_names": [{"name": "shop", "node": 14, "backends": ["http://${vm.web.ip}:8080"]}]
+}`
+
+func names(resources []Resource) []string {
+	var res []string
+	for _, r := range resources {
+		res = append(res, r.String())
+	}
+	return res
+}
+
+func TestParse(t *testing.T) {
+	for name, data := range map[string]string{"yaml": yamlManifest, "json": jsonManifest} {
+		t.Run(name, func(t *testing.T) {
+			m, err := Parse([]byte(data))
+			require.NoError(t, err)
+
+			assert.Equal(t, "shop", m.Project)
+			require.NotEmpty(t, m.Deployments)
+			assert.Equal(t, uint32(11), m.Deployments[0].NodeID)
+			assert.Equal(t, uint64(1024), m.Deployments[0].VMs[0].MemoryMB)
+		})
+	}
+
+	t.Run("order", func(t *testing.T) {
+		m, err := Parse([]byte(yamlManifest))
+		require.NoError(t, err)
+
+		resources, err := m.Order()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"network.net", "deployment.storage", "deployment.backend", "gateway_name.shop"}, names(resources))
+	})
+
+	t.Run("unknown field", func(t *testing.T) {
+		_, err := Parse([]byte("project: shop\nnetwork: []\n"))
+		assert.Error(t, err)
+	})
+
+	t.Run("missing project", func(t *testing.T) {
+		_, err := Parse([]byte("networks: []\n"))
+		assert.Error(t, err)
+	})
+}
+
+func TestOrderErrors(t *testing.T) {
+	network := Network{Name: "net", Nodes: []uint32{11}, IPRange: "10.20.0.0/16"}
+
+	t.Run("missing network", func(t *testing.T) {
+		m := Manifest{Project: "p", Deployments: []Deployment{{Name: "d", NetworkName: "net"}}}
+		_, err := m.Order()
+		assert.ErrorContains(t, err, "network net which is not in the manifest")
+	})
+
+	t.Run("duplicate name", func(t *testing.T) {
+		m := Manifest{Project: "p", Networks: []Network{network, network}}
+		_, err := m.Order()
+		assert.ErrorContains(t, err, "defined more than once")
+	})
+
+	t.Run("unknown attribute", func(t *testing.T) {
+		m := Manifest{
+			Project:      "p",
+			Networks:     []Network{network},
+			Deployments:  []Deployment{{Name: "d", NetworkName: "net", VMs: []VM{{Name: "vm"}}}},
+			GatewayNames: []GatewayName{{Name: "gw", Backends: []string{"http://${vm.vm.address}"}}},
+		}
+		_, err := m.Order()
+		assert.ErrorContains(t, err, "unknown attribute address")
+	})
+
+	t.Run("unknown resource", func(t *testing.T) {
+		m := Manifest{Project: "p", GatewayNames: []GatewayName{{Name: "gw", Backends: []string{"http://${vm.web.ip}"}}}}
+		_, err := m.Order()
+		assert.ErrorContains(t, err, "vm web referenced in ${vm.web.ip} is not in the manifest")
+	})
+
+	t.Run("self reference", func(t *testing.T) {
+		m := Manifest{
+			Project:  "p",
+			Networks: []Network{network},
+			Deployments: []Deployment{{
+				Name:        "d",
+				NetworkName: "net",
+				VMs:         []VM{{Name: "vm", EnvVars: map[string]string{"IP": "${vm.vm.ip}"}}},
+			}},
+		}
+		_, err := m.Order()
+		assert.ErrorContains(t, err, "cannot reference its own output")
+	})
+
+	t.Run("cycle", func(t *testing.T) {
+		m := Manifest{
+			Project:  "p",
+			Networks: []Network{network},
+			Deployments: []Deployment{
+				{Name: "a", NetworkName: "net", VMs: []VM{{Name: "a", EnvVars: map[string]string{"B": "${vm.b.ip}"}}}},
+				{Name: "b", NetworkName: "net", VMs: []VM{{Name: "b", EnvVars: map[string]string{"A": "${vm.a.ip}"}}}},
+			},
+		}
+		_, err := m.Order()
+		assert.ErrorContains(t, err, "dependency cycle: deployment.a -> deployment.b -> deployment.a")
+	})
+}
+
+func TestOutputsResolve(t *testing.T) {
+	outputs := Outputs{"vm.web.ip": "10.20.2.2"}
+
+	gw, err := outputs.ResolveGatewayName(GatewayName{Name: "gw", Backends: []string{"http://${vm.web.ip}:8080"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"http://10.20.2.2:8080"}, gw.Backends)
+
+	_, err = outputs.Resolve("${vm.db.ip}")
+	assert.ErrorContains(t, err, "reference ${vm.db.ip} has no value")
+
+	dl := Deployment{Name: "d", VMs: []VM{{Name: "vm", EnvVars: map[string]string{"WEB": "${vm.web.ip}"}}}}
+	resolved, err := outputs.ResolveDeployment(dl)
+	require.NoError(t, err)
+	assert.Equal(t, "10.20.2.2", resolved.VMs[0].EnvVars["WEB"])
+	assert.Equal(t, "${vm.web.ip}", dl.VMs[0].EnvVars["WEB"], "original deployment should not be changed")
+}
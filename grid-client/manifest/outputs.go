@@ -0,0 +1,162 @@
+package manifest
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+)
+
+// Outputs holds the attributes of the applied resources, keyed by kind.name.attribute
+type Outputs map[string]string
+
+// Resolve replaces the references in s with their values
+func (o Outputs) Resolve(s string) (string, error) {
+	var err error
+
+	resolved := referenceRegex.ReplaceAllStringFunc(s, func(ref string) string {
+		key := strings.TrimSuffix(strings.TrimPrefix(ref, "${"), "}")
+		value, ok := o[key]
+		if !ok && err == nil {
+			err = errors.Errorf("reference %s has no value", ref)
+		}
+		return value
+	})
+
+	return resolved, err
+}
+
+// ResolveDeployment returns a copy of the deployment with its references resolved
+func (o Outputs) ResolveDeployment(d Deployment) (Deployment, error) {
+	var err error
+
+	vms := make([]VM, len(d.VMs))
+	for idx, vm := range d.VMs {
+		envVars := make(map[string]string, len(vm.EnvVars))
+		for key, value := range vm.EnvVars {
+			if envVars[key], err = o.Resolve(value); err != nil {
+				return d, errors.Wrapf(err, "could not resolve env var %s of vm %s", key, vm.Name)
+			}
+		}
+		vm.EnvVars = envVars
+		vms[idx] = vm
+	}
+	d.VMs = vms
+
+	qsfs := make([]QSFS, len(d.QSFS))
+	for idx, q := range d.QSFS {
+		if q.Metadata.Backends, err = o.resolveBackends(q.Metadata.Backends); err != nil {
+			return d, errors.Wrapf(err, "could not resolve metadata backends of qsfs %s", q.Name)
+		}
+
+		groups := make([]QSFSGroup, len(q.Groups))
+		for i, g := range q.Groups {
+			if groups[i].Backends, err = o.resolveBackends(g.Backends); err != nil {
+				return d, errors.Wrapf(err, "could not resolve group backends of qsfs %s", q.Name)
+			}
+		}
+		q.Groups = groups
+		qsfs[idx] = q
+	}
+	d.QSFS = qsfs
+
+	return d, nil
+}
+
+// ResolveGatewayName returns a copy of the name gateway with its references resolved
+func (o Outputs) ResolveGatewayName(g GatewayName) (GatewayName, error) {
+	backends, err := o.resolveAll(g.Backends)
+	g.Backends = backends
+	return g, errors.Wrapf(err, "could not resolve backends of gateway %s", g.Name)
+}
+
+// ResolveGatewayFQDN returns a copy of the fqdn gateway with its references resolved
+func (o Outputs) ResolveGatewayFQDN(g GatewayFQDN) (GatewayFQDN, error) {
+	backends, err := o.resolveAll(g.Backends)
+	g.Backends = backends
+	return g, errors.Wrapf(err, "could not resolve backends of gateway %s", g.Name)
+}
+
+func (o Outputs) resolveAll(values []string) ([]string, error) {
+	resolved := make([]string, len(values))
+	for idx, value := range values {
+		var err error
+		if resolved[idx], err = o.Resolve(value); err != nil {
+			return nil, err
+		}
+	}
+	return resolved, nil
+}
+
+func (o Outputs) resolveBackends(backends []QSFSBackend) ([]QSFSBackend, error) {
+	resolved := make([]QSFSBackend, len(backends))
+	for idx, b := range backends {
+		var err error
+		if resolved[idx].Address, err = o.Resolve(b.Address); err != nil {
+			return nil, err
+		}
+		if resolved[idx].Namespace, err = o.Resolve(b.Namespace); err != nil {
+			return nil, err
+		}
+		if resolved[idx].Password, err = o.Resolve(b.Password); err != nil {
+			return nil, err
+		}
+	}
+	return resolved, nil
+}
+
+func (o Outputs) set(kind, name, attribute, value string) {
+	o[fmt.Sprintf("%s.%s.%s", kind, name, attribute)] = value
+}
+
+// SetNetwork stores the outputs of a deployed network
+func (o Outputs) SetNetwork(znet *workloads.ZNet) {
+	o.set(string(KindNetwork), znet.Name, "ip_range", znet.IPRange.String())
+	o.set(string(KindNetwork), znet.Name, "wg_config", znet.AccessWGConfig)
+}
+
+// SetDeployment stores the outputs of the vms and zdbs of a deployed deployment
+func (o Outputs) SetDeployment(dl *workloads.Deployment) {
+	for _, vm := range dl.Vms {
+		o.set(refVM, vm.Name, "ip", vm.IP)
+		o.set(refVM, vm.Name, "public_ip", vm.ComputedIP)
+		o.set(refVM, vm.Name, "public_ip6", vm.ComputedIP6)
+		o.set(refVM, vm.Name, "planetary_ip", vm.PlanetaryIP)
+		o.set(refVM, vm.Name, "mycelium_ip", vm.MyceliumIP)
+	}
+
+	for _, zdb := range dl.Zdbs {
+		var ip string
+		if len(zdb.IPs) != 0 {
+			ip = zdb.IPs[0]
+		}
+
+		o.set(refZDB, zdb.Name, "ip", ip)
+		o.set(refZDB, zdb.Name, "port", fmt.Sprint(zdb.Port))
+		o.set(refZDB, zdb.Name, "namespace", zdb.Namespace)
+		o.set(refZDB, zdb.Name, "password", zdb.Password)
+		o.set(refZDB, zdb.Name, "address", net.JoinHostPort(ip, fmt.Sprint(zdb.Port)))
+	}
+}
+
+// SetK8sCluster stores the outputs of a deployed kubernetes cluster
+func (o Outputs) SetK8sCluster(cluster *workloads.K8sCluster) {
+	name := cluster.Master.Name
+	o.set(string(KindKubernetes), name, "master_ip", cluster.Master.IP)
+	o.set(string(KindKubernetes), name, "master_public_ip", cluster.Master.ComputedIP)
+	o.set(string(KindKubernetes), name, "master_public_ip6", cluster.Master.ComputedIP6)
+	o.set(string(KindKubernetes), name, "master_planetary_ip", cluster.Master.PlanetaryIP)
+	o.set(string(KindKubernetes), name, "master_mycelium_ip", cluster.Master.MyceliumIP)
+}
+
+// SetGatewayName stores the outputs of a deployed name gateway
+func (o Outputs) SetGatewayName(gw *workloads.GatewayNameProxy) {
+	o.set(string(KindGatewayName), gw.Name, "fqdn", gw.FQDN)
+}
+
+// SetGatewayFQDN stores the outputs of a deployed fqdn gateway
+func (o Outputs) SetGatewayFQDN(gw *workloads.GatewayFQDNProxy) {
+	o.set(string(KindGatewayFQDN), gw.Name, "fqdn", gw.FQDN)
+}
@@ -0,0 +1,241 @@
+package manifest
+
+import (
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/zos"
+	zosTypes "github.com/threefoldtech/zos/pkg/gridtypes/zos"
+)
+
+// ZNet returns the network workload of the spec owned by the given project.
+// mycelium keys are generated randomly and should be replaced by the live ones if the network exists.
+func (n Network) ZNet(project string) (workloads.ZNet, error) {
+	ipRange, err := zos.ParseIPNet(n.IPRange)
+	if err != nil {
+		return workloads.ZNet{}, errors.Wrapf(err, "invalid ip range of network %s", n.Name)
+	}
+
+	znet := workloads.ZNet{
+		Name:         n.Name,
+		Description:  n.Description,
+		Nodes:        n.Nodes,
+		IPRange:      ipRange,
+		AddWGAccess:  n.AddWGAccess,
+		SolutionType: project,
+	}
+
+	if n.Mycelium {
+		znet.MyceliumKeys = make(map[uint32][]byte)
+		for _, node := range n.Nodes {
+			if znet.MyceliumKeys[node], err = workloads.RandomMyceliumKey(); err != nil {
+				return workloads.ZNet{}, errors.Wrapf(err, "could not generate mycelium key of network %s", n.Name)
+			}
+		}
+	}
+
+	return znet, nil
+}
+
+// Deployment returns the grid deployment of the spec owned by the given project, references must be resolved.
+// mycelium seeds are generated randomly and should be replaced by the live ones if the vms exist.
+func (d Deployment) Deployment(project string) (workloads.Deployment, error) {
+	var vms []workloads.VM
+	for _, vm := range d.VMs {
+		wlVM, err := vm.vm(d.NodeID, d.NetworkName)
+		if err != nil {
+			return workloads.Deployment{}, err
+		}
+		vms = append(vms, wlVM)
+	}
+
+	var disks []workloads.Disk
+	for _, disk := range d.Disks {
+		disks = append(disks, workloads.Disk{Name: disk.Name, SizeGB: disk.SizeGB, Description: disk.Description})
+	}
+
+	var zdbs []workloads.ZDB
+	for _, zdb := range d.ZDBs {
+		mode := zdb.Mode
+		if len(mode) == 0 {
+			mode = workloads.ZDBModeUser
+		}
+
+		zdbs = append(zdbs, workloads.ZDB{
+			Name:        zdb.Name,
+			Description: zdb.Description,
+			Password:    zdb.Password,
+			Public:      zdb.Public,
+			SizeGB:      zdb.SizeGB,
+			Mode:        mode,
+		})
+	}
+
+	var qsfs []workloads.QSFS
+	for _, q := range d.QSFS {
+		qsfs = append(qsfs, q.qsfs())
+	}
+
+	return workloads.NewDeployment(d.Name, d.NodeID, project, nil, d.NetworkName, disks, zdbs, vms, nil, qsfs, nil), nil
+}
+
+// Cluster returns the kubernetes cluster of the spec owned by the given project.
+// mycelium seeds are generated randomly and should be replaced by the live ones if the nodes exist.
+func (k K8sCluster) Cluster(project string) (workloads.K8sCluster, error) {
+	master, err := k.Master.k8sNode(k.Name, k.NetworkName)
+	if err != nil {
+		return workloads.K8sCluster{}, err
+	}
+
+	cluster := workloads.K8sCluster{
+		Master:       &master,
+		Token:        k.Token,
+		NetworkName:  k.NetworkName,
+		Flist:        k.Flist,
+		SolutionType: project,
+		SSHKey:       k.SSHKey,
+		Endpoint:     k.Endpoint,
+	}
+
+	for _, m := range k.Masters {
+		master, err := m.k8sNode(m.Name, k.NetworkName)
+		if err != nil {
+			return workloads.K8sCluster{}, err
+		}
+		cluster.Masters = append(cluster.Masters, master)
+	}
+
+	for _, w := range k.Workers {
+		worker, err := w.k8sNode(w.Name, k.NetworkName)
+		if err != nil {
+			return workloads.K8sCluster{}, err
+		}
+		cluster.Workers = append(cluster.Workers, worker)
+	}
+
+	return cluster, nil
+}
+
+// Proxy returns the name gateway workload of the spec owned by the given project, references must be resolved
+func (g GatewayName) Proxy(project string) workloads.GatewayNameProxy {
+	return workloads.GatewayNameProxy{
+		NodeID:         g.NodeID,
+		Name:           g.Name,
+		Backends:       backends(g.Backends),
+		TLSPassthrough: g.TLSPassthrough,
+		Network:        g.Network,
+		Description:    g.Description,
+		SolutionType:   project,
+	}
+}
+
+// Proxy returns the fqdn gateway workload of the spec owned by the given project, references must be resolved
+func (g GatewayFQDN) Proxy(project string) workloads.GatewayFQDNProxy {
+	return workloads.GatewayFQDNProxy{
+		NodeID:         g.NodeID,
+		Name:           g.Name,
+		FQDN:           g.FQDN,
+		Backends:       backends(g.Backends),
+		TLSPassthrough: g.TLSPassthrough,
+		Network:        g.Network,
+		Description:    g.Description,
+		SolutionType:   project,
+	}
+}
+
+func (vm VM) vm(nodeID uint32, network string) (workloads.VM, error) {
+	wlVM := workloads.VM{
+		Name:         vm.Name,
+		NodeID:       nodeID,
+		NetworkName:  network,
+		Description:  vm.Description,
+		Flist:        vm.Flist,
+		Entrypoint:   vm.Entrypoint,
+		PublicIP:     vm.PublicIP,
+		PublicIP6:    vm.PublicIP6,
+		Planetary:    vm.Planetary,
+		CPU:          vm.CPU,
+		MemoryMB:     vm.MemoryMB,
+		RootfsSizeMB: vm.RootfsSizeMB,
+		EnvVars:      vm.EnvVars,
+	}
+
+	for _, m := range vm.Mounts {
+		wlVM.Mounts = append(wlVM.Mounts, workloads.Mount{Name: m.Name, MountPoint: m.MountPoint})
+	}
+
+	if vm.Mycelium {
+		seed, err := workloads.RandomMyceliumIPSeed()
+		if err != nil {
+			return workloads.VM{}, errors.Wrapf(err, "could not generate mycelium ip seed of vm %s", vm.Name)
+		}
+		wlVM.MyceliumIPSeed = seed
+	}
+
+	return wlVM, nil
+}
+
+func (k K8sNode) k8sNode(name, network string) (workloads.K8sNode, error) {
+	vm, err := VM{
+		Name:      name,
+		CPU:       k.CPU,
+		MemoryMB:  k.MemoryMB,
+		PublicIP:  k.PublicIP,
+		PublicIP6: k.PublicIP6,
+		Planetary: k.Planetary,
+		Mycelium:  k.Mycelium,
+	}.vm(k.NodeID, network)
+
+	return workloads.K8sNode{VM: &vm, DiskSizeGB: k.DiskSizeGB}, err
+}
+
+func (q QSFS) qsfs() workloads.QSFS {
+	qsfs := workloads.QSFS{
+		Name:                 q.Name,
+		Description:          q.Description,
+		Cache:                q.Cache,
+		MinimalShards:        q.MinimalShards,
+		ExpectedShards:       q.ExpectedShards,
+		RedundantGroups:      q.RedundantGroups,
+		RedundantNodes:       q.RedundantNodes,
+		MaxZDBDataDirSize:    q.MaxZDBDataDirSize,
+		EncryptionAlgorithm:  "AES",
+		EncryptionKey:        q.EncryptionKey,
+		CompressionAlgorithm: q.CompressionAlgorithm,
+		Metadata: workloads.Metadata{
+			Type:                q.Metadata.Type,
+			Prefix:              q.Metadata.Prefix,
+			EncryptionAlgorithm: "AES",
+			EncryptionKey:       q.Metadata.EncryptionKey,
+			Backends:            qsfsBackendsOf(q.Metadata.Backends),
+		},
+	}
+
+	if len(qsfs.CompressionAlgorithm) == 0 {
+		qsfs.CompressionAlgorithm = "snappy"
+	}
+	if len(qsfs.Metadata.Type) == 0 {
+		qsfs.Metadata.Type = "zdb"
+	}
+
+	for _, g := range q.Groups {
+		qsfs.Groups = append(qsfs.Groups, workloads.Group{Backends: qsfsBackendsOf(g.Backends)})
+	}
+
+	return qsfs
+}
+
+func qsfsBackendsOf(backends []QSFSBackend) workloads.Backends {
+	var res workloads.Backends
+	for _, b := range backends {
+		res = append(res, workloads.Backend{Address: b.Address, Namespace: b.Namespace, Password: b.Password})
+	}
+	return res
+}
+
+func backends(values []string) []zosTypes.Backend {
+	var res []zosTypes.Backend
+	for _, value := range values {
+		res = append(res, zosTypes.Backend(value))
+	}
+	return res
+}
@@ -0,0 +1,226 @@
+package simulation
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	countQuery   = regexp.MustCompile(`items:\s*(\w+)Connection`)
+	twinIDFilter = regexp.MustCompile(`twinID_eq:\s*(\d+)`)
+	statesFilter = regexp.MustCompile(`state_in:\s*\[([^\]]*)\]`)
+	typedQuery   = regexp.MustCompile(`(\w+Contracts)\(where:\s*\$where`)
+)
+
+// graphQLContract has the contract fields queried by graphql.ContractsGetter
+type graphQLContract struct {
+	ContractID         string  `json:"contractID"`
+	TwinID             uint32  `json:"twinID"`
+	State              string  `json:"state"`
+	CreatedAt          string  `json:"createdAt"`
+	SolutionProviderID *uint64 `json:"solutionProviderID,omitempty"`
+	DeploymentData     string  `json:"deploymentData,omitempty"`
+	DeploymentHash     string  `json:"deploymentHash,omitempty"`
+	NumberOfPublicIPs  uint32  `json:"numberOfPublicIPs,omitempty"`
+	NodeID             uint32  `json:"nodeID,omitempty"`
+	Name               string  `json:"name,omitempty"`
+
+	createdAt int64
+}
+
+// graphQLWhere is the contracts filter of the typed paginated queries
+type graphQLWhere struct {
+	TwinID       *uint32  `json:"twinID_eq"`
+	States       []string `json:"state_in"`
+	NodeID       *uint32  `json:"nodeID_eq"`
+	ContractIDGt string   `json:"contractID_gt"`
+	CreatedAtGte string   `json:"createdAt_gte"`
+	CreatedAtLte string   `json:"createdAt_lte"`
+}
+
+// GraphQL returns an http handler answering the contracts count and listing queries
+// sent by graphql.ContractsGetter from the grid contracts ledger
+func (g *Grid) GraphQL() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Query     string `json:"query"`
+			Variables struct {
+				Where  *graphQLWhere `json:"where"`
+				Limit  int           `json:"limit"`
+				Offset int           `json:"offset"`
+			} `json:"variables"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeGraphQL(w, http.StatusBadRequest, map[string]interface{}{"errors": []string{err.Error()}})
+			return
+		}
+
+		// the simulated chain doesn't bill contracts
+		if strings.Contains(request.Query, "contractBillReports(") {
+			writeGraphQL(w, http.StatusOK, map[string]interface{}{
+				"data": map[string]interface{}{"contractBillReports": []interface{}{}},
+			})
+			return
+		}
+
+		if match := typedQuery.FindStringSubmatch(request.Query); match != nil && request.Variables.Where != nil {
+			where := request.Variables.Where
+			contracts := g.graphQLContracts(where.TwinID, where.States)[match[1]]
+			writeGraphQL(w, http.StatusOK, map[string]interface{}{
+				"data": map[string]interface{}{match[1]: where.filter(contracts, request.Variables.Offset, request.Variables.Limit)},
+			})
+			return
+		}
+
+		twinID, states := parseContractsFilter(request.Query)
+		contracts := g.graphQLContracts(twinID, states)
+
+		if match := countQuery.FindStringSubmatch(request.Query); match != nil {
+			writeGraphQL(w, http.StatusOK, map[string]interface{}{
+				"data": map[string]interface{}{
+					"items": map[string]interface{}{"count": len(contracts[match[1]])},
+				},
+			})
+			return
+		}
+
+		data := map[string]interface{}{}
+		for kind, list := range contracts {
+			if strings.Contains(request.Query, kind+"(") {
+				data[kind] = list
+			}
+		}
+		writeGraphQL(w, http.StatusOK, map[string]interface{}{"data": data})
+	})
+}
+
+// ServeGraphQL serves the graphql handler on a local port until stop is called
+func (g *Grid) ServeGraphQL() (url string, stop func(), err error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", nil, errors.Wrap(err, "failed to listen for simulated graphql")
+	}
+
+	server := &http.Server{Handler: g.GraphQL()}
+	go func() {
+		_ = server.Serve(listener)
+	}()
+
+	return fmt.Sprintf("http://%s/graphql", listener.Addr().String()), func() { _ = server.Close() }, nil
+}
+
+func (g *Grid) graphQLContracts(twinID *uint32, states []string) map[string][]graphQLContract {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	contracts := map[string][]graphQLContract{
+		"nodeContracts": {},
+		"nameContracts": {},
+		"rentContracts": {},
+	}
+
+	// contracts of the simulated ledger are either created or removed
+	if len(states) != 0 && !containsState(states, "Created") {
+		return contracts
+	}
+
+	for _, c := range g.sortedContracts() {
+		if twinID != nil && uint32(c.TwinID) != *twinID {
+			continue
+		}
+
+		contract := graphQLContract{
+			ContractID: strconv.FormatUint(uint64(c.ContractID), 10),
+			TwinID:     uint32(c.TwinID),
+			State:      "Created",
+			CreatedAt:  strconv.FormatInt(c.createdAt, 10),
+			createdAt:  c.createdAt,
+		}
+		if ok, id := c.SolutionProviderID.Unwrap(); ok {
+			provider := uint64(id)
+			contract.SolutionProviderID = &provider
+		}
+		switch {
+		case c.ContractType.IsNodeContract:
+			contract.NodeID = uint32(c.ContractType.NodeContract.Node)
+			contract.DeploymentData = c.ContractType.NodeContract.DeploymentData
+			contract.DeploymentHash = c.hash
+			contract.NumberOfPublicIPs = uint32(c.ContractType.NodeContract.PublicIPsCount)
+			contracts["nodeContracts"] = append(contracts["nodeContracts"], contract)
+		case c.ContractType.IsNameContract:
+			contract.Name = c.ContractType.NameContract.Name
+			contracts["nameContracts"] = append(contracts["nameContracts"], contract)
+		case c.ContractType.IsRentContract:
+			contract.NodeID = uint32(c.ContractType.RentContract.Node)
+			contracts["rentContracts"] = append(contracts["rentContracts"], contract)
+		}
+	}
+	return contracts
+}
+
+// filter returns the contracts matching the filter after the cursor, skipping offset contracts and up to limit contracts if set
+func (f *graphQLWhere) filter(contracts []graphQLContract, offset, limit int) []graphQLContract {
+	cursor, _ := strconv.ParseUint(f.ContractIDGt, 10, 64)
+	after, _ := strconv.ParseInt(f.CreatedAtGte, 10, 64)
+	before, _ := strconv.ParseInt(f.CreatedAtLte, 10, 64)
+
+	filtered := []graphQLContract{}
+	for _, c := range contracts {
+		id, _ := strconv.ParseUint(c.ContractID, 10, 64)
+		if id <= cursor ||
+			(f.NodeID != nil && c.NodeID != *f.NodeID) ||
+			(f.CreatedAtGte != "" && c.createdAt < after) ||
+			(f.CreatedAtLte != "" && c.createdAt > before) {
+			continue
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		filtered = append(filtered, c)
+		if limit > 0 && len(filtered) == limit {
+			break
+		}
+	}
+	return filtered
+}
+
+func parseContractsFilter(query string) (twinID *uint32, states []string) {
+	if match := twinIDFilter.FindStringSubmatch(query); match != nil {
+		if id, err := strconv.ParseUint(match[1], 10, 32); err == nil {
+			twin := uint32(id)
+			twinID = &twin
+		}
+	}
+
+	if match := statesFilter.FindStringSubmatch(query); match != nil {
+		for _, state := range strings.Split(match[1], ",") {
+			if state = strings.Trim(strings.TrimSpace(state), `"`); state != "" {
+				states = append(states, state)
+			}
+		}
+	}
+	return twinID, states
+}
+
+func containsState(states []string, state string) bool {
+	for _, s := range states {
+		if strings.EqualFold(s, state) {
+			return true
+		}
+	}
+	return false
+}
+
+func writeGraphQL(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,450 @@
+// Package simulation provides an in-process simulated grid: a tfchain contracts ledger, nodes and a grid proxy
+// all backed by the same model, so grid-client flows can run without tfchain, relays or real nodes.
+package simulation
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/pkg/errors"
+	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
+	zosTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-client/zos"
+)
+
+const (
+	// DefaultBalance is the balance of newly registered twins (1000 TFT)
+	DefaultBalance uint64 = 1000 * 1e7
+	// DefaultTFTPrice is the default tft price in mUSD
+	DefaultTFTPrice uint32 = 10
+	// DefaultPricingPolicyID is the id of the pricing policy of the default farm
+	DefaultPricingPolicyID uint32 = 1
+)
+
+// errors returned by the simulated chain, named after their tfchain counterparts
+var (
+	ErrContractNotExists        = errors.New("ContractNotExists")
+	ErrTwinNotAuthorized        = errors.New("TwinNotAuthorizedToUpdateContract")
+	ErrNodeNotExists            = errors.New("NodeNotExists")
+	ErrFarmNotExists            = errors.New("FarmNotExists")
+	ErrNameExists               = errors.New("NameExists")
+	ErrContractIsNotUnique      = errors.New("ContractIsNotUnique")
+	ErrNodeNotAvailableToDeploy = errors.New("NodeNotAvailableToDeploy")
+	ErrNotEnoughPublicIPsFree   = errors.New("FarmHasNotEnoughPublicIPsFree")
+	ErrNodeHasActiveContracts   = errors.New("NodeHasActiveContracts")
+	ErrNodeAlreadyRented        = errors.New("NodeHasRentContract")
+)
+
+// Farm is a simulated farm
+type Farm struct {
+	ID              uint32
+	Name            string
+	TwinID          uint32
+	PricingPolicyID uint32
+	Certified       bool
+	Dedicated       bool
+	PublicIPs       []PublicIP
+}
+
+// PublicIP is a farm public ip, ContractID is set while the ip is reserved by a contract
+type PublicIP struct {
+	IP         string
+	Gateway    string
+	ContractID uint64
+}
+
+// Node is a simulated node
+type Node struct {
+	ID        uint32
+	FarmID    uint32
+	TwinID    uint32
+	Country   string
+	City      string
+	Certified bool
+	Dedicated bool
+	ExtraFee  uint64
+	// Total is the total capacity of the node
+	Total zosTypes.Capacity
+	// PublicIPv4 is the node public config ipv4 in cidr notation, empty for nodes without public config
+	PublicIPv4 string
+	Gateway4   string
+	// Domain is the gateway domain of the node
+	Domain string
+	// Down nodes don't answer rmb calls and are reported as down by the proxy
+	Down bool
+}
+
+type node struct {
+	Node
+	created     int64
+	rentedBy    uint32
+	rentID      uint64
+	used        zosTypes.Capacity
+	deployments map[uint64]*zosTypes.Deployment
+}
+
+type twin struct {
+	id      uint32
+	pk      []byte
+	balance uint64
+}
+
+type contract struct {
+	substrate.Contract
+	hash      string
+	createdAt int64
+	bills     []bill
+}
+
+type bill struct {
+	amount    uint64
+	timestamp int64
+}
+
+// Grid is the simulated grid model shared by the simulated chain, nodes and proxy
+type Grid struct {
+	mu sync.Mutex
+
+	tftPrice        uint32
+	pricingPolicies map[uint32]substrate.PricingPolicy
+
+	farms     map[uint32]*Farm
+	nodes     map[uint32]*node
+	twins     map[uint32]*twin
+	contracts map[uint64]*contract
+	names     map[string]uint64
+
+	lastTwinID     uint32
+	lastContractID uint64
+}
+
+// NewGrid creates a simulated grid with one farm having five public ips and three up nodes with public config
+func NewGrid() *Grid {
+	g := NewEmptyGrid()
+
+	farm := Farm{ID: 1, Name: "simulated-farm", PricingPolicyID: DefaultPricingPolicyID}
+	for i := 10; i < 15; i++ {
+		farm.PublicIPs = append(farm.PublicIPs, PublicIP{IP: fmt.Sprintf("185.206.122.%d/24", i), Gateway: "185.206.122.1"})
+	}
+	mustNot(g.AddFarm(farm))
+
+	for id := uint32(1); id <= 3; id++ {
+		mustNot(g.AddNode(Node{
+			ID:      id,
+			FarmID:  farm.ID,
+			Country: "Belgium",
+			City:    "Ghent",
+			Total: zosTypes.Capacity{
+				CRU: 16,
+				MRU: 64 * zosTypes.Gigabyte,
+				SRU: 1 * zosTypes.Terabyte,
+				HRU: 4 * zosTypes.Terabyte,
+			},
+			PublicIPv4: fmt.Sprintf("185.206.123.%d/24", id),
+			Gateway4:   "185.206.123.254",
+			Domain:     fmt.Sprintf("node%d.sim.grid.tf", id),
+		}))
+	}
+
+	return g
+}
+
+// NewEmptyGrid creates a simulated grid without farms or nodes
+func NewEmptyGrid() *Grid {
+	return &Grid{
+		tftPrice: DefaultTFTPrice,
+		pricingPolicies: map[uint32]substrate.PricingPolicy{
+			DefaultPricingPolicyID: {
+				ID:                     1,
+				Name:                   "simulated",
+				SU:                     substrate.Policy{Value: 50000},
+				CU:                     substrate.Policy{Value: 100000},
+				NU:                     substrate.Policy{Value: 15000},
+				IPU:                    substrate.Policy{Value: 40000},
+				UniqueName:             substrate.Policy{Value: 2500},
+				DomainName:             substrate.Policy{Value: 5000},
+				DedicatedNodesDiscount: 50,
+			},
+		},
+		farms:     make(map[uint32]*Farm),
+		nodes:     make(map[uint32]*node),
+		twins:     make(map[uint32]*twin),
+		contracts: make(map[uint64]*contract),
+		names:     make(map[string]uint64),
+	}
+}
+
+func mustNot(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
+
+// AddFarm adds a farm to the grid, a twin is registered for the farmer if the farm has none
+func (g *Grid) AddFarm(farm Farm) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if farm.ID == 0 {
+		return errors.New("farm id is required")
+	}
+	if _, ok := g.farms[farm.ID]; ok {
+		return errors.Errorf("farm %d already exists", farm.ID)
+	}
+	if farm.PricingPolicyID == 0 {
+		farm.PricingPolicyID = DefaultPricingPolicyID
+	}
+	if _, ok := g.pricingPolicies[farm.PricingPolicyID]; !ok {
+		return errors.Errorf("pricing policy %d doesn't exist", farm.PricingPolicyID)
+	}
+	for _, ip := range farm.PublicIPs {
+		if _, _, err := net.ParseCIDR(ip.IP); err != nil {
+			return errors.Wrapf(err, "invalid public ip %s of farm %d", ip.IP, farm.ID)
+		}
+	}
+	if farm.TwinID == 0 {
+		farm.TwinID = g.registerTwin(nil).id
+	}
+
+	farm.PublicIPs = append([]PublicIP(nil), farm.PublicIPs...)
+	g.farms[farm.ID] = &farm
+	return nil
+}
+
+// AddNode adds a node to an existing farm, a twin is registered for the node if it has none
+func (g *Grid) AddNode(n Node) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if n.ID == 0 {
+		return errors.New("node id is required")
+	}
+	if _, ok := g.nodes[n.ID]; ok {
+		return errors.Errorf("node %d already exists", n.ID)
+	}
+	if _, ok := g.farms[n.FarmID]; !ok {
+		return errors.Wrapf(ErrFarmNotExists, "farm %d of node %d", n.FarmID, n.ID)
+	}
+	if n.PublicIPv4 != "" {
+		if _, _, err := net.ParseCIDR(n.PublicIPv4); err != nil {
+			return errors.Wrapf(err, "invalid public ipv4 %s of node %d", n.PublicIPv4, n.ID)
+		}
+	}
+	if n.TwinID == 0 {
+		n.TwinID = g.registerTwin(nil).id
+	}
+
+	g.nodes[n.ID] = &node{
+		Node:        n,
+		created:     time.Now().Unix(),
+		deployments: make(map[uint64]*zosTypes.Deployment),
+	}
+	return nil
+}
+
+// SetNodeDown marks a node as down or up
+func (g *Grid) SetNodeDown(nodeID uint32, down bool) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	n, ok := g.nodes[nodeID]
+	if !ok {
+		return errors.Wrapf(ErrNodeNotExists, "node %d", nodeID)
+	}
+	n.Down = down
+	return nil
+}
+
+// SetTFTPrice sets the tft price in mUSD
+func (g *Grid) SetTFTPrice(price uint32) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.tftPrice = price
+}
+
+// SetPricingPolicy adds or replaces a pricing policy
+func (g *Grid) SetPricingPolicy(policy substrate.PricingPolicy) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.pricingPolicies[uint32(policy.ID)] = policy
+}
+
+// SetBalance sets the free balance of a twin in units of 1e-7 TFT
+func (g *Grid) SetBalance(twinID uint32, balance uint64) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	t, ok := g.twins[twinID]
+	if !ok {
+		return errors.Wrapf(substrate.ErrNotFound, "twin %d", twinID)
+	}
+	t.balance = balance
+	return nil
+}
+
+// RegisterTwin returns the twin of the given public key, registering it if needed
+func (g *Grid) RegisterTwin(pk []byte) uint32 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.registerTwin(pk).id
+}
+
+// RentNode creates a rent contract for a node, the node must have no active node contracts of other twins
+func (g *Grid) RentNode(twinID, nodeID uint32) (uint64, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, ok := g.twins[twinID]; !ok {
+		return 0, errors.Wrapf(substrate.ErrNotFound, "twin %d", twinID)
+	}
+	n, ok := g.nodes[nodeID]
+	if !ok {
+		return 0, errors.Wrapf(ErrNodeNotExists, "node %d", nodeID)
+	}
+	if n.rentedBy != 0 {
+		return 0, errors.Wrapf(ErrNodeAlreadyRented, "node %d", nodeID)
+	}
+	for _, c := range g.contracts {
+		if c.ContractType.IsNodeContract && uint32(c.ContractType.NodeContract.Node) == nodeID && uint32(c.TwinID) != twinID {
+			return 0, errors.Wrapf(ErrNodeHasActiveContracts, "node %d", nodeID)
+		}
+	}
+
+	c := g.newContract(twinID)
+	c.ContractType.IsRentContract = true
+	c.ContractType.RentContract.Node = types.U32(nodeID)
+	n.rentedBy = twinID
+	n.rentID = uint64(c.ContractID)
+	return n.rentID, nil
+}
+
+// Contracts returns the active contracts of a twin sorted by id
+func (g *Grid) Contracts(twinID uint32) []substrate.Contract {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var contracts []substrate.Contract
+	for _, c := range g.sortedContracts() {
+		if uint32(c.TwinID) == twinID {
+			contracts = append(contracts, c.Contract)
+		}
+	}
+	return contracts
+}
+
+// BillContract records a bill of the contract in units of 1e-7 TFT, the simulated chain never bills contracts by itself
+func (g *Grid) BillContract(contractID uint64, amount uint64, at time.Time) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	c, ok := g.contracts[contractID]
+	if !ok {
+		return errors.Wrapf(ErrContractNotExists, "contract %d", contractID)
+	}
+	c.bills = append(c.bills, bill{amount: amount, timestamp: at.Unix()})
+	return nil
+}
+
+// Deployment returns the deployment of a contract as stored on its node
+func (g *Grid) Deployment(nodeID uint32, contractID uint64) (zosTypes.Deployment, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	n, ok := g.nodes[nodeID]
+	if !ok {
+		return zosTypes.Deployment{}, errors.Wrapf(ErrNodeNotExists, "node %d", nodeID)
+	}
+	dl, ok := n.deployments[contractID]
+	if !ok {
+		return zosTypes.Deployment{}, errors.Errorf("deployment %d not found on node %d", contractID, nodeID)
+	}
+	return copyDeployment(dl), nil
+}
+
+// NodeCapacity returns the total and used capacity of a node
+func (g *Grid) NodeCapacity(nodeID uint32) (total, used zosTypes.Capacity, err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	n, ok := g.nodes[nodeID]
+	if !ok {
+		return total, used, errors.Wrapf(ErrNodeNotExists, "node %d", nodeID)
+	}
+	return n.Total, n.used, nil
+}
+
+func (g *Grid) registerTwin(pk []byte) *twin {
+	if pk != nil {
+		for _, t := range g.twins {
+			if string(t.pk) == string(pk) {
+				return t
+			}
+		}
+	}
+
+	g.lastTwinID++
+	t := &twin{id: g.lastTwinID, pk: append([]byte(nil), pk...), balance: DefaultBalance}
+	g.twins[t.id] = t
+	return t
+}
+
+func (g *Grid) newContract(twinID uint32) *contract {
+	g.lastContractID++
+	c := &contract{createdAt: time.Now().Unix()}
+	c.ContractID = types.U64(g.lastContractID)
+	c.TwinID = types.U32(twinID)
+	c.State.IsCreated = true
+	g.contracts[g.lastContractID] = c
+	return c
+}
+
+func (g *Grid) sortedContracts() []*contract {
+	contracts := make([]*contract, 0, len(g.contracts))
+	for _, c := range g.contracts {
+		contracts = append(contracts, c)
+	}
+	sort.Slice(contracts, func(i, j int) bool { return contracts[i].ContractID < contracts[j].ContractID })
+	return contracts
+}
+
+func (g *Grid) sortedNodes() []*node {
+	nodes := make([]*node, 0, len(g.nodes))
+	for _, n := range g.nodes {
+		nodes = append(nodes, n)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+	return nodes
+}
+
+func (g *Grid) nodeByTwin(twinID uint32) (*node, bool) {
+	for _, n := range g.nodes {
+		if n.TwinID == twinID {
+			return n, true
+		}
+	}
+	return nil, false
+}
+
+func (g *Grid) freeIPs(farmID uint32) int {
+	free := 0
+	for _, ip := range g.farms[farmID].PublicIPs {
+		if ip.ContractID == 0 {
+			free++
+		}
+	}
+	return free
+}
+
+func copyDeployment(dl *zosTypes.Deployment) zosTypes.Deployment {
+	cp := *dl
+	cp.Workloads = append([]zosTypes.Workload(nil), dl.Workloads...)
+	cp.SignatureRequirement.Requests = append([]zosTypes.SignatureRequest(nil), dl.SignatureRequirement.Requests...)
+	cp.SignatureRequirement.Signatures = append([]zosTypes.Signature(nil), dl.SignatureRequirement.Signatures...)
+	return cp
+}
@@ -0,0 +1,165 @@
+package simulation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
+	proxyTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+)
+
+func newIdentity(t *testing.T) substrate.Identity {
+	t.Helper()
+
+	identity, err := substrate.NewIdentityFromSr25519Phrase("//Alice")
+	require.NoError(t, err)
+	return identity
+}
+
+func TestSubstrateContracts(t *testing.T) {
+	grid := NewGrid()
+	sub := grid.Substrate()
+	identity := newIdentity(t)
+
+	twinID, err := sub.GetTwinByPubKey(identity.PublicKey())
+	require.NoError(t, err)
+
+	t.Run("node contract", func(t *testing.T) {
+		contractID, err := sub.CreateNodeContract(identity, 1, "", "hash", 1, nil)
+		require.NoError(t, err)
+
+		_, err = sub.CreateNodeContract(identity, 1, "", "hash", 0, nil)
+		assert.True(t, errors.Is(err, ErrContractIsNotUnique))
+
+		contract, err := sub.GetContract(contractID)
+		require.NoError(t, err)
+		assert.Equal(t, twinID, contract.TwinID())
+		assert.Equal(t, uint32(1), contract.PublicIPCount())
+
+		require.NoError(t, sub.CancelContract(identity, contractID))
+		_, err = sub.GetContract(contractID)
+		assert.True(t, errors.Is(err, substrate.ErrNotFound))
+	})
+
+	t.Run("public ips", func(t *testing.T) {
+		_, err := sub.CreateNodeContract(identity, 1, "", "many-ips", 6, nil)
+		assert.True(t, errors.Is(err, ErrNotEnoughPublicIPsFree))
+	})
+
+	t.Run("name contract", func(t *testing.T) {
+		contractID, err := sub.CreateNameContract(identity, "example")
+		require.NoError(t, err)
+
+		_, err = sub.CreateNameContract(identity, "example")
+		assert.True(t, errors.Is(err, ErrNameExists))
+
+		id, err := sub.GetContractIDByNameRegistration("example")
+		require.NoError(t, err)
+		assert.Equal(t, contractID, id)
+
+		require.NoError(t, sub.CancelContract(identity, contractID))
+	})
+
+	t.Run("rented node", func(t *testing.T) {
+		other := grid.RegisterTwin([]byte("other"))
+		rentID, err := grid.RentNode(other, 2)
+		require.NoError(t, err)
+		assert.NotZero(t, rentID)
+
+		_, err = sub.CreateNodeContract(identity, 2, "", "rented", 0, nil)
+		assert.True(t, errors.Is(err, ErrNodeNotAvailableToDeploy))
+	})
+
+	t.Run("batch all rolls back", func(t *testing.T) {
+		_, err := sub.BatchAllCreateContract(identity, []substrate.BatchCreateContractData{
+			{Node: 3, Hash: "first"},
+			{Node: 404, Hash: "second"},
+		})
+		assert.Error(t, err)
+		assert.Empty(t, grid.Contracts(twinID))
+	})
+}
+
+func TestRMBDeployments(t *testing.T) {
+	grid := NewGrid()
+	relay := grid.RMB()
+
+	twinID, err := grid.Substrate().GetNodeTwin(1)
+	require.NoError(t, err)
+
+	var version struct {
+		ZOS string `json:"zos"`
+	}
+	require.NoError(t, relay.Call(context.Background(), twinID, "zos.system.version", nil, &version))
+	assert.Equal(t, "simulated", version.ZOS)
+
+	err = relay.Call(context.Background(), twinID, "zos.deployment.get", map[string]uint64{"contract_id": 1}, nil)
+	assert.Error(t, err)
+
+	require.NoError(t, grid.SetNodeDown(1, true))
+	err = relay.Call(context.Background(), twinID, "zos.system.version", nil, &version)
+	assert.True(t, errors.Is(err, ErrNodeDown))
+}
+
+func TestProxyNodes(t *testing.T) {
+	grid := NewGrid()
+	proxy := grid.Proxy()
+	require.NoError(t, grid.SetNodeDown(3, true))
+
+	nodes, count, err := proxy.Nodes(context.Background(), proxyTypes.NodeFilter{Status: []string{"up"}}, proxyTypes.Limit{RetCount: true})
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.Len(t, nodes, 2)
+
+	nodes, _, err = proxy.Nodes(context.Background(), proxyTypes.NodeFilter{}, proxyTypes.Limit{Size: 1, Page: 2})
+	require.NoError(t, err)
+	require.Len(t, nodes, 1)
+	assert.Equal(t, 2, nodes[0].NodeID)
+}
+
+func TestGraphQLContracts(t *testing.T) {
+	grid := NewGrid()
+	identity := newIdentity(t)
+
+	twinID := grid.RegisterTwin(identity.PublicKey())
+	_, err := grid.Substrate().CreateNameContract(identity, "example")
+	require.NoError(t, err)
+
+	server := httptest.NewServer(grid.GraphQL())
+	defer server.Close()
+
+	query := func(q string) map[string]json.RawMessage {
+		body, err := json.Marshal(map[string]string{"query": q})
+		require.NoError(t, err)
+
+		response, err := http.Post(server.URL, "application/json", bytes.NewReader(body))
+		require.NoError(t, err)
+		defer response.Body.Close()
+
+		var result struct {
+			Data map[string]json.RawMessage `json:"data"`
+		}
+		require.NoError(t, json.NewDecoder(response.Body).Decode(&result))
+		return result.Data
+	}
+
+	data := query(fmt.Sprintf(`query { items: nameContractsConnection(where: {twinID_eq: %d, state_in: [Created]}, orderBy: twinID_ASC) { count: totalCount } }`, twinID))
+	assert.JSONEq(t, `{"count":1}`, string(data["items"]))
+
+	data = query(fmt.Sprintf(`query { nameContracts(where: {twinID_eq: %d, state_in: [Deleted]}) { contractID name } }`, twinID))
+	assert.JSONEq(t, `[]`, string(data["nameContracts"]))
+
+	data = query(fmt.Sprintf(`query { nameContracts(where: {twinID_eq: %d, state_in: [Created]}) { contractID name } }`, twinID))
+	var contracts []graphQLContract
+	require.NoError(t, json.Unmarshal(data["nameContracts"], &contracts))
+	require.Len(t, contracts, 1)
+	assert.Equal(t, "example", contracts[0].Name)
+}
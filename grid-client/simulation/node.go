@@ -0,0 +1,483 @@
+package simulation
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	client "github.com/threefoldtech/tfgrid-sdk-go/grid-client/node"
+	zosTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-client/zos"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+	"github.com/threefoldtech/zos/pkg/gridtypes/zos"
+)
+
+// workload types zos can update in place, others have to be removed then added again
+var updatableTypes = map[string]bool{
+	zosTypes.ZMountType:        true,
+	zosTypes.VolumeType:        true,
+	zosTypes.ZDBType:           true,
+	zosTypes.QuantumSafeFSType: true,
+	zosTypes.NetworkType:       true,
+	zosTypes.NetworkLightType:  true,
+}
+
+// deploy validates a new deployment against its contract and the node capacity then provisions its workloads
+func (g *Grid) deploy(n *node, dl zosTypes.Deployment) error {
+	if _, ok := n.deployments[dl.ContractID]; ok {
+		return errors.Errorf("deployment %d already exists", dl.ContractID)
+	}
+
+	c, err := g.deploymentContract(n, dl)
+	if err != nil {
+		return err
+	}
+
+	needed, err := deploymentCapacity(&dl)
+	if err != nil {
+		return err
+	}
+	if err := n.fits(zosTypes.Capacity{}, needed); err != nil {
+		return err
+	}
+
+	for i := range dl.Workloads {
+		g.provision(n, c, &dl, i)
+	}
+
+	n.used.Add(&needed)
+	n.deployments[dl.ContractID] = &dl
+	return nil
+}
+
+// update applies a new version of a deployment, only workloads with the new deployment version are provisioned again
+func (g *Grid) update(n *node, dl zosTypes.Deployment) error {
+	old, ok := n.deployments[dl.ContractID]
+	if !ok {
+		return errors.Errorf("deployment %d not found", dl.ContractID)
+	}
+	if dl.Version <= old.Version {
+		return errors.Errorf("deployment version %d must be higher than current version %d", dl.Version, old.Version)
+	}
+
+	c, err := g.deploymentContract(n, dl)
+	if err != nil {
+		return err
+	}
+
+	released, err := deploymentCapacity(old)
+	if err != nil {
+		return err
+	}
+	needed, err := deploymentCapacity(&dl)
+	if err != nil {
+		return err
+	}
+	if err := n.fits(released, needed); err != nil {
+		return err
+	}
+
+	current := make(map[string]zosTypes.Workload)
+	for _, wl := range old.Workloads {
+		current[wl.Name] = wl
+	}
+
+	// zos validates the upgrade before applying any of it
+	for _, wl := range dl.Workloads {
+		existing, ok := current[wl.Name]
+		if !ok || wl.Version != dl.Version {
+			continue
+		}
+		if existing.Type != wl.Type {
+			return errors.Errorf("cannot change workload type '%s'", wl.Name)
+		}
+		if !updatableTypes[wl.Type] {
+			return errors.Errorf("workload '%s' does not support upgrade", wl.Type)
+		}
+	}
+
+	// keep results of unchanged workloads first so updated ones don't take their public ips
+	changed := []int{}
+	for i, wl := range dl.Workloads {
+		if existing, ok := current[wl.Name]; ok && wl.Version != dl.Version {
+			dl.Workloads[i].Result = existing.Result
+			continue
+		}
+		dl.Workloads[i].Result = zosTypes.Result{}
+		changed = append(changed, i)
+	}
+	for _, i := range changed {
+		if existing, ok := current[dl.Workloads[i].Name]; ok {
+			if err := resizeError(old, &dl, existing, dl.Workloads[i]); err != nil {
+				// zos keeps the workload as is
+				dl.Workloads[i].Result = existing.Result
+				dl.Workloads[i].Result.State = zosTypes.StateUnChanged
+				dl.Workloads[i].Result.Error = err.Error()
+				continue
+			}
+		}
+		g.provision(n, c, &dl, i)
+	}
+
+	n.used = subtract(n.used, released)
+	n.used.Add(&needed)
+	n.deployments[dl.ContractID] = &dl
+	return nil
+}
+
+// resizeError mirrors the checks of zos before resizing a disk or a volume
+func resizeError(old, dl *zosTypes.Deployment, existing, wl zosTypes.Workload) error {
+	if wl.Type != zosTypes.ZMountType && wl.Type != zosTypes.VolumeType {
+		return nil
+	}
+
+	var oldSize, newSize zosTypes.ZMount
+	if err := json.Unmarshal(existing.Data, &oldSize); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(wl.Data, &newSize); err != nil {
+		return err
+	}
+
+	if newSize.Size < oldSize.Size {
+		return errors.New("not safe to shrink a disk")
+	}
+	if wl.Type == zosTypes.VolumeType || newSize.Size == oldSize.Size {
+		return nil
+	}
+
+	// removed vms are deleted before the disk is updated
+	kept := make(map[string]bool)
+	for _, w := range dl.Workloads {
+		kept[w.Name] = true
+	}
+	for _, w := range old.Workloads {
+		if !kept[w.Name] || (w.Type != zosTypes.ZMachineType && w.Type != zosTypes.ZMachineLightType) {
+			continue
+		}
+
+		var vm zosTypes.ZMachine
+		if err := json.Unmarshal(w.Data, &vm); err != nil {
+			return err
+		}
+		for _, mount := range vm.Mounts {
+			if mount.Name == wl.Name {
+				return errors.New("disk is mounted, please delete the VM first")
+			}
+		}
+	}
+
+	return nil
+}
+
+// deploymentContract returns the contract of a deployment making sure it matches the node, the twin and the hash
+func (g *Grid) deploymentContract(n *node, dl zosTypes.Deployment) (*contract, error) {
+	c, ok := g.contracts[dl.ContractID]
+	if !ok || !c.ContractType.IsNodeContract {
+		return nil, errors.Errorf("contract %d not found", dl.ContractID)
+	}
+	if uint32(c.ContractType.NodeContract.Node) != n.ID {
+		return nil, errors.Errorf("contract %d is not for node %d", dl.ContractID, n.ID)
+	}
+	if uint32(c.TwinID) != dl.TwinID {
+		return nil, errors.Errorf("contract %d is not owned by twin %d", dl.ContractID, dl.TwinID)
+	}
+
+	hash, err := dl.ChallengeHash()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to compute deployment hash")
+	}
+	if hex.EncodeToString(hash) != c.hash {
+		return nil, errors.Errorf("deployment hash doesn't match contract %d hash", dl.ContractID)
+	}
+
+	if err := dl.Valid(); err != nil {
+		return nil, errors.Wrap(err, "invalid deployment")
+	}
+	return c, nil
+}
+
+// provision sets the result of the workload at index i as zos would after deploying it
+func (g *Grid) provision(n *node, c *contract, dl *zosTypes.Deployment, i int) {
+	wl := &dl.Workloads[i]
+
+	data, err := g.workloadResult(n, c, dl, i)
+	if err != nil {
+		wl.Result = zosTypes.Result{Created: time.Now().Unix(), State: zosTypes.StateError, Error: err.Error()}
+		return
+	}
+
+	wl.Result = zosTypes.Result{Created: time.Now().Unix(), State: zosTypes.StateOk, Data: zosTypes.MustMarshal(data)}
+}
+
+func (g *Grid) workloadResult(n *node, c *contract, dl *zosTypes.Deployment, i int) (interface{}, error) {
+	wl := &dl.Workloads[i]
+	id := fmt.Sprintf("%d-%d-%s", dl.TwinID, dl.ContractID, wl.Name)
+	suffix := i + 1
+
+	switch wl.Type {
+	case zosTypes.ZMachineType:
+		var vm zosTypes.ZMachine
+		if err := json.Unmarshal(wl.Data, &vm); err != nil {
+			return nil, errors.Wrap(err, "invalid zmachine data")
+		}
+		result := zosTypes.ZMachineResult{ID: id}
+		if len(vm.Network.Interfaces) > 0 {
+			result.IP = vm.Network.Interfaces[0].IP.String()
+		}
+		if vm.Network.Planetary {
+			result.PlanetaryIP = fmt.Sprintf("300:%x:%x::%x", n.ID, dl.ContractID, suffix)
+		}
+		if vm.Network.Mycelium != nil {
+			result.MyceliumIP = fmt.Sprintf("400:%x:%x::%x", n.ID, dl.ContractID, suffix)
+		}
+		return result, nil
+
+	case zosTypes.ZMachineLightType:
+		var vm zosTypes.ZMachineLight
+		if err := json.Unmarshal(wl.Data, &vm); err != nil {
+			return nil, errors.Wrap(err, "invalid zmachine-light data")
+		}
+		result := zosTypes.ZMachineLightResult{ID: id}
+		if len(vm.Network.Interfaces) > 0 {
+			result.IP = vm.Network.Interfaces[0].IP.String()
+		}
+		if vm.Network.Mycelium != nil {
+			result.MyceliumIP = fmt.Sprintf("400:%x:%x::%x", n.ID, dl.ContractID, suffix)
+		}
+		return result, nil
+
+	case zosTypes.PublicIPType, zosTypes.PublicIPv4Type:
+		ip := zosTypes.PublicIP{V4: true}
+		if wl.Type == zosTypes.PublicIPType {
+			if err := json.Unmarshal(wl.Data, &ip); err != nil {
+				return nil, errors.Wrap(err, "invalid public ip data")
+			}
+		}
+		var result zos.PublicIPResult
+		if ip.V4 {
+			reserved, err := freeReservedIP(c, dl, wl.Name)
+			if err != nil {
+				return nil, err
+			}
+			ipNet, err := gridtypes.ParseIPNet(reserved.IP)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid reserved ip %s", reserved.IP)
+			}
+			result.IP = ipNet
+			result.Gateway = net.ParseIP(reserved.Gateway)
+		}
+		if ip.V6 {
+			ipNet, err := gridtypes.ParseIPNet(fmt.Sprintf("2a10:b600:%x:%x::%x/64", n.ID, dl.ContractID, suffix))
+			if err != nil {
+				return nil, err
+			}
+			result.IPv6 = ipNet
+		}
+		return result, nil
+
+	case zosTypes.GatewayNameProxyType:
+		if n.Domain == "" {
+			return nil, errors.Errorf("node %d doesn't support gateways", n.ID)
+		}
+		var gw struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(wl.Data, &gw); err != nil {
+			return nil, errors.Wrap(err, "invalid gateway name data")
+		}
+		return zos.GatewayProxyResult{FQDN: fmt.Sprintf("%s.%s", gw.Name, n.Domain)}, nil
+
+	case zosTypes.GatewayFQDNProxyType:
+		if n.Domain == "" {
+			return nil, errors.Errorf("node %d doesn't support gateways", n.ID)
+		}
+		return nil, nil
+
+	case zosTypes.ZDBType:
+		var zdb zosTypes.ZDB
+		if err := json.Unmarshal(wl.Data, &zdb); err != nil {
+			return nil, errors.Wrap(err, "invalid zdb data")
+		}
+		ips := []string{fmt.Sprintf("300:%x:%x::%x", n.ID, dl.ContractID, suffix), fmt.Sprintf("400:%x:%x::%x", n.ID, dl.ContractID, suffix)}
+		if zdb.Public {
+			ips = append([]string{fmt.Sprintf("2a10:b600:%x:%x::%x", n.ID, dl.ContractID, suffix)}, ips...)
+		}
+		return zosTypes.ZDBResult{Namespace: id, IPs: ips, Port: 9900}, nil
+
+	case zosTypes.QuantumSafeFSType:
+		return zosTypes.QuatumSafeFSResult{Path: "/mnt/" + id, MetricsEndpoint: fmt.Sprintf("http://[300:%x:%x::%x]:9100/metrics", n.ID, dl.ContractID, suffix)}, nil
+	}
+
+	return nil, nil
+}
+
+// freeReservedIP returns a public ip reserved by the contract and not used by other ip workloads of the deployment
+func freeReservedIP(c *contract, dl *zosTypes.Deployment, name string) (PublicIP, error) {
+	used := make(map[string]bool)
+	for _, wl := range dl.Workloads {
+		if wl.Name == name || (wl.Type != zosTypes.PublicIPType && wl.Type != zosTypes.PublicIPv4Type) || !wl.Result.State.IsOkay() {
+			continue
+		}
+		var result zos.PublicIPResult
+		if err := json.Unmarshal(wl.Result.Data, &result); err == nil && result.IP.IP != nil {
+			used[result.IP.String()] = true
+		}
+	}
+
+	for _, ip := range c.ContractType.NodeContract.PublicIPs {
+		if !used[ip.IP] {
+			return PublicIP{IP: ip.IP, Gateway: ip.Gateway, ContractID: uint64(ip.ContractID)}, nil
+		}
+	}
+	return PublicIP{}, errors.Errorf("contract %d has no free public ips", c.ContractID)
+}
+
+func deploymentCapacity(dl *zosTypes.Deployment) (zosTypes.Capacity, error) {
+	var total zosTypes.Capacity
+	for i := range dl.Workloads {
+		c, err := dl.Workloads[i].Capacity()
+		if err != nil {
+			return zosTypes.Capacity{}, errors.Wrapf(err, "failed to get capacity of workload %s", dl.Workloads[i].Name)
+		}
+		total.Add(&c)
+	}
+	return total, nil
+}
+
+// fits checks the node has enough memory and storage after releasing and reserving the given capacities,
+// cpu is allowed to be overprovisioned like in zos
+func (n *node) fits(released, needed zosTypes.Capacity) error {
+	used := subtract(n.used, released)
+
+	if used.MRU+needed.MRU > n.Total.MRU {
+		return errors.Errorf("node %d has not enough memory, needed %d bytes", n.ID, needed.MRU)
+	}
+	if used.SRU+needed.SRU > n.Total.SRU {
+		return errors.Errorf("node %d has not enough ssd storage, needed %d bytes", n.ID, needed.SRU)
+	}
+	if used.HRU+needed.HRU > n.Total.HRU {
+		return errors.Errorf("node %d has not enough hdd storage, needed %d bytes", n.ID, needed.HRU)
+	}
+	return nil
+}
+
+func subtract(c, o zosTypes.Capacity) zosTypes.Capacity {
+	sub := func(a, b uint64) uint64 {
+		if b > a {
+			return 0
+		}
+		return a - b
+	}
+
+	return zosTypes.Capacity{
+		CRU:   sub(c.CRU, o.CRU),
+		SRU:   sub(c.SRU, o.SRU),
+		HRU:   sub(c.HRU, o.HRU),
+		MRU:   sub(c.MRU, o.MRU),
+		IPV4U: sub(c.IPV4U, o.IPV4U),
+	}
+}
+
+func (n *node) removeDeployment(contractID uint64) {
+	dl, ok := n.deployments[contractID]
+	if !ok {
+		return
+	}
+
+	if released, err := deploymentCapacity(dl); err == nil {
+		n.used = subtract(n.used, released)
+	}
+	delete(n.deployments, contractID)
+}
+
+func (n *node) sortedDeployments() []*zosTypes.Deployment {
+	dls := make([]*zosTypes.Deployment, 0, len(n.deployments))
+	for _, dl := range n.deployments {
+		dls = append(dls, dl)
+	}
+	sort.Slice(dls, func(i, j int) bool { return dls[i].ContractID < dls[j].ContractID })
+	return dls
+}
+
+func (n *node) privateIPs(network string) []string {
+	ips := []string{}
+	for _, dl := range n.sortedDeployments() {
+		for _, wl := range dl.Workloads {
+			var interfaces []zosTypes.MachineInterface
+			switch wl.Type {
+			case zosTypes.ZMachineType:
+				var vm zosTypes.ZMachine
+				if err := json.Unmarshal(wl.Data, &vm); err != nil {
+					continue
+				}
+				interfaces = vm.Network.Interfaces
+			case zosTypes.ZMachineLightType:
+				var vm zosTypes.ZMachineLight
+				if err := json.Unmarshal(wl.Data, &vm); err != nil {
+					continue
+				}
+				interfaces = vm.Network.Interfaces
+			}
+			for _, iface := range interfaces {
+				if iface.Network == network {
+					ips = append(ips, iface.IP.String())
+				}
+			}
+		}
+	}
+	return ips
+}
+
+func (n *node) wgPorts() []uint16 {
+	ports := []uint16{}
+	for _, dl := range n.sortedDeployments() {
+		for _, wl := range dl.Workloads {
+			if wl.Type != zosTypes.NetworkType {
+				continue
+			}
+			var network zosTypes.Network
+			if err := json.Unmarshal(wl.Data, &network); err == nil && network.WGListenPort != 0 {
+				ports = append(ports, network.WGListenPort)
+			}
+		}
+	}
+	return ports
+}
+
+func (n *node) publicIPs() []string {
+	ips := []string{}
+	for _, dl := range n.sortedDeployments() {
+		for _, wl := range dl.Workloads {
+			if (wl.Type != zosTypes.PublicIPType && wl.Type != zosTypes.PublicIPv4Type) || !wl.Result.State.IsOkay() {
+				continue
+			}
+			var result zos.PublicIPResult
+			if err := json.Unmarshal(wl.Result.Data, &result); err == nil && result.IP.IP != nil {
+				ips = append(ips, result.IP.String())
+			}
+		}
+	}
+	return ips
+}
+
+func (n *node) publicConfig() (client.PublicConfig, error) {
+	if n.PublicIPv4 == "" {
+		return client.PublicConfig{}, errors.Errorf("node %d has no public config", n.ID)
+	}
+
+	ipv4, err := gridtypes.ParseIPNet(n.PublicIPv4)
+	if err != nil {
+		return client.PublicConfig{}, errors.Wrapf(err, "invalid public ipv4 of node %d", n.ID)
+	}
+
+	return client.PublicConfig{
+		Type:   "macvlan",
+		IPv4:   ipv4,
+		GW4:    net.ParseIP(n.Gateway4),
+		Domain: n.Domain,
+	}, nil
+}
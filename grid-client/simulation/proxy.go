@@ -0,0 +1,548 @@
+package simulation
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	proxy "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/client"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+)
+
+const (
+	statusUp   = "up"
+	statusDown = "down"
+)
+
+// Proxy is a simulated grid proxy listing the grid farms, nodes, twins and contracts.
+// Results are sorted by id, filters with no simulated counterpart (prices, regions, gpus details) are ignored.
+type Proxy struct {
+	grid *Grid
+}
+
+var _ proxy.Client = (*Proxy)(nil)
+
+// Proxy returns the simulated grid proxy of the grid
+func (g *Grid) Proxy() *Proxy {
+	return &Proxy{grid: g}
+}
+
+// Ping always succeeds for the simulated proxy
+func (p *Proxy) Ping() error {
+	return nil
+}
+
+// Nodes returns the nodes matching the filter
+func (p *Proxy) Nodes(ctx context.Context, filter types.NodeFilter, limit types.Limit) ([]types.Node, int, error) {
+	p.grid.mu.Lock()
+	defer p.grid.mu.Unlock()
+
+	nodes := []types.Node{}
+	for _, n := range p.grid.sortedNodes() {
+		if p.grid.nodeMatches(n, filter) {
+			nodes = append(nodes, p.grid.proxyNode(n))
+		}
+	}
+	return paginate(nodes, limit), len(nodes), nil
+}
+
+// Node returns a node by its id
+func (p *Proxy) Node(ctx context.Context, nodeID uint32) (types.NodeWithNestedCapacity, error) {
+	p.grid.mu.Lock()
+	defer p.grid.mu.Unlock()
+
+	n, ok := p.grid.nodes[nodeID]
+	if !ok {
+		return types.NodeWithNestedCapacity{}, errors.Errorf("node %d not found", nodeID)
+	}
+
+	node := p.grid.proxyNode(n)
+	return types.NodeWithNestedCapacity{
+		ID:                node.ID,
+		NodeID:            node.NodeID,
+		FarmID:            node.FarmID,
+		FarmName:          node.FarmName,
+		TwinID:            node.TwinID,
+		Country:           node.Country,
+		GridVersion:       node.GridVersion,
+		City:              node.City,
+		Uptime:            node.Uptime,
+		Created:           node.Created,
+		FarmingPolicyID:   node.FarmingPolicyID,
+		UpdatedAt:         node.UpdatedAt,
+		Capacity:          types.CapacityResult{Total: node.TotalResources, Used: node.UsedResources},
+		Location:          node.Location,
+		PublicConfig:      node.PublicConfig,
+		Status:            node.Status,
+		CertificationType: node.CertificationType,
+		Dedicated:         node.Dedicated,
+		InDedicatedFarm:   node.InDedicatedFarm,
+		RentContractID:    node.RentContractID,
+		RentedByTwinID:    node.RentedByTwinID,
+		Rented:            node.Rented,
+		Rentable:          node.Rentable,
+		ExtraFee:          node.ExtraFee,
+		Healthy:           node.Healthy,
+		FarmFreeIps:       node.FarmFreeIps,
+		Features:          node.Features,
+	}, nil
+}
+
+// NodeStatus returns the status of a node
+func (p *Proxy) NodeStatus(ctx context.Context, nodeID uint32) (types.NodeStatus, error) {
+	p.grid.mu.Lock()
+	defer p.grid.mu.Unlock()
+
+	n, ok := p.grid.nodes[nodeID]
+	if !ok {
+		return types.NodeStatus{}, errors.Errorf("node %d not found", nodeID)
+	}
+	return types.NodeStatus{Status: nodeStatus(n)}, nil
+}
+
+// Farms returns the farms matching the filter
+func (p *Proxy) Farms(ctx context.Context, filter types.FarmFilter, limit types.Limit) ([]types.Farm, int, error) {
+	p.grid.mu.Lock()
+	defer p.grid.mu.Unlock()
+
+	farms := []types.Farm{}
+	for _, farm := range p.grid.sortedFarms() {
+		if p.grid.farmMatches(farm, filter) {
+			farms = append(farms, p.grid.proxyFarm(farm))
+		}
+	}
+	return paginate(farms, limit), len(farms), nil
+}
+
+// PublicIps returns the farms public ips matching the filter
+func (p *Proxy) PublicIps(ctx context.Context, filter types.PublicIpFilter, limit types.Limit) ([]types.PublicIP, uint, error) {
+	p.grid.mu.Lock()
+	defer p.grid.mu.Unlock()
+
+	ips := []types.PublicIP{}
+	for _, farm := range p.grid.sortedFarms() {
+		if len(filter.FarmIDs) != 0 && !slices.Contains(filter.FarmIDs, uint64(farm.ID)) {
+			continue
+		}
+		for _, ip := range proxyIPs(farm) {
+			if (filter.Free != nil && *filter.Free != (ip.ContractID == 0)) ||
+				(filter.Ip != nil && *filter.Ip != ip.IP) ||
+				(filter.Gateway != nil && *filter.Gateway != ip.Gateway) {
+				continue
+			}
+			ips = append(ips, ip)
+		}
+	}
+	return paginate(ips, limit), uint(len(ips)), nil
+}
+
+// Twins returns the twins matching the filter
+func (p *Proxy) Twins(ctx context.Context, filter types.TwinFilter, limit types.Limit) ([]types.Twin, int, error) {
+	p.grid.mu.Lock()
+	defer p.grid.mu.Unlock()
+
+	twins := []types.Twin{}
+	for id := uint32(1); id <= p.grid.lastTwinID; id++ {
+		t, ok := p.grid.twins[id]
+		if !ok {
+			continue
+		}
+		twin := types.Twin{TwinID: uint(t.id), PublicKey: hex.EncodeToString(t.pk)}
+		if (filter.TwinID != nil && *filter.TwinID != uint64(twin.TwinID)) ||
+			(filter.PublicKey != nil && *filter.PublicKey != twin.PublicKey) {
+			continue
+		}
+		twins = append(twins, twin)
+	}
+	return paginate(twins, limit), len(twins), nil
+}
+
+// Contracts returns the contracts matching the filter, only active contracts exist in the simulated ledger
+func (p *Proxy) Contracts(ctx context.Context, filter types.ContractFilter, limit types.Limit) ([]types.Contract, int, error) {
+	p.grid.mu.Lock()
+	defer p.grid.mu.Unlock()
+
+	contracts := []types.Contract{}
+	for _, c := range p.grid.sortedContracts() {
+		contract := p.grid.proxyContract(c)
+		if p.grid.contractMatches(contract, filter) {
+			contracts = append(contracts, contract)
+		}
+	}
+	return paginate(contracts, limit), len(contracts), nil
+}
+
+// Contract returns a contract by its id
+func (p *Proxy) Contract(ctx context.Context, contractID uint32) (types.Contract, error) {
+	p.grid.mu.Lock()
+	defer p.grid.mu.Unlock()
+
+	c, ok := p.grid.contracts[uint64(contractID)]
+	if !ok {
+		return types.Contract{}, errors.Errorf("contract %d not found", contractID)
+	}
+	return p.grid.proxyContract(c), nil
+}
+
+// ContractBills returns the recorded bills of a contract, newest first
+func (p *Proxy) ContractBills(ctx context.Context, contractID uint32, limit types.Limit) ([]types.ContractBilling, uint, error) {
+	p.grid.mu.Lock()
+	defer p.grid.mu.Unlock()
+
+	bills := []types.ContractBilling{}
+	c, ok := p.grid.contracts[uint64(contractID)]
+	if !ok {
+		return bills, 0, nil
+	}
+	for _, b := range c.bills {
+		bills = append(bills, types.ContractBilling{
+			ContractId:   uint64(contractID),
+			AmountBilled: b.amount,
+			Timestamp:    uint64(b.timestamp),
+		})
+	}
+	sort.SliceStable(bills, func(i, j int) bool { return bills[i].Timestamp > bills[j].Timestamp })
+
+	return paginate(bills, limit), uint(len(bills)), nil
+}
+
+// Stats returns the grid statistics of nodes with the given statuses
+func (p *Proxy) Stats(ctx context.Context, filter types.StatsFilter) (types.Stats, error) {
+	p.grid.mu.Lock()
+	defer p.grid.mu.Unlock()
+
+	stats := types.Stats{
+		Farms:             int64(len(p.grid.farms)),
+		Twins:             int64(len(p.grid.twins)),
+		Contracts:         int64(len(p.grid.contracts)),
+		NodesDistribution: map[string]int64{},
+	}
+
+	countries := map[string]bool{}
+	for _, n := range p.grid.sortedNodes() {
+		if len(filter.Status) != 0 && !slices.Contains(filter.Status, nodeStatus(n)) {
+			continue
+		}
+		stats.Nodes++
+		stats.TotalCRU += int64(n.Total.CRU)
+		stats.TotalMRU += int64(n.Total.MRU)
+		stats.TotalSRU += int64(n.Total.SRU)
+		stats.TotalHRU += int64(n.Total.HRU)
+		stats.NodesDistribution[n.Country]++
+		countries[n.Country] = true
+		if n.PublicIPv4 != "" {
+			stats.AccessNodes++
+		}
+		if n.Domain != "" {
+			stats.Gateways++
+		}
+		if n.Dedicated {
+			stats.DedicatedNodes++
+		}
+		for _, dl := range n.deployments {
+			stats.WorkloadsNumber += uint32(len(dl.Workloads))
+		}
+	}
+	stats.Countries = int64(len(countries))
+
+	for _, farm := range p.grid.farms {
+		stats.PublicIPs += int64(len(farm.PublicIPs))
+	}
+	return stats, nil
+}
+
+func (g *Grid) proxyNode(n *node) types.Node {
+	farm := g.farms[n.FarmID]
+
+	certification := "Diy"
+	if n.Certified {
+		certification = "Certified"
+	}
+
+	publicConfig := types.PublicConfig{Domain: n.Domain}
+	if n.PublicIPv4 != "" {
+		publicConfig.Ipv4 = n.PublicIPv4
+		publicConfig.Gw4 = n.Gateway4
+	}
+
+	now := time.Now().Unix()
+	return types.Node{
+		ID:              fmt.Sprintf("node-%d", n.ID),
+		NodeID:          int(n.ID),
+		FarmID:          int(n.FarmID),
+		FarmName:        farm.Name,
+		TwinID:          int(n.TwinID),
+		Country:         n.Country,
+		City:            n.City,
+		GridVersion:     3,
+		Uptime:          now - n.created,
+		Created:         n.created,
+		UpdatedAt:       now,
+		FarmingPolicyID: 1,
+		TotalResources: types.Capacity{
+			CRU: n.Total.CRU,
+			SRU: gridtypes.Unit(n.Total.SRU),
+			HRU: gridtypes.Unit(n.Total.HRU),
+			MRU: gridtypes.Unit(n.Total.MRU),
+		},
+		UsedResources: types.Capacity{
+			CRU: n.used.CRU,
+			SRU: gridtypes.Unit(n.used.SRU),
+			HRU: gridtypes.Unit(n.used.HRU),
+			MRU: gridtypes.Unit(n.used.MRU),
+		},
+		Location:          types.Location{Country: n.Country, City: n.City},
+		PublicConfig:      publicConfig,
+		Status:            nodeStatus(n),
+		CertificationType: certification,
+		Dedicated:         n.Dedicated,
+		InDedicatedFarm:   farm.Dedicated,
+		RentContractID:    uint(n.rentID),
+		RentedByTwinID:    uint(n.rentedBy),
+		Rented:            n.rentedBy != 0,
+		Rentable:          n.rentedBy == 0 && !g.hasNodeContracts(n.ID),
+		ExtraFee:          n.ExtraFee,
+		Healthy:           !n.Down,
+		FarmFreeIps:       uint(g.freeIPs(farm.ID)),
+		Features:          nodeFeatures,
+	}
+}
+
+func (g *Grid) nodeMatches(n *node, f types.NodeFilter) bool {
+	node := g.proxyNode(n)
+	farm := g.farms[n.FarmID]
+	free := subtract(n.Total, n.used)
+	dedicated := n.Dedicated || farm.Dedicated
+
+	checks := []bool{
+		len(f.Status) == 0 || slices.Contains(f.Status, node.Status),
+		f.FreeMRU == nil || free.MRU >= *f.FreeMRU,
+		f.FreeHRU == nil || free.HRU >= *f.FreeHRU,
+		f.FreeSRU == nil || free.SRU >= *f.FreeSRU,
+		f.TotalMRU == nil || n.Total.MRU >= *f.TotalMRU,
+		f.TotalHRU == nil || n.Total.HRU >= *f.TotalHRU,
+		f.TotalSRU == nil || n.Total.SRU >= *f.TotalSRU,
+		f.TotalCRU == nil || n.Total.CRU >= *f.TotalCRU,
+		f.Country == nil || strings.EqualFold(*f.Country, n.Country),
+		f.CountryContains == nil || containsFold(n.Country, *f.CountryContains),
+		f.City == nil || strings.EqualFold(*f.City, n.City),
+		f.CityContains == nil || containsFold(n.City, *f.CityContains),
+		f.FarmName == nil || strings.EqualFold(*f.FarmName, farm.Name),
+		f.FarmNameContains == nil || containsFold(farm.Name, *f.FarmNameContains),
+		len(f.FarmIDs) == 0 || slices.Contains(f.FarmIDs, uint64(n.FarmID)),
+		f.FreeIPs == nil || uint64(g.freeIPs(farm.ID)) >= *f.FreeIPs,
+		f.IPv4 == nil || *f.IPv4 == (n.PublicIPv4 != ""),
+		f.IPv6 == nil || !*f.IPv6,
+		f.HasIpv6 == nil || !*f.HasIpv6,
+		f.Domain == nil || *f.Domain == (n.Domain != ""),
+		f.Dedicated == nil || *f.Dedicated == n.Dedicated,
+		f.InDedicatedFarm == nil || *f.InDedicatedFarm == farm.Dedicated,
+		f.Rentable == nil || *f.Rentable == node.Rentable,
+		f.Rented == nil || *f.Rented == node.Rented,
+		f.RentedBy == nil || uint64(n.rentedBy) == *f.RentedBy,
+		f.RentableOrRentedBy == nil || node.Rentable || uint64(n.rentedBy) == *f.RentableOrRentedBy,
+		f.AvailableFor == nil || (n.rentedBy == 0 && !dedicated) || uint64(n.rentedBy) == *f.AvailableFor,
+		f.OwnedBy == nil || uint64(farm.TwinID) == *f.OwnedBy,
+		f.NodeID == nil || uint64(n.ID) == *f.NodeID,
+		len(f.NodeIDs) == 0 || slices.Contains(f.NodeIDs, uint64(n.ID)),
+		f.TwinID == nil || uint64(n.TwinID) == *f.TwinID,
+		f.CertificationType == nil || strings.EqualFold(*f.CertificationType, node.CertificationType),
+		f.HasGPU == nil || !*f.HasGPU,
+		f.GpuAvailable == nil || !*f.GpuAvailable,
+		f.Healthy == nil || *f.Healthy == node.Healthy,
+		!slices.Contains(f.Excluded, uint64(n.ID)),
+	}
+	for _, feature := range f.Features {
+		checks = append(checks, slices.Contains(nodeFeatures, feature))
+	}
+
+	return !slices.Contains(checks, false)
+}
+
+func (g *Grid) proxyFarm(farm *Farm) types.Farm {
+	certification := "NotCertified"
+	if farm.Certified {
+		certification = "Gold"
+	}
+
+	return types.Farm{
+		Name:              farm.Name,
+		FarmID:            int(farm.ID),
+		TwinID:            int(farm.TwinID),
+		PricingPolicyID:   int(farm.PricingPolicyID),
+		CertificationType: certification,
+		Dedicated:         farm.Dedicated,
+		PublicIps:         proxyIPs(farm),
+	}
+}
+
+func (g *Grid) farmMatches(farm *Farm, f types.FarmFilter) bool {
+	checks := []bool{
+		f.FarmID == nil || uint64(farm.ID) == *f.FarmID,
+		f.TwinID == nil || uint64(farm.TwinID) == *f.TwinID,
+		f.Name == nil || strings.EqualFold(*f.Name, farm.Name),
+		f.NameContains == nil || containsFold(farm.Name, *f.NameContains),
+		f.PricingPolicyID == nil || uint64(farm.PricingPolicyID) == *f.PricingPolicyID,
+		f.Dedicated == nil || *f.Dedicated == farm.Dedicated,
+		f.FreeIPs == nil || uint64(g.freeIPs(farm.ID)) >= *f.FreeIPs,
+		f.TotalIPs == nil || uint64(len(farm.PublicIPs)) >= *f.TotalIPs,
+	}
+	if slices.Contains(checks, false) {
+		return false
+	}
+
+	if !f.IsNodeFilterRequested() {
+		return true
+	}
+
+	// the farm must have at least one node matching the node filters
+	nodeFilter := types.NodeFilter{
+		FarmIDs:      []uint64{uint64(farm.ID)},
+		FreeMRU:      f.NodeFreeMRU,
+		FreeHRU:      f.NodeFreeHRU,
+		FreeSRU:      f.NodeFreeSRU,
+		TotalCRU:     f.NodeTotalCRU,
+		Status:       f.NodeStatus,
+		RentedBy:     f.NodeRentedBy,
+		AvailableFor: f.NodeAvailableFor,
+		HasGPU:       f.NodeHasGPU,
+		HasIpv6:      f.NodeHasIpv6,
+		Features:     f.NodeFeatures,
+		Country:      f.Country,
+	}
+	for _, n := range g.sortedNodes() {
+		if g.nodeMatches(n, nodeFilter) && (f.NodeCertified == nil || *f.NodeCertified == n.Certified) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Grid) proxyContract(c *contract) types.Contract {
+	contract := types.Contract{
+		ContractID: uint(c.ContractID),
+		TwinID:     uint(c.TwinID),
+		State:      "Created",
+		CreatedAt:  uint(c.createdAt),
+	}
+
+	switch {
+	case c.ContractType.IsNodeContract:
+		n := g.nodes[uint32(c.ContractType.NodeContract.Node)]
+		contract.Type = "node"
+		contract.Details = types.NodeContractDetails{
+			NodeID:            uint(n.ID),
+			DeploymentData:    c.ContractType.NodeContract.DeploymentData,
+			DeploymentHash:    c.hash,
+			NumberOfPublicIps: uint(c.ContractType.NodeContract.PublicIPsCount),
+			FarmName:          g.farms[n.FarmID].Name,
+			FarmId:            uint64(n.FarmID),
+		}
+	case c.ContractType.IsNameContract:
+		contract.Type = "name"
+		contract.Details = types.NameContractDetails{Name: c.ContractType.NameContract.Name}
+	case c.ContractType.IsRentContract:
+		n := g.nodes[uint32(c.ContractType.RentContract.Node)]
+		contract.Type = "rent"
+		contract.Details = types.RentContractDetails{
+			NodeID:   uint(n.ID),
+			FarmName: g.farms[n.FarmID].Name,
+			FarmId:   uint64(n.FarmID),
+		}
+	}
+
+	return contract
+}
+
+func (g *Grid) contractMatches(c types.Contract, f types.ContractFilter) bool {
+	node, _ := c.Details.(types.NodeContractDetails)
+	name, _ := c.Details.(types.NameContractDetails)
+	rent, _ := c.Details.(types.RentContractDetails)
+
+	nodeID, farmID := node.NodeID, node.FarmId
+	if c.Type == "rent" {
+		nodeID, farmID = rent.NodeID, rent.FarmId
+	}
+
+	checks := []bool{
+		f.ContractID == nil || uint64(c.ContractID) == *f.ContractID,
+		f.TwinID == nil || uint64(c.TwinID) == *f.TwinID,
+		f.NodeID == nil || (c.Type != "name" && uint64(nodeID) == *f.NodeID),
+		f.Type == nil || *f.Type == c.Type,
+		len(f.State) == 0 || slices.ContainsFunc(f.State, func(s string) bool { return strings.EqualFold(s, c.State) }),
+		f.Name == nil || (c.Type == "name" && name.Name == *f.Name),
+		f.NumberOfPublicIps == nil || (c.Type == "node" && uint64(node.NumberOfPublicIps) >= *f.NumberOfPublicIps),
+		f.DeploymentData == nil || (c.Type == "node" && node.DeploymentData == *f.DeploymentData),
+		f.DeploymentHash == nil || (c.Type == "node" && node.DeploymentHash == *f.DeploymentHash),
+		f.FarmName == nil || (c.Type != "name" && (node.FarmName == *f.FarmName || rent.FarmName == *f.FarmName)),
+		f.FarmId == nil || (c.Type != "name" && farmID == *f.FarmId),
+	}
+	return !slices.Contains(checks, false)
+}
+
+func (g *Grid) sortedFarms() []*Farm {
+	farms := make([]*Farm, 0, len(g.farms))
+	for _, farm := range g.farms {
+		farms = append(farms, farm)
+	}
+	sort.Slice(farms, func(i, j int) bool { return farms[i].ID < farms[j].ID })
+	return farms
+}
+
+func (g *Grid) hasNodeContracts(nodeID uint32) bool {
+	for _, c := range g.contracts {
+		if c.ContractType.IsNodeContract && uint32(c.ContractType.NodeContract.Node) == nodeID {
+			return true
+		}
+	}
+	return false
+}
+
+func proxyIPs(farm *Farm) []types.PublicIP {
+	ips := make([]types.PublicIP, 0, len(farm.PublicIPs))
+	for i, ip := range farm.PublicIPs {
+		ips = append(ips, types.PublicIP{
+			ID:         fmt.Sprintf("farm-%d-ip-%d", farm.ID, i),
+			IP:         ip.IP,
+			Gateway:    ip.Gateway,
+			ContractID: ip.ContractID,
+			FarmID:     uint64(farm.ID),
+		})
+	}
+	return ips
+}
+
+func nodeStatus(n *node) string {
+	if n.Down {
+		return statusDown
+	}
+	return statusUp
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+func paginate[T any](items []T, limit types.Limit) []T {
+	if limit.Size == 0 {
+		return items
+	}
+
+	page := limit.Page
+	if page == 0 {
+		page = 1
+	}
+
+	start := (page - 1) * limit.Size
+	if start >= uint64(len(items)) {
+		return []T{}
+	}
+	end := min(start+limit.Size, uint64(len(items)))
+	return items[start:end]
+}
@@ -0,0 +1,200 @@
+package simulation
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+
+	"github.com/pkg/errors"
+	client "github.com/threefoldtech/tfgrid-sdk-go/grid-client/node"
+	zosTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-client/zos"
+	"github.com/threefoldtech/tfgrid-sdk-go/rmb-sdk-go"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+	"github.com/threefoldtech/zos/pkg/gridtypes/zos"
+)
+
+// ErrNodeDown is returned for calls to nodes marked as down
+var ErrNodeDown = errors.New("node is not reachable")
+
+// features reported by simulated nodes
+var nodeFeatures = []string{
+	zosTypes.ZMountType,
+	zosTypes.NetworkType,
+	zosTypes.ZDBType,
+	zosTypes.ZMachineType,
+	zosTypes.VolumeType,
+	zosTypes.PublicIPv4Type,
+	zosTypes.PublicIPType,
+	zosTypes.GatewayNameProxyType,
+	zosTypes.GatewayFQDNProxyType,
+	zosTypes.QuantumSafeFSType,
+	zosTypes.ZLogsType,
+	"mycelium",
+	"wireguard",
+	"yggdrasil",
+}
+
+// RMB is a simulated relay answering calls on behalf of the simulated nodes
+type RMB struct {
+	grid *Grid
+}
+
+var _ rmb.Client = (*RMB)(nil)
+
+// RMB returns the simulated relay of the grid
+func (g *Grid) RMB() *RMB {
+	return &RMB{grid: g}
+}
+
+type contractArgs struct {
+	ContractID uint64 `json:"contract_id"`
+}
+
+type networkArgs struct {
+	NetworkName string `json:"network_name"`
+}
+
+// Call executes a node command on the node owning the given twin
+func (r *RMB) Call(ctx context.Context, twin uint32, fn string, data interface{}, result interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode request data")
+	}
+
+	r.grid.mu.Lock()
+	defer r.grid.mu.Unlock()
+
+	n, ok := r.grid.nodeByTwin(twin)
+	if !ok {
+		return errors.Errorf("twin %d is not a node twin", twin)
+	}
+	if n.Down {
+		return errors.Wrapf(ErrNodeDown, "node %d", n.ID)
+	}
+
+	out, err := r.grid.handle(n, fn, payload)
+	if err != nil {
+		return err
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	response, err := json.Marshal(out)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode response")
+	}
+	return json.Unmarshal(response, result)
+}
+
+func (g *Grid) handle(n *node, fn string, payload []byte) (interface{}, error) {
+	switch fn {
+	case "zos.system.version":
+		return client.Version{ZOS: "simulated", ZInit: "simulated"}, nil
+
+	case "zos.system.node_features_get":
+		return nodeFeatures, nil
+
+	case "zos.deployment.deploy":
+		var dl zosTypes.Deployment
+		if err := json.Unmarshal(payload, &dl); err != nil {
+			return nil, errors.Wrap(err, "invalid deployment")
+		}
+		return nil, g.deploy(n, dl)
+
+	case "zos.deployment.update":
+		var dl zosTypes.Deployment
+		if err := json.Unmarshal(payload, &dl); err != nil {
+			return nil, errors.Wrap(err, "invalid deployment")
+		}
+		return nil, g.update(n, dl)
+
+	case "zos.deployment.get", "zos.deployment.changes", "zos.deployment.delete":
+		var args contractArgs
+		if err := json.Unmarshal(payload, &args); err != nil {
+			return nil, errors.Wrap(err, "invalid arguments")
+		}
+		dl, ok := n.deployments[args.ContractID]
+		if !ok {
+			return nil, errors.Errorf("deployment %d not found", args.ContractID)
+		}
+		switch fn {
+		case "zos.deployment.changes":
+			return dl.Workloads, nil
+		case "zos.deployment.delete":
+			n.removeDeployment(args.ContractID)
+			return nil, nil
+		}
+		return dl, nil
+
+	case "zos.deployment.list":
+		dls := make([]zosTypes.Deployment, 0, len(n.deployments))
+		for _, dl := range n.sortedDeployments() {
+			dls = append(dls, *dl)
+		}
+		return dls, nil
+
+	case "zos.statistics.get":
+		workloads := 0
+		for _, dl := range n.deployments {
+			workloads += len(dl.Workloads)
+		}
+		return map[string]interface{}{
+			"total":  toGridCapacity(n.Total),
+			"used":   toGridCapacity(n.used),
+			"system": gridtypes.Capacity{},
+			"users": map[string]int{
+				"deployments": len(n.deployments),
+				"workloads":   workloads,
+			},
+		}, nil
+
+	case "zos.network.list_private_ips":
+		var args networkArgs
+		if err := json.Unmarshal(payload, &args); err != nil {
+			return nil, errors.Wrap(err, "invalid arguments")
+		}
+		return n.privateIPs(args.NetworkName), nil
+
+	case "zos.network.list_wg_ports":
+		return n.wgPorts(), nil
+
+	case "zos.network.interfaces":
+		return map[string][]net.IP{"zos": {}}, nil
+
+	case "zos.network.list_public_ips":
+		return n.publicIPs(), nil
+
+	case "zos.network.public_config_get":
+		return n.publicConfig()
+
+	case "zos.network.has_ipv6":
+		return false, nil
+
+	case "zos.storage.pools":
+		return []client.PoolMetrics{
+			{Name: "ssd", Type: zos.SSDDevice, Size: gridtypes.Unit(n.Total.SRU), Used: gridtypes.Unit(n.used.SRU)},
+			{Name: "hdd", Type: zos.HDDDevice, Size: gridtypes.Unit(n.Total.HRU), Used: gridtypes.Unit(n.used.HRU)},
+		}, nil
+
+	case "zos.gpu.list":
+		return []client.GPU{}, nil
+	}
+
+	return nil, errors.Errorf("command %s is not supported by simulated nodes", fn)
+}
+
+func toGridCapacity(c zosTypes.Capacity) gridtypes.Capacity {
+	return gridtypes.Capacity{
+		CRU:   c.CRU,
+		SRU:   gridtypes.Unit(c.SRU),
+		HRU:   gridtypes.Unit(c.HRU),
+		MRU:   gridtypes.Unit(c.MRU),
+		IPV4U: c.IPV4U,
+	}
+}
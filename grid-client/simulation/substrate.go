@@ -0,0 +1,398 @@
+package simulation
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/pkg/errors"
+	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/subi"
+)
+
+// Substrate is a simulated tfchain implementing subi.SubstrateExt on top of the grid contracts ledger
+type Substrate struct {
+	grid *Grid
+}
+
+var _ subi.SubstrateExt = (*Substrate)(nil)
+
+// Substrate returns the simulated chain of the grid
+func (g *Grid) Substrate() *Substrate {
+	return &Substrate{grid: g}
+}
+
+// Close is a no-op for the simulated chain
+func (s *Substrate) Close() {}
+
+// GetTwinByPubKey returns the twin of a public key, twins are registered on first use
+func (s *Substrate) GetTwinByPubKey(pk []byte) (uint32, error) {
+	return s.grid.RegisterTwin(pk), nil
+}
+
+// GetTwinPK returns twin's public key
+func (s *Substrate) GetTwinPK(twinID uint32) ([]byte, error) {
+	s.grid.mu.Lock()
+	defer s.grid.mu.Unlock()
+
+	t, ok := s.grid.twins[twinID]
+	if !ok {
+		return nil, substrate.ErrNotFound
+	}
+	return append([]byte(nil), t.pk...), nil
+}
+
+// GetNodeTwin returns the twin ID of a node
+func (s *Substrate) GetNodeTwin(nodeID uint32) (uint32, error) {
+	s.grid.mu.Lock()
+	defer s.grid.mu.Unlock()
+
+	n, ok := s.grid.nodes[nodeID]
+	if !ok {
+		return 0, substrate.ErrNotFound
+	}
+	return n.TwinID, nil
+}
+
+// GetAccount returns the account of an identity
+func (s *Substrate) GetAccount(identity substrate.Identity) (substrate.AccountInfo, error) {
+	balance, err := s.GetBalance(identity)
+	if err != nil {
+		return substrate.AccountInfo{}, err
+	}
+	return substrate.AccountInfo{Data: balance}, nil
+}
+
+// GetBalance returns the balance of an identity
+func (s *Substrate) GetBalance(identity substrate.Identity) (substrate.Balance, error) {
+	s.grid.mu.Lock()
+	defer s.grid.mu.Unlock()
+
+	t := s.grid.registerTwin(identity.PublicKey())
+	return substrate.Balance{Free: types.NewU128(*new(big.Int).SetUint64(t.balance))}, nil
+}
+
+// GetTFTPrice returns the tft price in mUSD
+func (s *Substrate) GetTFTPrice() (types.U32, error) {
+	s.grid.mu.Lock()
+	defer s.grid.mu.Unlock()
+
+	return types.U32(s.grid.tftPrice), nil
+}
+
+// GetPricingPolicy returns a pricing policy
+func (s *Substrate) GetPricingPolicy(policyID uint32) (substrate.PricingPolicy, error) {
+	s.grid.mu.Lock()
+	defer s.grid.mu.Unlock()
+
+	policy, ok := s.grid.pricingPolicies[policyID]
+	if !ok {
+		return substrate.PricingPolicy{}, substrate.ErrNotFound
+	}
+	return policy, nil
+}
+
+// GetContract returns a contract given its ID
+func (s *Substrate) GetContract(contractID uint64) (subi.Contract, error) {
+	s.grid.mu.Lock()
+	defer s.grid.mu.Unlock()
+
+	c, ok := s.grid.contracts[contractID]
+	if !ok {
+		return subi.Contract{}, substrate.ErrNotFound
+	}
+	cp := c.Contract
+	cp.ContractType.NodeContract.PublicIPs = append([]substrate.PublicIP(nil), c.ContractType.NodeContract.PublicIPs...)
+	return subi.Contract{Contract: &cp}, nil
+}
+
+// GetContractIDByNameRegistration returns the name contract ID of a name
+func (s *Substrate) GetContractIDByNameRegistration(name string) (uint64, error) {
+	s.grid.mu.Lock()
+	defer s.grid.mu.Unlock()
+
+	contractID, ok := s.grid.names[name]
+	if !ok {
+		return 0, substrate.ErrNotFound
+	}
+	return contractID, nil
+}
+
+// IsValidContract checks if a contract exists and is created
+func (s *Substrate) IsValidContract(contractID uint64) (bool, error) {
+	if contractID == 0 {
+		return false, nil
+	}
+
+	s.grid.mu.Lock()
+	defer s.grid.mu.Unlock()
+
+	c, ok := s.grid.contracts[contractID]
+	return ok && c.State.IsCreated, nil
+}
+
+// DeleteInvalidContracts deletes invalid contracts from the given map
+func (s *Substrate) DeleteInvalidContracts(contracts map[uint32]uint64) error {
+	for node, contractID := range contracts {
+		valid, err := s.IsValidContract(contractID)
+		if err != nil {
+			return err
+		}
+		if !valid {
+			delete(contracts, node)
+		}
+	}
+	return nil
+}
+
+// CreateNodeContract creates a node contract reserving the requested public ips from the node's farm
+func (s *Substrate) CreateNodeContract(identity substrate.Identity, node uint32, body string, hash string, publicIPs uint32, solutionProviderID *uint64) (uint64, error) {
+	s.grid.mu.Lock()
+	defer s.grid.mu.Unlock()
+
+	return s.grid.createNodeContract(identity.PublicKey(), node, body, hash, publicIPs, solutionProviderID)
+}
+
+// UpdateNodeContract updates the deployment data and hash of a node contract
+func (s *Substrate) UpdateNodeContract(identity substrate.Identity, contractID uint64, body string, hash string) (uint64, error) {
+	s.grid.mu.Lock()
+	defer s.grid.mu.Unlock()
+
+	c, err := s.grid.ownedContract(identity.PublicKey(), contractID)
+	if err != nil {
+		return 0, err
+	}
+	if !c.ContractType.IsNodeContract {
+		return 0, errors.Errorf("contract %d is not a node contract", contractID)
+	}
+
+	c.hash = hash
+	c.ContractType.NodeContract.DeploymentHash = substrate.NewHexHash(hash)
+	c.ContractType.NodeContract.DeploymentData = body
+	return contractID, nil
+}
+
+// CreateNameContract creates a name contract
+func (s *Substrate) CreateNameContract(identity substrate.Identity, name string) (uint64, error) {
+	s.grid.mu.Lock()
+	defer s.grid.mu.Unlock()
+
+	return s.grid.createNameContract(identity.PublicKey(), name)
+}
+
+// InvalidateNameContract cancels the name contract if its name doesn't match the given name
+func (s *Substrate) InvalidateNameContract(ctx context.Context, identity substrate.Identity, contractID uint64, name string) (uint64, error) {
+	if contractID == 0 {
+		return 0, nil
+	}
+
+	s.grid.mu.Lock()
+	defer s.grid.mu.Unlock()
+
+	c, ok := s.grid.contracts[contractID]
+	if !ok || !c.State.IsCreated {
+		return 0, nil
+	}
+
+	if c.ContractType.NameContract.Name != name {
+		if err := s.grid.cancelContract(identity.PublicKey(), contractID); err != nil {
+			return 0, errors.Wrap(err, "failed to cleanup unmatched name contract")
+		}
+		return 0, nil
+	}
+
+	return contractID, nil
+}
+
+// CancelContract cancels a contract, deployments of canceled node contracts are removed from their nodes
+func (s *Substrate) CancelContract(identity substrate.Identity, contractID uint64) error {
+	if contractID == 0 {
+		return nil
+	}
+
+	s.grid.mu.Lock()
+	defer s.grid.mu.Unlock()
+
+	return s.grid.cancelContract(identity.PublicKey(), contractID)
+}
+
+// EnsureContractCanceled cancels a contract
+func (s *Substrate) EnsureContractCanceled(identity substrate.Identity, contractID uint64) error {
+	return s.CancelContract(identity, contractID)
+}
+
+// BatchCreateContract creates a batch of contracts non-atomically, returning the index of the failing contract if any
+func (s *Substrate) BatchCreateContract(identity substrate.Identity, contractsData []substrate.BatchCreateContractData) ([]uint64, *int, error) {
+	s.grid.mu.Lock()
+	defer s.grid.mu.Unlock()
+
+	var contracts []uint64
+	for i, data := range contractsData {
+		contractID, err := s.grid.createContract(identity.PublicKey(), data)
+		if err != nil {
+			return contracts, &i, err
+		}
+		contracts = append(contracts, contractID)
+	}
+	return contracts, nil, nil
+}
+
+// BatchAllCreateContract creates a batch of contracts atomically
+func (s *Substrate) BatchAllCreateContract(identity substrate.Identity, contractsData []substrate.BatchCreateContractData) ([]uint64, error) {
+	s.grid.mu.Lock()
+	defer s.grid.mu.Unlock()
+
+	var contracts []uint64
+	for _, data := range contractsData {
+		contractID, err := s.grid.createContract(identity.PublicKey(), data)
+		if err != nil {
+			for _, created := range contracts {
+				if err := s.grid.cancelContract(identity.PublicKey(), created); err != nil {
+					return nil, errors.Wrapf(err, "failed to revert contract %d", created)
+				}
+			}
+			return nil, err
+		}
+		contracts = append(contracts, contractID)
+	}
+	return contracts, nil
+}
+
+// BatchCancelContract cancels a batch of contracts
+func (s *Substrate) BatchCancelContract(identity substrate.Identity, contracts []uint64) error {
+	s.grid.mu.Lock()
+	defer s.grid.mu.Unlock()
+
+	for _, contractID := range contracts {
+		if _, err := s.grid.ownedContract(identity.PublicKey(), contractID); err != nil {
+			return err
+		}
+	}
+	for _, contractID := range contracts {
+		if err := s.grid.cancelContract(identity.PublicKey(), contractID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *Grid) createContract(pk []byte, data substrate.BatchCreateContractData) (uint64, error) {
+	if data.Name != "" {
+		return g.createNameContract(pk, data.Name)
+	}
+	return g.createNodeContract(pk, data.Node, data.Body, data.Hash, data.PublicIPs, data.SolutionProviderID)
+}
+
+func (g *Grid) createNodeContract(pk []byte, nodeID uint32, body, hash string, publicIPs uint32, solutionProviderID *uint64) (uint64, error) {
+	t := g.registerTwin(pk)
+
+	n, ok := g.nodes[nodeID]
+	if !ok {
+		return 0, errors.Wrapf(ErrNodeNotExists, "node %d", nodeID)
+	}
+	if n.rentedBy != 0 && n.rentedBy != t.id {
+		return 0, errors.Wrapf(ErrNodeNotAvailableToDeploy, "node %d is rented by twin %d", nodeID, n.rentedBy)
+	}
+	if (n.Dedicated || g.farms[n.FarmID].Dedicated) && n.rentedBy != t.id {
+		return 0, errors.Wrapf(ErrNodeNotAvailableToDeploy, "node %d is dedicated and must be rented first", nodeID)
+	}
+	for _, c := range g.contracts {
+		if c.ContractType.IsNodeContract && uint32(c.ContractType.NodeContract.Node) == nodeID && c.hash == hash {
+			return 0, errors.Wrapf(ErrContractIsNotUnique, "contract %d has the same hash on node %d", c.ContractID, nodeID)
+		}
+	}
+
+	farm := g.farms[n.FarmID]
+	if g.freeIPs(farm.ID) < int(publicIPs) {
+		return 0, errors.Wrapf(ErrNotEnoughPublicIPsFree, "farm %d", farm.ID)
+	}
+
+	c := g.newContract(t.id)
+	c.hash = hash
+	c.ContractType.IsNodeContract = true
+	c.ContractType.NodeContract = substrate.NodeContract{
+		Node:           types.U32(nodeID),
+		DeploymentHash: substrate.NewHexHash(hash),
+		DeploymentData: body,
+		PublicIPsCount: types.U32(publicIPs),
+	}
+	if solutionProviderID != nil {
+		c.SolutionProviderID = types.NewOptionU64(types.U64(*solutionProviderID))
+	}
+
+	for i := range farm.PublicIPs {
+		if uint32(len(c.ContractType.NodeContract.PublicIPs)) == publicIPs {
+			break
+		}
+		ip := &farm.PublicIPs[i]
+		if ip.ContractID != 0 {
+			continue
+		}
+		ip.ContractID = uint64(c.ContractID)
+		c.ContractType.NodeContract.PublicIPs = append(c.ContractType.NodeContract.PublicIPs, substrate.PublicIP{
+			IP:         ip.IP,
+			Gateway:    ip.Gateway,
+			ContractID: c.ContractID,
+		})
+	}
+
+	return uint64(c.ContractID), nil
+}
+
+func (g *Grid) createNameContract(pk []byte, name string) (uint64, error) {
+	t := g.registerTwin(pk)
+
+	if _, ok := g.names[name]; ok {
+		return 0, errors.Wrapf(ErrNameExists, "name %s", name)
+	}
+
+	c := g.newContract(t.id)
+	c.ContractType.IsNameContract = true
+	c.ContractType.NameContract.Name = name
+	g.names[name] = uint64(c.ContractID)
+	return uint64(c.ContractID), nil
+}
+
+func (g *Grid) ownedContract(pk []byte, contractID uint64) (*contract, error) {
+	c, ok := g.contracts[contractID]
+	if !ok {
+		return nil, errors.Wrapf(ErrContractNotExists, "contract %d", contractID)
+	}
+	if uint32(c.TwinID) != g.registerTwin(pk).id {
+		return nil, errors.Wrapf(ErrTwinNotAuthorized, "contract %d", contractID)
+	}
+	return c, nil
+}
+
+func (g *Grid) cancelContract(pk []byte, contractID uint64) error {
+	c, err := g.ownedContract(pk, contractID)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case c.ContractType.IsNodeContract:
+		n := g.nodes[uint32(c.ContractType.NodeContract.Node)]
+		n.removeDeployment(contractID)
+		farm := g.farms[n.FarmID]
+		for i := range farm.PublicIPs {
+			if farm.PublicIPs[i].ContractID == contractID {
+				farm.PublicIPs[i].ContractID = 0
+			}
+		}
+	case c.ContractType.IsNameContract:
+		delete(g.names, c.ContractType.NameContract.Name)
+	case c.ContractType.IsRentContract:
+		nodeID := uint32(c.ContractType.RentContract.Node)
+		for _, other := range g.contracts {
+			if other.ContractType.IsNodeContract && uint32(other.ContractType.NodeContract.Node) == nodeID {
+				return errors.Wrapf(ErrNodeHasActiveContracts, "node %d", nodeID)
+			}
+		}
+		g.nodes[nodeID].rentedBy = 0
+		g.nodes[nodeID].rentID = 0
+	}
+
+	delete(g.contracts, contractID)
+	return nil
+}
@@ -0,0 +1,119 @@
+// Package state for grid state
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+const boltStoreLockTimeout = 30 * time.Second
+
+var boltStateBucket = []byte("state")
+
+// BoltStore is a StateStore backed by a BoltDB file.
+// the database is opened for each operation, bolt holds an exclusive file lock
+// while it is open so processes sharing the file are serialized.
+type BoltStore struct {
+	path string
+}
+
+// NewBoltStore creates a new bolt store at the given path
+func NewBoltStore(path string) (*BoltStore, error) {
+	store := &BoltStore{path: path}
+
+	db, err := store.open(false)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltStateBucket)
+		return err
+	})
+
+	return store, errors.Wrap(err, "could not create state bucket")
+}
+
+// Load returns the persisted snapshot of a twin
+func (b *BoltStore) Load(twinID uint32) (Snapshot, error) {
+	db, err := b.open(true)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	defer db.Close()
+
+	var snapshot Snapshot
+	err = db.View(func(tx *bolt.Tx) (err error) {
+		snapshot, err = readBoltSnapshot(tx, twinID)
+		return err
+	})
+
+	return snapshot, err
+}
+
+// Update applies fn on the twin snapshot within a single bolt transaction
+func (b *BoltStore) Update(twinID uint32, fn func(*Snapshot) error) error {
+	db, err := b.open(false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		snapshot, err := readBoltSnapshot(tx, twinID)
+		if err != nil {
+			return err
+		}
+
+		if err := fn(&snapshot); err != nil {
+			return err
+		}
+
+		data, err := json.Marshal(snapshot)
+		if err != nil {
+			return errors.Wrapf(err, "could not encode state of twin %d", twinID)
+		}
+
+		return tx.Bucket(boltStateBucket).Put(boltKey(twinID), data)
+	})
+}
+
+// Close is a no-op as the database is only opened during operations
+func (b *BoltStore) Close() error {
+	return nil
+}
+
+func (b *BoltStore) open(readOnly bool) (*bolt.DB, error) {
+	db, err := bolt.Open(b.path, 0o600, &bolt.Options{Timeout: boltStoreLockTimeout, ReadOnly: readOnly})
+	return db, errors.Wrapf(err, "could not open state database %s", b.path)
+}
+
+func readBoltSnapshot(tx *bolt.Tx, twinID uint32) (Snapshot, error) {
+	snapshot := NewSnapshot()
+
+	bucket := tx.Bucket(boltStateBucket)
+	if bucket == nil {
+		return snapshot, nil
+	}
+
+	data := bucket.Get(boltKey(twinID))
+	if data == nil {
+		return snapshot, nil
+	}
+
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return snapshot, errors.Wrapf(err, "could not decode state of twin %d", twinID)
+	}
+	snapshot.initialize()
+
+	return snapshot, nil
+}
+
+func boltKey(twinID uint32) []byte {
+	return []byte(fmt.Sprint(twinID))
+}
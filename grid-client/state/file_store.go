@@ -0,0 +1,140 @@
+// Package state for grid state
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	fileStoreLockTimeout = 30 * time.Second
+	fileStoreLockRetry   = 50 * time.Millisecond
+	// a lock older than this is considered left behind by a crashed process
+	fileStoreStaleLock = 2 * time.Minute
+)
+
+// FileStore is a StateStore that keeps a JSON file per twin in a directory
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore creates a new file store in the given directory
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, errors.Wrapf(err, "could not create state directory %s", dir)
+	}
+
+	return &FileStore{dir: dir}, nil
+}
+
+// Load returns the persisted snapshot of a twin
+func (f *FileStore) Load(twinID uint32) (Snapshot, error) {
+	return f.read(twinID)
+}
+
+// Update applies fn on the twin snapshot while holding the twin lock file
+func (f *FileStore) Update(twinID uint32, fn func(*Snapshot) error) error {
+	unlock, err := f.lock(twinID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	snapshot, err := f.read(twinID)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(&snapshot); err != nil {
+		return err
+	}
+
+	return f.write(twinID, snapshot)
+}
+
+// Close is a no-op for the file store
+func (f *FileStore) Close() error {
+	return nil
+}
+
+func (f *FileStore) path(twinID uint32) string {
+	return filepath.Join(f.dir, fmt.Sprintf("state-%d.json", twinID))
+}
+
+func (f *FileStore) read(twinID uint32) (Snapshot, error) {
+	snapshot := NewSnapshot()
+
+	data, err := os.ReadFile(f.path(twinID))
+	if errors.Is(err, os.ErrNotExist) {
+		return snapshot, nil
+	}
+	if err != nil {
+		return snapshot, errors.Wrapf(err, "could not read state of twin %d", twinID)
+	}
+
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return snapshot, errors.Wrapf(err, "could not decode state of twin %d", twinID)
+	}
+	snapshot.initialize()
+
+	return snapshot, nil
+}
+
+// write stores the snapshot in a temporary file first then renames it
+// so readers never see a partially written state
+func (f *FileStore) write(twinID uint32, snapshot Snapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return errors.Wrapf(err, "could not encode state of twin %d", twinID)
+	}
+
+	tmp, err := os.CreateTemp(f.dir, fmt.Sprintf("state-%d-*.tmp", twinID))
+	if err != nil {
+		return errors.Wrap(err, "could not create temporary state file")
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "could not write temporary state file")
+	}
+
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "could not close temporary state file")
+	}
+
+	return errors.Wrapf(os.Rename(tmp.Name(), f.path(twinID)), "could not store state of twin %d", twinID)
+}
+
+// lock creates the twin lock file exclusively, waiting for other processes to release it
+func (f *FileStore) lock(twinID uint32) (func(), error) {
+	lockPath := f.path(twinID) + ".lock"
+	deadline := time.Now().Add(fileStoreLockTimeout)
+
+	for {
+		file, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			file.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+
+		if !errors.Is(err, os.ErrExist) {
+			return nil, errors.Wrapf(err, "could not lock state of twin %d", twinID)
+		}
+
+		if info, err := os.Stat(lockPath); err == nil && time.Since(info.ModTime()) > fileStoreStaleLock {
+			os.Remove(lockPath)
+			continue
+		}
+
+		if time.Now().After(deadline) {
+			return nil, errors.Errorf("timed out waiting for state lock of twin %d", twinID)
+		}
+		time.Sleep(fileStoreLockRetry)
+	}
+}
@@ -11,11 +11,14 @@ import (
 type NetworkState struct {
 	State     map[string]Network
 	stateLock sync.Mutex
+
+	// persist is called after a network is updated or deleted if a state store is attached
+	persist func(networkName string, network Network, deleted bool)
 }
 
 // Network struct includes Subnets and node IPs
 type Network struct {
-	Subnets map[uint32]string
+	Subnets map[uint32]string `json:"subnets"`
 }
 
 // NewNetwork creates a new Network
@@ -46,15 +49,25 @@ func (nm *NetworkState) UpdateNetworkSubnets(networkName string, ipRange map[uin
 	}
 
 	nm.stateLock.Lock()
-	defer nm.stateLock.Unlock()
 	nm.State[networkName] = network
+	persist := nm.persist
+	nm.stateLock.Unlock()
+
+	if persist != nil {
+		persist(networkName, network, false)
+	}
 }
 
 // DeleteNetwork deletes a Network using its name
 func (nm *NetworkState) DeleteNetwork(networkName string) {
 	nm.stateLock.Lock()
-	defer nm.stateLock.Unlock()
 	delete(nm.State, networkName)
+	persist := nm.persist
+	nm.stateLock.Unlock()
+
+	if persist != nil {
+		persist(networkName, Network{}, true)
+	}
 }
 
 // GetNodeSubnet gets a node subnet using its ID
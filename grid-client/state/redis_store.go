@@ -0,0 +1,98 @@
+// Package state for grid state
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/go-redis/redis"
+	"github.com/pkg/errors"
+)
+
+const redisStoreMaxRetries = 10
+
+// RedisStore is a StateStore backed by redis.
+// updates use optimistic transactions (WATCH/MULTI/EXEC) and are retried on conflicts.
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisStore creates a new redis store, keys are prefixed with the given prefix
+func NewRedisStore(client *redis.Client, prefix string) *RedisStore {
+	if prefix == "" {
+		prefix = "grid-client"
+	}
+
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+// Load returns the persisted snapshot of a twin
+func (r *RedisStore) Load(twinID uint32) (Snapshot, error) {
+	return decodeRedisSnapshot(r.client.Get(r.key(twinID)), twinID)
+}
+
+// Update applies fn on the twin snapshot, retrying if another writer changed it meanwhile
+func (r *RedisStore) Update(twinID uint32, fn func(*Snapshot) error) error {
+	key := r.key(twinID)
+
+	txf := func(tx *redis.Tx) error {
+		snapshot, err := decodeRedisSnapshot(tx.Get(key), twinID)
+		if err != nil {
+			return err
+		}
+
+		if err := fn(&snapshot); err != nil {
+			return err
+		}
+
+		data, err := json.Marshal(snapshot)
+		if err != nil {
+			return errors.Wrapf(err, "could not encode state of twin %d", twinID)
+		}
+
+		_, err = tx.Pipelined(func(pipe redis.Pipeliner) error {
+			pipe.Set(key, data, 0)
+			return nil
+		})
+		return err
+	}
+
+	for i := 0; i < redisStoreMaxRetries; i++ {
+		err := r.client.Watch(txf, key)
+		if err == redis.TxFailedErr {
+			continue
+		}
+		return err
+	}
+
+	return errors.Errorf("could not update state of twin %d: too many concurrent updates", twinID)
+}
+
+// Close closes the redis client
+func (r *RedisStore) Close() error {
+	return r.client.Close()
+}
+
+func (r *RedisStore) key(twinID uint32) string {
+	return fmt.Sprintf("%s:state:%d", r.prefix, twinID)
+}
+
+func decodeRedisSnapshot(cmd *redis.StringCmd, twinID uint32) (Snapshot, error) {
+	snapshot := NewSnapshot()
+
+	data, err := cmd.Bytes()
+	if err == redis.Nil {
+		return snapshot, nil
+	}
+	if err != nil {
+		return snapshot, errors.Wrapf(err, "could not get state of twin %d", twinID)
+	}
+
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return snapshot, errors.Wrapf(err, "could not decode state of twin %d", twinID)
+	}
+	snapshot.initialize()
+
+	return snapshot, nil
+}
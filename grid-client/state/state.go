@@ -8,8 +8,10 @@ import (
 	"reflect"
 	"slices"
 	"strings"
+	"sync"
 
 	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
 	client "github.com/threefoldtech/tfgrid-sdk-go/grid-client/node"
 	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/subi"
 	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
@@ -31,6 +33,10 @@ type State struct {
 
 	NcPool    client.NodeClientGetter
 	Substrate subi.SubstrateExt
+
+	store   StateStore
+	twinID  uint32
+	storeMu sync.Mutex
 }
 
 // ErrNotFound for state not found instances
@@ -46,18 +52,114 @@ func NewState(ncPool client.NodeClientGetter, substrate subi.SubstrateExt) *Stat
 	}
 }
 
+// AttachStore loads the persisted state of a twin and persists any further state changes in the given store
+func (st *State) AttachStore(twinID uint32, store StateStore) error {
+	snapshot, err := store.Load(twinID)
+	if err != nil {
+		return errors.Wrapf(err, "could not load state of twin %d", twinID)
+	}
+
+	st.storeMu.Lock()
+	st.store = store
+	st.twinID = twinID
+	st.storeMu.Unlock()
+
+	for nodeID, contractIDs := range snapshot.NodeDeployments {
+		for _, contractID := range contractIDs {
+			if !slices.Contains(st.CurrentNodeDeployments[nodeID], contractID) {
+				st.CurrentNodeDeployments[nodeID] = append(st.CurrentNodeDeployments[nodeID], contractID)
+			}
+		}
+	}
+
+	st.Networks.stateLock.Lock()
+	for name, network := range snapshot.Networks {
+		st.Networks.State[name] = network
+	}
+	st.Networks.persist = st.persistNetwork
+	st.Networks.stateLock.Unlock()
+
+	return nil
+}
+
+// Snapshot returns the persisted snapshot of the twin, it fails if no store is attached
+func (st *State) Snapshot() (Snapshot, error) {
+	st.storeMu.Lock()
+	store, twinID := st.store, st.twinID
+	st.storeMu.Unlock()
+
+	if store == nil {
+		return Snapshot{}, errors.New("no state store is attached")
+	}
+
+	return store.Load(twinID)
+}
+
+// StoreContractIDs stores contract IDs of a node
 func (st *State) StoreContractIDs(nodeID uint32, contractIDs ...uint64) {
 	for _, contractID := range contractIDs {
 		if !slices.Contains(st.CurrentNodeDeployments[nodeID], contractID) {
 			st.CurrentNodeDeployments[nodeID] = append(st.CurrentNodeDeployments[nodeID], contractID)
 		}
 	}
+
+	st.persist(func(s *Snapshot) {
+		s.addContractIDs(nodeID, contractIDs...)
+	})
 }
 
+// RemoveContractIDs removes contract IDs of a node
 func (st *State) RemoveContractIDs(nodeID uint32, contractIDs ...uint64) {
 	for _, contractID := range contractIDs {
 		st.CurrentNodeDeployments[nodeID] = workloads.Delete(st.CurrentNodeDeployments[nodeID], contractID)
 	}
+
+	st.persist(func(s *Snapshot) {
+		s.removeContractIDs(nodeID, contractIDs...)
+	})
+}
+
+// StoreDeploymentInfo stores the metadata of a deployment contract,
+// it has no effect if no store is attached
+func (st *State) StoreDeploymentInfo(contractID uint64, info DeploymentInfo) {
+	if contractID == 0 {
+		return
+	}
+
+	st.persist(func(s *Snapshot) {
+		s.addContractIDs(info.NodeID, contractID)
+		s.Deployments[contractID] = info
+	})
+}
+
+// persist applies a change on the attached store.
+// only the change is applied on the latest stored snapshot so other processes changes are kept.
+// failures are logged and don't affect the in memory state.
+func (st *State) persist(change func(*Snapshot)) {
+	st.storeMu.Lock()
+	defer st.storeMu.Unlock()
+
+	if st.store == nil {
+		return
+	}
+
+	err := st.store.Update(st.twinID, func(s *Snapshot) error {
+		change(s)
+		return nil
+	})
+	if err != nil {
+		log.Error().Err(err).Uint32("twin", st.twinID).Msg("failed to persist state")
+	}
+}
+
+func (st *State) persistNetwork(name string, network Network, deleted bool) {
+	st.persist(func(s *Snapshot) {
+		if deleted {
+			delete(s.Networks, name)
+			return
+		}
+		s.Networks[name] = network
+	})
 }
 
 // LoadDiskFromGrid loads a disk from grid
@@ -82,7 +184,7 @@ func (st *State) LoadVolumeFromGrid(ctx context.Context, nodeID uint32, name str
 
 // LoadGatewayFQDNFromGrid loads a gateway FQDN proxy from grid
 func (st *State) LoadGatewayFQDNFromGrid(ctx context.Context, nodeID uint32, name string, deploymentName string) (workloads.GatewayFQDNProxy, error) {
-	wl, dl, err := st.GetWorkloadInDeployment(ctx, nodeID, name, deploymentName)
+	wl, dl, err := st.getGatewayInDeployment(ctx, nodeID, name, deploymentName, zosTypes.GatewayFQDNProxyType)
 	if err != nil {
 		return workloads.GatewayFQDNProxy{}, errors.Wrapf(err, "could not get workload from node %d within deployment %v", nodeID, dl)
 	}
@@ -95,6 +197,9 @@ func (st *State) LoadGatewayFQDNFromGrid(ctx context.Context, nodeID uint32, nam
 	if err != nil {
 		return workloads.GatewayFQDNProxy{}, err
 	}
+	if gateway.Name != name {
+		gateway.Name, gateway.WorkloadName = name, wl.Name
+	}
 	gateway.ContractID = dl.ContractID
 	gateway.NodeID = nodeID
 	gateway.SolutionType = deploymentData.ProjectName
@@ -102,6 +207,27 @@ func (st *State) LoadGatewayFQDNFromGrid(ctx context.Context, nodeID uint32, nam
 	return gateway, nil
 }
 
+// getGatewayInDeployment returns the gateway workload of a deployment.
+// the workload of a gateway replaced in place isn't named after the gateway so the deployment gateway is returned instead
+func (st *State) getGatewayInDeployment(ctx context.Context, nodeID uint32, name, deploymentName, workloadType string) (zosTypes.Workload, zosTypes.Deployment, error) {
+	wl, dl, err := st.GetWorkloadInDeployment(ctx, nodeID, name, deploymentName)
+	if !errors.Is(err, ErrNotFound) {
+		return wl, dl, err
+	}
+
+	_, gwDl, dlErr := st.GetWorkloadInDeployment(ctx, nodeID, "", deploymentName)
+	if dlErr != nil {
+		return wl, dl, err
+	}
+	for _, workload := range gwDl.Workloads {
+		if workload.Type == workloadType {
+			return workload, gwDl, nil
+		}
+	}
+
+	return wl, dl, err
+}
+
 // LoadQSFSFromGrid loads a QSFS from grid
 func (st *State) LoadQSFSFromGrid(ctx context.Context, nodeID uint32, name string, deploymentName string) (workloads.QSFS, error) {
 	wl, dl, err := st.GetWorkloadInDeployment(ctx, nodeID, name, deploymentName)
@@ -114,7 +240,7 @@ func (st *State) LoadQSFSFromGrid(ctx context.Context, nodeID uint32, name strin
 
 // LoadGatewayNameFromGrid loads a gateway name proxy from grid
 func (st *State) LoadGatewayNameFromGrid(ctx context.Context, nodeID uint32, name string, deploymentName string) (workloads.GatewayNameProxy, error) {
-	wl, dl, err := st.GetWorkloadInDeployment(ctx, nodeID, deploymentName, deploymentName)
+	wl, dl, err := st.getGatewayInDeployment(ctx, nodeID, deploymentName, deploymentName, zosTypes.GatewayNameProxyType)
 	if err != nil {
 		return workloads.GatewayNameProxy{}, errors.Wrapf(err, "could not get workload from node %d within deployment %v", nodeID, dl)
 	}
@@ -131,6 +257,9 @@ func (st *State) LoadGatewayNameFromGrid(ctx context.Context, nodeID uint32, nam
 	if err != nil {
 		return workloads.GatewayNameProxy{}, err
 	}
+	if wl.Name != deploymentName {
+		gateway.WorkloadName = wl.Name
+	}
 	gateway.NameContractID = nameContractID
 	gateway.ContractID = dl.ContractID
 	gateway.NodeID = nodeID
@@ -198,13 +327,23 @@ func (st *State) LoadK8sFromGrid(ctx context.Context, nodeIDs []uint32, deployme
 			if err != nil {
 				return workloads.K8sCluster{}, errors.Wrapf(err, "could not generate node data for %s", workload.Name)
 			}
+			node.Zlogs = workloads.ZlogsFromDeployment(&deployment, workload.Name)
 
 			isMaster, err := isMasterNode(*workload.Workload3())
 			if err != nil {
 				return workloads.K8sCluster{}, err
 			}
+			serverFlags, err := workloads.K3sServerFlags(*workload.Workload3())
+			if err != nil {
+				return workloads.K8sCluster{}, err
+			}
+			if isMaster && serverFlags[workloads.K3sServerFlag] != "" {
+				cluster.Masters = append(cluster.Masters, node)
+				continue
+			}
 			if isMaster {
 				cluster.Master = &node
+				cluster.Endpoint = serverFlags[workloads.K3sTLSSANFlag]
 				deploymentData, err := workloads.ParseDeploymentData(deployment.Metadata)
 				if err != nil {
 					return workloads.K8sCluster{}, errors.Wrapf(err, "could not generate node deployment metadata for %s", workload.Name)
@@ -225,6 +364,7 @@ func (st *State) LoadK8sFromGrid(ctx context.Context, nodeIDs []uint32, deployme
 	cluster.Flist = cluster.Master.Flist
 	cluster.FlistChecksum = cluster.Master.FlistChecksum
 	cluster.Entrypoint = cluster.Master.Entrypoint
+	slices.SortFunc(cluster.Masters, func(a, b workloads.K8sNode) int { return strings.Compare(a.Name, b.Name) })
 
 	// get cluster IP ranges
 	_, err := st.LoadNetworkFromGrid(ctx, cluster.NetworkName)
@@ -374,12 +514,18 @@ func (st *State) LoadNetworkFromGrid(ctx context.Context, name string) (znet wor
 	nodesIPRange := map[uint32]zosTypes.IPNet{}
 	wgPort := map[uint32]int{}
 	keys := map[uint32]wgtypes.Key{}
+	var accessPeers []workloads.WGAccessPeer
 	for _, net := range zNets {
 		maps.Copy(nodesIPRange, net.NodesIPRange)
 		maps.Copy(wgPort, net.WGPort)
 		maps.Copy(keys, net.Keys)
 		maps.Copy(myceliumKeys, net.MyceliumKeys)
 		nodes = append(nodes, net.Nodes...)
+
+		// access peers are only stored on the public node
+		if net.Nodes[0] == net.PublicNodeID {
+			accessPeers = net.AccessPeers
+		}
 	}
 
 	znet.NodeDeploymentID = nodeDeploymentsIDs
@@ -388,6 +534,17 @@ func (st *State) LoadNetworkFromGrid(ctx context.Context, name string) (znet wor
 	znet.MyceliumKeys = myceliumKeys
 	znet.Keys = keys
 	znet.WGPort = wgPort
+	znet.AccessPeers = accessPeers
+
+	for i, peer := range znet.AccessPeers {
+		znet.AccessPeers[i].WGConfig = workloads.GenerateWGConfig(
+			peer.IP.IP.String(),
+			peer.PrivateKey.String(),
+			znet.Keys[znet.PublicNodeID].PublicKey().String(),
+			fmt.Sprintf("%s:%d", publicNodeEndpoint, znet.WGPort[znet.PublicNodeID]),
+			znet.IPRange.String(),
+		)
+	}
 
 	if znet.AddWGAccess {
 		znet.AccessWGConfig = workloads.GenerateWGConfig(
@@ -561,6 +718,12 @@ func (st *State) AssignNodesIPRange(k *workloads.K8sCluster) (err error) {
 	if err != nil {
 		return errors.Wrap(err, "could not parse master node ip range")
 	}
+	for _, master := range k.Masters {
+		nodesIPRange[master.NodeID], err = gridtypes.ParseIPNet(network.GetNodeSubnet(master.NodeID))
+		if err != nil {
+			return errors.Wrapf(err, "could not parse master node (%d) ip range", master.NodeID)
+		}
+	}
 	for _, worker := range k.Workers {
 		nodesIPRange[worker.NodeID], err = gridtypes.ParseIPNet(network.GetNodeSubnet(worker.NodeID))
 		if err != nil {
@@ -0,0 +1,84 @@
+// Package state for grid state
+package state
+
+import (
+	"slices"
+
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+)
+
+// StateStore persists the state of a twin so it survives process restarts.
+// implementations must make Update atomic across processes using the same store,
+// so concurrent writers of the same twin never overwrite each other's changes.
+type StateStore interface {
+	// Load returns the persisted snapshot of a twin, an empty snapshot is returned if nothing was stored
+	Load(twinID uint32) (Snapshot, error)
+	// Update loads the snapshot of a twin, applies fn on it and stores the result atomically
+	Update(twinID uint32, fn func(*Snapshot) error) error
+	// Close releases the store resources
+	Close() error
+}
+
+// Snapshot is the persisted part of a twin state
+type Snapshot struct {
+	NodeDeployments map[uint32]ContractIDs    `json:"node_deployments"`
+	Networks        map[string]Network        `json:"networks"`
+	Deployments     map[uint64]DeploymentInfo `json:"deployments"`
+}
+
+// DeploymentInfo is the metadata stored for a deployment contract
+type DeploymentInfo struct {
+	NodeID      uint32   `json:"node_id"`
+	Name        string   `json:"name"`
+	Type        string   `json:"type"`
+	ProjectName string   `json:"project_name"`
+	Workloads   []string `json:"workloads,omitempty"`
+}
+
+// NewSnapshot creates a new empty snapshot
+func NewSnapshot() Snapshot {
+	return Snapshot{
+		NodeDeployments: make(map[uint32]ContractIDs),
+		Networks:        make(map[string]Network),
+		Deployments:     make(map[uint64]DeploymentInfo),
+	}
+}
+
+// initialize makes sure all snapshot maps are usable after decoding
+func (s *Snapshot) initialize() {
+	if s.NodeDeployments == nil {
+		s.NodeDeployments = make(map[uint32]ContractIDs)
+	}
+	if s.Networks == nil {
+		s.Networks = make(map[string]Network)
+	}
+	if s.Deployments == nil {
+		s.Deployments = make(map[uint64]DeploymentInfo)
+	}
+	for name, network := range s.Networks {
+		if network.Subnets == nil {
+			network.Subnets = make(map[uint32]string)
+			s.Networks[name] = network
+		}
+	}
+}
+
+// addContractIDs adds contract IDs to a node if they don't exist
+func (s *Snapshot) addContractIDs(nodeID uint32, contractIDs ...uint64) {
+	for _, contractID := range contractIDs {
+		if !slices.Contains(s.NodeDeployments[nodeID], contractID) {
+			s.NodeDeployments[nodeID] = append(s.NodeDeployments[nodeID], contractID)
+		}
+	}
+}
+
+// removeContractIDs removes contract IDs and their deployment info from a node
+func (s *Snapshot) removeContractIDs(nodeID uint32, contractIDs ...uint64) {
+	for _, contractID := range contractIDs {
+		s.NodeDeployments[nodeID] = workloads.Delete(s.NodeDeployments[nodeID], contractID)
+		delete(s.Deployments, contractID)
+	}
+	if len(s.NodeDeployments[nodeID]) == 0 {
+		delete(s.NodeDeployments, nodeID)
+	}
+}
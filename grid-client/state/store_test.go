@@ -0,0 +1,89 @@
+// Package state for grid state
+package state
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/zos"
+)
+
+const testTwinID = uint32(13)
+
+func testStores(t *testing.T) map[string]func() StateStore {
+	dir := t.TempDir()
+
+	return map[string]func() StateStore{
+		"file": func() StateStore {
+			store, err := NewFileStore(filepath.Join(dir, "files"))
+			require.NoError(t, err)
+			return store
+		},
+		"bolt": func() StateStore {
+			store, err := NewBoltStore(filepath.Join(dir, "state.db"))
+			require.NoError(t, err)
+			return store
+		},
+	}
+}
+
+func TestStateStores(t *testing.T) {
+	for name, newStore := range testStores(t) {
+		t.Run(name+" empty state", func(t *testing.T) {
+			snapshot, err := newStore().Load(99)
+			assert.NoError(t, err)
+			assert.Empty(t, snapshot.NodeDeployments)
+			assert.NotNil(t, snapshot.Deployments)
+		})
+
+		t.Run(name+" state survives restarts", func(t *testing.T) {
+			st := NewState(nil, nil)
+			assert.NoError(t, st.AttachStore(testTwinID, newStore()))
+
+			st.StoreContractIDs(1, 10, 11)
+			st.StoreDeploymentInfo(10, DeploymentInfo{NodeID: 1, Name: "vm", ProjectName: "vm/vm", Workloads: []string{"vm", "disk"}})
+			st.Networks.UpdateNetworkSubnets("net", map[uint32]zos.IPNet{1: zos.MustParseIPNet("10.1.2.0/24")})
+			st.RemoveContractIDs(1, 11)
+
+			restarted := NewState(nil, nil)
+			assert.NoError(t, restarted.AttachStore(testTwinID, newStore()))
+
+			assert.Equal(t, ContractIDs{10}, restarted.CurrentNodeDeployments[1])
+			network := restarted.Networks.GetNetwork("net")
+			assert.Equal(t, "10.1.2.0/24", network.GetNodeSubnet(1))
+
+			snapshot, err := restarted.Snapshot()
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"vm", "disk"}, snapshot.Deployments[10].Workloads)
+
+			restarted.Networks.DeleteNetwork("net")
+			snapshot, err = restarted.Snapshot()
+			assert.NoError(t, err)
+			assert.NotContains(t, snapshot.Networks, "net")
+		})
+
+		t.Run(name+" concurrent writers keep each other changes", func(t *testing.T) {
+			const writers = 8
+
+			var wg sync.WaitGroup
+			for i := 0; i < writers; i++ {
+				wg.Add(1)
+				go func(contractID uint64) {
+					defer wg.Done()
+					// every writer has its own store instance like a separate process
+					st := NewState(nil, nil)
+					assert.NoError(t, st.AttachStore(testTwinID+1, newStore()))
+					st.StoreContractIDs(2, contractID)
+				}(uint64(100 + i))
+			}
+			wg.Wait()
+
+			snapshot, err := newStore().Load(testTwinID + 1)
+			assert.NoError(t, err)
+			assert.Len(t, snapshot.NodeDeployments[2], writers)
+		})
+	}
+}
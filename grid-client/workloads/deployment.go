@@ -123,6 +123,23 @@ func (d *Deployment) Validate() error {
 	return nil
 }
 
+// AttachZlogTarget streams the logs of all the vms in the deployment to a target
+func (d *Deployment) AttachZlogTarget(target ZlogTarget) error {
+	if err := target.Validate(); err != nil {
+		return errors.Wrap(err, "zlog target is invalid")
+	}
+
+	for i := range d.Vms {
+		d.Vms[i].Zlogs = attachZlog(d.Vms[i].Zlogs, d.Vms[i].Name, target)
+	}
+
+	for i := range d.VmsLight {
+		d.VmsLight[i].Zlogs = attachZlog(d.VmsLight[i].Zlogs, d.VmsLight[i].Name, target)
+	}
+
+	return nil
+}
+
 func validateName(name string) error {
 	if len(name) == 0 {
 		return fmt.Errorf("name cannot be empty")
@@ -32,6 +32,9 @@ type GatewayFQDNProxy struct {
 	Network      string
 	Description  string
 	SolutionType string
+	// WorkloadName is the name of the zos workload, defaults to Name.
+	// zos can't update gateways, so a gateway is replaced in place by a workload of another name in the same deployment
+	WorkloadName string
 
 	// computed
 	ContractID       uint64
@@ -84,6 +87,10 @@ func (g *GatewayFQDNProxy) Validate() error {
 		return fmt.Errorf("fqdn %s is invalid", g.FQDN)
 	}
 
+	if g.WorkloadName != "" && !nameMatch.MatchString(g.WorkloadName) {
+		return fmt.Errorf("gateway workload name %s is invalid", g.WorkloadName)
+	}
+
 	return validateBackend(g.Backends, g.TLSPassthrough)
 }
 
@@ -111,10 +118,14 @@ func (g *GatewayFQDNProxy) ZosWorkload() gridtypes.Workload {
 	if g.Network == "" {
 		network = nil
 	}
+	name := g.Name
+	if g.WorkloadName != "" {
+		name = g.WorkloadName
+	}
 	return gridtypes.Workload{
 		Version: 0,
 		Type:    zos.GatewayFQDNProxyType,
-		Name:    gridtypes.Name(g.Name),
+		Name:    gridtypes.Name(name),
 		// REVISE: whether description should be set here
 		Data: gridtypes.MustMarshal(zos.GatewayFQDNProxy{
 			GatewayBase: zos.GatewayBase{
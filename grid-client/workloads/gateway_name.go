@@ -27,6 +27,9 @@ type GatewayNameProxy struct {
 	Network      string
 	Description  string
 	SolutionType string
+	// WorkloadName is the name of the zos workload, defaults to Name.
+	// zos can't update gateways, so a gateway is replaced in place by a workload of another name in the same deployment
+	WorkloadName string
 
 	// computed
 	// FQDN deployed on the node
@@ -58,6 +61,7 @@ func NewGatewayNameProxyFromZosWorkload(wl gridtypes.Workload) (GatewayNameProxy
 	if data.Network != nil {
 		network = data.Network.String()
 	}
+
 	return GatewayNameProxy{
 		Name:           data.Name,
 		TLSPassthrough: data.TLSPassthrough,
@@ -84,6 +88,10 @@ func (g *GatewayNameProxy) Validate() error {
 		}
 	}
 
+	if g.WorkloadName != "" && !nameMatch.MatchString(g.WorkloadName) {
+		return fmt.Errorf("gateway workload name %s is invalid", g.WorkloadName)
+	}
+
 	return validateBackend(g.Backends, g.TLSPassthrough)
 }
 
@@ -93,10 +101,14 @@ func (g *GatewayNameProxy) ZosWorkload() gridtypes.Workload {
 	if g.Network == "" {
 		network = nil
 	}
+	name := g.Name
+	if g.WorkloadName != "" {
+		name = g.WorkloadName
+	}
 	return gridtypes.Workload{
 		Version: 0,
 		Type:    zos.GatewayNameProxyType,
-		Name:    gridtypes.Name(g.Name),
+		Name:    gridtypes.Name(name),
 		// REVISE: whether description should be set here
 		Data: gridtypes.MustMarshal(zos.GatewayNameProxy{
 			GatewayBase: zos.GatewayBase{
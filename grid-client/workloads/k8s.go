@@ -7,6 +7,7 @@ import (
 	"net"
 	"reflect"
 	"regexp"
+	"strings"
 
 	"github.com/pkg/errors"
 	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
@@ -18,6 +19,27 @@ import (
 // old: https://hub.grid.tf/tf-official-apps/threefoldtech-k3s-latest.flist
 var K8sFlist = "https://hub.grid.tf/tf-official-apps/threefolddev-k3s-v1.31.0.flist"
 
+// the k3s flist init runs k3s as an agent joining K3S_URL if it is set and as a standalone server otherwise,
+// it has no way to join a server to another one. so masters of a highly available cluster, or of a cluster
+// with an endpoint, run k3s server directly as their entrypoint instead of the flist init:
+// the first one with --cluster-init and the others with --server pointing to the first one, all sharing K3S_TOKEN.
+// the flist init services like ssh don't run on these masters, so ssh keys are rejected for such clusters.
+const (
+	// K3sServerFlag is the k3s server flag additional masters join the first master through
+	K3sServerFlag = "--server"
+	// K3sClusterInitFlag is the k3s server flag making the first master initialize the embedded etcd datastore
+	K3sClusterInitFlag = "--cluster-init"
+	// K3sTLSSANFlag is the k3s server flag adding the cluster endpoint to the certificate of the masters api server
+	K3sTLSSANFlag = "--tls-san"
+	// K8sFlistEntrypoint is the init of the k3s flist
+	K8sFlistEntrypoint = "/sbin/zinit init"
+
+	// k3sBinary is where the k3s flist installs k3s
+	k3sBinary    = "/usr/local/bin/k3s"
+	k3sURLEnvVar = "K3S_URL"
+	k3sAPIPort   = 6443
+)
+
 // K8sNode kubernetes data
 type K8sNode struct {
 	*VM
@@ -26,18 +48,27 @@ type K8sNode struct {
 
 // K8sCluster struct for k8s cluster
 type K8sCluster struct {
-	Master      *K8sNode
+	// Master is the first master of the cluster, the cluster deployments are named after it
+	Master *K8sNode
+	// Masters are the additional masters of a highly available cluster joining the first one.
+	// the cluster must have 1, 3 or 5 masters in total each on a different node
+	Masters     []K8sNode
 	Workers     []K8sNode
 	Token       string
 	NetworkName string
 
 	Flist         string `json:"flist"`
 	FlistChecksum string `json:"flist_checksum"`
-	Entrypoint    string `json:"entry_point"`
+	// Entrypoint of the nodes running the flist init, masters of a highly available cluster
+	// or of a cluster with an endpoint run k3s server instead
+	Entrypoint string `json:"entry_point"`
 
 	// optional
 	SolutionType string
 	SSHKey       string
+	// Endpoint is a shared address of the masters, e.g. a name gateway domain or a floating public ip.
+	// workers register through it if set, otherwise through the first master private ip
+	Endpoint string
 
 	// computed
 	NodesIPRange     map[uint32]gridtypes.IPNet
@@ -71,6 +102,12 @@ func NewK8sNodeFromWorkload(wl gridtypes.Workload, nodeID uint32, diskSize uint6
 		myceliumIPSeed = d.Network.Mycelium.Seed
 	}
 
+	// masters running k3s server are redeployed from the cluster entrypoint like the other nodes
+	entrypoint := d.Entrypoint
+	if IsK3sServerEntrypoint(entrypoint) {
+		entrypoint = K8sFlistEntrypoint
+	}
+
 	var ip, networkName string
 	if len(d.Network.Interfaces) > 0 {
 		ip = d.Network.Interfaces[0].IP.String()
@@ -97,6 +134,7 @@ func NewK8sNodeFromWorkload(wl gridtypes.Workload, nodeID uint32, diskSize uint6
 			NetworkName:    networkName,
 			ConsoleURL:     result.ConsoleURL,
 			EnvVars:        d.Env,
+			Entrypoint:     entrypoint,
 		},
 		DiskSizeGB: diskSize,
 	}, nil
@@ -112,10 +150,100 @@ func (k *K8sNode) WorkerZosWorkload(cluster *K8sCluster) (K8sWorkloads []gridtyp
 	return k.zosWorkload(cluster, true)
 }
 
+// IsMaster returns true if the node env vars make it a master of its cluster
+func (k *K8sNode) IsMaster() bool {
+	return isK8sMaster(k.EnvVars)
+}
+
+// MasterNodes returns the first master of the cluster followed by the additional masters
+func (k *K8sCluster) MasterNodes() []K8sNode {
+	masters := []K8sNode{}
+	if k.Master != nil {
+		masters = append(masters, *k.Master)
+	}
+	return append(masters, k.Masters...)
+}
+
+// IsHA returns true if the cluster has more than one master
+func (k *K8sCluster) IsHA() bool {
+	return len(k.Masters) != 0
+}
+
+// JoinURL returns the url workers register through
+func (k *K8sCluster) JoinURL() string {
+	if k.Endpoint != "" {
+		return fmt.Sprintf("https://%s", net.JoinHostPort(k.Endpoint, fmt.Sprint(k3sAPIPort)))
+	}
+	return k.masterURL()
+}
+
+// masterURL returns the url of the api server of the first master
+func (k *K8sCluster) masterURL() string {
+	return fmt.Sprintf("https://%s", net.JoinHostPort(k.Master.IP, fmt.Sprint(k3sAPIPort)))
+}
+
+// runsK3sServer returns true if the cluster masters run k3s server as their entrypoint instead of the flist init
+func (k *K8sCluster) runsK3sServer() bool {
+	return k.IsHA() || k.Endpoint != ""
+}
+
+// k3sServerEntrypoint returns the k3s server command a master of the cluster runs
+func (k *K8sCluster) k3sServerEntrypoint(node *K8sNode) string {
+	args := []string{k3sBinary, "server", "--data-dir", "/mydisk", "--flannel-iface", "eth0", "--node-name", node.Name}
+	if node.Name == k.Master.Name {
+		args = append(args, K3sClusterInitFlag)
+	} else {
+		args = append(args, K3sServerFlag, k.masterURL())
+	}
+	if k.Endpoint != "" {
+		args = append(args, K3sTLSSANFlag, k.Endpoint)
+	}
+	return strings.Join(args, " ")
+}
+
+// K3sServerFlags returns the k3s server flags of a master running k3s server as its entrypoint,
+// it is empty for workers and for masters running the flist init
+func K3sServerFlags(wl gridtypes.Workload) (map[string]string, error) {
+	dataI, err := wl.WorkloadData()
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not get workload %s data", wl.Name)
+	}
+	data, ok := dataI.(*zos.ZMachine)
+	if !ok {
+		return nil, errors.Errorf("workload %s is not a vm", wl.Name)
+	}
+
+	flags := map[string]string{}
+	if !IsK3sServerEntrypoint(data.Entrypoint) {
+		return flags, nil
+	}
+	args := strings.Fields(data.Entrypoint)
+	for i := 2; i < len(args); i++ {
+		if !strings.HasPrefix(args[i], "--") {
+			continue
+		}
+		if i+1 < len(args) && !strings.HasPrefix(args[i+1], "--") {
+			flags[args[i]] = args[i+1]
+			i++
+			continue
+		}
+		flags[args[i]] = ""
+	}
+	return flags, nil
+}
+
+// IsK3sServerEntrypoint returns true if the entrypoint runs k3s server instead of the flist init
+func IsK3sServerEntrypoint(entrypoint string) bool {
+	args := strings.Fields(entrypoint)
+	return len(args) >= 2 && args[0] == k3sBinary && args[1] == "server"
+}
+
 // ZosWorkloads generates k8s workloads from a k8s cluster
 func (k *K8sCluster) ZosWorkloads() ([]gridtypes.Workload, error) {
 	k8sWorkloads := []gridtypes.Workload{}
-	k8sWorkloads = append(k8sWorkloads, k.Master.MasterZosWorkload(k)...)
+	for _, master := range k.MasterNodes() {
+		k8sWorkloads = append(k8sWorkloads, master.MasterZosWorkload(k)...)
+	}
 
 	for _, worker := range k.Workers {
 		k8sWorkloads = append(k8sWorkloads, worker.WorkerZosWorkload(k)...)
@@ -153,6 +281,37 @@ func (k *K8sCluster) Validate() error {
 	names := make(map[string]bool)
 	names[k.Master.Name] = true
 
+	if count := len(k.Masters) + 1; count != 1 && count != 3 && count != 5 {
+		return errors.Errorf("k8s cluster must have 1, 3 or 5 masters, got %d", count)
+	}
+	// masters running k3s server skip the flist init that authorizes the ssh key
+	if k.runsK3sServer() && len(k.SSHKey) != 0 {
+		return errors.New("ssh keys are not supported on k8s clusters with more than one master or an endpoint, their masters run k3s server instead of the flist init")
+	}
+
+	masterNodes := map[uint32]string{k.Master.NodeID: k.Master.Name}
+	for _, m := range k.Masters {
+		if _, ok := names[m.Name]; ok {
+			return errors.Errorf("k8s masters must have unique names: %s occurred more than once", m.Name)
+		}
+		names[m.Name] = true
+
+		if err := m.Validate(); err != nil {
+			return errors.Wrap(err, "master is invalid")
+		}
+
+		if other, ok := masterNodes[m.NodeID]; ok {
+			return errors.Errorf("k8s masters %s and %s must be on different nodes, both are on node %d", other, m.Name, m.NodeID)
+		}
+		masterNodes[m.NodeID] = m.Name
+	}
+
+	if k.Endpoint != "" {
+		if err := validateTargetHost(k.Endpoint); err != nil {
+			return errors.Wrap(err, "endpoint is invalid")
+		}
+	}
+
 	for _, w := range k.Workers {
 		if _, ok := names[w.Name]; ok {
 			return errors.Errorf("k8s workers and master must have unique names: %s occurred more than once", w.Name)
@@ -181,6 +340,24 @@ func (k *K8sCluster) Validate() error {
 	return nil
 }
 
+// AttachZlogTarget streams the logs of the masters and all the workers of the cluster to a target
+func (k *K8sCluster) AttachZlogTarget(target ZlogTarget) error {
+	if err := target.Validate(); err != nil {
+		return errors.Wrap(err, "zlog target is invalid")
+	}
+
+	nodes := append(k.MasterNodes(), k.Workers...)
+
+	for _, node := range nodes {
+		if node.VM == nil {
+			continue
+		}
+		node.Zlogs = attachZlog(node.Zlogs, node.Name, target)
+	}
+
+	return nil
+}
+
 // ValidateToken validate cluster token
 func (k *K8sCluster) ValidateToken() error {
 	if len(k.Token) < 6 {
@@ -204,6 +381,12 @@ func (k *K8sCluster) ValidateIPranges() error {
 		return errors.Errorf("the master node %d does not exist in the network's ip ranges", k.Master.NodeID)
 	}
 
+	for _, m := range k.Masters {
+		if _, ok := k.NodesIPRange[m.NodeID]; !ok {
+			return errors.Errorf("the node with id %d in master %s does not exist in the network's ip ranges", m.NodeID, m.Name)
+		}
+	}
+
 	for _, w := range k.Workers {
 		if _, ok := k.NodesIPRange[w.NodeID]; !ok {
 			return errors.Errorf("the node with id %d in worker %s does not exist in the network's ip ranges", w.NodeID, w.Name)
@@ -261,11 +444,15 @@ func (k *K8sNode) zosWorkload(cluster *K8sCluster, isWorker bool) (K8sWorkloads
 		"K3S_DATA_DIR":      "/mydisk",
 		"K3S_FLANNEL_IFACE": "eth0",
 		"K3S_NODE_NAME":     k.Name,
-		"K3S_URL":           "",
+		k3sURLEnvVar:        "",
 	}
-	if isWorker {
+	entrypoint := cluster.Entrypoint
+	switch {
+	case isWorker:
 		// K3S_URL marks where to find the master node
-		envVars["K3S_URL"] = fmt.Sprintf("https://%s:6443", cluster.Master.IP)
+		envVars[k3sURLEnvVar] = cluster.JoinURL()
+	case cluster.runsK3sServer():
+		entrypoint = cluster.k3sServerEntrypoint(k)
 	}
 	var myceliumIP *zos.MyceliumIP
 	if len(k.MyceliumIPSeed) != 0 {
@@ -295,7 +482,7 @@ func (k *K8sNode) zosWorkload(cluster *K8sCluster, isWorker bool) (K8sWorkloads
 				CPU:    k.CPU,
 				Memory: gridtypes.Unit(uint(k.MemoryMB)) * gridtypes.Megabyte,
 			},
-			Entrypoint: cluster.Entrypoint,
+			Entrypoint: entrypoint,
 			Mounts: []zos.MachineMount{
 				{Name: gridtypes.Name(diskName), Mountpoint: "/mydisk"},
 			},
@@ -304,9 +491,19 @@ func (k *K8sNode) zosWorkload(cluster *K8sCluster, isWorker bool) (K8sWorkloads
 	}
 	K8sWorkloads = append(K8sWorkloads, workload)
 
+	for _, zlog := range k.Zlogs {
+		zlogWorkload := zlog.ZosWorkload()
+		K8sWorkloads = append(K8sWorkloads, *zlogWorkload.Workload3())
+	}
+
 	return K8sWorkloads
 }
 
+// isK8sMaster returns true if the env vars of a k8s node make it a master, only workers join a K3S_URL
+func isK8sMaster(env map[string]string) bool {
+	return env[k3sURLEnvVar] == ""
+}
+
 // ConstructPublicIPWorkload constructs a public IP workload
 func ConstructK8sPublicIPWorkload(workloadName string, ipv4 bool, ipv6 bool) gridtypes.Workload {
 	return gridtypes.Workload{
@@ -76,6 +76,7 @@ func TestK8sNodeData(t *testing.T) {
 
 		k8sFromWorkload.IP = ""
 		k8sFromWorkload.EnvVars = nil
+		k8sFromWorkload.Entrypoint = ""
 		assert.Equal(t, k8sFromWorkload, K8sWorkload)
 	})
 
@@ -87,3 +88,63 @@ func TestK8sNodeData(t *testing.T) {
 		assert.Equal(t, len(k8sWorkloads), 2)
 	})
 }
+
+func TestK8sHAEntrypoints(t *testing.T) {
+	node := func(name, ip string) K8sNode {
+		return K8sNode{VM: &VM{Name: name, IP: ip, NetworkName: "network"}, DiskSizeGB: 5}
+	}
+	master := node("master", "10.20.2.2")
+	cluster := K8sCluster{
+		Master:      &master,
+		Masters:     []K8sNode{node("master1", "10.20.3.2"), node("master2", "10.20.4.2")},
+		Workers:     []K8sNode{node("worker", "10.20.2.3")},
+		Token:       "testToken",
+		NetworkName: "network",
+		Flist:       K8sFlist,
+		Entrypoint:  "/sbin/zinit init",
+		Endpoint:    "k8s.example.com",
+	}
+
+	vms := map[string]*zos.ZMachine{}
+	flags := map[string]map[string]string{}
+	wls, err := cluster.ZosWorkloads()
+	assert.NoError(t, err)
+	for _, wl := range wls {
+		if wl.Type != zos.ZMachineType {
+			continue
+		}
+		data, err := wl.WorkloadData()
+		assert.NoError(t, err)
+		vms[wl.Name.String()] = data.(*zos.ZMachine)
+
+		flags[wl.Name.String()], err = K3sServerFlags(wl)
+		assert.NoError(t, err)
+	}
+
+	// the flist init only runs agents joining K3S_URL and standalone servers
+	assert.Equal(t, "/usr/local/bin/k3s server --data-dir /mydisk --flannel-iface eth0 --node-name master --cluster-init --tls-san k8s.example.com", vms["master"].Entrypoint)
+	assert.Equal(t, "/usr/local/bin/k3s server --data-dir /mydisk --flannel-iface eth0 --node-name master1 --server https://10.20.2.2:6443 --tls-san k8s.example.com", vms["master1"].Entrypoint)
+	assert.Equal(t, "/sbin/zinit init", vms["worker"].Entrypoint)
+
+	for _, name := range []string{"master", "master1", "master2"} {
+		assert.Empty(t, vms[name].Env[k3sURLEnvVar])
+		assert.Equal(t, "testToken", vms[name].Env["K3S_TOKEN"])
+		assert.Equal(t, "k8s.example.com", flags[name][K3sTLSSANFlag])
+	}
+	assert.Contains(t, flags["master"], K3sClusterInitFlag)
+	assert.Equal(t, "https://10.20.2.2:6443", flags["master2"][K3sServerFlag])
+	assert.Equal(t, "https://k8s.example.com:6443", vms["worker"].Env[k3sURLEnvVar])
+	assert.Empty(t, flags["worker"])
+
+	t.Run("single master", func(t *testing.T) {
+		single := K8sCluster{Master: &master, Token: "testToken", NetworkName: "network", Flist: K8sFlist, Entrypoint: "/sbin/zinit init"}
+		wl := master.MasterZosWorkload(&single)[1]
+		data, err := wl.WorkloadData()
+		assert.NoError(t, err)
+		assert.Equal(t, "/sbin/zinit init", data.(*zos.ZMachine).Entrypoint)
+
+		flags, err := K3sServerFlags(wl)
+		assert.NoError(t, err)
+		assert.Empty(t, flags)
+	})
+}
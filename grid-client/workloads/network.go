@@ -35,12 +35,16 @@ type UserAccess struct {
 type NetworkMetaData struct {
 	Version      int          `json:"version"`
 	UserAccesses []UserAccess `json:"user_accesses"`
+	AccessSubnet string       `json:"access_subnet,omitempty"`
+	AccessPeers  []AccessPeer `json:"access_peers,omitempty"`
 }
 
 func (m *NetworkMetaData) UnmarshalJSON(data []byte) error {
 	var deprecated struct {
 		Version      int          `json:"version"`
 		UserAccesses []UserAccess `json:"user_accesses"`
+		AccessSubnet string       `json:"access_subnet"`
+		AccessPeers  []AccessPeer `json:"access_peers"`
 		// deprecated fields
 
 		UserAccessIP string `json:"ip"`
@@ -52,6 +56,8 @@ func (m *NetworkMetaData) UnmarshalJSON(data []byte) error {
 	}
 	m.Version = deprecated.Version
 	m.UserAccesses = deprecated.UserAccesses
+	m.AccessSubnet = deprecated.AccessSubnet
+	m.AccessPeers = deprecated.AccessPeers
 	if deprecated.UserAccessIP != "" || deprecated.PrivateKey != "" || deprecated.PublicNodeID != 0 {
 		// it must be deprecated format
 		m.UserAccesses = []UserAccess{{
@@ -70,11 +76,13 @@ type ZNet struct {
 	Nodes        []uint32
 	IPRange      zos.IPNet
 	AddWGAccess  bool
+	AccessPeers  []WGAccessPeer
 	MyceliumKeys map[uint32][]byte
 	SolutionType string
 
 	// computed
 	AccessWGConfig   string
+	AccessSubnet     *zos.IPNet
 	ExternalIP       *zos.IPNet
 	ExternalSK       wgtypes.Key
 	PublicNodeID     uint32
@@ -134,6 +142,10 @@ func NewNetworkFromWorkload(wl zos.Workload, nodeID uint32) (ZNet, error) {
 	if len(metadata.UserAccesses) > 0 {
 		publicNodeID = metadata.UserAccesses[0].NodeID
 	}
+	accessSubnet, accessPeers, err := accessPeersFromMetadata(metadata)
+	if err != nil {
+		return ZNet{}, errors.Wrapf(err, "failed to parse network access peers from workload %s", wl.Name)
+	}
 	myceliumKeys := make(map[uint32][]byte)
 	if data.Mycelium != nil {
 		myceliumKeys[nodeID] = data.Mycelium.Key
@@ -151,6 +163,8 @@ func NewNetworkFromWorkload(wl zos.Workload, nodeID uint32) (ZNet, error) {
 		PublicNodeID: publicNodeID,
 		ExternalIP:   externalIP,
 		ExternalSK:   externalSK,
+		AccessSubnet: accessSubnet,
+		AccessPeers:  accessPeers,
 		MyceliumKeys: myceliumKeys,
 	}, nil
 }
@@ -185,7 +199,7 @@ func (znet *ZNet) Validate() error {
 		}
 	}
 
-	return nil
+	return znet.validateAccessPeers()
 }
 
 // InvalidateBrokenAttributes removes outdated attrs and deleted contracts
@@ -204,6 +218,12 @@ func (znet *ZNet) InvalidateBrokenAttributes(subConn subi.SubstrateExt, ncPool c
 	if znet.ExternalIP != nil && !znet.IPRange.Contains(znet.ExternalIP.IP) {
 		znet.ExternalIP = nil
 	}
+	if znet.AccessSubnet != nil && !znet.IPRange.Contains(znet.AccessSubnet.IP) {
+		znet.AccessSubnet = nil
+		for i := range znet.AccessPeers {
+			znet.AccessPeers[i].IP = nil
+		}
+	}
 	for node, ip := range znet.NodesIPRange {
 		if !znet.IPRange.Contains(ip.IP) {
 			delete(znet.NodesIPRange, node)
@@ -330,8 +350,9 @@ func (znet *ZNet) GetNodesIPRange() map[uint32]zos.IPNet {
 	return znet.NodesIPRange
 }
 
+// GetAddWGAccess returns true if the network is accessed over wireguard, with the single access or with access peers
 func (znet *ZNet) GetAddWGAccess() bool {
-	return znet.AddWGAccess
+	return znet.AddWGAccess || len(znet.AccessPeers) != 0
 }
 
 func (znet *ZNet) GetNodeDeploymentID() map[uint32]uint64 {
@@ -392,6 +413,18 @@ func (znet *ZNet) AssignNodesIPs(nodes []uint32) error {
 			znet.ExternalIP = &ip
 		}
 	}
+	// the access subnet is kept once assigned so adding access peers later only updates the public node
+	if znet.AccessSubnet != nil {
+		usedIPs = append(usedIPs, znet.AccessSubnet.IP[l-2])
+	} else if len(znet.AccessPeers) != 0 {
+		err := nextFreeIP(usedIPs, &cur)
+		if err != nil {
+			return err
+		}
+		usedIPs = append(usedIPs, cur)
+		ip := IPNet(znet.IPRange.IP[l-4], znet.IPRange.IP[l-3], cur, znet.IPRange.IP[l-1], 24)
+		znet.AccessSubnet = &ip
+	}
 	for _, nodeID := range nodes {
 		if _, ok := ips[nodeID]; !ok {
 			err := nextFreeIP(usedIPs, &cur)
@@ -589,7 +622,7 @@ func (znet *ZNet) generateDeployments(endpointIPs map[uint32]net.IP, usedPorts m
 		}
 	}
 
-	needsIPv4Access := znet.AddWGAccess || (len(hiddenNodes) != 0 && len(hiddenNodes)+len(accessibleNodes) > 1)
+	needsIPv4Access := znet.GetAddWGAccess() || (len(hiddenNodes) != 0 && len(hiddenNodes)+len(accessibleNodes) > 1)
 	if needsIPv4Access {
 		if znet.PublicNodeID != 0 { // it's set
 			// if public node id is already set, it should be added to accessible nodes
@@ -620,8 +653,11 @@ func (znet *ZNet) generateDeployments(endpointIPs map[uint32]net.IP, usedPorts m
 		znet.WGPort = make(map[uint32]int)
 	}
 
-	// assign WireGuard ports
+	// assign WireGuard ports, assigned ports are kept so unchanged nodes are not updated
 	for _, nodeID := range allNodes {
+		if _, ok := znet.WGPort[nodeID]; ok {
+			continue
+		}
 		nodeUsedPorts := usedPorts[nodeID]
 		p := uint16(r.Intn(32768-1024) + 1024)
 		for slices.Contains(nodeUsedPorts, p) {
@@ -643,6 +679,9 @@ func (znet *ZNet) generateDeployments(endpointIPs map[uint32]net.IP, usedPorts m
 		nonAccessibleIPRanges = append(nonAccessibleIPRanges, *r)
 		nonAccessibleIPRanges = append(nonAccessibleIPRanges, WgIP(*r))
 	}
+	if znet.AccessSubnet != nil {
+		nonAccessibleIPRanges = append(nonAccessibleIPRanges, *znet.AccessSubnet)
+	}
 
 	log.Debug().Msgf("hidden nodes: %v", hiddenNodes)
 	log.Debug().Uint32("public node", znet.PublicNodeID)
@@ -668,10 +707,25 @@ func (znet *ZNet) generateDeployments(endpointIPs map[uint32]net.IP, usedPorts m
 		)
 	}
 
+	if len(znet.AccessPeers) != 0 {
+		if err := znet.assignAccessPeers(); err != nil {
+			return nil, errors.Wrapf(err, "could not assign access peers of network %s", znet.Name)
+		}
+
+		znet.accessPeersWGConfig(
+			znet.Keys[znet.PublicNodeID].PublicKey().String(),
+			fmt.Sprintf("%s:%d", endpoints[znet.PublicNodeID], znet.WGPort[znet.PublicNodeID]),
+		)
+	}
+
 	externalIP := ""
 	if znet.ExternalIP != nil {
 		externalIP = znet.ExternalIP.String()
 	}
+	accessSubnet := ""
+	if znet.AccessSubnet != nil {
+		accessSubnet = znet.AccessSubnet.String()
+	}
 	metadata := NetworkMetaData{
 		Version: int(Version3),
 		UserAccesses: []UserAccess{
@@ -681,6 +735,7 @@ func (znet *ZNet) generateDeployments(endpointIPs map[uint32]net.IP, usedPorts m
 				NodeID:     znet.PublicNodeID,
 			},
 		},
+		AccessSubnet: accessSubnet,
 	}
 
 	metadataBytes, err := json.Marshal(metadata)
@@ -688,6 +743,13 @@ func (znet *ZNet) generateDeployments(endpointIPs map[uint32]net.IP, usedPorts m
 		return nil, errors.Wrapf(err, "failed to marshal network metadata")
 	}
 
+	// access peers are only stored on the public node so changing them doesn't update the other nodes
+	metadata.AccessPeers = znet.accessPeersMetadata()
+	publicNodeMetadataBytes, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to marshal network metadata")
+	}
+
 	// accessible nodes deployments
 	for _, nodeID := range accessibleNodes {
 		peers := make([]zos.Peer, 0, len(znet.Nodes))
@@ -714,7 +776,10 @@ func (znet *ZNet) generateDeployments(endpointIPs map[uint32]net.IP, usedPorts m
 			})
 		}
 
+		nodeMetadata := metadataBytes
 		if nodeID == znet.PublicNodeID {
+			nodeMetadata = publicNodeMetadataBytes
+
 			// external node
 			if znet.AddWGAccess {
 				peers = append(peers, zos.Peer{
@@ -723,6 +788,7 @@ func (znet *ZNet) generateDeployments(endpointIPs map[uint32]net.IP, usedPorts m
 					AllowedIPs:  []zos.IPNet{*znet.ExternalIP, WgIP(*znet.ExternalIP)},
 				})
 			}
+			peers = append(peers, znet.accessPeers()...)
 
 			// hidden nodes
 			for _, peerNodeID := range hiddenNodes {
@@ -738,7 +804,7 @@ func (znet *ZNet) generateDeployments(endpointIPs map[uint32]net.IP, usedPorts m
 			}
 		}
 
-		workload := znet.ZosWorkload(znet.NodesIPRange[nodeID], znet.Keys[nodeID].String(), uint16(znet.WGPort[nodeID]), peers, string(metadataBytes), znet.MyceliumKeys[nodeID])
+		workload := znet.ZosWorkload(znet.NodesIPRange[nodeID], znet.Keys[nodeID].String(), uint16(znet.WGPort[nodeID]), peers, string(nodeMetadata), znet.MyceliumKeys[nodeID])
 		deployment := zos.NewGridDeployment(twinID, []zos.Workload{workload})
 
 		// add metadata
@@ -824,7 +890,7 @@ func (znet *ZNet) ReadNodesConfig(ctx context.Context, nodeDeployments map[uint3
 			nodesIPRange[node] = zos.IPNet(d.Subnet)
 			// this will fail when hidden node is supported
 			for _, peer := range d.Peers {
-				if peer.Endpoint == "" {
+				if peer.Endpoint == "" && !znet.isAccessPeer(peer.Subnet.IP) {
 					WGAccess = true
 				}
 			}
@@ -0,0 +1,193 @@
+package workloads
+
+import (
+	"fmt"
+	"net"
+	"slices"
+
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/zos"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// WGAccessPeer is a named user accessing a network over wireguard through the network public node.
+// each peer has its own key and an ip in the access subnet of the network
+type WGAccessPeer struct {
+	Name string
+	// PrivateKey is generated if not set
+	PrivateKey wgtypes.Key
+
+	// computed
+	IP       *zos.IPNet
+	WGConfig string
+}
+
+// AccessPeer is a wireguard access peer stored in the network metadata of the public node
+type AccessPeer struct {
+	Name       string `json:"name"`
+	IP         string `json:"ip"`
+	PrivateKey string `json:"private_key"`
+}
+
+// AddAccessPeer adds a named access peer to the network, deploy the network to apply it
+func (znet *ZNet) AddAccessPeer(name string) error {
+	if slices.ContainsFunc(znet.AccessPeers, func(p WGAccessPeer) bool { return p.Name == name }) {
+		return fmt.Errorf("access peer '%s' already exists in network %s", name, znet.Name)
+	}
+
+	znet.AccessPeers = append(znet.AccessPeers, WGAccessPeer{Name: name})
+	return nil
+}
+
+// RevokeAccessPeer removes a named access peer from the network, deploy the network to apply it
+func (znet *ZNet) RevokeAccessPeer(name string) error {
+	idx := slices.IndexFunc(znet.AccessPeers, func(p WGAccessPeer) bool { return p.Name == name })
+	if idx < 0 {
+		return fmt.Errorf("access peer '%s' not found in network %s", name, znet.Name)
+	}
+
+	znet.AccessPeers = slices.Delete(znet.AccessPeers, idx, idx+1)
+	return nil
+}
+
+// AccessPeerConfig returns the wireguard config of an access peer, it can be saved as a .conf file or encoded as a qr code
+func (znet *ZNet) AccessPeerConfig(name string) (string, error) {
+	idx := slices.IndexFunc(znet.AccessPeers, func(p WGAccessPeer) bool { return p.Name == name })
+	if idx < 0 {
+		return "", fmt.Errorf("access peer '%s' not found in network %s", name, znet.Name)
+	}
+	if znet.AccessPeers[idx].WGConfig == "" {
+		return "", fmt.Errorf("access peer '%s' of network %s is not deployed", name, znet.Name)
+	}
+
+	return znet.AccessPeers[idx].WGConfig, nil
+}
+
+// validateAccessPeers validates the names of the access peers
+func (znet *ZNet) validateAccessPeers() error {
+	names := make(map[string]struct{}, len(znet.AccessPeers))
+	for _, peer := range znet.AccessPeers {
+		if err := validateName(peer.Name); err != nil {
+			return errors.Wrapf(err, "access peer name '%s' is invalid", peer.Name)
+		}
+		if _, ok := names[peer.Name]; ok {
+			return fmt.Errorf("access peer name '%s' is duplicated", peer.Name)
+		}
+		names[peer.Name] = struct{}{}
+	}
+
+	// .0 and .1 of the access subnet are not assigned to peers
+	if len(znet.AccessPeers) > 253 {
+		return fmt.Errorf("network %s can't have more than 253 access peers", znet.Name)
+	}
+
+	return nil
+}
+
+// assignAccessPeers assigns ips in the access subnet and keys to the access peers missing them
+func (znet *ZNet) assignAccessPeers() error {
+	l := len(znet.AccessSubnet.IP)
+	used := []byte{}
+	for _, peer := range znet.AccessPeers {
+		if peer.IP != nil && znet.AccessSubnet.Contains(peer.IP.IP) {
+			used = append(used, peer.IP.IP[len(peer.IP.IP)-1])
+		}
+	}
+
+	var cur byte = 2
+	for i := range znet.AccessPeers {
+		peer := &znet.AccessPeers[i]
+		if peer.PrivateKey == (wgtypes.Key{}) {
+			key, err := wgtypes.GeneratePrivateKey()
+			if err != nil {
+				return errors.Wrapf(err, "failed to generate wireguard private key for access peer %s", peer.Name)
+			}
+			peer.PrivateKey = key
+		}
+
+		if peer.IP != nil && znet.AccessSubnet.Contains(peer.IP.IP) {
+			continue
+		}
+		if err := nextFreeIP(used, &cur); err != nil {
+			return errors.Wrapf(err, "failed to assign an ip to access peer %s", peer.Name)
+		}
+		used = append(used, cur)
+
+		ip := IPNet(znet.AccessSubnet.IP[l-4], znet.AccessSubnet.IP[l-3], znet.AccessSubnet.IP[l-2], cur, 32)
+		peer.IP = &ip
+	}
+
+	return nil
+}
+
+// accessPeersWGConfig generates the wireguard configs of the access peers to connect to the given public node
+func (znet *ZNet) accessPeersWGConfig(publicKey, endpoint string) {
+	for i := range znet.AccessPeers {
+		peer := &znet.AccessPeers[i]
+		if peer.IP == nil {
+			continue
+		}
+		peer.WGConfig = GenerateWGConfig(peer.IP.IP.String(), peer.PrivateKey.String(), publicKey, endpoint, znet.IPRange.String())
+	}
+}
+
+// accessPeers returns the zos peers of the access peers added to the public node
+func (znet *ZNet) accessPeers() []zos.Peer {
+	peers := make([]zos.Peer, 0, len(znet.AccessPeers))
+	for _, peer := range znet.AccessPeers {
+		peers = append(peers, zos.Peer{
+			Subnet:      *peer.IP,
+			WGPublicKey: peer.PrivateKey.PublicKey().String(),
+			AllowedIPs:  []zos.IPNet{*peer.IP},
+		})
+	}
+	return peers
+}
+
+// accessPeersMetadata returns the access peers to store in the network metadata
+func (znet *ZNet) accessPeersMetadata() []AccessPeer {
+	peers := make([]AccessPeer, 0, len(znet.AccessPeers))
+	for _, peer := range znet.AccessPeers {
+		peers = append(peers, AccessPeer{
+			Name:       peer.Name,
+			IP:         peer.IP.String(),
+			PrivateKey: peer.PrivateKey.String(),
+		})
+	}
+	return peers
+}
+
+// isAccessPeer checks if a peer subnet is in the access subnet of the network
+func (znet *ZNet) isAccessPeer(subnet net.IP) bool {
+	return znet.AccessSubnet != nil && znet.AccessSubnet.Contains(subnet)
+}
+
+// accessPeersFromMetadata parses the access peers stored in a network metadata
+func accessPeersFromMetadata(metadata NetworkMetaData) (*zos.IPNet, []WGAccessPeer, error) {
+	if metadata.AccessSubnet == "" {
+		return nil, nil, nil
+	}
+
+	subnet, err := zos.ParseIPNet(metadata.AccessSubnet)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to parse access subnet")
+	}
+
+	var peers []WGAccessPeer
+	for _, p := range metadata.AccessPeers {
+		ip, err := zos.ParseIPNet(p.IP)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "failed to parse access peer %s ip", p.Name)
+		}
+		if !subnet.Contains(ip.IP) {
+			return nil, nil, fmt.Errorf("access peer %s ip %s is not in the access subnet %s", p.Name, ip.String(), subnet.String())
+		}
+		key, err := wgtypes.ParseKey(p.PrivateKey)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "failed to parse access peer %s private key", p.Name)
+		}
+		peers = append(peers, WGAccessPeer{Name: p.Name, PrivateKey: key, IP: &ip})
+	}
+
+	return &subnet, peers, nil
+}
@@ -0,0 +1,76 @@
+package workloads
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// SSHKeyEnvVar holds the root ssh keys of a vm, one per line
+	SSHKeyEnvVar = "SSH_KEY"
+)
+
+// Provisioning is applied on the first boot of a vm.
+// zos only turns the keys of the SSH_KEY env var into cloud-init user data for root,
+// other env vars are only exported in the vm environment through its EnvVars
+type Provisioning struct {
+	// SSHKeys are authorized for root
+	SSHKeys []string `yaml:"ssh_keys,omitempty" json:"ssh_keys,omitempty"`
+}
+
+// Validate validates the provisioning ssh keys
+func (p *Provisioning) Validate() error {
+	for _, key := range p.SSHKeys {
+		if err := validateSSHKey(key); err != nil {
+			return errors.Wrap(err, "invalid root ssh key")
+		}
+	}
+
+	return nil
+}
+
+// EnvVars returns the env vars carrying the provisioning spec
+func (p *Provisioning) EnvVars() map[string]string {
+	env := map[string]string{}
+	if len(p.SSHKeys) != 0 {
+		env[SSHKeyEnvVar] = strings.Join(p.SSHKeys, "\n")
+	}
+	return env
+}
+
+// provisionedEnvVars merges the env vars of a vm with the ones of its provisioning spec
+func provisionedEnvVars(env map[string]string, p *Provisioning) map[string]string {
+	if p == nil {
+		return env
+	}
+
+	merged := make(map[string]string, len(env)+2)
+	for key, value := range env {
+		merged[key] = value
+	}
+	for key, value := range p.EnvVars() {
+		merged[key] = value
+	}
+	return merged
+}
+
+// validateProvisioning validates the provisioning spec of a vm doesn't conflict with its env vars
+func validateProvisioning(env map[string]string, p *Provisioning) error {
+	if p == nil {
+		return nil
+	}
+
+	if _, ok := env[SSHKeyEnvVar]; ok && len(p.SSHKeys) != 0 {
+		return fmt.Errorf("env var %s conflicts with the provisioning ssh keys", SSHKeyEnvVar)
+	}
+
+	return p.Validate()
+}
+
+func validateSSHKey(key string) error {
+	_, _, _, _, err := ssh.ParseAuthorizedKey([]byte(key))
+	return err
+}
@@ -0,0 +1,56 @@
+package workloads
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func generateSSHKey(t *testing.T) string {
+	t.Helper()
+
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	key, err := ssh.NewPublicKey(pub)
+	require.NoError(t, err)
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+}
+
+func TestProvisioning(t *testing.T) {
+	rootKey := generateSSHKey(t)
+	otherKey := generateSSHKey(t)
+
+	provisioning := Provisioning{SSHKeys: []string{rootKey, otherKey}}
+
+	t.Run("validate", func(t *testing.T) {
+		assert.NoError(t, provisioning.Validate())
+
+		invalid := Provisioning{SSHKeys: []string{"not a key"}}
+		assert.Error(t, invalid.Validate())
+	})
+
+	t.Run("vm env vars", func(t *testing.T) {
+		vm := VMWorkload
+		vm.EnvVars = map[string]string{"APP_ENV": "production"}
+		vm.Provisioning = &provisioning
+		assert.NoError(t, validateProvisioning(vm.EnvVars, vm.Provisioning))
+
+		wls := vm.ZosWorkload()
+		data, err := wls[len(wls)-1].ZMachineWorkload()
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"APP_ENV": "production", SSHKeyEnvVar: rootKey + "\n" + otherKey}, data.Env)
+		assert.Equal(t, map[string]string{"APP_ENV": "production"}, vm.EnvVars)
+	})
+
+	t.Run("conflicting env vars", func(t *testing.T) {
+		assert.Error(t, validateProvisioning(map[string]string{SSHKeyEnvVar: rootKey}, &provisioning))
+		assert.NoError(t, validateProvisioning(map[string]string{SSHKeyEnvVar: rootKey}, &Provisioning{}))
+		assert.NoError(t, validateProvisioning(map[string]string{SSHKeyEnvVar: rootKey}, nil))
+	})
+}
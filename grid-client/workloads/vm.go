@@ -39,6 +39,8 @@ type VM struct {
 	Mounts         []Mount           `json:"mounts"`
 	Zlogs          []Zlog            `json:"zlogs"`
 	EnvVars        map[string]string `json:"env_vars"`
+	// Provisioning is merged in the vm env vars, vms loaded from the grid have it in EnvVars
+	Provisioning *Provisioning `json:"provisioning,omitempty"`
 
 	// OUTPUT
 	ComputedIP  string `json:"computedip"`
@@ -227,7 +229,7 @@ func (vm *VM) ZosWorkload() []zosTypes.Workload {
 			Entrypoint: vm.Entrypoint,
 			Corex:      vm.Corex,
 			Mounts:     mounts,
-			Env:        vm.EnvVars,
+			Env:        provisionedEnvVars(vm.EnvVars, vm.Provisioning),
 		}),
 		Description: vm.Description,
 	}
@@ -296,6 +298,10 @@ func (vm *VM) Validate() error {
 		}
 	}
 
+	if err := validateProvisioning(vm.EnvVars, vm.Provisioning); err != nil {
+		return errors.Wrap(err, "invalid provisioning")
+	}
+
 	return nil
 }
 
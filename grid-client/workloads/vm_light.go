@@ -34,6 +34,8 @@ type VMLight struct {
 	Mounts         []Mount           `json:"mounts"`
 	Zlogs          []Zlog            `json:"zlogs"`
 	EnvVars        map[string]string `json:"env_vars"`
+	// Provisioning is merged in the vm env vars, vms loaded from the grid have it in EnvVars
+	Provisioning *Provisioning `json:"provisioning,omitempty"`
 
 	// OUTPUT
 	MyceliumIP string `json:"mycelium_ip"`
@@ -142,7 +144,7 @@ func (vm *VMLight) ZosWorkload() []zos.Workload {
 			Entrypoint: vm.Entrypoint,
 			Corex:      vm.Corex,
 			Mounts:     mounts,
-			Env:        vm.EnvVars,
+			Env:        provisionedEnvVars(vm.EnvVars, vm.Provisioning),
 		}),
 		Description: vm.Description,
 	}
@@ -211,6 +213,10 @@ func (vm *VMLight) Validate() error {
 		}
 	}
 
+	if err := validateProvisioning(vm.EnvVars, vm.Provisioning); err != nil {
+		return errors.Wrap(err, "invalid provisioning")
+	}
+
 	return nil
 }
 
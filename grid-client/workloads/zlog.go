@@ -4,26 +4,173 @@ package workloads
 import (
 	"crypto/md5"
 	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
 
 	"github.com/pkg/errors"
 	zosTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-client/zos"
 	"github.com/threefoldtech/zos/pkg/gridtypes/zos"
 )
 
+const (
+	// RedisZlogScheme streams the logs to a redis channel
+	RedisZlogScheme = "redis"
+	// WebsocketZlogScheme streams the logs to a websocket
+	WebsocketZlogScheme = "ws"
+	// SecureWebsocketZlogScheme streams the logs to a websocket over tls
+	SecureWebsocketZlogScheme = "wss"
+)
+
 // Zlog logger struct
 type Zlog struct {
 	Zmachine string `json:"zmachine"`
 	Output   string `json:"output"`
+	// Name is the zos workload name of a zlog loaded from the grid, it is kept so updates don't replace the zlog
+	Name string `json:"name,omitempty"`
+}
+
+// ZlogTarget is an output zos nodes can stream the logs of a vm to
+type ZlogTarget interface {
+	URL() string
+	Validate() error
+}
+
+// RedisZlogTarget publishes the logs of a vm on a redis channel
+type RedisZlogTarget struct {
+	Host string `json:"host"`
+	// Port defaults to the redis port if not set
+	Port     uint16 `json:"port,omitempty"`
+	Password string `json:"password,omitempty"`
+	Channel  string `json:"channel,omitempty"`
+}
+
+// WebsocketZlogTarget sends the logs of a vm as websocket messages
+type WebsocketZlogTarget struct {
+	Host string `json:"host"`
+	// Port defaults to the scheme port if not set
+	Port   uint16 `json:"port,omitempty"`
+	Path   string `json:"path,omitempty"`
+	Secure bool   `json:"secure,omitempty"`
+}
+
+// NewZlog generates a zlog streaming the logs of a zmachine to a target
+func NewZlog(zmachine string, target ZlogTarget) Zlog {
+	return Zlog{
+		Zmachine: zmachine,
+		Output:   target.URL(),
+	}
+}
+
+// URL returns the zlog output of the redis target
+func (t RedisZlogTarget) URL() string {
+	u := url.URL{
+		Scheme: RedisZlogScheme,
+		Host:   targetHost(t.Host, t.Port),
+		Path:   "/" + t.Channel,
+	}
+	if t.Password != "" {
+		u.User = url.UserPassword("", t.Password)
+	}
+	if t.Channel == "" {
+		u.Path = ""
+	}
+	return u.String()
+}
+
+// Validate validates the redis target
+func (t RedisZlogTarget) Validate() error {
+	if err := validateTargetHost(t.Host); err != nil {
+		return err
+	}
+
+	if strings.ContainsAny(t.Channel, "/ \t\n") {
+		return fmt.Errorf("invalid redis channel '%s'", t.Channel)
+	}
+
+	return nil
+}
+
+// URL returns the zlog output of the websocket target
+func (t WebsocketZlogTarget) URL() string {
+	u := url.URL{
+		Scheme: WebsocketZlogScheme,
+		Host:   targetHost(t.Host, t.Port),
+		Path:   t.Path,
+	}
+	if t.Secure {
+		u.Scheme = SecureWebsocketZlogScheme
+	}
+	return u.String()
+}
+
+// Validate validates the websocket target
+func (t WebsocketZlogTarget) Validate() error {
+	if err := validateTargetHost(t.Host); err != nil {
+		return err
+	}
+
+	if t.Path != "" && !strings.HasPrefix(t.Path, "/") {
+		return fmt.Errorf("websocket path '%s' must be absolute", t.Path)
+	}
+
+	return nil
 }
 
-// ZosWorkload generates a zlog workload
+// ParseZlogTarget parses a zlog output to its target
+func ParseZlogTarget(output string) (ZlogTarget, error) {
+	u, err := url.Parse(output)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid zlog output url")
+	}
+
+	var port uint16
+	if u.Port() != "" {
+		p, err := strconv.ParseUint(u.Port(), 10, 16)
+		if err != nil || p == 0 {
+			return nil, fmt.Errorf("invalid port '%s' in zlog output", u.Port())
+		}
+		port = uint16(p)
+	}
+
+	var target ZlogTarget
+	switch u.Scheme {
+	case RedisZlogScheme:
+		password, _ := u.User.Password()
+		target = RedisZlogTarget{
+			Host:     u.Hostname(),
+			Port:     port,
+			Password: password,
+			Channel:  strings.TrimPrefix(u.Path, "/"),
+		}
+	case WebsocketZlogScheme, SecureWebsocketZlogScheme:
+		target = WebsocketZlogTarget{
+			Host:   u.Hostname(),
+			Port:   port,
+			Path:   u.Path,
+			Secure: u.Scheme == SecureWebsocketZlogScheme,
+		}
+	default:
+		return nil, fmt.Errorf("unsupported zlog output scheme '%s', zos nodes only stream to %s, %s and %s outputs", u.Scheme, RedisZlogScheme, WebsocketZlogScheme, SecureWebsocketZlogScheme)
+	}
+
+	return target, target.Validate()
+}
+
+// ZosWorkload generates a zlog workload.
+// new zlogs hash the zmachine with the output so many vms of a deployment can stream to the same output
 func (zlog *Zlog) ZosWorkload() zosTypes.Workload {
-	url := []byte(zlog.Output)
-	urlHash := md5.Sum(url)
+	name := zlog.Name
+	if name == "" {
+		hash := md5.Sum([]byte(zlog.Zmachine + zlog.Output))
+		name = hex.EncodeToString(hash[:])
+	}
 
 	return zosTypes.Workload{
 		Version: 0,
-		Name:    hex.EncodeToString(urlHash[:]),
+		Name:    name,
 		Type:    zosTypes.ZLogsType,
 		Data: zosTypes.MustMarshal(zosTypes.ZLogs{
 			ZMachine: zlog.Zmachine,
@@ -32,6 +179,11 @@ func (zlog *Zlog) ZosWorkload() zosTypes.Workload {
 	}
 }
 
+// ZlogsFromDeployment returns the zlogs of a zmachine in a deployment
+func ZlogsFromDeployment(dl *zosTypes.Deployment, zmachine string) []Zlog {
+	return zlogs(dl, zmachine)
+}
+
 func zlogs(dl *zosTypes.Deployment, name string) []Zlog {
 	var res []Zlog
 	for _, wl := range dl.ByType(zosTypes.ZLogsType) {
@@ -61,15 +213,58 @@ func zlogs(dl *zosTypes.Deployment, name string) []Zlog {
 		res = append(res, Zlog{
 			Output:   data.Output,
 			Zmachine: name,
+			Name:     wl.Name,
 		})
 	}
 	return res
 }
 
+// Validate validates the zlog, outputs of zlogs loaded from the grid are kept as deployed
 func (z *Zlog) Validate() error {
 	if err := validateName(z.Zmachine); err != nil {
 		return errors.Wrap(err, "zmachine name is invalid")
 	}
 
+	if z.Name != "" {
+		return nil
+	}
+
+	if _, err := ParseZlogTarget(z.Output); err != nil {
+		return errors.Wrap(err, "output is invalid")
+	}
+
+	return nil
+}
+
+// attachZlog adds a zlog of a target to a zmachine unless it already streams to it
+func attachZlog(zlogs []Zlog, zmachine string, target ZlogTarget) []Zlog {
+	zlog := NewZlog(zmachine, target)
+	for _, z := range zlogs {
+		if z.Output == zlog.Output {
+			return zlogs
+		}
+	}
+	return append(zlogs, zlog)
+}
+
+func targetHost(host string, port uint16) string {
+	if port == 0 {
+		if strings.Contains(host, ":") {
+			return "[" + host + "]"
+		}
+		return host
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(port)))
+}
+
+func validateTargetHost(host string) error {
+	if host == "" {
+		return errors.New("target host cannot be empty")
+	}
+
+	if strings.ContainsAny(host, "/@[] \t\n") {
+		return fmt.Errorf("invalid target host '%s'", host)
+	}
+
 	return nil
 }
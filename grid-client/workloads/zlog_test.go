@@ -5,13 +5,14 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/zos"
 )
 
 // ZlogWorkload for tests
 var ZlogWorkload = Zlog{
 	Zmachine: "test",
-	Output:   "output",
+	Output:   "redis://10.1.0.2:6379/vm_logs",
 }
 
 func TestZLog(t *testing.T) {
@@ -22,6 +23,95 @@ func TestZLog(t *testing.T) {
 
 	t.Run("test_zLogs_from_deployment", func(t *testing.T) {
 		zlogs := zlogs(&deployment, ZlogWorkload.Zmachine)
-		assert.Equal(t, zlogs, []Zlog{ZlogWorkload})
+
+		zlog := ZlogWorkload
+		zlog.Name = zlogWorkload.Name
+		assert.Equal(t, zlogs, []Zlog{zlog})
+	})
+
+	t.Run("test_loaded_zlogs_keep_name_and_output", func(t *testing.T) {
+		// zlogs deployed before their names hashed the zmachine, streaming to outputs new zlogs reject
+		zlogWorkload := zos.Workload{
+			Name: "f3b64fe1d1a4dbd1ffd7e6e4c17e2a4b",
+			Type: zos.ZLogsType,
+			Data: zos.MustMarshal(zos.ZLogs{ZMachine: "test", Output: "tcp://10.1.0.2:514"}),
+		}
+		zlogWorkload.Result.State = "ok"
+
+		deployment := NewGridDeployment(1, 0, []zos.Workload{zlogWorkload})
+
+		zlogs := zlogs(&deployment, "test")
+		require.Len(t, zlogs, 1)
+		assert.NoError(t, zlogs[0].Validate())
+		assert.Equal(t, zlogWorkload.Name, zlogs[0].ZosWorkload().Name)
+
+		zlogs[0].Name = ""
+		assert.Error(t, zlogs[0].Validate())
+	})
+}
+
+func TestZlogTargets(t *testing.T) {
+	t.Run("urls", func(t *testing.T) {
+		targets := map[string]ZlogTarget{
+			"redis://10.1.0.2:6379/vm_logs":     RedisZlogTarget{Host: "10.1.0.2", Port: 6379, Channel: "vm_logs"},
+			"redis://:secret@logs.example.com":  RedisZlogTarget{Host: "logs.example.com", Password: "secret"},
+			"ws://[300:1::2]:8080/vm":           WebsocketZlogTarget{Host: "300:1::2", Port: 8080, Path: "/vm"},
+			"wss://logs.example.com/vms/server": WebsocketZlogTarget{Host: "logs.example.com", Path: "/vms/server", Secure: true},
+		}
+
+		for output, target := range targets {
+			assert.Equal(t, output, target.URL())
+
+			parsed, err := ParseZlogTarget(output)
+			require.NoError(t, err)
+			assert.Equal(t, target, parsed)
+		}
+	})
+
+	t.Run("invalid outputs", func(t *testing.T) {
+		for _, output := range []string{
+			"output",
+			"tcp://10.1.0.2:514",
+			"udp://10.1.0.2:514",
+			"redis:///channel",
+			"ws://10.1.0.2:0/vm",
+			"ws://10.1.0.2:99999/vm",
+		} {
+			_, err := ParseZlogTarget(output)
+			assert.Error(t, err, output)
+
+			zlog := Zlog{Zmachine: "vm", Output: output}
+			assert.Error(t, zlog.Validate(), output)
+		}
+
+		assert.Error(t, RedisZlogTarget{Host: "10.1.0.2", Channel: "vm logs"}.Validate())
+		assert.Error(t, WebsocketZlogTarget{Host: "10.1.0.2", Path: "vm"}.Validate())
+	})
+
+	target := WebsocketZlogTarget{Host: "10.1.0.2", Port: 8080, Path: "/logs"}
+
+	t.Run("attach to deployment", func(t *testing.T) {
+		dl := Deployment{Vms: []VM{{Name: "vm1"}, {Name: "vm2", Zlogs: []Zlog{NewZlog("vm2", target)}}}}
+		require.NoError(t, dl.AttachZlogTarget(target))
+
+		assert.Equal(t, []Zlog{NewZlog("vm1", target)}, dl.Vms[0].Zlogs)
+		assert.Equal(t, []Zlog{NewZlog("vm2", target)}, dl.Vms[1].Zlogs)
+		assert.NotEqual(t, dl.Vms[0].Zlogs[0].ZosWorkload().Name, dl.Vms[1].Zlogs[0].ZosWorkload().Name)
+
+		assert.Error(t, dl.AttachZlogTarget(WebsocketZlogTarget{}))
+	})
+
+	t.Run("attach to k8s cluster", func(t *testing.T) {
+		cluster := K8sCluster{
+			Master:  &K8sNode{VM: &VM{Name: "master"}},
+			Workers: []K8sNode{{VM: &VM{Name: "worker"}}},
+		}
+		require.NoError(t, cluster.AttachZlogTarget(target))
+
+		assert.Equal(t, []Zlog{NewZlog("master", target)}, cluster.Master.Zlogs)
+		assert.Equal(t, []Zlog{NewZlog("worker", target)}, cluster.Workers[0].Zlogs)
+
+		wls := cluster.Workers[0].WorkerZosWorkload(&cluster)
+		assert.Equal(t, zos.ZLogsType, wls[len(wls)-1].Type.String())
 	})
 }
@@ -0,0 +1,152 @@
+// Package zlogs includes a receiver for the vm logs streamed by zos nodes
+package zlogs
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+)
+
+// Line is a log line of a vm
+type Line struct {
+	// Source is the path of the target the vm streams to
+	Source string
+	Text   string
+	Time   time.Time
+}
+
+// Handler handles the received log lines, it is never called concurrently
+type Handler func(Line)
+
+// Receiver is a websocket server receiving the logs zos nodes stream to websocket zlog targets.
+// each vm should stream to its own target path so its lines can be told apart
+type Receiver struct {
+	listener net.Listener
+	handler  Handler
+	upgrader websocket.Upgrader
+	handling sync.Mutex
+
+	mu    sync.Mutex
+	conns map[*websocket.Conn]struct{}
+}
+
+// NewReceiver listens on the given address for the logs of the vms
+func NewReceiver(address string, handler Handler) (*Receiver, error) {
+	if handler == nil {
+		return nil, errors.New("log handler is required")
+	}
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to listen on %s", address)
+	}
+
+	return &Receiver{
+		listener: listener,
+		handler:  handler,
+		upgrader: websocket.Upgrader{
+			// zos nodes don't send an origin
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+		conns: make(map[*websocket.Conn]struct{}),
+	}, nil
+}
+
+// Addr returns the address the receiver listens on
+func (r *Receiver) Addr() net.Addr {
+	return r.listener.Addr()
+}
+
+// Target returns the zlog target of a source, the host must be reachable from the node of the vm
+func (r *Receiver) Target(host, source string) workloads.WebsocketZlogTarget {
+	var port uint16
+	if addr, ok := r.listener.Addr().(*net.TCPAddr); ok {
+		port = uint16(addr.Port)
+	}
+
+	return workloads.WebsocketZlogTarget{
+		Host: host,
+		Port: port,
+		Path: "/" + strings.Trim(source, "/"),
+	}
+}
+
+// Serve receives the logs until the context is done
+func (r *Receiver) Serve(ctx context.Context) error {
+	server := http.Server{
+		Handler:           http.HandlerFunc(r.receive),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Serve(r.listener)
+	}()
+
+	select {
+	case err := <-errs:
+		return errors.Wrap(err, "failed to receive logs")
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := server.Shutdown(shutdownCtx)
+
+	// hijacked websocket connections are not closed by the server shutdown
+	r.mu.Lock()
+	for conn := range r.conns {
+		conn.Close()
+	}
+	r.mu.Unlock()
+
+	return err
+}
+
+func (r *Receiver) receive(w http.ResponseWriter, req *http.Request) {
+	conn, err := r.upgrader.Upgrade(w, req, nil)
+	if err != nil {
+		log.Debug().Err(err).Str("remote", req.RemoteAddr).Msg("failed to upgrade zlogs connection")
+		return
+	}
+
+	r.mu.Lock()
+	r.conns[conn] = struct{}{}
+	r.mu.Unlock()
+
+	defer func() {
+		r.mu.Lock()
+		delete(r.conns, conn)
+		r.mu.Unlock()
+		conn.Close()
+	}()
+
+	source := strings.Trim(req.URL.Path, "/")
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		now := time.Now()
+		for _, text := range strings.Split(strings.TrimRight(string(message), "\n"), "\n") {
+			r.handle(Line{Source: source, Text: strings.TrimSuffix(text, "\r"), Time: now})
+		}
+	}
+}
+
+func (r *Receiver) handle(line Line) {
+	r.handling.Lock()
+	defer r.handling.Unlock()
+
+	r.handler(line)
+}
@@ -0,0 +1,87 @@
+package zlogs
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReceiver(t *testing.T) {
+	var mu sync.Mutex
+	var lines []Line
+
+	receiver, err := NewReceiver("127.0.0.1:0", func(line Line) {
+		mu.Lock()
+		defer mu.Unlock()
+		lines = append(lines, line)
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error)
+	go func() {
+		served <- receiver.Serve(ctx)
+	}()
+
+	target := receiver.Target("127.0.0.1", "vm1")
+	require.NoError(t, target.Validate())
+	assert.Equal(t, "/vm1", target.Path)
+
+	conn, _, err := websocket.DefaultDialer.Dial(target.URL(), nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte("booting\r\nstarted sshd\n")))
+	require.NoError(t, conn.WriteMessage(websocket.BinaryMessage, []byte("ready")))
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(lines) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+
+	mu.Lock()
+	for i, text := range []string{"booting", "started sshd", "ready"} {
+		assert.Equal(t, "vm1", lines[i].Source)
+		assert.Equal(t, text, lines[i].Text)
+	}
+	mu.Unlock()
+
+	cancel()
+	assert.NoError(t, <-served)
+
+	_, _, err = conn.ReadMessage()
+	assert.Error(t, err)
+}
+
+func TestSyslogForwarder(t *testing.T) {
+	_, err := NewSyslogForwarder("unix", "/dev/log", "vms")
+	assert.Error(t, err)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	forwarder, err := NewSyslogForwarder("tcp", listener.Addr().String(), "vms")
+	require.NoError(t, err)
+	defer forwarder.Close()
+
+	conn, err := listener.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	forwarder.Handle(Line{Source: "vm1", Text: "started sshd", Time: now})
+
+	message, err := bufio.NewReader(conn).ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "<14>1 2024-01-02T03:04:05Z vm1 vms - - - started sshd", strings.TrimSuffix(message, "\n"))
+}
@@ -0,0 +1,80 @@
+package zlogs
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// syslog priority of the forwarded lines, facility user and severity info
+const syslogPriority = 14
+
+// SyslogForwarder forwards the received log lines to a syslog server over tcp or udp.
+// zos nodes can't stream to syslog directly, so the receiver relays the lines
+type SyslogForwarder struct {
+	network string
+	tag     string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// NewSyslogForwarder connects to a syslog server, the tag is the app name of the forwarded lines
+func NewSyslogForwarder(network, address, tag string) (*SyslogForwarder, error) {
+	if network != "tcp" && network != "udp" {
+		return nil, fmt.Errorf("unsupported syslog network '%s', only tcp and udp are supported", network)
+	}
+
+	if tag == "" || strings.ContainsAny(tag, " \t\n") {
+		return nil, fmt.Errorf("invalid syslog tag '%s'", tag)
+	}
+
+	conn, err := net.DialTimeout(network, address, 10*time.Second)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to connect to syslog server %s", address)
+	}
+
+	return &SyslogForwarder{
+		network: network,
+		tag:     tag,
+		conn:    conn,
+	}, nil
+}
+
+// Forward sends a log line to the syslog server as an RFC 5424 message with the source as its hostname
+func (f *SyslogForwarder) Forward(line Line) error {
+	hostname := line.Source
+	if hostname == "" {
+		hostname = "-"
+	}
+	hostname = strings.ReplaceAll(hostname, "/", "_")
+
+	message := fmt.Sprintf("<%d>1 %s %s %s - - - %s", syslogPriority, line.Time.UTC().Format(time.RFC3339Nano), hostname, f.tag, line.Text)
+	if f.network == "tcp" {
+		// non transparent framing
+		message += "\n"
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	_, err := f.conn.Write([]byte(message))
+	return errors.Wrap(err, "failed to forward log line")
+}
+
+// Handle forwards a log line, it can be used as the handler of a receiver
+func (f *SyslogForwarder) Handle(line Line) {
+	if err := f.Forward(line); err != nil {
+		log.Error().Err(err).Str("source", line.Source).Msg("failed to forward zlogs line to syslog")
+	}
+}
+
+// Close closes the connection to the syslog server
+func (f *SyslogForwarder) Close() error {
+	return f.conn.Close()
+}
@@ -90,6 +90,15 @@ func validateVMs(vms []tfrobot.Vms, nodeGroups []tfrobot.NodesGroup, sskKeys map
 			return fmt.Errorf("invalid flist for vms group '%s', %w", vm.Name, err)
 		}
 
+		if vm.Provisioning != nil {
+			if err := vm.Provisioning.Validate(); err != nil {
+				return fmt.Errorf("invalid provisioning for vms group '%s', %w", vm.Name, err)
+			}
+			if _, ok := vm.EnvVars["SSH_KEY"]; ok {
+				return fmt.Errorf("vms group '%s' env var SSH_KEY can't be set with provisioning, the ssh key is added to the provisioning ssh keys", vm.Name)
+			}
+		}
+
 		for _, nodeGroup := range nodeGroups {
 			nodeGroupName := strings.TrimSpace(nodeGroup.Name)
 			if strings.TrimSpace(vm.NodeGroup) == nodeGroupName {
@@ -8,6 +8,7 @@ import (
 	"os/signal"
 	"path/filepath"
 	"slices"
+	"strings"
 	"syscall"
 	"time"
 
@@ -18,6 +19,7 @@ import (
 	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/deployer"
 	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
 	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/zos"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
 )
 
 const (
@@ -132,7 +134,7 @@ func deployNodeGroup(
 	}
 
 	log.Info().Str("Node group", nodeGroup.Name).Msg("Filter nodes")
-	nodesIDs, isLight, err := filterNodes(ctx, tfPluginClient, nodeGroup, excludedNodes, yggOrWG)
+	nodesIDs, filter, isLight, err := filterNodes(ctx, tfPluginClient, nodeGroup, excludedNodes, yggOrWG)
 	if err != nil {
 		return err
 	}
@@ -141,6 +143,13 @@ func deployNodeGroup(
 	if groupDeployments.networkDeployments == nil {
 		log.Debug().Str("Node group", nodeGroup.Name).Msg("Parsing vms group")
 		*groupDeployments = parseVMsGroup(vms, nodeGroup.Name, nodesIDs, isLight, sshKeys)
+
+		if nodeGroup.Packing != "" {
+			log.Info().Str("Node group", nodeGroup.Name).Msg("Packing vms")
+			if err := packDeployments(ctx, tfPluginClient, nodeGroup, filter, groupDeployments); err != nil {
+				return err
+			}
+		}
 	} else {
 		log.Debug().Str("Node group", nodeGroup.Name).Msg("Updating vms group")
 		updateFailedDeployments(ctx, tfPluginClient, nodesIDs, groupDeployments)
@@ -202,22 +211,40 @@ func updateFailedDeployments(ctx context.Context, tfPluginClient deployer.TFPlug
 
 	for idx, deployment := range groupDeployments.vmDeployments {
 		if deployment.ContractID == 0 || len(groupDeployments.networkDeployments[idx].GetNodeDeploymentID()) == 0 {
-			nodeID := uint32(nodesIDs[idx%len(nodesIDs)])
-			groupDeployments.vmDeployments[idx].NodeID = nodeID
-			groupDeployments.networkDeployments[idx].SetNodes([]uint32{nodeID})
-
-			myceliumKeys := groupDeployments.networkDeployments[idx].GetMyceliumKeys()
-			if len(myceliumKeys) != 0 {
-				myceliumKey, err := workloads.RandomMyceliumKey()
-				if err != nil {
-					log.Debug().Err(err).Send()
-				}
-				groupDeployments.networkDeployments[idx].SetMyceliumKeys(map[uint32][]byte{nodeID: myceliumKey})
-			}
+			setDeploymentNode(groupDeployments, idx, uint32(nodesIDs[idx%len(nodesIDs)]))
 		}
 	}
 }
 
+// packDeployments moves the vms of the group to a minimal set of the nodes matching the group filter
+func packDeployments(ctx context.Context, tfPluginClient deployer.TFPluginClient, nodeGroup NodesGroup, filter types.NodeFilter, groupDeployments *groupDeploymentsInfo) error {
+	plan, err := tfPluginClient.PackDeployments(ctx, filter, groupDeployments.vmDeployments, deployer.PackingObjective(nodeGroup.Packing))
+	if err != nil {
+		return fmt.Errorf("failed to pack vms of node group %s: %w", nodeGroup.Name, err)
+	}
+	log.Debug().Str("Node group", nodeGroup.Name).Uints32("packed nodes IDs", plan.Nodes).Send()
+
+	for idx, deployment := range groupDeployments.vmDeployments {
+		setDeploymentNode(groupDeployments, idx, deployment.NodeID)
+	}
+	return nil
+}
+
+// setDeploymentNode moves a vm deployment and its network to a node
+func setDeploymentNode(groupDeployments *groupDeploymentsInfo, idx int, nodeID uint32) {
+	groupDeployments.vmDeployments[idx].NodeID = nodeID
+	groupDeployments.networkDeployments[idx].SetNodes([]uint32{nodeID})
+
+	myceliumKeys := groupDeployments.networkDeployments[idx].GetMyceliumKeys()
+	if len(myceliumKeys) != 0 {
+		myceliumKey, err := workloads.RandomMyceliumKey()
+		if err != nil {
+			log.Debug().Err(err).Send()
+		}
+		groupDeployments.networkDeployments[idx].SetMyceliumKeys(map[uint32][]byte{nodeID: myceliumKey})
+	}
+}
+
 func massDeploy(ctx context.Context, tfPluginClient deployer.TFPluginClient, deployments *groupDeploymentsInfo) error {
 	// deploy only contracts that need to be deployed
 	networks, vms := getNotDeployedDeployments(deployments)
@@ -397,12 +424,26 @@ func buildNetworkDeployment(vm *Vms, nodeID uint32, name, solutionType string, i
 	}
 }
 
-func buildVMDeployment(vm Vms, nodeID uint32, name, networkName, sshKey string, mounts []workloads.Mount) workloads.VM {
+// buildVMProvisioning returns the env vars and provisioning spec of a vm,
+// the ssh key is authorized for root by the provisioning spec if the vms group has one or by the SSH_KEY env var otherwise
+func buildVMProvisioning(vm Vms, sshKey string) (map[string]string, *workloads.Provisioning) {
 	envVars := vm.EnvVars
 	if envVars == nil {
 		envVars = map[string]string{}
 	}
-	envVars["SSH_KEY"] = sshKey
+
+	if vm.Provisioning == nil {
+		envVars["SSH_KEY"] = sshKey
+		return envVars, nil
+	}
+
+	provisioning := *vm.Provisioning
+	provisioning.SSHKeys = append(slices.Clone(provisioning.SSHKeys), strings.TrimSpace(sshKey))
+	return envVars, &provisioning
+}
+
+func buildVMDeployment(vm Vms, nodeID uint32, name, networkName, sshKey string, mounts []workloads.Mount) workloads.VM {
+	envVars, provisioning := buildVMProvisioning(vm, sshKey)
 
 	// get random mycelium seeds
 	var myceliumSeed []byte
@@ -428,16 +469,13 @@ func buildVMDeployment(vm Vms, nodeID uint32, name, networkName, sshKey string,
 		RootfsSizeMB:   vm.RootSize * 1024, // RootSize is in MB
 		Entrypoint:     vm.Entrypoint,
 		EnvVars:        envVars,
+		Provisioning:   provisioning,
 		Mounts:         mounts,
 	}
 }
 
 func buildVMLightDeployment(vm Vms, nodeID uint32, name, networkName, sshKey string, mounts []workloads.Mount) workloads.VMLight {
-	envVars := vm.EnvVars
-	if envVars == nil {
-		envVars = map[string]string{}
-	}
-	envVars["SSH_KEY"] = sshKey
+	envVars, provisioning := buildVMProvisioning(vm, sshKey)
 
 	// get random mycelium seeds
 	var myceliumSeed []byte
@@ -460,6 +498,7 @@ func buildVMLightDeployment(vm Vms, nodeID uint32, name, networkName, sshKey str
 		RootfsSizeMB:   vm.RootSize * 1024, // RootSize is in MB
 		Entrypoint:     vm.Entrypoint,
 		EnvVars:        envVars,
+		Provisioning:   provisioning,
 		Mounts:         mounts,
 	}
 }
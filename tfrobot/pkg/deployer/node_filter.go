@@ -14,8 +14,7 @@ func filterNodes(ctx context.Context,
 	group NodesGroup,
 	excludedNodes []uint64,
 	yggOrWgExistsInVms bool,
-) (nodesIDs []int, isLight bool, err error) {
-	filter := types.NodeFilter{}
+) (nodesIDs []int, filter types.NodeFilter, isLight bool, err error) {
 	filter.Excluded = excludedNodes
 
 	freeMRU := convertMBToBytes(uint64(group.FreeMRU * 1024))
@@ -25,6 +25,8 @@ type NodesGroup struct {
 	PublicIP6  bool    `yaml:"public_ip6" json:"public_ip6"`
 	Certified  bool    `yaml:"certified" json:"certified"`
 	Region     string  `yaml:"region" json:"region"`
+	// Packing packs the vms on as few of the group nodes as possible (min_nodes) or on the cheapest ones (min_cost)
+	Packing string `yaml:"packing" validate:"omitempty,oneof=min_nodes min_cost" json:"packing"`
 }
 
 type Vms struct {
@@ -45,6 +47,8 @@ type Vms struct {
 	SSHKey     string            `yaml:"ssh_key" validate:"required" json:"ssh_key"`
 	EnvVars    map[string]string `yaml:"env_vars" json:"env_vars"`
 	WireGuard  bool              `yaml:"wireguard" json:"wireguard"`
+	// Provisioning is applied on the first boot of the vms, the ssh key is authorized for root
+	Provisioning *workloads.Provisioning `yaml:"provisioning" json:"provisioning"`
 }
 
 type Disk struct {